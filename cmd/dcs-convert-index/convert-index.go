@@ -0,0 +1,43 @@
+// vim:ts=4:sw=4:noexpandtab
+
+// dcs-convert-index converts an index file to the current on-disk format
+// (e.g. "csearch index 1" files, which are limited to 4 GiB, to "csearch index
+// 3"). Indexes of any version can be served, so converting is only necessary
+// to merge them into files larger than 4 GiB or to add checksums.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Debian/dcs/index"
+)
+
+var (
+	outputPath = flag.String("output_path",
+		"",
+		"Path to store the converted index at. Defaults to the input path with \".v3\" appended.")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-output_path=<path>] <index>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src := flag.Arg(0)
+	dst := *outputPath
+	if dst == "" {
+		dst = src + ".v3"
+	}
+	if err := index.Convert(dst, src); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Converted %q to %q\n", src, dst)
+}
@@ -0,0 +1,165 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/ranking"
+	"github.com/Debian/dcs/regexp"
+)
+
+// fileFilter restricts the files returned by Files to those matching the
+// package, path, suffix and flag restrictions of a FilesRequest. A fileFilter must
+// not be used concurrently, as regexp.Regexp is not safe for concurrent use.
+type fileFilter struct {
+	packages, npackages []*regexp.Regexp
+	paths, npaths       []*regexp.Regexp
+	suffixes, nsuffixes map[string]bool
+
+	// nflags are the file flags (see index.FileFlags) of excluded files.
+	nflags index.FileFlags
+}
+
+func compileAll(kind string, exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(exprs))
+	for idx, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", kind, expr, err)
+		}
+		res[idx] = re
+	}
+	return res, nil
+}
+
+func suffixSet(suffixes []string) map[string]bool {
+	if len(suffixes) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(suffixes))
+	for _, suffix := range suffixes {
+		set[strings.ToLower(suffix)] = true
+	}
+	return set
+}
+
+func newFileFilter(in *proto.FilesRequest) (*fileFilter, error) {
+	f := &fileFilter{
+		suffixes:  suffixSet(in.Suffix),
+		nsuffixes: suffixSet(in.Nsuffix),
+	}
+	if in.Nvendored {
+		f.nflags |= index.Vendored
+	}
+	var err error
+	if f.packages, err = compileAll("package", in.Package); err != nil {
+		return nil, err
+	}
+	if f.npackages, err = compileAll("-package", in.Npackage); err != nil {
+		return nil, err
+	}
+	if f.paths, err = compileAll("path", in.Path); err != nil {
+		return nil, err
+	}
+	if f.npaths, err = compileAll("-path", in.Npath); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// matchAll reports whether all of res (want true) or none of res (want
+// false) match s.
+func matchAll(res []*regexp.Regexp, s string, want bool) bool {
+	for _, re := range res {
+		if (re.MatchString(s, true, true) != -1) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// filtersPackages reports whether f restricts packages at all.
+func (f *fileFilter) filtersPackages() bool {
+	return len(f.packages) > 0 || len(f.npackages) > 0
+}
+
+// matchPackage reports whether the files of the source package pkg (e.g.
+// “i3-wm”) can pass f.
+func (f *fileFilter) matchPackage(pkg string) bool {
+	return matchAll(f.packages, pkg, true) && matchAll(f.npackages, pkg, false)
+}
+
+// matchPath reports whether the file at p passes the path and suffix
+// restrictions of f.
+func (f *fileFilter) matchPath(p string) bool {
+	if f.suffixes != nil || f.nsuffixes != nil {
+		suffix := strings.ToLower(path.Ext(p))
+		if f.suffixes != nil && !f.suffixes[suffix] {
+			return false
+		}
+		if f.nsuffixes[suffix] {
+			return false
+		}
+	}
+	return matchAll(f.paths, p, true) && matchAll(f.npaths, p, false)
+}
+
+// filtersFlags reports whether f restricts file flags at all.
+func (f *fileFilter) filtersFlags() bool {
+	return f.nflags != 0
+}
+
+// pathFlags derives the flags of the file at p (e.g.
+// “i3-wm_4.13-1/src/main.c”) for indexes without file metadata, or without
+// index.Vendored in it (see doPostingQuery).
+func pathFlags(p string) index.FileFlags {
+	idx := strings.IndexByte(p, '/')
+	var pkg string
+	if idx > -1 {
+		pkg = p[:idx]
+	}
+	if i := strings.IndexByte(pkg, '_'); i > -1 {
+		pkg = pkg[:i]
+	}
+	return ranking.FileFlags(pkg, p[idx+1:])
+}
+
+// matchFlags reports whether a file with the given flags passes f.
+func (f *fileFilter) matchFlags(flags index.FileFlags) bool {
+	return flags&f.nflags == 0
+}
+
+// excluded returns the file ids of seg whose package does not pass f (nil if
+// there are none), and whether all files of seg are excluded, in which case
+// seg does not need to be queried at all. The package ranges of seg are used
+// so that each package is only considered once.
+func (f *fileFilter) excluded(seg *segment) (excluded bitmap, all bool) {
+	if !f.filtersPackages() {
+		return nil, false
+	}
+	all = true
+	for pkg, ranges := range seg.packages {
+		// seg.packages is keyed by the first path component, e.g.
+		// “i3-wm_4.13-1”.
+		if idx := strings.IndexByte(pkg, '_'); idx > -1 {
+			pkg = pkg[:idx]
+		}
+		if f.matchPackage(pkg) {
+			all = false
+			continue
+		}
+		if excluded == nil {
+			excluded = make(bitmap, (seg.ix.NumNames()+63)/64)
+		}
+		for _, r := range ranges {
+			for id := r.lo; id < r.hi; id++ {
+				excluded[id/64] |= 1 << (id % 64)
+			}
+		}
+	}
+	return excluded, all
+}
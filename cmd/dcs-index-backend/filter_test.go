@@ -0,0 +1,205 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/proto"
+)
+
+func TestNewFileFilterErrors(t *testing.T) {
+	for _, req := range []*proto.FilesRequest{
+		{Package: []string{"("}},
+		{Npackage: []string{"("}},
+		{Path: []string{"["}},
+		{Npath: []string{"["}},
+	} {
+		if _, err := newFileFilter(req); err == nil {
+			t.Errorf("newFileFilter(%+v) unexpectedly succeeded", req)
+		}
+	}
+}
+
+func TestFileFilterMatch(t *testing.T) {
+	f, err := newFileFilter(&proto.FilesRequest{
+		Package:  []string{"^i3"},
+		Npackage: []string{"-doc$"},
+		Path:     []string{"/src/"},
+		Npath:    []string{"_test"},
+		Suffix:   []string{".c", ".H"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		pkg  string
+		want bool
+	}{
+		{"i3-wm", true},
+		{"i3lock", true},
+		{"i3-wm-doc", false},
+		{"xorg", false},
+	} {
+		if got := f.matchPackage(tt.pkg); got != tt.want {
+			t.Errorf("matchPackage(%q) = %v, want %v", tt.pkg, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"i3-wm_4.13-1/src/main.c", true},
+		// Suffixes are compared case-insensitively.
+		{"i3-wm_4.13-1/src/main.h", true},
+		{"i3-wm_4.13-1/src/MAIN.C", true},
+		{"i3-wm_4.13-1/src/main.go", false},
+		{"i3-wm_4.13-1/libi3/font.c", false},
+		{"i3-wm_4.13-1/src/main_test.c", false},
+	} {
+		if got := f.matchPath(tt.path); got != tt.want {
+			t.Errorf("matchPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	f, err = newFileFilter(&proto.FilesRequest{Nsuffix: []string{".h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.matchPath("i3-wm_4.13-1/src/main.h") || !f.matchPath("i3-wm_4.13-1/src/main.c") {
+		t.Errorf("nsuffix .h does not exclude exactly .h files")
+	}
+}
+
+func TestFileFilterExcluded(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "full.idx")
+	buildIndex(path, []string{"a_1/x.c", "a_1/y.c", "b_1/z.c", "c_1/w.c"}, false)
+	seg, err := loadSegment(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seg.ix.release()
+
+	for _, tt := range []struct {
+		req      *proto.FilesRequest
+		excluded []bool
+		all      bool
+	}{
+		// Without package restrictions, nothing is excluded.
+		{&proto.FilesRequest{Path: []string{"x"}}, nil, false},
+		{&proto.FilesRequest{Package: []string{"^a$"}}, []bool{false, false, true, true}, false},
+		{&proto.FilesRequest{Npackage: []string{"^a$"}}, []bool{true, true, false, false}, false},
+		// Package names are matched without the version.
+		{&proto.FilesRequest{Package: []string{"_1"}}, []bool{true, true, true, true}, true},
+		// Segments without matching packages are skipped entirely.
+		{&proto.FilesRequest{Package: []string{"^d$"}}, []bool{true, true, true, true}, true},
+	} {
+		f, err := newFileFilter(tt.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		excluded, all := f.excluded(seg)
+		if all != tt.all {
+			t.Errorf("excluded(%+v): all = %v, want %v", tt.req, all, tt.all)
+		}
+		if tt.excluded == nil {
+			if excluded != nil {
+				t.Errorf("excluded(%+v) = %v, want nil", tt.req, excluded)
+			}
+			continue
+		}
+		for id, want := range tt.excluded {
+			if got := excluded.has(uint32(id)); got != want {
+				t.Errorf("excluded(%+v).has(%d) = %v, want %v", tt.req, id, got, want)
+			}
+		}
+	}
+}
+
+func TestFilesFiltered(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+	buildIndex(base, []string{"a_1/src/a.c", "a_1/src/a.h", "b_1/lib/b.c"}, false)
+	sh := loadShard(base)
+	defer releaseSegments(sh.segments)
+	// The delta segment contains file metadata, the base index does not.
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"c_1/src/c.go"}, true)
+	if _, err := sh.addSegment("delta.idx"); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{shards: []*shard{sh}}
+
+	for _, tt := range []struct {
+		req  *proto.FilesRequest
+		want []string
+	}{
+		{&proto.FilesRequest{}, []string{"a_1/src/a.c", "a_1/src/a.h", "b_1/lib/b.c", "c_1/src/c.go"}},
+		{&proto.FilesRequest{Package: []string{"^a$"}}, []string{"a_1/src/a.c", "a_1/src/a.h"}},
+		// Only the delta segment contains c, the base index is pruned.
+		{&proto.FilesRequest{Package: []string{"^c$"}}, []string{"c_1/src/c.go"}},
+		{&proto.FilesRequest{Npackage: []string{"^a$", "^c$"}}, []string{"b_1/lib/b.c"}},
+		{&proto.FilesRequest{Path: []string{"/src/"}}, []string{"a_1/src/a.c", "a_1/src/a.h", "c_1/src/c.go"}},
+		{&proto.FilesRequest{Npath: []string{"/src/"}}, []string{"b_1/lib/b.c"}},
+		{&proto.FilesRequest{Suffix: []string{".c"}}, []string{"a_1/src/a.c", "b_1/lib/b.c"}},
+		{&proto.FilesRequest{Nsuffix: []string{".c", ".h"}}, []string{"c_1/src/c.go"}},
+		{&proto.FilesRequest{Package: []string{"^a$"}, Suffix: []string{".h"}}, []string{"a_1/src/a.h"}},
+		{&proto.FilesRequest{Package: []string{"^x$"}}, nil},
+	} {
+		if got := query(t, s, tt.req); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Files(%+v) = %v, want %v", tt.req, got, tt.want)
+		}
+	}
+}
+
+func TestFilesNvendored(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+	buildIndex(base, []string{"a_1/vendor/x.go", "a_1/src/y.go"}, false)
+	sh := loadShard(base)
+	defer releaseSegments(sh.segments)
+	// The file metadata of the delta segment has no flags, like that of
+	// indexes written before index.Vendored was introduced.
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{
+		"b_1/third_party/z.c",
+		"b_1/z.c",
+		"expat_1/expat/lib/xmlparse.c",
+		"expat_1/zlib/inflate.c",
+	}, true)
+	if _, err := sh.addSegment("delta.idx"); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{shards: []*shard{sh}}
+
+	got := query(t, s, &proto.FilesRequest{Nvendored: true})
+	want := []string{"a_1/src/y.go", "b_1/z.c", "expat_1/expat/lib/xmlparse.c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files(nvendored) = %v, want %v", got, want)
+	}
+}
+
+func TestPathFlags(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want index.FileFlags
+	}{
+		{"i3-wm_4.13-1/src/main.c", 0},
+		{"i3-wm_4.13-1/tests/main.c", index.Test},
+		{"mysql_5.7/zlib/inflate.c", index.Vendored},
+		{"expat_2.2.0-1/expat/lib/xmlparse.c", 0},
+		// Directories without a version are package names, too.
+		{"expat/expat/lib/xmlparse.c", 0},
+		{"mysql/zlib/inflate.c", index.Vendored},
+		{"configure", index.Generated},
+	} {
+		if got := pathFlags(tt.path); got != tt.want {
+			t.Errorf("pathFlags(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -10,24 +10,30 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Debian/dcs/grpcutil"
 	"github.com/Debian/dcs/index"
 	"github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/regexp"
 	_ "github.com/Debian/dcs/varz"
-	"github.com/google/codesearch/regexp"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/uber/jaeger-client-go"
 	jaegercfg "github.com/uber/jaeger-client-go/config"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
 	listenAddress = flag.String("listen_address", ":28081", "listen address ([host]:port)")
-	indexPath     = flag.String("index_path", "", "path to the index shard to serve, e.g. /dcs-ssd/index.0.idx")
+	indexPath     = flag.String("index_path", "", "path to the index shard to serve, e.g. /dcs-ssd/index.0.idx. Multiple shards can be specified separated by commas, or as a directory containing shards named full.idx or index.<n>.idx.")
 	cpuProfile    = flag.String("cpuprofile", "", "write cpu profile to this file")
 	tlsCertPath   = flag.String("tls_cert_path", "", "Path to a .pem file containing the TLS certificate.")
 	tlsKeyPath    = flag.String("tls_key_path", "", "Path to a .pem file containing the TLS private key.")
@@ -36,38 +42,171 @@ var (
 		"host:port of a github.com/uber/jaeger agent")
 )
 
+// refIndex is a reference-counted *index.Index. The index is closed (i.e.
+// unmapped) once the last reference is released, so that ReplaceIndex does not
+// need to wait for in-flight queries.
+type refIndex struct {
+	*index.Index
+
+	// refs is modified atomically. It starts at 1 for the reference held by
+	// the server.
+	refs int32
+}
+
+func newRefIndex(ix *index.Index) *refIndex {
+	return &refIndex{Index: ix, refs: 1}
+}
+
+// closeIndex closes r once its last reference is released. It is replaced in
+// tests.
+var closeIndex = func(r *refIndex) error {
+	return r.Close()
+}
+
+func (r *refIndex) release() {
+	if atomic.AddInt32(&r.refs, -1) == 0 {
+		log.Printf("Closing %q, no more readers\n", r.File)
+		closeIndex(r)
+	}
+}
+
 type server struct {
-	id      string
-	ix      *index.Index
-	ixMutex sync.Mutex
+	id     string
+	shards []*shard
+}
+
+// shardFor returns the shard whose base index has the file name name. An
+// empty name refers to the only shard.
+func (s *server) shardFor(name string) (*shard, error) {
+	if name == "" {
+		if len(s.shards) != 1 {
+			return nil, fmt.Errorf("%d shards loaded, please specify one", len(s.shards))
+		}
+		return s.shards[0], nil
+	}
+	for _, sh := range s.shards {
+		if filepath.Base(sh.path) == name {
+			return sh, nil
+		}
+	}
+	return nil, fmt.Errorf("No such shard.")
 }
 
 // doPostingQuery runs the actual query. This code is in a separate function so
 // that we can use defer (to be safe against panics in the index querying code)
-// and still don’t hold the mutex for longer than we need to.
-func (s *server) doPostingQuery(query *index.Query, stream proto.IndexBackend_FilesServer) error {
-	s.ixMutex.Lock()
-	defer s.ixMutex.Unlock()
+// and still release the index references reliably.
+//
+// The query is evaluated on all segments of all shards concurrently. Results
+// are sent in the order in which the segments finish. Only files passing
+// filter are sent; segments without any package passing filter are not
+// queried at all.
+func (s *server) doPostingQuery(query *index.Query, filter *fileFilter, stream proto.IndexBackend_FilesServer) error {
+	var segments []*segment
+	for _, sh := range s.shards {
+		acquired := sh.acquireSegments()
+		defer releaseSegments(acquired)
+		segments = append(segments, acquired...)
+	}
 	t0 := time.Now()
-	post := s.ix.PostingQuery(query)
-	t1 := time.Now()
-	fmt.Printf("[%s] postingquery done in %v, %d results\n", s.id, t1.Sub(t0), len(post))
-	var reply proto.FilesReply
-	for _, fileid := range post {
-		reply.Path = s.ix.Name(fileid)
-		if err := stream.Send(&reply); err != nil {
+
+	type result struct {
+		seg      *segment
+		excluded bitmap
+		post     []uint32
+		err      error
+	}
+	results := make(chan result, len(segments))
+	queried := 0
+	for _, seg := range segments {
+		excluded, all := filter.excluded(seg)
+		if all {
+			continue
+		}
+		queried++
+		go func(seg *segment, excluded bitmap) {
+			post, err := seg.ix.PostingQueryErr(query)
+			results <- result{seg, excluded, post, err}
+		}(seg, excluded)
+	}
+
+	var (
+		reply proto.FilesReply
+		meta  proto.FileMeta
+	)
+	files, filtered := 0, 0
+	for i := 0; i < queried; i++ {
+		r := <-results
+		err := r.err
+		for _, fileid := range r.post {
+			if err != nil {
+				break
+			}
+			if r.seg.deleted.has(fileid) {
+				continue
+			}
+			if r.excluded.has(fileid) {
+				filtered++
+				continue
+			}
+			reply.Path, err = r.seg.ix.NameErr(fileid)
+			if err == nil && !filter.matchPath(reply.Path) {
+				filtered++
+				continue
+			}
+			reply.Meta = nil
+			var flags index.FileFlags
+			if err == nil && r.seg.ix.HasMeta() {
+				var m index.FileMeta
+				m, err = r.seg.ix.MetaErr(fileid)
+				// Indexes written before index.Vendored was introduced
+				// have file metadata without it. Instead of bumping the
+				// format version, which would require rebuilding all
+				// indexes, the Vendored flag derived from the path is
+				// added for all indexes.
+				m.Flags |= pathFlags(reply.Path) & index.Vendored
+				meta = proto.FileMeta{
+					Package:     m.Package,
+					Version:     m.Version,
+					Language:    m.Language,
+					Size:        m.Size,
+					ContentHash: m.ContentHash,
+					Generated:   m.Flags&index.Generated != 0,
+					Test:        m.Flags&index.Test != 0,
+					Vendored:    m.Flags&index.Vendored != 0,
+				}
+				reply.Meta = &meta
+				flags = m.Flags
+			} else if err == nil && filter.filtersFlags() {
+				flags = pathFlags(reply.Path)
+			}
+			if err == nil && !filter.matchFlags(flags) {
+				filtered++
+				continue
+			}
+			if err == nil {
+				err = stream.Send(&reply)
+			}
+			if err == nil {
+				files++
+			}
+		}
+		if err != nil {
+			// Wait for the remaining queries, they use the segments.
+			for i++; i < queried; i++ {
+				<-results
+			}
+			log.Printf("[%s] query failed: %v\n", s.id, err)
 			return err
 		}
 	}
-	t2 := time.Now()
-	fmt.Printf("[%s] filenames collected in %v\n", s.id, t2.Sub(t1))
+	fmt.Printf("[%s] query done in %v, %d results (%d filtered) from %d of %d segments\n", s.id, time.Since(t0), files, filtered, queried, len(segments))
 	return nil
 }
 
 // Handles requests to /index by compiling the q= parameter into a regular
 // expression (codesearch/regexp), searching the index for it and returning the
-// list of matching filenames in a JSON array.
-// TODO: This doesn’t handle file name regular expressions at all yet.
+// list of matching filenames in a JSON array. Files are restricted to the
+// packages, paths and suffixes specified in the request.
 // TODO: errors aren’t properly signaled to the requester
 func (s *server) Files(in *proto.FilesRequest, stream proto.IndexBackend_FilesServer) error {
 	if *cpuProfile != "" {
@@ -80,50 +219,192 @@ func (s *server) Files(in *proto.FilesRequest, stream proto.IndexBackend_FilesSe
 		defer pprof.StopCPUProfile()
 	}
 
-	re, err := regexp.Compile(in.Query)
+	re, err := regexp.CompileQuery(in.Query)
 	if err != nil {
-		return fmt.Errorf("regexp.Compile: %s\n", err)
+		return fmt.Errorf("regexp.CompileQuery: %s\n", err)
+	}
+	filter, err := newFileFilter(in)
+	if err != nil {
+		return err
 	}
 	query := index.RegexpQuery(re.Syntax)
 	log.Printf("[%s] query: text = %s, regexp = %s\n", s.id, in.Query, query)
-	return s.doPostingQuery(query, stream)
+	return s.doPostingQuery(query, filter, stream)
+}
+
+// addPlan adds the posting list lengths of plan to the corresponding trigrams
+// of dst, creating dst if it is nil. All plans must stem from the same query.
+func addPlan(dst *proto.QueryPlan, plan *index.QueryPlan) *proto.QueryPlan {
+	if dst == nil {
+		dst = &proto.QueryPlan{
+			Op:      proto.QueryPlan_Op(plan.Op),
+			Trigram: make([]*proto.TrigramCount, len(plan.Trigrams)),
+			Sub:     make([]*proto.QueryPlan, len(plan.Sub)),
+		}
+		for idx, t := range plan.Trigrams {
+			dst.Trigram[idx] = &proto.TrigramCount{Trigram: t.Trigram}
+		}
+	}
+	for idx, t := range plan.Trigrams {
+		dst.Trigram[idx].Count += uint64(t.Count)
+	}
+	for idx, sub := range plan.Sub {
+		dst.Sub[idx] = addPlan(dst.Sub[idx], sub)
+	}
+	return dst
+}
+
+// Explain evaluates the query just like Files does, but only returns the
+// query plan and the number of files instead of the files themselves.
+func (s *server) Explain(ctx context.Context, in *proto.ExplainRequest) (*proto.ExplainReply, error) {
+	re, err := regexp.CompileQuery(in.Query)
+	if err != nil {
+		return nil, fmt.Errorf("regexp.CompileQuery: %s\n", err)
+	}
+	query := index.RegexpQuery(re.Syntax)
+
+	var segments []*segment
+	for _, sh := range s.shards {
+		acquired := sh.acquireSegments()
+		defer releaseSegments(acquired)
+		segments = append(segments, acquired...)
+	}
+
+	reply := &proto.ExplainReply{
+		TrigramQuery: query.String(),
+		Segments:     uint32(len(segments)),
+	}
+	for _, seg := range segments {
+		plan, err := seg.ix.Explain(query)
+		if err != nil {
+			return nil, err
+		}
+		reply.Plan = addPlan(reply.Plan, plan)
+		post, err := seg.ix.PostingQueryErr(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileid := range post {
+			if !seg.deleted.has(fileid) {
+				reply.Candidates++
+			}
+		}
+	}
+	log.Printf("[%s] explain: text = %s, regexp = %s, %d candidates\n", s.id, in.Query, query, reply.Candidates)
+	return reply, nil
+}
+
+// Stats returns statistics about the specified shard or all shards.
+func (s *server) Stats(ctx context.Context, in *proto.StatsRequest) (*proto.StatsReply, error) {
+	shards := s.shards
+	if in.Shard != "" {
+		sh, err := s.shardFor(in.Shard)
+		if err != nil {
+			return nil, err
+		}
+		shards = []*shard{sh}
+	}
+	reply := &proto.StatsReply{}
+	for _, sh := range shards {
+		stats, err := sh.stats(int(in.TopN), in.IncludePackages)
+		if err != nil {
+			return nil, err
+		}
+		reply.Shard = append(reply.Shard, stats)
+	}
+	return reply, nil
 }
 
 func (s *server) ReplaceIndex(ctx context.Context, in *proto.ReplaceIndexRequest) (*proto.ReplaceIndexReply, error) {
-	newShard := in.ReplacementPath
+	sh, err := s.shardFor(in.Shard)
+	if err != nil {
+		return nil, err
+	}
+	if err := sh.replace(in.ReplacementPath, in.Generation); err != nil {
+		return nil, err
+	}
+	return &proto.ReplaceIndexReply{}, nil
+}
 
-	file, err := os.Open(filepath.Dir(*indexPath))
+func (s *server) AddSegment(ctx context.Context, in *proto.AddSegmentRequest) (*proto.AddSegmentReply, error) {
+	sh, err := s.shardFor(in.Shard)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer file.Close()
-	names, err := file.Readdirnames(-1)
+	generation, err := sh.addSegment(in.SegmentPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return &proto.AddSegmentReply{Generation: generation}, nil
+}
 
-	for _, name := range names {
-		if name == newShard {
-			newShard = filepath.Join(filepath.Dir(*indexPath), name)
-			// We verified the given argument refers to an index shard within
-			// this directory, so let’s load this shard.
-			oldIndex := s.ix
-			log.Printf("Trying to load %q\n", newShard)
-			s.ixMutex.Lock()
-			s.ix = index.Open(newShard)
-			s.ixMutex.Unlock()
-			// Overwrite the old full shard with the new one. This is necessary
-			// so that the state is persistent across restarts and has the nice
-			// side-effect of cleaning up the old full shard.
-			if err := os.Rename(newShard, *indexPath); err != nil {
-				log.Fatal(err)
+func (s *server) DeletePackages(ctx context.Context, in *proto.DeletePackagesRequest) (*proto.DeletePackagesReply, error) {
+	sh, err := s.shardFor(in.Shard)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DeletePackagesReply{Generation: sh.deletePackages(in.Package)}, nil
+}
+
+func (s *server) Segments(ctx context.Context, in *proto.SegmentsRequest) (*proto.SegmentsReply, error) {
+	sh, err := s.shardFor(in.Shard)
+	if err != nil {
+		return nil, err
+	}
+	generation, deltas, packages := sh.livePackages()
+	sort.Strings(packages)
+	return &proto.SegmentsReply{
+		Generation: generation,
+		Segments:   uint32(deltas),
+		Package:    packages,
+	}, nil
+}
+
+// isShardName reports whether name is that of a base index: full.idx, as
+// written by dcs-package-importer, or index.<n>.idx. Other .idx files, e.g.
+// the per-package indexes next to full.idx, are not shards.
+func isShardName(name string) bool {
+	if name == "full.idx" {
+		return true
+	}
+	if !strings.HasPrefix(name, "index.") || !strings.HasSuffix(name, ".idx") {
+		return false
+	}
+	n := strings.TrimSuffix(strings.TrimPrefix(name, "index."), ".idx")
+	_, err := strconv.ParseUint(n, 10, 32)
+	return err == nil
+}
+
+// shardPaths returns the paths of all base indexes specified by -index_path,
+// which is a comma-separated list of index files or directories. Of
+// directories, all shards (see isShardName) are loaded.
+func shardPaths() []string {
+	var paths []string
+	for _, path := range strings.Split(*indexPath, ",") {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !fi.IsDir() {
+			paths = append(paths, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.idx"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var found int
+		for _, match := range matches {
+			if isShardName(filepath.Base(match)) {
+				paths = append(paths, match)
+				found++
 			}
-			oldIndex.Close()
-			return &proto.ReplaceIndexReply{}, nil
+		}
+		if found == 0 {
+			log.Fatalf("No shards (full.idx or index.<n>.idx) found in %q", path)
 		}
 	}
-
-	return nil, fmt.Errorf("No such shard.")
+	return paths
 }
 
 func main() {
@@ -134,6 +415,18 @@ func main() {
 	}
 	fmt.Println("Debian Code Search index-backend")
 
+	paths := shardPaths()
+	shards := make([]*shard, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			shards[i] = loadShard(path)
+		}(i, path)
+	}
+	wg.Wait()
+
 	cfg := jaegercfg.Configuration{
 		Sampler: &jaegercfg.SamplerConfig{
 			Type:  "const",
@@ -160,8 +453,11 @@ func main() {
 		*tlsKeyPath,
 		func(s *grpc.Server) {
 			proto.RegisterIndexBackendServer(s, &server{
-				id: filepath.Base(*indexPath),
-				ix: index.Open(*indexPath),
+				id:     filepath.Base(*indexPath),
+				shards: shards,
 			})
+			hs := health.NewServer()
+			hs.SetServingStatus("proto.IndexBackend", healthpb.HealthCheckResponse_SERVING)
+			healthpb.RegisterHealthServer(s, hs)
 		}))
 }
@@ -0,0 +1,224 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Debian/dcs/index"
+)
+
+// manifestSuffix is appended to the path of a base index to get the path of
+// its manifest.
+const manifestSuffix = ".manifest"
+
+// tombstone marks all files of Package as deleted in segments which are
+// older than the tombstone (i.e. have a lower generation). Newer segments may
+// contain a re-imported version of the package.
+type tombstone struct {
+	Package    string
+	Generation uint64
+}
+
+type segmentEntry struct {
+	// Path is relative to the directory of the base index.
+	Path       string
+	Generation uint64
+}
+
+// manifest describes the delta segments and tombstones on top of a base index.
+// It is persisted so that they survive restarts.
+type manifest struct {
+	// Generation is incremented for every added segment and every batch of
+	// tombstones.
+	Generation uint64
+
+	// BaseGeneration is the generation up to which segments and tombstones
+	// are contained in the base index.
+	BaseGeneration uint64
+
+	Segments   []segmentEntry
+	Tombstones []tombstone
+}
+
+func readManifest(base string) (manifest, error) {
+	var m manifest
+	b, err := ioutil.ReadFile(base + manifestSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// No manifest yet, i.e. the base index is all there is.
+			return m, nil
+		}
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+func writeManifest(base string, m manifest) error {
+	b, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(base), "manifest")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), base+manifestSuffix)
+}
+
+// idRange is the half-open range [lo, hi) of file ids.
+type idRange struct {
+	lo, hi uint32
+}
+
+// bitmap is a set of file ids.
+type bitmap []uint64
+
+func (b bitmap) has(id uint32) bool {
+	i := int(id / 64)
+	return i < len(b) && b[i]&(1<<(id%64)) != 0
+}
+
+// segment is an index (either the base index or a delta segment) together
+// with the files of deleted packages. segments are never modified once
+// visible to queries: deleting packages creates a new segment sharing the
+// same index.
+type segment struct {
+	ix         *refIndex
+	generation uint64
+
+	// packages maps package names (the first path component of file names)
+	// to the file ids of their files.
+	packages map[string][]idRange
+
+	deleted bitmap
+}
+
+func loadSegment(path string, generation uint64, tombstones []tombstone) (*segment, error) {
+	ix, err := index.OpenErr(path)
+	if err != nil {
+		return nil, err
+	}
+	names, err := packageRanges(ix)
+	if err != nil {
+		ix.Close()
+		return nil, err
+	}
+	s := &segment{
+		ix:         newRefIndex(ix),
+		generation: generation,
+		packages:   names,
+	}
+	var deleted []string
+	for _, t := range tombstones {
+		if t.Generation > generation {
+			deleted = append(deleted, t.Package)
+		}
+	}
+	return s.withDeleted(deleted), nil
+}
+
+// packageRanges returns the file ids of each package in ix. The files of a
+// package are usually contiguous since ConcatN concatenates per-package
+// indexes.
+func packageRanges(ix *index.Index) (map[string][]idRange, error) {
+	packages := make(map[string][]idRange)
+	var last string
+	var lo uint32
+	n := uint32(ix.NumNames())
+	for id := uint32(0); id < n; id++ {
+		name, err := ix.NameErr(id)
+		if err != nil {
+			return nil, err
+		}
+		if idx := strings.IndexByte(name, '/'); idx > -1 {
+			name = name[:idx]
+		}
+		if id > 0 && name == last {
+			continue
+		}
+		if id > 0 {
+			packages[last] = append(packages[last], idRange{lo, id})
+		}
+		last = name
+		lo = id
+	}
+	if n > 0 {
+		packages[last] = append(packages[last], idRange{lo, n})
+	}
+	return packages, nil
+}
+
+// withDeleted returns a copy of s in which the files of pkgs are deleted, or s
+// itself if s contains none of pkgs.
+func (s *segment) withDeleted(pkgs []string) *segment {
+	var deleted bitmap
+	for _, pkg := range pkgs {
+		ranges, ok := s.packages[pkg]
+		if !ok {
+			continue
+		}
+		if deleted == nil {
+			deleted = make(bitmap, (s.ix.NumNames()+63)/64)
+			copy(deleted, s.deleted)
+		}
+		for _, r := range ranges {
+			for id := r.lo; id < r.hi; id++ {
+				deleted[id/64] |= 1 << (id % 64)
+			}
+		}
+	}
+	if deleted == nil {
+		return s
+	}
+	return &segment{
+		ix:         s.ix,
+		generation: s.generation,
+		packages:   s.packages,
+		deleted:    deleted,
+	}
+}
+
+// livePackages returns the packages of s which are not deleted.
+func (s *segment) livePackages() []string {
+	var live []string
+	for pkg, ranges := range s.packages {
+		// Packages are always deleted as a whole.
+		if !s.deleted.has(ranges[0].lo) {
+			live = append(live, pkg)
+		}
+	}
+	return live
+}
+
+// loadSegments loads the base index and all delta segments listed in m.
+func loadSegments(base string, m manifest) ([]*segment, error) {
+	seg, err := loadSegment(base, m.BaseGeneration, m.Tombstones)
+	if err != nil {
+		return nil, err
+	}
+	segments := []*segment{seg}
+	for _, entry := range m.Segments {
+		path := filepath.Join(filepath.Dir(base), entry.Path)
+		log.Printf("Loading segment %q (generation %d)\n", path, entry.Generation)
+		seg, err := loadSegment(path, entry.Generation, m.Tombstones)
+		if err != nil {
+			releaseSegments(segments)
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
@@ -0,0 +1,261 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shard is a base index plus the delta segments and tombstones described by
+// its manifest.
+type shard struct {
+	// path is the path of the base index, e.g. /dcs-ssd/unpacked/full.idx.
+	path string
+
+	// segments holds the base index first, followed by the delta segments
+	// in ascending generation order. The slice is never modified in place.
+	segments []*segment
+	state    manifest
+
+	// loadDuration is the time it took to load the base index and the delta
+	// segments at time loaded.
+	loadDuration time.Duration
+	loaded       time.Time
+
+	// ixMutex guards segments, state, loadDuration and loaded. It is only
+	// held while acquiring references to or swapping segments, not during
+	// queries.
+	ixMutex sync.RWMutex
+
+	// modifyMutex serializes replace, addSegment and deletePackages, which
+	// load indexes and write the manifest without holding ixMutex.
+	modifyMutex sync.Mutex
+}
+
+func loadShard(path string) *shard {
+	t0 := time.Now()
+	state, err := readManifest(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	segments, err := loadSegments(path, state)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &shard{
+		path:         path,
+		segments:     segments,
+		state:        state,
+		loadDuration: time.Since(t0),
+		loaded:       time.Now(),
+	}
+	s.updateGauges()
+	return s
+}
+
+// acquireSegments returns the current segments. The caller must call
+// releaseSegments once done.
+func (s *shard) acquireSegments() []*segment {
+	s.ixMutex.RLock()
+	defer s.ixMutex.RUnlock()
+	for _, seg := range s.segments {
+		atomic.AddInt32(&seg.ix.refs, 1)
+	}
+	return s.segments
+}
+
+func releaseSegments(segments []*segment) {
+	for _, seg := range segments {
+		seg.ix.release()
+	}
+}
+
+// findFile returns the path of the file name within the directory of the
+// shard. Only names of existing files in that directory are accepted.
+func (s *shard) findFile(name string) (string, error) {
+	file, err := os.Open(filepath.Dir(s.path))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, n := range names {
+		if n == name {
+			return filepath.Join(filepath.Dir(s.path), n), nil
+		}
+	}
+	return "", fmt.Errorf("No such shard.")
+}
+
+// swap makes segments and state visible to queries and releases the shard’s
+// reference to all segments in released.
+func (s *shard) swap(segments []*segment, state manifest, released []*segment) {
+	if err := writeManifest(s.path, state); err != nil {
+		log.Fatal(err)
+	}
+	s.ixMutex.Lock()
+	s.segments = segments
+	s.state = state
+	s.ixMutex.Unlock()
+	releaseSegments(released)
+	s.updateGauges()
+}
+
+// replace replaces the base index with the file name. Segments and tombstones
+// up to generation are contained in the new base index, newer ones are
+// retained on top of it. A generation of 0 means the new base index contains
+// everything.
+func (s *shard) replace(name string, generation uint64) error {
+	s.modifyMutex.Lock()
+	defer s.modifyMutex.Unlock()
+
+	newShard, err := s.findFile(name)
+	if err != nil {
+		return err
+	}
+
+	if generation == 0 {
+		generation = s.state.Generation
+	}
+	state := manifest{
+		Generation:     s.state.Generation,
+		BaseGeneration: generation,
+	}
+	for _, t := range s.state.Tombstones {
+		if t.Generation > generation {
+			state.Tombstones = append(state.Tombstones, t)
+		}
+	}
+
+	// We verified the given argument refers to an index shard within this
+	// directory, so let’s load this shard.
+	log.Printf("Trying to load %q (generation %d)\n", newShard, generation)
+	t0 := time.Now()
+	base, err := loadSegment(newShard, generation, state.Tombstones)
+	if err != nil {
+		return err
+	}
+	loadDuration := time.Since(t0)
+	segments := []*segment{base}
+	released := []*segment{s.segments[0]}
+	var obsolete []string
+	for i, seg := range s.segments[1:] {
+		entry := s.state.Segments[i]
+		if seg.generation > generation {
+			segments = append(segments, seg)
+			state.Segments = append(state.Segments, entry)
+		} else {
+			released = append(released, seg)
+			obsolete = append(obsolete, filepath.Join(filepath.Dir(s.path), entry.Path))
+		}
+	}
+
+	// Overwrite the old full shard with the new one. This is necessary so
+	// that the state is persistent across restarts and has the nice
+	// side-effect of cleaning up the old full shard. Queries which still use
+	// the old shard are unaffected: it stays mapped until they release it.
+	if err := os.Rename(newShard, s.path); err != nil {
+		base.ix.release()
+		return err
+	}
+	s.ixMutex.Lock()
+	s.loadDuration = loadDuration
+	s.loaded = time.Now()
+	s.ixMutex.Unlock()
+	s.swap(segments, state, released)
+	for _, path := range obsolete {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Could not remove compacted segment: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// addSegment loads the file name as a new delta segment and returns its
+// generation.
+func (s *shard) addSegment(name string) (uint64, error) {
+	s.modifyMutex.Lock()
+	defer s.modifyMutex.Unlock()
+
+	path, err := s.findFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	generation := s.state.Generation + 1
+	log.Printf("Loading segment %q (generation %d)\n", path, generation)
+	// Existing tombstones never apply to a new segment.
+	seg, err := loadSegment(path, generation, nil)
+	if err != nil {
+		return 0, err
+	}
+	segmentPath := fmt.Sprintf("%s.seg.%d", s.path, generation)
+	if err := os.Rename(path, segmentPath); err != nil {
+		seg.ix.release()
+		return 0, err
+	}
+
+	state := s.state
+	state.Generation = generation
+	state.Segments = append(append([]segmentEntry(nil), s.state.Segments...), segmentEntry{
+		Path:       filepath.Base(segmentPath),
+		Generation: generation,
+	})
+	segments := append(append([]*segment(nil), s.segments...), seg)
+	s.swap(segments, state, nil)
+	return generation, nil
+}
+
+// deletePackages tombstones pkgs and returns the generation of the
+// tombstones.
+func (s *shard) deletePackages(pkgs []string) uint64 {
+	s.modifyMutex.Lock()
+	defer s.modifyMutex.Unlock()
+
+	generation := s.state.Generation + 1
+	state := s.state
+	state.Generation = generation
+	state.Tombstones = append([]tombstone(nil), s.state.Tombstones...)
+	segments := make([]*segment, len(s.segments))
+	for i, seg := range s.segments {
+		segments[i] = seg.withDeleted(pkgs)
+	}
+	for _, pkg := range pkgs {
+		// Only packages contained in a segment need a tombstone.
+		for _, seg := range s.segments {
+			if _, ok := seg.packages[pkg]; ok {
+				state.Tombstones = append(state.Tombstones, tombstone{
+					Package:    pkg,
+					Generation: generation,
+				})
+				break
+			}
+		}
+	}
+	log.Printf("Deleted %d packages from %q (generation %d)\n", len(pkgs), s.path, generation)
+	s.swap(segments, state, nil)
+	return generation
+}
+
+// livePackages returns the current generation, the number of delta segments
+// and the packages which are not deleted.
+func (s *shard) livePackages() (generation uint64, deltas int, packages []string) {
+	s.ixMutex.RLock()
+	segments := s.segments
+	generation = s.state.Generation
+	s.ixMutex.RUnlock()
+
+	for _, seg := range segments {
+		packages = append(packages, seg.livePackages()...)
+	}
+	return generation, len(segments) - 1, packages
+}
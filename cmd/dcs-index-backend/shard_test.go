@@ -0,0 +1,552 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/regexp"
+	"google.golang.org/grpc"
+)
+
+// buildIndex writes an index of the given files (all containing “hello”)
+// to path. With meta set, file metadata is stored, derived from the names.
+func buildIndex(path string, names []string, meta bool) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	ix := index.Create(path)
+	for _, name := range sorted {
+		contents := strings.NewReader("hello from " + name + "\n")
+		if !meta {
+			ix.Add(name, contents)
+			continue
+		}
+		pkg := name[:strings.IndexByte(name, '/')]
+		ix.AddMeta(name, contents, index.FileMeta{Package: pkg[:strings.IndexByte(pkg, '_')]})
+	}
+	ix.Flush()
+}
+
+// filesStream collects the paths sent by Files.
+type filesStream struct {
+	grpc.ServerStream
+	paths []string
+}
+
+func (s *filesStream) Send(reply *proto.FilesReply) error {
+	s.paths = append(s.paths, reply.Path)
+	return nil
+}
+
+// query returns the sorted paths of the files of s containing “hello” which
+// pass the restrictions of req.
+func query(t *testing.T, s *server, req *proto.FilesRequest) []string {
+	re, err := regexp.CompileQuery("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newFileFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stream filesStream
+	if err := s.doPostingQuery(index.RegexpQuery(re.Syntax), filter, &stream); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(stream.paths)
+	return stream.paths
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dcs-index-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+
+	// Without a manifest, the base index is all there is.
+	m, err := readManifest(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, manifest{}) {
+		t.Fatalf("readManifest without manifest = %+v, want zero manifest", m)
+	}
+
+	want := manifest{
+		Generation:     5,
+		BaseGeneration: 2,
+		Segments: []segmentEntry{
+			{Path: "full.idx.seg.3", Generation: 3},
+			{Path: "full.idx.seg.5", Generation: 5},
+		},
+		Tombstones: []tombstone{{Package: "i3-wm_4.13-1", Generation: 4}},
+	}
+	if err := writeManifest(base, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readManifest(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("readManifest = %+v, want %+v", got, want)
+	}
+	// writeManifest must not leave temporary files behind.
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{base + manifestSuffix}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("files after writeManifest = %v, want %v", names, want)
+	}
+}
+
+func TestPackageRanges(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "full.idx")
+	buildIndex(path, []string{"a_1/x.c", "a_1/y.c", "b_1/z.c", "c_1/d/e.c"}, false)
+	seg, err := loadSegment(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seg.ix.release()
+
+	want := map[string][]idRange{
+		"a_1": {{0, 2}},
+		"b_1": {{2, 3}},
+		"c_1": {{3, 4}},
+	}
+	if !reflect.DeepEqual(seg.packages, want) {
+		t.Fatalf("packages = %v, want %v", seg.packages, want)
+	}
+}
+
+func TestWithDeleted(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "full.idx")
+	buildIndex(path, []string{"a_1/x.c", "a_1/y.c", "b_1/z.c"}, false)
+	// Tombstones of older generations do not apply.
+	seg, err := loadSegment(path, 2, []tombstone{
+		{Package: "b_1", Generation: 1},
+		{Package: "b_1", Generation: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seg.ix.release()
+	if seg.deleted != nil {
+		t.Fatalf("deleted = %v, want none", seg.deleted)
+	}
+
+	if got := seg.withDeleted([]string{"unknown_1"}); got != seg {
+		t.Errorf("withDeleted(unknown package) returned a copy")
+	}
+
+	deleted := seg.withDeleted([]string{"a_1"})
+	for id, want := range []bool{true, true, false} {
+		if got := deleted.deleted.has(uint32(id)); got != want {
+			t.Errorf("withDeleted(a_1).deleted.has(%d) = %v, want %v", id, got, want)
+		}
+	}
+	// Segments visible to queries are never modified.
+	if seg.deleted != nil {
+		t.Errorf("withDeleted modified the original segment")
+	}
+	if got, want := deleted.livePackages(), []string{"b_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("livePackages = %v, want %v", got, want)
+	}
+
+	both := deleted.withDeleted([]string{"b_1"})
+	if got := both.livePackages(); len(got) != 0 {
+		t.Errorf("livePackages after deleting all packages = %v, want none", got)
+	}
+
+	// A tombstone of a newer generation applies when loading.
+	loaded, err := loadSegment(path, 2, []tombstone{{Package: "b_1", Generation: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.ix.release()
+	if got, want := loaded.livePackages(), []string{"a_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("livePackages with tombstone = %v, want %v", got, want)
+	}
+}
+
+func livePackages(sh *shard) []string {
+	_, _, packages := sh.livePackages()
+	sort.Strings(packages)
+	return packages
+}
+
+func TestShardGenerations(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+	buildIndex(base, []string{"a_1/a.c", "b_1/b.c"}, false)
+	sh := loadShard(base)
+	s := &server{shards: []*shard{sh}}
+
+	// Add a delta segment with a new package.
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"c_1/c.c"}, false)
+	generation, err := sh.addSegment("delta.idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generation != 1 {
+		t.Fatalf("addSegment generation = %d, want 1", generation)
+	}
+	if _, err := os.Stat(base + ".seg.1"); err != nil {
+		t.Fatalf("segment was not renamed: %v", err)
+	}
+	if _, err := sh.addSegment("nonexistent.idx"); err == nil {
+		t.Fatalf("addSegment(nonexistent.idx) unexpectedly succeeded")
+	}
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"a_1/a.c", "b_1/b.c", "c_1/c.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after addSegment = %v, want %v", got, want)
+	}
+
+	// Deleted packages stop appearing.
+	if generation := sh.deletePackages([]string{"a_1", "unknown_1"}); generation != 2 {
+		t.Fatalf("deletePackages generation = %d, want 2", generation)
+	}
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"b_1/b.c", "c_1/c.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after deletePackages = %v, want %v", got, want)
+	}
+	// Only packages contained in a segment need a tombstone.
+	if want := []tombstone{{Package: "a_1", Generation: 2}}; !reflect.DeepEqual(sh.state.Tombstones, want) {
+		t.Fatalf("tombstones = %+v, want %+v", sh.state.Tombstones, want)
+	}
+
+	// A re-imported package in a newer segment is not affected by the
+	// tombstone.
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"a_1/a.c"}, false)
+	if _, err := sh.addSegment("delta.idx"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a_1/a.c", "b_1/b.c", "c_1/c.c"}
+	if got := query(t, s, &proto.FilesRequest{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after re-import = %v, want %v", got, want)
+	}
+
+	// The state survives restarts.
+	reloaded := loadShard(base)
+	if !reflect.DeepEqual(reloaded.state, sh.state) {
+		t.Fatalf("reloaded state = %+v, want %+v", reloaded.state, sh.state)
+	}
+	if got := query(t, &server{shards: []*shard{reloaded}}, &proto.FilesRequest{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after reload = %v, want %v", got, want)
+	}
+	releaseSegments(reloaded.segments)
+	if got, want := livePackages(sh), []string{"a_1", "b_1", "c_1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("livePackages = %v, want %v", got, want)
+	}
+	releaseSegments(sh.segments)
+}
+
+func TestShardReplace(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+	buildIndex(base, []string{"a_1/a.c", "b_1/b.c"}, false)
+	sh := loadShard(base)
+	s := &server{shards: []*shard{sh}}
+
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"c_1/c.c"}, false)
+	if _, err := sh.addSegment("delta.idx"); err != nil { // generation 1
+		t.Fatal(err)
+	}
+	sh.deletePackages([]string{"a_1"}) // generation 2
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"d_1/d.c"}, false)
+	if _, err := sh.addSegment("delta.idx"); err != nil { // generation 3
+		t.Fatal(err)
+	}
+	sh.deletePackages([]string{"b_1"}) // generation 4
+
+	// A query which is running while the base index is replaced keeps its
+	// segments mapped until it is done.
+	running := sh.acquireSegments()
+	oldBase := running[0].ix
+
+	// The compacted index contains everything up to generation 2, i.e. the
+	// segment of generation 3 and the tombstone of generation 4 must be
+	// retained.
+	buildIndex(filepath.Join(dir, "compacted.idx"), []string{"b_1/b.c", "c_1/c.c"}, false)
+	if err := sh.replace("compacted.idx", 2); err != nil {
+		t.Fatal(err)
+	}
+	want := manifest{
+		Generation:     4,
+		BaseGeneration: 2,
+		Segments:       []segmentEntry{{Path: "full.idx.seg.3", Generation: 3}},
+		Tombstones:     []tombstone{{Package: "b_1", Generation: 4}},
+	}
+	if !reflect.DeepEqual(sh.state, want) {
+		t.Fatalf("state after replace = %+v, want %+v", sh.state, want)
+	}
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"c_1/c.c", "d_1/d.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after replace = %v, want %v", got, want)
+	}
+	// The compacted segment is removed, the retained one is not.
+	if _, err := os.Stat(base + ".seg.1"); !os.IsNotExist(err) {
+		t.Errorf("compacted segment still exists: %v", err)
+	}
+	if _, err := os.Stat(base + ".seg.3"); err != nil {
+		t.Errorf("retained segment: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "compacted.idx")); !os.IsNotExist(err) {
+		t.Errorf("replacement index was not renamed: %v", err)
+	}
+
+	// The old base index is only closed once the running query is done.
+	if refs := oldBase.refs; refs != 1 {
+		t.Fatalf("references to the old base index = %d, want 1", refs)
+	}
+	releaseSegments(running)
+	if refs := oldBase.refs; refs != 0 {
+		t.Fatalf("references to the old base index = %d, want 0", refs)
+	}
+
+	// A generation of 0 means the new base index contains everything.
+	buildIndex(filepath.Join(dir, "compacted.idx"), []string{"c_1/c.c", "d_1/d.c"}, false)
+	if err := sh.replace("compacted.idx", 0); err != nil {
+		t.Fatal(err)
+	}
+	want = manifest{Generation: 4, BaseGeneration: 4}
+	if !reflect.DeepEqual(sh.state, want) {
+		t.Fatalf("state after full replace = %+v, want %+v", sh.state, want)
+	}
+	if len(sh.segments) != 1 {
+		t.Fatalf("%d segments after full replace, want 1", len(sh.segments))
+	}
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"c_1/c.c", "d_1/d.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after full replace = %v, want %v", got, want)
+	}
+	if err := sh.replace("nonexistent.idx", 0); err == nil {
+		t.Fatalf("replace(nonexistent.idx) unexpectedly succeeded")
+	}
+	releaseSegments(sh.segments)
+}
+
+// TestReplaceWhileQuerying replaces the base index while posting queries are
+// running. Run it with -race.
+func TestReplaceWhileQuerying(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "full.idx")
+	contents := [][]string{
+		{"a_1/a.c", "b_1/b.c"},
+		{"c_1/c.c"},
+	}
+	buildIndex(base, contents[0], false)
+	sh := loadShard(base)
+	s := &server{shards: []*shard{sh}}
+
+	var (
+		closedMu sync.Mutex
+		closed   = make(map[*refIndex]bool)
+	)
+	oldClose := closeIndex
+	defer func() { closeIndex = oldClose }()
+	closeIndex = func(r *refIndex) error {
+		if refs := atomic.LoadInt32(&r.refs); refs != 0 {
+			t.Errorf("closing %q with %d references", r.File, refs)
+		}
+		closedMu.Lock()
+		closed[r] = true
+		closedMu.Unlock()
+		return oldClose(r)
+	}
+	isClosed := func(r *refIndex) bool {
+		closedMu.Lock()
+		defer closedMu.Unlock()
+		return closed[r]
+	}
+
+	const queriers = 8
+	var (
+		wg      sync.WaitGroup
+		queries int64
+	)
+	stop := make(chan struct{})
+	for i := 0; i < queriers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// regexp.Regexp is not safe for concurrent use, so each
+			// querier compiles its own query.
+			re, err := regexp.CompileQuery("hello")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			q := index.RegexpQuery(re.Syntax)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Hold a reference across the query, like a query which
+				// started before a swap and finishes after it.
+				held := sh.acquireSegments()
+				filter, err := newFileFilter(&proto.FilesRequest{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var stream filesStream
+				if err := s.doPostingQuery(q, filter, &stream); err != nil {
+					t.Error(err)
+				}
+				sort.Strings(stream.paths)
+				if !reflect.DeepEqual(stream.paths, contents[0]) && !reflect.DeepEqual(stream.paths, contents[1]) {
+					t.Errorf("files during replace = %v, want %v or %v", stream.paths, contents[0], contents[1])
+				}
+				for _, seg := range held {
+					if isClosed(seg.ix) {
+						t.Errorf("%q closed while a query holds a reference", seg.ix.File)
+					}
+				}
+				releaseSegments(held)
+				atomic.AddInt64(&queries, 1)
+			}
+		}()
+	}
+
+	// waitQueries waits until each querier ran about one more query.
+	waitQueries := func() {
+		start := atomic.LoadInt64(&queries)
+		for atomic.LoadInt64(&queries) < start+queriers {
+			runtime.Gosched()
+		}
+	}
+	var replaced []*refIndex
+	for i := 1; i <= 10; i++ {
+		waitQueries()
+		replaced = append(replaced, sh.segments[0].ix)
+		buildIndex(filepath.Join(dir, "compacted.idx"), contents[i%2], false)
+		if err := sh.replace("compacted.idx", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitQueries()
+	close(stop)
+	wg.Wait()
+
+	// Once all queries are done, all replaced base indexes are closed, the
+	// current one is not.
+	for i, r := range replaced {
+		if !isClosed(r) {
+			t.Errorf("base index %d is not closed after its last release", i)
+		}
+	}
+	current := sh.segments[0].ix
+	if isClosed(current) {
+		t.Errorf("current base index is closed")
+	}
+	if refs := atomic.LoadInt32(&current.refs); refs != 1 {
+		t.Errorf("references to the current base index = %d, want 1", refs)
+	}
+	releaseSegments(sh.segments)
+}
+
+func TestMultiShard(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// As with -index_path pointing to a directory, the shards share it.
+	path0 := filepath.Join(dir, "index.0.idx")
+	path1 := filepath.Join(dir, "index.1.idx")
+	buildIndex(path0, []string{"a_1/a.c", "b_1/b.c"}, false)
+	buildIndex(path1, []string{"c_1/c.c"}, false)
+	sh0, sh1 := loadShard(path0), loadShard(path1)
+	s := &server{shards: []*shard{sh0, sh1}}
+
+	// Queries fan out to all segments of all shards.
+	buildIndex(filepath.Join(dir, "delta.idx"), []string{"d_1/d.c"}, false)
+	if _, err := sh1.addSegment("delta.idx"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"a_1/a.c", "b_1/b.c", "c_1/c.c", "d_1/d.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	// Deleting packages only affects the shard they are deleted from.
+	sh0.deletePackages([]string{"a_1"})
+	sh1.deletePackages([]string{"a_1", "c_1"})
+	if got, want := query(t, s, &proto.FilesRequest{}), []string{"b_1/b.c", "d_1/d.c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files after deletePackages = %v, want %v", got, want)
+	}
+	if got, want := livePackages(sh0), []string{"b_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("livePackages(shard 0) = %v, want %v", got, want)
+	}
+	if got, want := livePackages(sh1), []string{"d_1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("livePackages(shard 1) = %v, want %v", got, want)
+	}
+
+	// With multiple shards, requests must name their shard.
+	if _, err := s.shardFor(""); err == nil {
+		t.Errorf("shardFor(\"\") unexpectedly succeeded with 2 shards")
+	}
+	if got, err := s.shardFor("index.1.idx"); err != nil || got != sh1 {
+		t.Errorf("shardFor(index.1.idx) = %v, %v, want shard 1", got, err)
+	}
+	if _, err := s.shardFor("index.2.idx"); err == nil {
+		t.Errorf("shardFor(index.2.idx) unexpectedly succeeded")
+	}
+	if got, err := (&server{shards: []*shard{sh0}}).shardFor(""); err != nil || got != sh0 {
+		t.Errorf("shardFor(\"\") with one shard = %v, %v, want shard 0", got, err)
+	}
+
+	releaseSegments(sh0.segments)
+	releaseSegments(sh1.segments)
+}
+
+func TestShardPaths(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"full.idx",
+		"full.idx.seg.1",
+		"index.0.idx",
+		"index.1.idx",
+		"index.x.idx",
+		"i3-wm_4.13-1.idx",
+		"zsh_5.3.1-4.idx.quarantined",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := *indexPath
+	defer func() { *indexPath = old }()
+	*indexPath = dir + "," + filepath.Join(dir, "i3-wm_4.13-1.idx")
+	want := []string{
+		filepath.Join(dir, "full.idx"),
+		filepath.Join(dir, "index.0.idx"),
+		filepath.Join(dir, "index.1.idx"),
+		// Files are used as specified.
+		filepath.Join(dir, "i3-wm_4.13-1.idx"),
+	}
+	if got := shardPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("shardPaths() = %v, want %v", got, want)
+	}
+}
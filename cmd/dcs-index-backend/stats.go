@@ -0,0 +1,172 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"log"
+	"math/bits"
+	"path/filepath"
+	"sort"
+
+	"github.com/Debian/dcs/proto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	shardFiles = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_files",
+			Help: "Number of files which are not deleted.",
+		},
+		[]string{"shard"})
+
+	shardDeletedFiles = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_deleted_files",
+			Help: "Number of files of deleted packages which are still contained in the index files.",
+		},
+		[]string{"shard"})
+
+	shardTrigrams = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_trigrams",
+			Help: "Number of posting lists, summed over all segments.",
+		},
+		[]string{"shard"})
+
+	shardSizeBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_size_bytes",
+			Help: "Size of all index files of the shard in bytes.",
+		},
+		[]string{"shard"})
+
+	shardPackages = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_packages",
+			Help: "Number of packages which are not deleted.",
+		},
+		[]string{"shard"})
+
+	shardSegments = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_segments",
+			Help: "Number of delta segments on top of the base index.",
+		},
+		[]string{"shard"})
+
+	shardLongestPostingList = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_longest_posting_list",
+			Help: "Number of files in the longest posting list.",
+		},
+		[]string{"shard"})
+
+	shardLoadSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "shard_load_seconds",
+			Help: "Time it took to load the shard.",
+		},
+		[]string{"shard"})
+)
+
+func init() {
+	prometheus.MustRegister(shardFiles)
+	prometheus.MustRegister(shardDeletedFiles)
+	prometheus.MustRegister(shardTrigrams)
+	prometheus.MustRegister(shardSizeBytes)
+	prometheus.MustRegister(shardPackages)
+	prometheus.MustRegister(shardSegments)
+	prometheus.MustRegister(shardLongestPostingList)
+	prometheus.MustRegister(shardLoadSeconds)
+}
+
+type byCount []*proto.TrigramCount
+
+func (s byCount) Len() int {
+	return len(s)
+}
+
+func (s byCount) Less(i, j int) bool {
+	if s[i].Count == s[j].Count {
+		return s[i].Trigram < s[j].Trigram
+	}
+	return s[i].Count > s[j].Count
+}
+
+func (s byCount) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// stats returns statistics about the shard including its topN longest
+// posting lists. Since only the topN longest posting lists of each segment
+// are considered, the result is exact only if there are no delta segments.
+func (s *shard) stats(topN int, includePackages bool) (*proto.ShardStats, error) {
+	segments := s.acquireSegments()
+	defer releaseSegments(segments)
+	s.ixMutex.RLock()
+	loadDuration := s.loadDuration
+	loaded := s.loaded
+	s.ixMutex.RUnlock()
+
+	stats := &proto.ShardStats{
+		Shard:       filepath.Base(s.path),
+		Segments:    uint32(len(segments) - 1),
+		LoadSeconds: loadDuration.Seconds(),
+		Loaded:      loaded.Unix(),
+	}
+	longest := make(map[string]uint64)
+	var packages []string
+	for _, seg := range segments {
+		ixStats, err := seg.ix.Stats(topN)
+		if err != nil {
+			return nil, err
+		}
+		deleted := 0
+		for _, word := range seg.deleted {
+			deleted += bits.OnesCount64(word)
+		}
+		stats.Files += uint64(ixStats.Files - deleted)
+		stats.DeletedFiles += uint64(deleted)
+		stats.Trigrams += uint64(ixStats.Trigrams)
+		stats.SizeBytes += ixStats.Size
+		for _, tc := range ixStats.Longest {
+			longest[tc.Trigram] += uint64(tc.Count)
+		}
+		packages = append(packages, seg.livePackages()...)
+	}
+	stats.Packages = uint64(len(packages))
+	if includePackages {
+		sort.Strings(packages)
+		stats.Package = packages
+	}
+	for trigram, count := range longest {
+		stats.Longest = append(stats.Longest, &proto.TrigramCount{
+			Trigram: trigram,
+			Count:   count,
+		})
+	}
+	sort.Sort(byCount(stats.Longest))
+	if len(stats.Longest) > topN {
+		stats.Longest = stats.Longest[:topN]
+	}
+	return stats, nil
+}
+
+// updateGauges exports the statistics of the shard to prometheus.
+func (s *shard) updateGauges() {
+	stats, err := s.stats(1, false)
+	if err != nil {
+		log.Printf("Could not get statistics of %q: %v\n", s.path, err)
+		return
+	}
+	shardFiles.WithLabelValues(stats.Shard).Set(float64(stats.Files))
+	shardDeletedFiles.WithLabelValues(stats.Shard).Set(float64(stats.DeletedFiles))
+	shardTrigrams.WithLabelValues(stats.Shard).Set(float64(stats.Trigrams))
+	shardSizeBytes.WithLabelValues(stats.Shard).Set(float64(stats.SizeBytes))
+	shardPackages.WithLabelValues(stats.Shard).Set(float64(stats.Packages))
+	shardSegments.WithLabelValues(stats.Shard).Set(float64(stats.Segments))
+	shardLoadSeconds.WithLabelValues(stats.Shard).Set(stats.LoadSeconds)
+	if len(stats.Longest) > 0 {
+		shardLongestPostingList.WithLabelValues(stats.Shard).Set(float64(stats.Longest[0].Count))
+	}
+}
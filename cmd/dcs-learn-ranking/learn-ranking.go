@@ -0,0 +1,232 @@
+// vim:ts=4:sw=4:noexpandtab
+
+// dcs-learn-ranking learns the weights of the ranking signals (see
+// ranking.Model) from the click log and the ranking log written by dcs-web,
+// and writes them to a ranking model file, which the source backends and
+// dcs-web load using -ranking_model_path.
+//
+// Each click is joined with the results shown for its search term shortly
+// before the click. Following the “skip above” heuristic, the clicked result
+// is taken to be preferred over each result which was ranked higher but not
+// clicked, and the weights are fitted to rank the clicked results higher.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Debian/dcs/ranking"
+)
+
+var (
+	clickLogPaths = flag.String("click_log_path",
+		"",
+		"Comma-separated list of click logs written by dcs-web -click_log_path")
+
+	rankingLogPaths = flag.String("ranking_log_path",
+		"",
+		"Comma-separated list of ranking logs written by dcs-web -ranking_log_path")
+
+	initModelPath = flag.String("init_model_path",
+		"",
+		"Path to the ranking model to start from. The built-in weights are used if empty.")
+
+	outputPath = flag.String("output_path",
+		"/var/dcs/ranking-model.json",
+		"Path to store the resulting ranking model at. Will be overwritten atomically using rename(2).")
+
+	maxAge = flag.Duration("max_age",
+		1*time.Hour,
+		"Maximum time between showing a result and the click for them to be joined")
+
+	iterations = flag.Int("iterations",
+		1000,
+		"Number of gradient descent iterations")
+
+	learningRate = flag.Float64("learning_rate",
+		0.1,
+		"Learning rate of the gradient descent")
+
+	regularization = flag.Float64("regularization",
+		0.01,
+		"How strongly the weights are pulled towards those of the initial model")
+)
+
+// logTimeFormat is the timestamp format of the click log and the ranking log.
+const logTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+type click struct {
+	Searchterm string `json:"searchterm"`
+	Path       string `json:"path"`
+	Line       string `json:"line"`
+}
+
+type timedImpression struct {
+	t time.Time
+	ranking.Impression
+}
+
+type byTime []timedImpression
+
+func (s byTime) Len() int           { return len(s) }
+func (s byTime) Less(i, j int) bool { return s[i].t.Before(s[j].t) }
+func (s byTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// readLog calls fn with the timestamp and JSON of each entry in the logs at
+// the comma-separated paths.
+func readLog(paths string, fn func(t time.Time, entry []byte) error) error {
+	for _, path := range strings.Split(paths, ",") {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			idx := strings.Index(line, " - ")
+			if idx == -1 {
+				f.Close()
+				return fmt.Errorf("%s: malformed line %q", path, line)
+			}
+			t, err := time.Parse(logTimeFormat, line[:idx])
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			if err := fn(t, []byte(line[idx+len(" - "):])); err != nil {
+				f.Close()
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shownBefore returns the results shown for a search term within maxAge
+// before t, each result (identified by path and line) only once.
+func shownBefore(impressions []timedImpression, t time.Time) []ranking.Impression {
+	// impressions is sorted by time.
+	hi := sort.Search(len(impressions), func(i int) bool {
+		return impressions[i].t.After(t)
+	})
+	seen := make(map[string]bool)
+	var shown []ranking.Impression
+	// Newer impressions take precedence, as the ranking may have changed.
+	for i := hi - 1; i >= 0 && t.Sub(impressions[i].t) <= *maxAge; i-- {
+		key := impressions[i].Path + ":" + impressions[i].Line
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		shown = append(shown, impressions[i].Impression)
+	}
+	return shown
+}
+
+// accuracy returns the fraction of pairs which m ranks correctly.
+func accuracy(m ranking.Model, pairs []ranking.Pair) float64 {
+	if len(pairs) == 0 {
+		return 0
+	}
+	correct := 0
+	for _, p := range pairs {
+		if m.Score(p.Clicked) > m.Score(p.Skipped) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(pairs))
+}
+
+func main() {
+	flag.Parse()
+
+	if *clickLogPaths == "" || *rankingLogPaths == "" {
+		log.Fatal("-click_log_path and -ranking_log_path must be specified")
+	}
+
+	initial := ranking.DefaultModel
+	if *initModelPath != "" {
+		if err := ranking.ReadModel(*initModelPath); err != nil {
+			log.Fatal(err)
+		}
+		initial = ranking.ActiveModel()
+	}
+
+	impressions := make(map[string][]timedImpression)
+	if err := readLog(*rankingLogPaths, func(t time.Time, entry []byte) error {
+		var imp ranking.Impression
+		if err := json.Unmarshal(entry, &imp); err != nil {
+			return err
+		}
+		impressions[imp.Searchterm] = append(impressions[imp.Searchterm], timedImpression{t, imp})
+		return nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+	for _, imps := range impressions {
+		sort.Stable(byTime(imps))
+	}
+
+	var (
+		pairs           []ranking.Pair
+		clicks, unknown int
+	)
+	if err := readLog(*clickLogPaths, func(t time.Time, entry []byte) error {
+		var c click
+		if err := json.Unmarshal(entry, &c); err != nil {
+			return err
+		}
+		clicks++
+		shown := shownBefore(impressions[c.Searchterm], t)
+		var clicked *ranking.Impression
+		for idx, imp := range shown {
+			if imp.Path == c.Path && imp.Line == c.Line {
+				clicked = &shown[idx]
+				break
+			}
+		}
+		if clicked == nil {
+			unknown++
+			return nil
+		}
+		for _, imp := range shown {
+			if imp.Ranking > clicked.Ranking {
+				pairs = append(pairs, ranking.Pair{
+					Clicked: clicked.Features,
+					Skipped: imp.Features,
+				})
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d clicks (%d without shown result), %d preference pairs\n", clicks, unknown, len(pairs))
+	if len(pairs) == 0 {
+		log.Fatal("No preference pairs, not writing a model")
+	}
+
+	learnt := ranking.FitModel(initial, pairs, ranking.FitOpts{
+		Iterations:     *iterations,
+		LearningRate:   *learningRate,
+		Regularization: *regularization,
+	})
+	log.Printf("initial model: %+v, pairwise accuracy %.3f\n", initial, accuracy(initial, pairs))
+	log.Printf("learnt model: %+v, pairwise accuracy %.3f\n", learnt, accuracy(learnt, pairs))
+
+	if err := ranking.WriteModel(*outputPath, learnt); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -15,14 +16,20 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
+	"github.com/Debian/dcs/contenthash"
 	"github.com/Debian/dcs/goroutinez"
 	"github.com/Debian/dcs/grpcutil"
 	"github.com/Debian/dcs/index"
 	"github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/ranking"
+	"github.com/Debian/dcs/seekable"
+	"github.com/Debian/dcs/transcode"
 	_ "github.com/Debian/dcs/varz"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
@@ -46,10 +53,28 @@ var (
 		false,
 		"Print log messages when files are skipped")
 
+	maxSegments = flag.Int("max_segments",
+		8,
+		"Number of delta segments served by dcs-index-backend after which a background compaction folds them into full.idx.")
+
+	compress = flag.Bool("compress",
+		false,
+		"Store unpacked files compressed (see package seekable) instead of copying them verbatim. The source backend reads either variant.")
+
+	sparseNGrams = flag.Bool("sparse_ngrams",
+		true,
+		"Also build a sparse n-gram index, which makes queries for long literals more selective. Merged indexes only keep it if all of their parts have one, so existing indexes need to be re-imported to benefit.")
+
 	tmpdir string
 
-	indexQueue chan string
-	mergeQueue chan bool
+	indexQueue   chan string
+	mergeQueue   chan bool
+	compactQueue chan bool
+
+	// indexMu serializes changes to the set of packages served by
+	// dcs-index-backend, i.e. merges, garbage collection and the start and
+	// end of compactions.
+	indexMu sync.Mutex
 
 	failedDpkgSourceExtracts = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -75,6 +100,24 @@ var (
 			Help: "Successful garbage collects.",
 		})
 
+	successfulCompactions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "compactions_successful",
+			Help: "Successful compactions of delta segments into the base index.",
+		})
+
+	failedMerges = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "merges_failed",
+			Help: "Failed merges and compactions.",
+		})
+
+	quarantinedPackageIndexes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "package_indexes_quarantined",
+			Help: "Corrupt package indexes which were quarantined.",
+		})
+
 	successfulMerges = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "merges_successful",
@@ -110,6 +153,9 @@ func init() {
 	prometheus.MustRegister(failedPackageImports)
 	prometheus.MustRegister(successfulDpkgSourceExtracts)
 	prometheus.MustRegister(successfulGarbageCollects)
+	prometheus.MustRegister(failedMerges)
+	prometheus.MustRegister(quarantinedPackageIndexes)
+	prometheus.MustRegister(successfulCompactions)
 	prometheus.MustRegister(successfulMerges)
 	prometheus.MustRegister(successfulPackageImports)
 	prometheus.MustRegister(successfulPackageIndexes)
@@ -204,6 +250,9 @@ func listPackages(w http.ResponseWriter, r *http.Request) {
 
 	type ListPackageReply struct {
 		Packages []string
+
+		// Packages whose index was found to be corrupt, see quarantine.
+		Quarantined []string
 	}
 
 	var reply ListPackageReply
@@ -212,6 +261,9 @@ func listPackages(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(name, ".idx") && name != "full.idx" {
 			reply.Packages = append(reply.Packages, name[:len(name)-len(".idx")])
 		}
+		if strings.HasSuffix(name, ".idx"+quarantineSuffix) {
+			reply.Quarantined = append(reply.Quarantined, name[:len(name)-len(".idx"+quarantineSuffix)])
+		}
 	}
 
 	jsonReply, err := json.Marshal(&reply)
@@ -253,39 +305,92 @@ func garbageCollect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	indexMu.Lock()
+	defer indexMu.Unlock()
+
 	if err := os.RemoveAll(filepath.Join(*unpackedPath, pkg)); err != nil {
 		http.Error(w, fmt.Sprintf("Could not garbage collect package %q: %v", pkg, err), http.StatusInternalServerError)
 		return
 	}
 
-	if err := os.Remove(filepath.Join(*unpackedPath, pkg+".idx")); err != nil {
+	idxPath := filepath.Join(*unpackedPath, pkg+".idx")
+	if _, err := os.Stat(idxPath + quarantineSuffix); err == nil {
+		idxPath += quarantineSuffix
+	}
+	if err := os.Remove(idxPath); err != nil {
 		http.Error(w, fmt.Sprintf("Could not garbage collect package index for %q: %v", pkg, err), http.StatusInternalServerError)
 		return
 	}
 
+	// Packages imported before content hashes were introduced have none.
+	if err := os.Remove(filepath.Join(*unpackedPath, pkg+contenthash.Suffix)); err != nil && !os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("Could not garbage collect content hashes for %q: %v", pkg, err), http.StatusInternalServerError)
+		return
+	}
+
+	// Only packages with transcoded files have encodings.
+	if err := os.Remove(filepath.Join(*unpackedPath, pkg+transcode.EncodingsSuffix)); err != nil && !os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("Could not garbage collect encodings for %q: %v", pkg, err), http.StatusInternalServerError)
+		return
+	}
+
+	// Remove the package from query results right away instead of waiting
+	// for the next compaction.
+	if _, err := indexBackend.DeletePackages(context.Background(), &proto.DeletePackagesRequest{Package: []string{pkg}}); err != nil {
+		http.Error(w, fmt.Sprintf("Could not delete package %q from the index: %v", pkg, err), http.StatusInternalServerError)
+		return
+	}
+
 	successfulGarbageCollects.Inc()
 }
 
-// Merges all packages in *unpackedPath into a big index shard.
-func mergeToShard() {
-	names := packageNames()
-	indexFiles := make([]string, 0, len(names))
-	for _, name := range names {
+// packageIndexFiles returns the paths of all package index files in
+// *unpackedPath, keyed by package name.
+func packageIndexFiles() map[string]string {
+	indexFiles := make(map[string]string)
+	for _, name := range packageNames() {
 		if strings.HasSuffix(name, ".idx") && name != "full.idx" {
-			indexFiles = append(indexFiles, filepath.Join(*unpackedPath, name))
+			indexFiles[strings.TrimSuffix(name, ".idx")] = filepath.Join(*unpackedPath, name)
 		}
 	}
+	return indexFiles
+}
+
+// quarantineSuffix is appended to the file name of corrupt package indexes.
+// Quarantined packages are not merged, but still garbage collected.
+const quarantineSuffix = ".quarantined"
+
+// quarantine renames the corrupt package index at path so that merges skip it
+// from now on. It returns false if path is not a package index.
+func quarantine(path string) bool {
+	if filepath.Dir(path) != filepath.Clean(*unpackedPath) ||
+		!strings.HasSuffix(path, ".idx") ||
+		filepath.Base(path) == "full.idx" {
+		return false
+	}
+	log.Printf("Quarantining corrupt package index %q\n", path)
+	if err := os.Rename(path, path+quarantineSuffix); err != nil {
+		log.Printf("Could not quarantine %q: %v\n", path, err)
+		return false
+	}
+	quarantinedPackageIndexes.Inc()
+	return true
+}
+
+// Merges all packages in *unpackedPath which are not yet served by
+// dcs-index-backend into a delta segment. Only on initial deployment, all
+// packages are merged into a big index shard.
+func mergeToShard() {
+	indexMu.Lock()
+	defer indexMu.Unlock()
 
+	indexFiles := packageIndexFiles()
 	filesInIndex.Set(float64(len(indexFiles)))
 
 	log.Printf("Got %d index files\n", len(indexFiles))
 	if len(indexFiles) < 2 {
 		return
 	}
-	tmpIndexPath, err := ioutil.TempFile(*unpackedPath, "newshard")
-	if err != nil {
-		log.Fatal(err)
-	}
 
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
@@ -297,35 +402,238 @@ func mergeToShard() {
 		defer pprof.StopCPUProfile()
 	}
 
-	t0 := time.Now()
-	index.ConcatN(tmpIndexPath.Name(), indexFiles...)
-	t1 := time.Now()
-	log.Printf("merged in %v\n", t1.Sub(t0))
-	//for i := 1; i < len(indexFiles); i++ {
-	//	log.Printf("merging %s with %s\n", indexFiles[i-1], indexFiles[i])
-	//	t0 := time.Now()
-	//	index.Concat(tmpIndexPath.Name(), indexFiles[i-1], indexFiles[i])
-	//	t1 := time.Now()
-	//	log.Printf("merged in %v\n", t1.Sub(t0))
-	//}
-	log.Printf("merged into shard %s\n", tmpIndexPath.Name())
-
 	// If full.idx does not exist (i.e. on initial deployment), just move the
 	// new index to full.idx, the dcs-index-backend will not be running anyway.
 	fullIdxPath := filepath.Join(*unpackedPath, "full.idx")
 	if _, err := os.Stat(fullIdxPath); os.IsNotExist(err) {
-		if err := os.Rename(tmpIndexPath.Name(), fullIdxPath); err != nil {
+		paths := make([]string, 0, len(indexFiles))
+		for _, path := range indexFiles {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		tmpIndexPath, err := concat(paths)
+		if err != nil {
+			log.Printf("Merge failed: %v\n", err)
+			failedMerges.Inc()
+			return
+		}
+		if err := os.Rename(tmpIndexPath, fullIdxPath); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
+	if err := mergeDelta(indexFiles); err != nil {
+		log.Printf("Merge failed: %v\n", err)
+		failedMerges.Inc()
+		return
+	}
 	successfulMerges.Inc()
+}
+
+// mergeDelta adds all packages in indexFiles which are not yet served by
+// dcs-index-backend as a new delta segment and tombstones all served packages
+// which are not in indexFiles. Must be called with indexMu held.
+func mergeDelta(indexFiles map[string]string) error {
+	ctx := context.Background()
+	reply, err := indexBackend.Segments(ctx, &proto.SegmentsRequest{})
+	if err != nil {
+		return fmt.Errorf("dcs-index-backend Segments failed: %v", err)
+	}
+	served := make(map[string]bool, len(reply.Package))
+	var deleted []string
+	for _, pkg := range reply.Package {
+		served[pkg] = true
+		// Garbage collection tombstones packages right away, so this only
+		// catches up with garbage collections while dcs-index-backend was
+		// unreachable (and with quarantined packages).
+		if _, ok := indexFiles[pkg]; !ok {
+			deleted = append(deleted, pkg)
+		}
+	}
+	var added []string
+	for pkg, path := range indexFiles {
+		if !served[pkg] {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(added)
+	log.Printf("%d packages added, %d deleted since the last merge\n", len(added), len(deleted))
+
+	if len(deleted) > 0 {
+		if _, err := indexBackend.DeletePackages(ctx, &proto.DeletePackagesRequest{Package: deleted}); err != nil {
+			return fmt.Errorf("dcs-index-backend DeletePackages failed: %v", err)
+		}
+	}
+
+	segments := reply.Segments
+	if len(added) > 0 {
+		tmpIndexPath, err := concat(added)
+		if err != nil {
+			return err
+		}
+		if _, err := indexBackend.AddSegment(ctx, &proto.AddSegmentRequest{SegmentPath: filepath.Base(tmpIndexPath)}); err != nil {
+			os.Remove(tmpIndexPath)
+			return fmt.Errorf("dcs-index-backend AddSegment failed: %v", err)
+		}
+		segments++
+	}
+
+	if int(segments) >= *maxSegments {
+		select {
+		case compactQueue <- true:
+		default:
+			// A compaction is already in progress.
+		}
+	}
+	return nil
+}
 
-	// Replace the current index with the newly created index.
-	if _, err := indexBackend.ReplaceIndex(context.Background(), &proto.ReplaceIndexRequest{ReplacementPath: filepath.Base(tmpIndexPath.Name())}); err != nil {
-		log.Fatalf("dcs-index-backend ReplaceIndex failed: %v", err)
+// concat concatenates the specified package index files into a new file in
+// *unpackedPath and returns its path. Corrupt package indexes are quarantined
+// and left out.
+func concat(indexFiles []string) (string, error) {
+	tmpIndexPath, err := ioutil.TempFile(*unpackedPath, "newshard")
+	if err != nil {
+		return "", err
+	}
+	tmpIndexPath.Close()
+
+	t0 := time.Now()
+	for {
+		err := index.ConcatN(tmpIndexPath.Name(), indexFiles...)
+		if cerr, ok := err.(*index.CorruptError); ok && quarantine(cerr.File) {
+			indexFiles = remove(indexFiles, cerr.File)
+			continue
+		}
+		if err != nil {
+			os.Remove(tmpIndexPath.Name())
+			return "", err
+		}
+		break
+	}
+	log.Printf("merged %d packages into shard %s in %v\n", len(indexFiles), tmpIndexPath.Name(), time.Since(t0))
+	// Never hand a broken shard to dcs-index-backend.
+	if err := index.Verify(tmpIndexPath.Name()); err != nil {
+		os.Remove(tmpIndexPath.Name())
+		return "", err
 	}
+	return tmpIndexPath.Name(), nil
+}
+
+// remove returns paths without path.
+func remove(paths []string, path string) []string {
+	result := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != path {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// compact folds all delta segments into a new full.idx. Only the start and the
+// end of a compaction hold indexMu, so merges and garbage collection continue
+// while the (long-running) concatenation is in progress.
+func compact() {
+	if err := compactSegments(); err != nil {
+		log.Printf("Compaction failed: %v\n", err)
+		failedMerges.Inc()
+		return
+	}
+	successfulCompactions.Inc()
+}
+
+func compactSegments() error {
+	indexMu.Lock()
+	reply, err := indexBackend.Segments(context.Background(), &proto.SegmentsRequest{})
+	if err != nil {
+		indexMu.Unlock()
+		return fmt.Errorf("dcs-index-backend Segments failed: %v", err)
+	}
+	if reply.Segments == 0 {
+		indexMu.Unlock()
+		return nil
+	}
+	// Open all index files while holding indexMu so that garbage collection
+	// cannot remove them before they are read.
+	indexFiles := packageIndexFiles()
+	ixes := make([]*index.Index, 0, len(reply.Package))
+	defer func() {
+		for _, ix := range ixes {
+			ix.Close()
+		}
+	}()
+	for _, pkg := range reply.Package {
+		// Packages which were garbage collected while dcs-index-backend was
+		// unreachable are not yet tombstoned, but need to be dropped, too.
+		path, ok := indexFiles[pkg]
+		if !ok {
+			continue
+		}
+		ix, err := index.OpenErr(path)
+		if err != nil {
+			if _, ok := err.(*index.CorruptError); ok && quarantine(path) {
+				continue
+			}
+			indexMu.Unlock()
+			return err
+		}
+		ixes = append(ixes, ix)
+	}
+	indexMu.Unlock()
+
+	tmpIndexPath, err := ioutil.TempFile(*unpackedPath, "newshard")
+	if err != nil {
+		return err
+	}
+	tmpIndexPath.Close()
+
+	t0 := time.Now()
+	if err := index.ConcatIndexes(tmpIndexPath.Name(), ixes...); err != nil {
+		// Corrupt posting lists are only detected while concatenating. The
+		// next compaction will leave out the quarantined package.
+		if cerr, ok := err.(*index.CorruptError); ok {
+			indexMu.Lock()
+			quarantine(cerr.File)
+			indexMu.Unlock()
+		}
+		return err
+	}
+	log.Printf("compacted %d segments (generation %d) into shard %s in %v\n", reply.Segments, reply.Generation, tmpIndexPath.Name(), time.Since(t0))
+	if err := index.Verify(tmpIndexPath.Name()); err != nil {
+		os.Remove(tmpIndexPath.Name())
+		return err
+	}
+
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	// Segments and tombstones added after reply.Generation are retained by
+	// dcs-index-backend on top of the new base index.
+	if _, err := indexBackend.ReplaceIndex(context.Background(), &proto.ReplaceIndexRequest{
+		ReplacementPath: filepath.Base(tmpIndexPath.Name()),
+		Generation:      reply.Generation,
+	}); err != nil {
+		os.Remove(tmpIndexPath.Name())
+		return fmt.Errorf("dcs-index-backend ReplaceIndex failed: %v", err)
+	}
+	return nil
+}
+
+// fileMeta returns the metadata to store in the index for the file at path
+// (relative to the unpacked packages) of pkg, i.e. “<package>_<version>”.
+func fileMeta(pkg, path string) index.FileMeta {
+	meta := index.FileMeta{
+		Package:  pkg,
+		Language: ranking.Language(path),
+	}
+	// Package names cannot contain underscores, versions can.
+	if idx := strings.Index(pkg, "_"); idx > -1 {
+		meta.Package = pkg[:idx]
+		meta.Version = pkg[idx+1:]
+	}
+	meta.Flags = ranking.FileFlags(meta.Package, strings.TrimPrefix(path, pkg+"/"))
+	return meta
 }
 
 func indexPackage(pkg string) {
@@ -339,9 +647,16 @@ func indexPackage(pkg string) {
 	// time. If we don’t do that, merges will try to use incomplete index
 	// files, which are interpreted as corrupted.
 	tmpIndexPath := filepath.Join(*unpackedPath, pkg+".tmp")
-	index := index.Create(tmpIndexPath)
+	ix, err := index.CreateErr(tmpIndexPath)
+	if err != nil {
+		log.Printf("Could not index %s: %v\n", pkg, err)
+		return
+	}
+	ix.SparseNGrams = *sparseNGrams
 	// +1 because of the / that should not be included in the index.
 	stripLen := len(filepath.Join(tmpdir, pkg)) + 1
+	hashes := make(map[string]string)
+	encodings := make(map[string]string)
 
 	filepath.Walk(unpacked,
 		func(path string, info os.FileInfo, err error) error {
@@ -377,35 +692,65 @@ func indexPackage(pkg string) {
 				return nil
 			}
 
-			if err := index.AddFile(path, path[stripLen:]); err != nil {
+			rel := path[stripLen:]
+			err = ix.AddFileMeta(path, rel, fileMeta(pkg, rel))
+			// Files in legacy encodings are indexed in their UTF-8
+			// transcoding, which is stored next to the original.
+			var (
+				encoding   string
+				transcoded []byte
+			)
+			if err == index.ErrInvalidUTF8 {
+				encoding, transcoded, err = transcodeFile(path)
+				if _, statErr := os.Lstat(path + transcode.Suffix); err == nil && statErr == nil {
+					// The transcoding would overwrite an upstream file.
+					err = fmt.Errorf("transcoding clashes with %q", rel+transcode.Suffix)
+				}
+				if err == nil {
+					err = ix.AddMeta(rel, bytes.NewReader(transcoded), fileMeta(pkg, rel))
+				}
+			}
+			if err != nil {
 				log.Printf("Could not index %q: %v\n", path, err)
 				if err := os.Remove(path); err != nil {
 					log.Fatalf("Could not remove file %q: %v\n", path, err)
 				}
 			} else {
 				// Copy this file out of /tmp to our unpacked directory.
-				outputPath := filepath.Join(*unpackedPath, path[stripLen:])
-				if err := os.MkdirAll(filepath.Dir(outputPath), os.FileMode(0755)); err != nil {
-					log.Fatalf("Could not create directory: %v\n", err)
-				}
-				output, err := os.Create(outputPath)
-				if err != nil {
-					log.Fatalf("Could not create output file %q: %v\n", outputPath, err)
-				}
-				defer output.Close()
+				outputPath := filepath.Join(*unpackedPath, rel)
 				input, err := os.Open(path)
 				if err != nil {
 					log.Fatalf("Could not open input file %q: %v\n", path, err)
 				}
 				defer input.Close()
-				if _, err := io.Copy(output, input); err != nil {
-					log.Fatalf("Could not copy %q to %q: %v\n", path, outputPath, err)
+				// Hash the contents while copying, for dedup:yes queries.
+				h := contenthash.New()
+				writeUnpacked(outputPath, io.TeeReader(input, h))
+				hashes[rel] = contenthash.String(h)
+				if transcoded != nil {
+					writeUnpacked(outputPath+transcode.Suffix, bytes.NewReader(transcoded))
+					encodings[rel] = encoding
 				}
 			}
 			return nil
 		})
 
-	index.Flush()
+	if err := ix.Flush(); err != nil {
+		log.Printf("Could not index %s: %v\n", pkg, err)
+		os.Remove(tmpIndexPath)
+		return
+	}
+
+	// Write the content hashes before the index becomes visible, so that the
+	// source backend finds them for every indexed package.
+	if err := contenthash.WriteFile(filepath.Join(*unpackedPath, pkg+contenthash.Suffix), hashes); err != nil {
+		log.Fatal(err)
+	}
+	if len(encodings) > 0 {
+		if err := transcode.WriteFile(filepath.Join(*unpackedPath, pkg+transcode.EncodingsSuffix), encodings); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	finalIndexPath := filepath.Join(*unpackedPath, pkg+".idx")
 	if err := os.Rename(tmpIndexPath, finalIndexPath); err != nil {
@@ -414,6 +759,51 @@ func indexPackage(pkg string) {
 	successfulPackageIndexes.Inc()
 }
 
+// transcodeFile returns the detected encoding and the UTF-8 transcoding of
+// the file at path, which is not valid UTF-8.
+func transcodeFile(path string) (string, []byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	encoding := transcode.Detect(b)
+	if encoding == "" {
+		return "", nil, fmt.Errorf("invalid UTF-8 in an unknown encoding")
+	}
+	transcoded, err := transcode.ToUTF8(b, encoding)
+	if err != nil {
+		return "", nil, err
+	}
+	return encoding, transcoded, nil
+}
+
+// writeUnpacked writes the contents of r to outputPath in the unpacked
+// directory, compressing it if -compress is set.
+func writeUnpacked(outputPath string, r io.Reader) {
+	if *compress {
+		outputPath += seekable.Suffix
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), os.FileMode(0755)); err != nil {
+		log.Fatalf("Could not create directory: %v\n", err)
+	}
+	output, err := os.Create(outputPath)
+	if err != nil {
+		log.Fatalf("Could not create output file %q: %v\n", outputPath, err)
+	}
+	defer output.Close()
+	if *compress {
+		w := seekable.NewWriter(output)
+		if _, err := io.Copy(w, r); err != nil {
+			log.Fatalf("Could not compress %q: %v\n", outputPath, err)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatalf("Could not compress %q: %v\n", outputPath, err)
+		}
+	} else if _, err := io.Copy(output, r); err != nil {
+		log.Fatalf("Could not write %q: %v\n", outputPath, err)
+	}
+}
+
 func unpack(dscPath, unpacked string) error {
 	cmd := exec.Command("dpkg-source", "--no-copy", "--no-check", "-x",
 		dscPath, unpacked)
@@ -498,6 +888,7 @@ func main() {
 
 	indexQueue = make(chan string)
 	mergeQueue = make(chan bool)
+	compactQueue = make(chan bool)
 
 	for i := 0; i < runtime.NumCPU(); i++ {
 		go unpackAndIndex()
@@ -509,6 +900,12 @@ func main() {
 		}
 	}()
 
+	go func() {
+		for _ = range compactQueue {
+			compact()
+		}
+	}()
+
 	conn, err := grpcutil.DialTLS("localhost:28081", *tlsCertPath, *tlsKeyPath)
 	if err != nil {
 		log.Fatalf("could not connect to %q: %v", "localhost:28081", err)
@@ -0,0 +1,57 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Debian/dcs/contenthash"
+	"github.com/Debian/dcs/ranking"
+)
+
+// dedupFiles reduces files to one file per unique content hash, keeping the
+// first (i.e. best-ranked, if files is sorted) file of each hash. It returns
+// the remaining files, the content hash of each remaining file and the paths
+// of the files which were dropped in favor of each remaining file. Files
+// without content hash (e.g. from packages imported before content hashes were
+// introduced) are always kept.
+func dedupFiles(files ranking.ResultPaths) (ranking.ResultPaths, map[string]string, map[string][]string) {
+	// Content hashes are stored per package, so load them once per package.
+	byPackage := make(map[string]map[string]string)
+	hashOf := func(file ranking.ResultPath) string {
+		// e.g. “i3-wm_4.7.2-1” for “i3-wm_4.7.2-1/src/main.c”.
+		pkg := file.Path[:strings.Index(file.Path, "/")]
+		hashes, ok := byPackage[pkg]
+		if !ok {
+			var err error
+			hashes, err = contenthash.ReadFile(path.Join(*unpackedPath, pkg+contenthash.Suffix))
+			if err != nil && !os.IsNotExist(err) {
+				log.Printf("Could not read content hashes of %q: %v\n", pkg, err)
+			}
+			byPackage[pkg] = hashes
+		}
+		return hashes[file.Path]
+	}
+
+	unique := make(ranking.ResultPaths, 0, len(files))
+	hashes := make(map[string]string)
+	duplicates := make(map[string][]string)
+	first := make(map[string]string)
+	for _, file := range files {
+		hash := hashOf(file)
+		if hash == "" {
+			unique = append(unique, file)
+			continue
+		}
+		if kept, ok := first[hash]; ok {
+			duplicates[kept] = append(duplicates[kept], file.Path)
+			continue
+		}
+		first[hash] = file.Path
+		hashes[file.Path] = hash
+		unique = append(unique, file)
+	}
+	return unique, hashes, duplicates
+}
@@ -0,0 +1,239 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Debian/dcs/seekable"
+	"github.com/Debian/dcs/transcode"
+)
+
+// resolvePath returns the absolute path of p (relative to -unpacked_path), or
+// an error if p refers to anything outside of -unpacked_path, either via “..”
+// or via symbolic links.
+func resolvePath(p string) (string, error) {
+	root := path.Clean(*unpackedPath)
+	// path.Join calls path.Clean so we get the shortest path without any "..".
+	absPath := path.Join(root, p)
+	if !inside(root, absPath) {
+		return "", fmt.Errorf("Path traversal is bad, mhkay?")
+	}
+	// Unpacked packages can contain symbolic links pointing anywhere.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if os.IsNotExist(err) {
+		// The file might be stored compressed.
+		realPath, err = filepath.EvalSymlinks(absPath + seekable.Suffix)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !inside(realRoot, realPath) {
+		return "", fmt.Errorf("Path traversal is bad, mhkay?")
+	}
+	return absPath, nil
+}
+
+// inside returns whether p is root or a path within root. Both must be clean.
+func inside(root, p string) bool {
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")
+}
+
+// countLines returns the number of lines in b. A trailing line without
+// newline counts as a line.
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte{'\n'})
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// lineRange returns the byte offsets [start, end) of the lines [first, last]
+// (1-based, inclusive) in b. Lines beyond the end of b are ignored.
+func lineRange(b []byte, first, last uint32) (start, end int) {
+	line := uint32(1)
+	start = len(b)
+	end = len(b)
+	if first <= 1 {
+		start = 0
+	}
+	for i, c := range b {
+		if c != '\n' {
+			continue
+		}
+		if line == last {
+			end = i + 1
+			break
+		}
+		line++
+		if line == first {
+			start = i + 1
+		}
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+// readLines returns the lines [first, last] (see lineRange) of f, which is
+// read frame by frame up to the end of line last only.
+func readLines(f seekable.File, first, last uint32) ([]byte, error) {
+	r := io.NewSectionReader(f, 0, f.Size())
+	chunk := make([]byte, seekable.FrameSize)
+	var b []byte
+	var lines uint64
+	for lines < uint64(last) {
+		n, err := r.Read(chunk)
+		b = append(b, chunk[:n]...)
+		lines += uint64(bytes.Count(chunk[:n], []byte{'\n'}))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	start, end := lineRange(b, first, last)
+	return b[start:end], nil
+}
+
+// countNewlines returns the number of newlines in the first n bytes of f,
+// which are read frame by frame.
+func countNewlines(f io.ReaderAt, n int64) (int, error) {
+	r := io.NewSectionReader(f, 0, n)
+	chunk := make([]byte, seekable.FrameSize)
+	var count int
+	for {
+		n, err := r.Read(chunk)
+		count += bytes.Count(chunk[:n], []byte{'\n'})
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// countLinesAt is countLines for the entire file f. Compressed files store
+// their number of lines (see seekable.Reader.Lines), uncompressed files are
+// read entirely.
+func countLinesAt(f seekable.File) (int, error) {
+	if r, ok := f.(*seekable.Reader); ok {
+		return int(r.Lines()), nil
+	}
+	n, err := countNewlines(f, f.Size())
+	if err != nil || f.Size() == 0 {
+		return n, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, f.Size()-1); err != nil {
+		return 0, err
+	}
+	if last[0] != '\n' {
+		n++
+	}
+	return n, nil
+}
+
+// readRange returns the length bytes of f starting at off. The range is
+// clamped to the size of f.
+func readRange(f seekable.File, off, length uint64) ([]byte, error) {
+	size := uint64(f.Size())
+	if off > size {
+		off = size
+	}
+	// off + length could overflow.
+	end := size
+	if length <= size-off {
+		end = off + length
+	}
+	b := make([]byte, end-off)
+	if n, err := f.ReadAt(b, int64(off)); err != nil && !(err == io.EOF && n == len(b)) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// detectEncoding returns the name of the encoding of b.
+func detectEncoding(b []byte) string {
+	if encoding := transcode.Detect(b); encoding != "" {
+		return encoding
+	}
+	return "unknown"
+}
+
+// packageEncodings returns the encodings of the transcoded files of the
+// package pkg (e.g. “i3-wm_4.7.2-1”), keyed by path. Only the files listed
+// there were transcoded: a file named like a transcoding (see
+// transcode.Suffix) is otherwise an ordinary upstream file.
+func packageEncodings(pkg string) map[string]string {
+	encodings, err := transcode.ReadFile(path.Join(*unpackedPath, pkg+transcode.EncodingsSuffix))
+	if err != nil {
+		return nil
+	}
+	return encodings
+}
+
+// recordedEncoding returns the encoding the importer detected for the
+// transcoded file at p, or the empty string if p was not transcoded.
+func recordedEncoding(p string) string {
+	idx := strings.Index(p, "/")
+	if idx == -1 {
+		return ""
+	}
+	return packageEncodings(p[:idx])[p]
+}
+
+// encodingsCache caches packageEncodings for the duration of a query, so that
+// the encodings of each package are read once instead of once per file.
+type encodingsCache struct {
+	mu        sync.Mutex
+	encodings map[string]map[string]string
+}
+
+// transcoded returns whether the file at p (relative to -unpacked_path) was
+// transcoded, i.e. whether its transcoding needs to be searched.
+func (c *encodingsCache) transcoded(p string) bool {
+	idx := strings.Index(p, "/")
+	if idx == -1 {
+		return false
+	}
+	pkg := p[:idx]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	encodings, ok := c.encodings[pkg]
+	if !ok {
+		encodings = packageEncodings(pkg)
+		if c.encodings == nil {
+			c.encodings = make(map[string]map[string]string)
+		}
+		c.encodings[pkg] = encodings
+	}
+	_, ok = encodings[p]
+	return ok
+}
+
+// packageVersion returns the source package version of the file at path,
+// e.g. “4.7.2-1” for “i3-wm_4.7.2-1/i3bar/src/xcb.c”.
+func packageVersion(path string) string {
+	if idx := strings.Index(path, "/"); idx > -1 {
+		path = path[:idx]
+	}
+	if idx := strings.Index(path, "_"); idx > -1 {
+		return path[idx+1:]
+	}
+	return ""
+}
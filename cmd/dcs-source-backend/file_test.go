@@ -0,0 +1,399 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/seekable"
+	"golang.org/x/net/context"
+)
+
+// withUnpacked sets -unpacked_path to a temporary directory containing the
+// given files (relative path to contents). The returned function restores
+// -unpacked_path and removes the directory.
+func withUnpacked(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "dcs-source-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := *unpackedPath
+	*unpackedPath = dir
+	return dir, func() {
+		*unpackedPath = old
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"\n", 1},
+		{"a", 1},
+		{"a\n", 1},
+		{"a\nb", 2},
+		{"a\nb\n", 2},
+		{"\n\n\n", 3},
+	} {
+		if got := countLines([]byte(tt.in)); got != tt.want {
+			t.Errorf("countLines(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLineRange(t *testing.T) {
+	const contents = "one\ntwo\nthree\nfour"
+	for _, tt := range []struct {
+		first, last uint32
+		want        string
+	}{
+		{1, 1, "one\n"},
+		{1, 2, "one\ntwo\n"},
+		{2, 3, "two\nthree\n"},
+		{3, 4, "three\nfour"},
+		{4, 4, "four"},
+		// Lines beyond the end of the file are ignored.
+		{3, 100, "three\nfour"},
+		{3, math.MaxUint32, "three\nfour"},
+		{5, 10, ""},
+		// Line 0 is treated like line 1.
+		{0, 1, "one\n"},
+	} {
+		start, end := lineRange([]byte(contents), tt.first, tt.last)
+		if got := contents[start:end]; got != tt.want {
+			t.Errorf("lineRange(%d, %d) = %q, want %q", tt.first, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	for _, tt := range []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte("hello"), "utf-8"},
+		{[]byte("gr\xc3\xbc\xc3\x9f"), "utf-8"},
+		{[]byte{0xff, 0xfe, 'a', 0}, "utf-16le"},
+		// Binary data.
+		{[]byte{0x89, 'P', 'N', 'G', 0, 0, 0, 0x0d, 0xff}, "unknown"},
+	} {
+		if got := detectEncoding(tt.in); got != tt.want {
+			t.Errorf("detectEncoding(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPackageVersion(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{"i3-wm_4.7.2-1/i3bar/src/xcb.c", "4.7.2-1"},
+		{"i3-wm_4.7.2-1", "4.7.2-1"},
+		// Versions can contain underscores, package names cannot.
+		{"foo_1.0_beta-1/x_y.c", "1.0_beta-1"},
+		{"foo/bar_baz.c", ""},
+		{"", ""},
+	} {
+		if got := packageVersion(tt.path); got != tt.want {
+			t.Errorf("packageVersion(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileRanges(t *testing.T) {
+	_, cleanup := withUnpacked(t, map[string]string{
+		"i3-wm_4.13-1/src/main.c": "one\ntwo\nthree\n",
+	})
+	defer cleanup()
+	s := &server{}
+	for _, tt := range []struct {
+		req  proto.FileRequest
+		want string
+	}{
+		{proto.FileRequest{}, "one\ntwo\nthree\n"},
+		{proto.FileRequest{FirstLine: 2, LastLine: 2}, "two\n"},
+		{proto.FileRequest{Offset: 4, Length: 3}, "two"},
+		{proto.FileRequest{Offset: 4, Length: 100}, "two\nthree\n"},
+		{proto.FileRequest{Offset: 100, Length: 1}, ""},
+		// start + Length overflows.
+		{proto.FileRequest{Offset: 1, Length: math.MaxUint64}, "ne\ntwo\nthree\n"},
+		{proto.FileRequest{Offset: math.MaxUint64, Length: math.MaxUint64}, ""},
+	} {
+		req := tt.req
+		req.Path = "i3-wm_4.13-1/src/main.c"
+		reply, err := s.File(context.Background(), &req)
+		if err != nil {
+			t.Errorf("File(%+v): %v", tt.req, err)
+			continue
+		}
+		if got := string(reply.Contents); got != tt.want {
+			t.Errorf("File(%+v) = %q, want %q", tt.req, got, tt.want)
+		}
+	}
+
+	for _, req := range []proto.FileRequest{
+		{FirstLine: 1, LastLine: 0},
+		{FirstLine: 3, LastLine: 2},
+	} {
+		req.Path = "i3-wm_4.13-1/src/main.c"
+		if _, err := s.File(context.Background(), &req); err == nil {
+			t.Errorf("File(%+v) unexpectedly succeeded", req)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir, cleanup := withUnpacked(t, map[string]string{
+		"i3-wm_4.13-1/src/main.c": "int main() {}\n",
+	})
+	defer cleanup()
+	outside, err := ioutil.TempDir("", "dcs-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "i3-wm_4.13-1", "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("src/main.c", filepath.Join(dir, "i3-wm_4.13-1", "main.c")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{
+		"i3-wm_4.13-1/src/main.c",
+		"/i3-wm_4.13-1/src/main.c",
+		"i3-wm_4.13-1/src/../src/main.c",
+		// Symbolic links within the unpacked sources are fine.
+		"i3-wm_4.13-1/main.c",
+		"",
+		"/",
+	} {
+		got, err := resolvePath(p)
+		if err != nil {
+			t.Errorf("resolvePath(%q): %v", p, err)
+			continue
+		}
+		if !inside(dir, got) {
+			t.Errorf("resolvePath(%q) = %q, which is not inside %q", p, got, dir)
+		}
+	}
+
+	for _, p := range []string{
+		"..",
+		"../../etc/passwd",
+		"i3-wm_4.13-1/../../etc/passwd",
+		filepath.Join("..", filepath.Base(outside), "secret"),
+		// Absolute paths are relative to the unpacked sources.
+		filepath.Join(outside, "secret"),
+		// Paths are not URL-decoded, so %2e%2e is a (non-existing) name.
+		"%2e%2e/%2e%2e/etc/passwd",
+		"i3-wm_4.13-1/escape/secret",
+		"i3-wm_4.13-1/escape",
+	} {
+		if got, err := resolvePath(p); err == nil {
+			t.Errorf("resolvePath(%q) = %q, want error", p, got)
+		}
+	}
+}
+
+func TestListDirectoryRoot(t *testing.T) {
+	_, cleanup := withUnpacked(t, map[string]string{
+		"i3-wm_4.13-1/src/main.c": "int main() {}\n",
+		"i3-wm_4.13-1.idx":        "",
+		"i3-wm_4.13-1.hashes":     "",
+		"i3-wm_4.13-1.encodings":  "",
+	})
+	defer cleanup()
+	s := &server{}
+	for _, tt := range []struct {
+		path string
+		want []string
+	}{
+		{"/", []string{"i3-wm_4.13-1"}},
+		{"", []string{"i3-wm_4.13-1"}},
+		{"i3-wm_4.13-1", []string{"src"}},
+		{"i3-wm_4.13-1/src", []string{"main.c"}},
+	} {
+		reply, err := s.ListDirectory(context.Background(), &proto.ListDirectoryRequest{Path: tt.path})
+		if err != nil {
+			t.Errorf("ListDirectory(%q): %v", tt.path, err)
+			continue
+		}
+		var got []string
+		for _, e := range reply.Entries {
+			got = append(got, e.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListDirectory(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTranscoded(t *testing.T) {
+	_, cleanup := withUnpacked(t, map[string]string{
+		"foo_1/latin1.txt":       "gr\xfc\xdf\n",
+		"foo_1/latin1.txt.utf-8": "gr\xc3\xbc\xc3\x9f\n",
+		// An upstream file which happens to be named like a transcoding.
+		"foo_1/notes":       "original\n",
+		"foo_1/notes.utf-8": "upstream\n",
+		"foo_1.encodings":   "iso-8859-1  foo_1/latin1.txt\n",
+		// The original of a transcoded file is not read unless requested,
+		// so it being corrupt goes unnoticed.
+		"bar_1/corrupt.txt.dcsz":  "not in seekable format",
+		"bar_1/corrupt.txt.utf-8": "transcoded\n",
+		"bar_1.encodings":         "iso-8859-1  bar_1/corrupt.txt\n",
+	})
+	defer cleanup()
+
+	var c encodingsCache
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"foo_1/latin1.txt", true},
+		{"foo_1/notes", false},
+		{"foo_1/notes.utf-8", false},
+		{"bar_1/latin1.txt", false},
+		{"foo_1", false},
+	} {
+		if got := c.transcoded(tt.path); got != tt.want {
+			t.Errorf("transcoded(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	s := &server{}
+	for _, tt := range []struct {
+		req        proto.FileRequest
+		want       string
+		encoding   string
+		transcoded bool
+	}{
+		{proto.FileRequest{Path: "foo_1/latin1.txt"}, "gr\xc3\xbc\xc3\x9f\n", "iso-8859-1", true},
+		{proto.FileRequest{Path: "foo_1/latin1.txt", Original: true}, "gr\xfc\xdf\n", "iso-8859-1", false},
+		{proto.FileRequest{Path: "foo_1/notes"}, "original\n", "utf-8", false},
+		{proto.FileRequest{Path: "foo_1/notes.utf-8"}, "upstream\n", "utf-8", false},
+		{proto.FileRequest{Path: "bar_1/corrupt.txt"}, "transcoded\n", "iso-8859-1", true},
+	} {
+		reply, err := s.File(context.Background(), &tt.req)
+		if err != nil {
+			t.Errorf("File(%+v): %v", tt.req, err)
+			continue
+		}
+		if got := string(reply.Contents); got != tt.want {
+			t.Errorf("File(%+v) = %q, want %q", tt.req, got, tt.want)
+		}
+		if reply.Encoding != tt.encoding || reply.Transcoded != tt.transcoded {
+			t.Errorf("File(%+v): encoding %q, transcoded %v, want %q, %v", tt.req, reply.Encoding, reply.Transcoded, tt.encoding, tt.transcoded)
+		}
+	}
+
+	reply, err := s.ListDirectory(context.Background(), &proto.ListDirectoryRequest{Path: "foo_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range reply.Entries {
+		got = append(got, e.Name)
+	}
+	if want := []string{"latin1.txt", "notes", "notes.utf-8"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListDirectory(%q) = %v, want %v", "foo_1", got, want)
+	}
+}
+
+func TestFileCompressed(t *testing.T) {
+	var contents bytes.Buffer
+	for i := 1; contents.Len() < 3*seekable.FrameSize; i++ {
+		fmt.Fprintf(&contents, "line %d\n", i)
+	}
+	dir, cleanup := withUnpacked(t, map[string]string{
+		"foo_1/plain.txt": contents.String(),
+	})
+	defer cleanup()
+	f, err := os.Create(filepath.Join(dir, "foo_1", "compressed.txt"+seekable.Suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := seekable.NewWriter(f)
+	if _, err := w.Write(contents.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{}
+	for _, req := range []proto.FileRequest{
+		{},
+		{FirstLine: 1, LastLine: 3},
+		{FirstLine: 10000, LastLine: 10002},
+		{FirstLine: 10000, LastLine: math.MaxUint32},
+		{Offset: uint64(seekable.FrameSize) - 5, Length: 10},
+		{Offset: 100000, Length: 50},
+	} {
+		req.Path = "foo_1/plain.txt"
+		want, err := s.File(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Path = "foo_1/compressed.txt"
+		got, err := s.File(context.Background(), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Contents, want.Contents) ||
+			got.Size != want.Size ||
+			got.Lines != want.Lines ||
+			got.FirstLine != want.FirstLine {
+			t.Errorf("File(%+v) = %+v, want %+v", req, got, want)
+		}
+	}
+
+	reply, err := s.File(context.Background(), &proto.FileRequest{
+		Path:      "foo_1/compressed.txt",
+		FirstLine: 10000,
+		LastLine:  10001,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(reply.Contents), "line 10000\nline 10001\n"; got != want {
+		t.Errorf("File(lines 10000-10001) = %q, want %q", got, want)
+	}
+	reply, err = s.File(context.Background(), &proto.FileRequest{
+		Path:   "foo_1/compressed.txt",
+		Offset: uint64(bytes.Index(contents.Bytes(), []byte("line 5000\n"))),
+		Length: 9,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(reply.Contents), "line 5000"; got != want || reply.FirstLine != 5000 {
+		t.Errorf("File(offset of line 5000) = %q, first line %d, want %q, 5000", got, reply.FirstLine, want)
+	}
+}
@@ -16,12 +16,16 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Debian/dcs/grpcutil"
+	"github.com/Debian/dcs/index"
 	"github.com/Debian/dcs/proto"
 	"github.com/Debian/dcs/ranking"
 	"github.com/Debian/dcs/regexp"
+	"github.com/Debian/dcs/seekable"
+	"github.com/Debian/dcs/transcode"
 	_ "github.com/Debian/dcs/varz"
 	opentracing "github.com/opentracing/opentracing-go"
 	olog "github.com/opentracing/opentracing-go/log"
@@ -30,6 +34,8 @@ import (
 	jaegercfg "github.com/uber/jaeger-client-go/config"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
@@ -40,15 +46,48 @@ var (
 	rankingDataPath = flag.String("ranking_data_path",
 		"/var/dcs/ranking.json",
 		"Path to the JSON containing ranking data")
+	rankingModelPath = flag.String("ranking_model_path",
+		"",
+		"Path to the JSON containing the ranking model (see dcs-learn-ranking). The built-in weights are used if empty.")
+	rankingProfilesPath = flag.String("ranking_profiles_path",
+		"",
+		"Path to the JSON containing the named ranking profiles selectable with the rank: keyword (see ranking.ReadProfiles). Only the default profile is available if empty.")
 	tlsCertPath = flag.String("tls_cert_path", "", "Path to a .pem file containing the TLS certificate.")
 	tlsKeyPath  = flag.String("tls_key_path", "", "Path to a .pem file containing the TLS private key.")
 	jaegerAgent = flag.String("jaeger_agent",
 		"localhost:5775",
 		"host:port of a github.com/uber/jaeger agent")
-
-	indexBackend proto.IndexBackendClient
+	pcreMaxSteps = flag.Int("pcre_max_steps",
+		10000000,
+		"Maximum number of backtracking steps spent verifying the lines of a single file for pcre: queries, or matching a single file for struct: queries (0 means unlimited)")
+	pcreMaxTime = flag.Duration("pcre_max_time",
+		500*time.Millisecond,
+		"Maximum time spent verifying the lines of a single file for pcre: queries, or matching a single file for struct: queries (0 means unlimited)")
+	maxDFAStates = flag.Int("max_dfa_states",
+		regexp.MaxDFAStates,
+		"Maximum number of DFA states each search worker caches (about 2 KiB each). When exceeded, the cache is flushed, and when that happens too often, the worker falls back to the slower NFA simulation.")
+
+	indexBackend       proto.IndexBackendClient
+	indexBackendHealth healthpb.HealthClient
+
+	dfaCacheResets = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dfa_cache_resets",
+			Help: "Flushes of a search worker’s DFA state cache because it exceeded -max_dfa_states.",
+		})
+
+	nfaFallbacks = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nfa_fallbacks",
+			Help: "Search workers which fell back to the NFA because their DFA state cache was thrashing.",
+		})
 )
 
+func init() {
+	prometheus.MustRegister(dfaCacheResets)
+	prometheus.MustRegister(nfaFallbacks)
+}
+
 type SourceReply struct {
 	// The number of the last used filename, needed for pagination
 	LastUsedFilename int
@@ -59,130 +98,246 @@ type SourceReply struct {
 type server struct {
 }
 
-// Serves a single file for displaying it in /show
+// Serves a single file (or the requested range of it) for displaying it in
+// /show, along with metadata about the file.
 func (s *server) File(ctx context.Context, in *proto.FileRequest) (*proto.FileReply, error) {
 	log.Printf("requested filename *%s*\n", in.Path)
-	// path.Join calls path.Clean so we get the shortest path without any "..".
-	absPath := path.Join(*unpackedPath, in.Path)
-	log.Printf("clean, absolute path is *%s*\n", absPath)
-	if !strings.HasPrefix(absPath, *unpackedPath) {
-		return nil, fmt.Errorf("Path traversal is bad, mhkay?")
+	absPath, err := resolvePath(in.Path)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("clean, absolute path is *%s*\n", absPath)
 
-	contents, err := ioutil.ReadFile(absPath)
+	// Files which are not valid UTF-8 were transcoded when importing. Only
+	// the file which is served is read.
+	encoding := recordedEncoding(in.Path)
+	transcoded := encoding != "" && !in.Original
+	name := absPath
+	if transcoded {
+		name += transcode.Suffix
+	}
+	if in.FirstLine > 0 && in.LastLine < in.FirstLine {
+		return nil, fmt.Errorf("invalid line range [%d, %d]", in.FirstLine, in.LastLine)
+	}
+	// Of compressed files, only the frames covering the requested range are
+	// decompressed.
+	f, err := seekable.OpenReaderAt(name)
 	if err != nil {
 		return nil, err
 	}
-	return &proto.FileReply{
-		Contents: contents,
-	}, nil
-}
-
-func filterByKeywords(rewritten *url.URL, files []ranking.ResultPath) []ranking.ResultPath {
-	// The "package:" keyword, if specified.
-	pkg := rewritten.Query().Get("package")
-	// The "-package:" keywords, if specified.
-	npkgs := rewritten.Query()["npackage"]
-	// The "path:" keywords, if specified.
-	paths := rewritten.Query()["path"]
-	// The "-path" keywords, if specified.
-	npaths := rewritten.Query()["npath"]
-
-	// Filter the filenames if the "package:" keyword was specified.
-	if pkg != "" {
-		fmt.Printf("Filtering for package %q\n", pkg)
-		pkgRegexp, err := regexp.Compile(pkg)
-		if err != nil {
-			return files
-		}
-		filtered := make(ranking.ResultPaths, 0, len(files))
-		for _, file := range files {
-			if pkgRegexp.MatchString(file.Path[file.SourcePkgIdx[0]:file.SourcePkgIdx[1]], true, true) == -1 {
-				continue
+	defer f.Close()
+	reply := &proto.FileReply{
+		Size:           uint64(f.Size()),
+		FirstLine:      1,
+		Language:       ranking.Language(in.Path),
+		PackageVersion: packageVersion(in.Path),
+		Transcoded:     transcoded,
+	}
+	switch {
+	case in.FirstLine > 0:
+		reply.Contents, err = readLines(f, in.FirstLine, in.LastLine)
+		reply.FirstLine = in.FirstLine
+	case in.Length > 0:
+		reply.Contents, err = readRange(f, in.Offset, in.Length)
+		if err == nil && in.Offset > 0 {
+			start := in.Offset
+			if start > reply.Size {
+				start = reply.Size
 			}
-
-			filtered = append(filtered, file)
+			var newlines int
+			newlines, err = countNewlines(f, int64(start))
+			reply.FirstLine = uint32(newlines) + 1
 		}
-
-		files = filtered
+	default:
+		reply.Contents, err = readRange(f, 0, reply.Size)
 	}
-
-	// Filter the filenames if the "-package:" keyword was specified.
-	for _, npkg := range npkgs {
-		fmt.Printf("Excluding matches for package %q\n", npkg)
-		npkgRegexp, err := regexp.Compile(npkg)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(reply.Contents)) == reply.Size {
+		reply.Lines = uint32(countLines(reply.Contents))
+	} else {
+		lines, err := countLinesAt(f)
 		if err != nil {
-			return files
-		}
-		filtered := make(ranking.ResultPaths, 0, len(files))
-		for _, file := range files {
-			if npkgRegexp.MatchString(file.Path[file.SourcePkgIdx[0]:file.SourcePkgIdx[1]], true, true) != -1 {
-				continue
-			}
-
-			filtered = append(filtered, file)
+			return nil, err
 		}
-
-		files = filtered
+		reply.Lines = uint32(lines)
+	}
+	// The importer keeps files which are not valid UTF-8 only if it
+	// transcoded them, so detecting the encoding of the requested range
+	// instead of the entire file suffices.
+	if encoding == "" {
+		encoding = detectEncoding(reply.Contents)
 	}
+	reply.Encoding = encoding
+	return reply, nil
+}
 
-	for _, path := range paths {
-		fmt.Printf("Filtering for path %q\n", path)
-		pathRegexp, err := regexp.Compile(path)
-		if err != nil {
-			return files
-			// TODO: perform this validation before accepting the query, i.e. in dcs-web
-			//err := common.Templates.ExecuteTemplate(w, "error.html", map[string]interface{}{
-			//	"q":          r.URL.Query().Get("q"),
-			//	"errormsg":   fmt.Sprintf(`%v`, err),
-			//	"suggestion": template.HTML(`See <a href="http://codesearch.debian.net/faq#regexp">http://codesearch.debian.net/faq#regexp</a> for help on regular expressions.`),
-			//})
-			//if err != nil {
-			//	http.Error(w, err.Error(), http.StatusInternalServerError)
-			//}
-		}
+// Lists a single directory for browsing the unpacked sources in dcs-web.
+func (s *server) ListDirectory(ctx context.Context, in *proto.ListDirectoryRequest) (*proto.ListDirectoryReply, error) {
+	log.Printf("requested directory *%s*\n", in.Path)
+	absPath, err := resolvePath(in.Path)
+	if err != nil {
+		return nil, err
+	}
 
-		filtered := make(ranking.ResultPaths, 0, len(files))
-		for _, file := range files {
-			if pathRegexp.MatchString(file.Path, true, true) == -1 {
-				continue
+	// ioutil.ReadDir returns the entries sorted by name.
+	fis, err := ioutil.ReadDir(absPath)
+	if err != nil {
+		return nil, err
+	}
+	reply := &proto.ListDirectoryReply{
+		Entries: make([]*proto.DirectoryEntry, 0, len(fis)),
+	}
+	// The root contains the package directories, but also bookkeeping files
+	// such as the package indexes (*.idx), content hashes (*.hashes) and
+	// encodings (*.encodings), which are not sources.
+	isRoot := absPath == path.Clean(*unpackedPath)
+	// dir is relative to -unpacked_path, e.g. “i3-wm_4.13-1/src”.
+	dir := strings.TrimPrefix(path.Clean("/"+in.Path), "/")
+	var encodings map[string]string
+	if !isRoot {
+		encodings = packageEncodings(strings.SplitN(dir, "/", 2)[0])
+	}
+	for _, fi := range fis {
+		entry := &proto.DirectoryEntry{Name: fi.Name()}
+		switch {
+		case isRoot && !fi.IsDir():
+			continue
+		case fi.Mode()&os.ModeSymlink != 0:
+			entry.Type = proto.DirectoryEntry_SYMLINK
+		case fi.IsDir():
+			entry.Type = proto.DirectoryEntry_DIRECTORY
+		case fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), seekable.Suffix):
+			// Files stored compressed are listed with their uncompressed
+			// name and size.
+			r, err := seekable.Open(path.Join(absPath, fi.Name()))
+			if err != nil {
+				return nil, err
 			}
-
-			filtered = append(filtered, file)
+			entry.Name = strings.TrimSuffix(fi.Name(), seekable.Suffix)
+			entry.Type = proto.DirectoryEntry_FILE
+			entry.Size = uint64(r.Size())
+			r.Close()
+		case fi.Mode().IsRegular():
+			entry.Type = proto.DirectoryEntry_FILE
+			entry.Size = uint64(fi.Size())
+		default:
+			// Skip devices, sockets, named pipes etc.
+			continue
+		}
+		if entry.Type == proto.DirectoryEntry_FILE &&
+			strings.HasSuffix(entry.Name, transcode.Suffix) &&
+			encodings[path.Join(dir, strings.TrimSuffix(entry.Name, transcode.Suffix))] != "" {
+			// UTF-8 transcodings are served in place of their original,
+			// see File.
+			continue
 		}
+		reply.Entries = append(reply.Entries, entry)
+	}
+	return reply, nil
+}
 
-		files = filtered
+// filesRequest returns the request for the files which possibly match query,
+// restricted by the package:, path: and filetype: keywords (and their
+// negations) and the -vendored keyword, so that the index backend does not
+// send excluded files.
+func filesRequest(query string, rewritten *url.URL, opts ranking.RankingOpts) *proto.FilesRequest {
+	values := rewritten.Query()
+	req := &proto.FilesRequest{
+		Query:     query,
+		Npackage:  values["npackage"],
+		Path:      values["path"],
+		Npath:     values["npath"],
+		Nvendored: opts.Nvendored,
+	}
+	// The "package:" keyword, if specified.
+	if pkg := values.Get("package"); pkg != "" {
+		req.Package = []string{pkg}
 	}
+	// Files of other file types are thrown away by ResultPath.Rank.
+	if opts.Filetype || opts.Weighted {
+		for suffix := range opts.Suffixes {
+			req.Suffix = append(req.Suffix, suffix)
+		}
+		for suffix := range opts.Nsuffixes {
+			req.Nsuffix = append(req.Nsuffix, suffix)
+		}
+		sort.Strings(req.Suffix)
+		sort.Strings(req.Nsuffix)
+	}
+	return req
+}
 
-	for _, path := range npaths {
-		fmt.Printf("Filtering for path %q\n", path)
-		pathRegexp, err := regexp.Compile(path)
+// keywordFilter re-checks the package:, path: and -vendored restrictions of
+// a FilesRequest on the files the index backend returned. Index backends
+// which predate these restrictions ignore them, e.g. during a rolling
+// deploy. Compared to searching the files, the check is cheap. File types
+// are checked by ResultPath.Rank.
+type keywordFilter struct {
+	packages, npackages []*regexp.Regexp
+	paths, npaths       []*regexp.Regexp
+	nvendored           bool
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(exprs))
+	for idx, expr := range exprs {
+		re, err := regexp.Compile(expr)
 		if err != nil {
-			return files
-			// TODO: perform this validation before accepting the query, i.e. in dcs-web
-			//err := common.Templates.ExecuteTemplate(w, "error.html", map[string]interface{}{
-			//	"q":          r.URL.Query().Get("q"),
-			//	"errormsg":   fmt.Sprintf(`%v`, err),
-			//	"suggestion": template.HTML(`See <a href="http://codesearch.debian.net/faq#regexp">http://codesearch.debian.net/faq#regexp</a> for help on regular expressions.`),
-			//})
-			//if err != nil {
-			//	http.Error(w, err.Error(), http.StatusInternalServerError)
-			//}
+			return nil, err
 		}
+		res[idx] = re
+	}
+	return res, nil
+}
 
-		filtered := make(ranking.ResultPaths, 0, len(files))
-		for _, file := range files {
-			if pathRegexp.MatchString(file.Path, true, true) != -1 {
-				continue
-			}
+func newKeywordFilter(req *proto.FilesRequest) (*keywordFilter, error) {
+	f := &keywordFilter{nvendored: req.Nvendored}
+	var err error
+	if f.packages, err = compileAll(req.Package); err != nil {
+		return nil, err
+	}
+	if f.npackages, err = compileAll(req.Npackage); err != nil {
+		return nil, err
+	}
+	if f.paths, err = compileAll(req.Path); err != nil {
+		return nil, err
+	}
+	if f.npaths, err = compileAll(req.Npath); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
 
-			filtered = append(filtered, file)
+// matchAll reports whether all of res (want true) or none of res (want
+// false) match s.
+func matchAll(res []*regexp.Regexp, s string, want bool) bool {
+	for _, re := range res {
+		if (re.MatchString(s, true, true) != -1) != want {
+			return false
 		}
-
-		files = filtered
 	}
+	return true
+}
 
-	return files
+// keep reports whether file, which must be ranked already, passes f.
+func (f *keywordFilter) keep(file *ranking.ResultPath) bool {
+	pkg := file.Path[file.SourcePkgIdx[0]:file.SourcePkgIdx[1]]
+	if !matchAll(f.packages, pkg, true) || !matchAll(f.npackages, pkg, false) {
+		return false
+	}
+	if !matchAll(f.paths, file.Path, true) || !matchAll(f.npaths, file.Path, false) {
+		return false
+	}
+	if f.nvendored {
+		// File metadata of older index backends lacks the Vendored flag.
+		rel := file.Path[strings.IndexByte(file.Path, '/')+1:]
+		if (file.Flags|ranking.FileFlags(pkg, rel))&index.Vendored != 0 {
+			return false
+		}
+	}
+	return true
 }
 
 func sendProgressUpdate(stream proto.SourceBackend_SearchServer, connMu *sync.Mutex, filesProcessed, filesTotal int) error {
@@ -205,13 +360,27 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 	logprefix := fmt.Sprintf("[%q]", in.Query)
 	span := opentracing.SpanFromContext(ctx)
 
-	// Ask the local index backend for all the filenames.
-	fstream, err := indexBackend.Files(ctx, &proto.FilesRequest{Query: in.Query})
+	// Parse the (rewritten) URL to extract all ranking options/keywords.
+	rewritten, err := url.Parse(in.RewrittenUrl)
+	if err != nil {
+		return err
+	}
+	rankingopts := ranking.RankingOptsFromQuery(rewritten.Query())
+	span.LogFields(olog.String("rankingopts", fmt.Sprintf("%+v", rankingopts)))
+
+	// Ask the local index backend for all the filenames. Files excluded by
+	// keywords are filtered by the index backend.
+	req := filesRequest(in.Query, rewritten, rankingopts)
+	filter, err := newKeywordFilter(req)
+	if err != nil {
+		return err
+	}
+	fstream, err := indexBackend.Files(ctx, req)
 	if err != nil {
 		return fmt.Errorf("%s Error querying index backend for query %q: %v\n", logprefix, in.Query, err)
 	}
 
-	var possible []string
+	var possible []*proto.FilesReply
 	for {
 		resp, err := fstream.Recv()
 		if err == io.EOF {
@@ -220,44 +389,53 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 		if err != nil {
 			return err
 		}
-		possible = append(possible, resp.Path)
+		possible = append(possible, resp)
 	}
 
 	span.LogFields(olog.Int("files.possible", len(possible)))
 
-	// Parse the (rewritten) URL to extract all ranking options/keywords.
-	rewritten, err := url.Parse(in.RewrittenUrl)
-	if err != nil {
-		return err
-	}
-	rankingopts := ranking.RankingOptsFromQuery(rewritten.Query())
-	span.LogFields(olog.String("rankingopts", fmt.Sprintf("%+v", rankingopts)))
-
 	// Rank all the paths.
 	rankspan, _ := opentracing.StartSpanFromContext(ctx, "Rank")
 	files := make(ranking.ResultPaths, 0, len(possible))
-	for _, filename := range possible {
-		result := ranking.ResultPath{Path: filename}
+	for _, resp := range possible {
+		result := ranking.ResultPath{Path: resp.Path}
+		if resp.Meta != nil {
+			result.Package = resp.Meta.Package
+			if resp.Meta.Generated {
+				result.Flags |= index.Generated
+			}
+			if resp.Meta.Test {
+				result.Flags |= index.Test
+			}
+			if resp.Meta.Vendored {
+				result.Flags |= index.Vendored
+			}
+		}
 		result.Rank(&rankingopts)
-		if result.Ranking > -1 {
+		if result.Ranking > -1 && filter.keep(&result) {
 			files = append(files, result)
 		}
 	}
 	rankspan.Finish()
 
-	// Filter all files that should be excluded.
-	filterspan, _ := opentracing.StartSpanFromContext(ctx, "Filter")
-	files = filterByKeywords(rewritten, files)
-	filterspan.Finish()
-
-	span.LogFields(olog.Int("files.filtered", len(files)))
-
 	// While not strictly necessary, this will lead to better results being
 	// discovered (and returned!) earlier, so let’s spend a few cycles on
 	// sorting the list of potential files first.
 	sort.Sort(files)
 
-	re, err := regexp.Compile(in.Query)
+	// With dedup:yes, files with identical contents are grepped only once.
+	var (
+		contentHashes map[string]string
+		duplicates    map[string][]string
+	)
+	if rewritten.Query().Get("dedup") == "yes" {
+		dedupspan, _ := opentracing.StartSpanFromContext(ctx, "Dedup")
+		files, contentHashes, duplicates = dedupFiles(files)
+		dedupspan.Finish()
+		span.LogFields(olog.Int("files.unique", len(files)))
+	}
+
+	re, err := regexp.CompileQuery(in.Query)
 	if err != nil {
 		return fmt.Errorf("%s Could not compile regexp: %v\n", logprefix, err)
 	}
@@ -329,41 +507,76 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 
 	querystr := ranking.NewQueryStr(in.Query)
 
+	// Cache resets and NFA fallbacks of this query, which point to
+	// pathological regular expressions.
+	var resets, fallbacks int64
+
+	// Which files were transcoded is recorded per package, see Grep.Transcoded.
+	var encodings encodingsCache
+
 	numWorkers := 1000
 	if len(files) < 1000 {
 		numWorkers = len(files)
 	}
 	for i := 0; i < numWorkers; i++ {
 		go func() {
-			re, err := regexp.Compile(in.Query)
+			re, err := regexp.CompileQuery(in.Query)
 			if err != nil {
 				log.Printf("%s\n", err)
 				return
 			}
 
 			grep := regexp.Grep{
-				Regexp: re,
-				Stdout: os.Stdout,
-				Stderr: os.Stderr,
+				Regexp:   re,
+				Stdout:   os.Stdout,
+				Stderr:   os.Stderr,
+				MaxSteps: *pcreMaxSteps,
+				MaxTime:  *pcreMaxTime,
 			}
 
+			var stats regexp.MatchStats
 			for file := range work {
 				sourcePkgName := file.Path[file.SourcePkgIdx[0]:file.SourcePkgIdx[1]]
+				stored := ranking.LookupStoredRanking(sourcePkgName)
+				features := proto.RankingFeatures{
+					Inst:           stored.Inst,
+					Rdep:           stored.Rdep,
+					Pathmatch:      querystr.Match(&file.Path),
+					Sourcepkgmatch: querystr.Match(&sourcePkgName),
+				}
 				if rankingopts.Pathmatch {
-					file.Ranking += querystr.Match(&file.Path)
+					file.Ranking += features.Pathmatch
 				}
 				if rankingopts.Sourcepkgmatch {
-					file.Ranking += querystr.Match(&sourcePkgName)
+					file.Ranking += features.Sourcepkgmatch
 				}
 				if rankingopts.Weighted {
-					file.Ranking += 0.1460 * querystr.Match(&file.Path)
-					file.Ranking += 0.0008 * querystr.Match(&sourcePkgName)
+					file.Ranking += rankingopts.Model.Pathmatch * features.Pathmatch
+					file.Ranking += rankingopts.Model.Sourcepkgmatch * features.Sourcepkgmatch
 				}
 
 				// TODO: figure out how to safely clone a dcs/regexp
-				matches := grep.File(path.Join(*unpackedPath, file.Path))
+				var matches []regexp.Match
+				if encodings.transcoded(file.Path) {
+					matches = grep.Transcoded(path.Join(*unpackedPath, file.Path))
+				} else {
+					matches = grep.File(path.Join(*unpackedPath, file.Path))
+				}
+				if st := re.Stats(); st.CacheResets > stats.CacheResets {
+					dfaCacheResets.Add(float64(st.CacheResets - stats.CacheResets))
+					atomic.AddInt64(&resets, int64(st.CacheResets-stats.CacheResets))
+					if st.NFA && !stats.NFA {
+						nfaFallbacks.Inc()
+						atomic.AddInt64(&fallbacks, 1)
+					}
+					stats = st
+				}
 				for _, match := range matches {
-					match.Ranking = ranking.PostRank(rankingopts, &match, &querystr)
+					classes := ranking.ClassifyMatch(file.Flags, &match, &querystr)
+					if !rankingopts.KeepLine(classes.Line) {
+						continue
+					}
+					match.Ranking = ranking.PostRank(rankingopts, &match, &querystr, classes)
 					match.PathRank = file.Ranking
 					//match.Path = match.Path[len(*unpackedPath):]
 					// NB: populating match.Ranking happens in
@@ -373,20 +586,31 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 					// TODO: ideally, we’d get proto.Match structs from grep.File(), let’s do that after profiling the decoding performance
 
 					path := match.Path[len(*unpackedPath):]
+					var bindings []*proto.Binding
+					for _, b := range match.Bindings {
+						bindings = append(bindings, &proto.Binding{
+							Name:  b.Name,
+							Value: b.Value,
+						})
+					}
 					connMu.Lock()
 					if err := stream.Send(&proto.SearchReply{
 						Type: proto.SearchReply_MATCH,
 						Match: &proto.Match{
-							Path:     path,
-							Line:     uint32(match.Line),
-							Package:  path[:strings.Index(path, "/")],
-							Ctxp2:    match.Ctxp2,
-							Ctxp1:    match.Ctxp1,
-							Context:  match.Context,
-							Ctxn1:    match.Ctxn1,
-							Ctxn2:    match.Ctxn2,
-							Pathrank: match.PathRank,
-							Ranking:  match.Ranking,
+							Path:        path,
+							Line:        uint32(match.Line),
+							Package:     path[:strings.Index(path, "/")],
+							Ctxp2:       match.Ctxp2,
+							Ctxp1:       match.Ctxp1,
+							Context:     match.Context,
+							Ctxn1:       match.Ctxn1,
+							Ctxn2:       match.Ctxn2,
+							Pathrank:    match.PathRank,
+							Ranking:     match.Ranking,
+							ContentHash: contentHashes[path],
+							Duplicates:  duplicates[path],
+							Bindings:    bindings,
+							Features:    &features,
 						},
 					}); err != nil {
 						connMu.Unlock()
@@ -400,6 +624,20 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 					}
 					connMu.Unlock()
 				}
+				if grep.BudgetErr != nil {
+					log.Printf("%s %s: %v\n", logprefix, file.Path, grep.BudgetErr)
+					connMu.Lock()
+					if err := stream.Send(&proto.SearchReply{
+						Type: proto.SearchReply_BUDGET_EXCEEDED,
+						BudgetExceeded: &proto.BudgetExceeded{
+							Path:   file.Path,
+							Reason: grep.BudgetErr.Error(),
+						},
+					}); err != nil {
+						log.Printf("%s %v\n", logprefix, err)
+					}
+					connMu.Unlock()
+				}
 
 				progress <- 1
 
@@ -410,10 +648,47 @@ func (s *server) Search(in *proto.SearchRequest, stream proto.SourceBackend_Sear
 
 	wg.Wait()
 
+	if resets := atomic.LoadInt64(&resets); resets > 0 {
+		log.Printf("%s DFA state cache flushed %d times, %d workers fell back to the NFA\n",
+			logprefix, resets, atomic.LoadInt64(&fallbacks))
+		span.LogFields(olog.Int64("dfa.cache_resets", resets))
+	}
+
 	log.Printf("%s Sent all results.\n", logprefix)
 	return nil
 }
 
+// Explain forwards the request to the local index backend, so that dcs-web
+// only needs to talk to source backends.
+func (s *server) Explain(ctx context.Context, in *proto.ExplainRequest) (*proto.ExplainReply, error) {
+	return indexBackend.Explain(ctx, in)
+}
+
+// IndexStats forwards the request to the local index backend.
+func (s *server) IndexStats(ctx context.Context, in *proto.StatsRequest) (*proto.StatsReply, error) {
+	return indexBackend.Stats(ctx, in)
+}
+
+// checkIndexBackend periodically health-checks the local index backend and
+// exports the result as the “proto.IndexBackend” service of this source
+// backend’s health server, so that dcs-web (which cannot reach index backends)
+// learns about index backends which are down.
+func checkIndexBackend(hs *health.Server) {
+	for {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, err := indexBackendHealth.Check(ctx, &healthpb.HealthCheckRequest{})
+		cancel()
+		if err != nil {
+			log.Printf("index backend health check failed: %v\n", err)
+		} else {
+			status = resp.Status
+		}
+		hs.SetServingStatus("proto.IndexBackend", status)
+		time.Sleep(10 * time.Second)
+	}
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	flag.Parse()
@@ -438,6 +713,7 @@ func main() {
 	defer closer.Close()
 
 	rand.Seed(time.Now().UnixNano())
+	regexp.MaxDFAStates = *maxDFAStates
 	if !strings.HasSuffix(*unpackedPath, "/") {
 		*unpackedPath = *unpackedPath + "/"
 	}
@@ -446,6 +722,16 @@ func main() {
 	if err := ranking.ReadRankingData(*rankingDataPath); err != nil {
 		log.Fatal(err)
 	}
+	if *rankingModelPath != "" {
+		if err := ranking.ReadModel(*rankingModelPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *rankingProfilesPath != "" {
+		if err := ranking.ReadProfiles(*rankingProfilesPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	conn, err := grpcutil.DialTLS("localhost:28081", *tlsCertPath, *tlsKeyPath)
 	if err != nil {
@@ -453,6 +739,12 @@ func main() {
 	}
 	defer conn.Close()
 	indexBackend = proto.NewIndexBackendClient(conn)
+	indexBackendHealth = healthpb.NewHealthClient(conn)
+
+	hs := health.NewServer()
+	hs.SetServingStatus("proto.SourceBackend", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("proto.IndexBackend", healthpb.HealthCheckResponse_UNKNOWN)
+	go checkIndexBackend(hs)
 
 	http.Handle("/metrics", prometheus.Handler())
 	log.Fatal(grpcutil.ListenAndServeTLS(*listenAddress,
@@ -460,5 +752,6 @@ func main() {
 		*tlsKeyPath,
 		func(s *grpc.Server) {
 			proto.RegisterSourceBackendServer(s, &server{})
+			healthpb.RegisterHealthServer(s, hs)
 		}))
 }
@@ -0,0 +1,46 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/ranking"
+)
+
+func TestKeywordFilter(t *testing.T) {
+	rewritten, err := url.Parse("/search?q=foo&package=^i3&npackage=-doc$&path=src&npath=_test&nvendored=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ranking.RankingOptsFromQuery(rewritten.Query())
+	filter, err := newKeywordFilter(filesRequest("foo", rewritten, opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path  string
+		pkg   string // from file metadata
+		flags index.FileFlags
+		want  bool
+	}{
+		{"i3-wm_4.13-1/src/main.c", "", 0, true},
+		{"i3lock_2.8-1/src/main.c", "", 0, true},
+		{"xorg_1.0/src/main.c", "", 0, false},
+		{"i3-wm-doc_4.13-1/src/main.c", "", 0, false},
+		{"i3-wm_4.13-1/libi3/font.c", "", 0, false},
+		{"i3-wm_4.13-1/src/main_test.c", "", 0, false},
+		{"i3-wm_4.13-1/src/vendor/foo.c", "", 0, false},
+		// Flags from file metadata are respected.
+		{"i3-wm_4.13-1/src/bundled.c", "i3-wm", index.Vendored, false},
+		// Older index backends do not send the Vendored flag.
+		{"i3-wm_4.13-1/src/third_party/foo.c", "i3-wm", 0, false},
+	} {
+		file := ranking.ResultPath{Path: tt.path, Package: tt.pkg, Flags: tt.flags}
+		file.Rank(&opts)
+		if got := filter.keep(&file); got != tt.want {
+			t.Errorf("keep(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// vim:ts=4:sw=4:noexpandtab
+
+// dcs-verify-index checks index files for corruption: checksum mismatches,
+// out-of-range offsets and malformed posting lists. Directories are expanded
+// to all .idx files they contain. The exit status is 1 if any index is
+// corrupt.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Debian/dcs/index"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s <index|directory>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var paths []string
+	for _, arg := range flag.Args() {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(arg, "*.idx"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		paths = append(paths, matches...)
+	}
+
+	failed := 0
+	for _, path := range paths {
+		if err := index.Verify(path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	if failed > 0 {
+		log.Printf("%d of %d indexes are corrupt\n", failed, len(paths))
+		os.Exit(1)
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/Debian/dcs/grpcutil"
 	"github.com/Debian/dcs/proto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var Version string = "unknown"
@@ -25,6 +26,12 @@ var sourceBackends = flag.String("source_backends",
 	"localhost:28082",
 	"host:port (multiple values are comma-separated) of the source-backend(s)")
 var SourceBackendStubs []proto.SourceBackendClient
+var SourceBackendAddrs []string
+
+// SourceBackendHealthStubs are used for health-checking the source backends
+// (and, through them, their index backends). They share the connection with
+// the corresponding entry of SourceBackendStubs.
+var SourceBackendHealthStubs []healthpb.HealthClient
 var UseSourcesDebianNet = flag.Bool("use_sources_debian_net",
 	false,
 	"Redirect to sources.debian.net instead of handling /show on our own.")
@@ -38,14 +45,16 @@ func Init(tlsCertPath, tlsKeyPath, staticPath string) {
 		log.Fatal(err)
 	}
 	CriticalCss = template.CSS(string(b))
-	addrs := strings.Split(*sourceBackends, ",")
-	SourceBackendStubs = make([]proto.SourceBackendClient, len(addrs))
-	for idx, addr := range addrs {
+	SourceBackendAddrs = strings.Split(*sourceBackends, ",")
+	SourceBackendStubs = make([]proto.SourceBackendClient, len(SourceBackendAddrs))
+	SourceBackendHealthStubs = make([]healthpb.HealthClient, len(SourceBackendAddrs))
+	for idx, addr := range SourceBackendAddrs {
 		conn, err := grpcutil.DialTLS(addr, tlsCertPath, tlsKeyPath)
 		if err != nil {
 			log.Fatalf("could not connect to %q: %v", addr, err)
 		}
 		SourceBackendStubs[idx] = proto.NewSourceBackendClient(conn)
+		SourceBackendHealthStubs[idx] = healthpb.NewHealthClient(conn)
 	}
 }
 
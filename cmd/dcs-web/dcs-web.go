@@ -25,6 +25,7 @@ import (
 	"github.com/Debian/dcs/cmd/dcs-web/show"
 	"github.com/Debian/dcs/goroutinez"
 	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/ranking"
 	dcsregexp "github.com/Debian/dcs/regexp"
 	_ "github.com/Debian/dcs/varz"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
@@ -55,6 +56,12 @@ var (
 	jaegerAgent = flag.String("jaeger_agent",
 		"localhost:5775",
 		"host:port of a github.com/uber/jaeger agent")
+	rankingModelPath = flag.String("ranking_model_path",
+		"",
+		"Path to the JSON containing the ranking model (see dcs-learn-ranking). The built-in weights are used if empty.")
+	rankingProfilesPath = flag.String("ranking_profiles_path",
+		"",
+		"Path to the JSON containing the named ranking profiles selectable with the rank: keyword (see ranking.ReadProfiles). Only the default profile is available if empty.")
 
 	accessLog *os.File
 
@@ -89,7 +96,17 @@ func validateQuery(query string) error {
 	}
 	rewritten := search.RewriteQuery(*fakeUrl)
 	log.Printf("rewritten query = %q\n", rewritten.String())
-	re, err := dcsregexp.Compile(rewritten.Query().Get("q"))
+	if _, _, err := ranking.ParseRank(rewritten.Query().Get("rank")); err != nil {
+		return err
+	}
+	for _, name := range []string{"in", "nin"} {
+		for _, value := range rewritten.Query()[name] {
+			if _, err := ranking.ParseLineClass(value); err != nil {
+				return err
+			}
+		}
+	}
+	re, err := dcsregexp.CompileQuery(rewritten.Query().Get("q"))
 	if err != nil {
 		return err
 	}
@@ -402,6 +419,26 @@ func main() {
 		}
 	}
 
+	if *rankingLogPath != "" {
+		var err error
+		rankingLog, err = os.OpenFile(*rankingLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *rankingModelPath != "" {
+		if err := ranking.ReadModel(*rankingModelPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *rankingProfilesPath != "" {
+		if err := ranking.ReadProfiles(*rankingProfilesPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	fmt.Printf("Debian Code Search webapp, version %s\n", common.Version)
 
 	health.StartChecking()
@@ -435,6 +472,8 @@ func main() {
 	http.HandleFunc("/favicon.ico", http.NotFound)
 	http.HandleFunc("/goroutinez", goroutinez.Goroutinez)
 	http.HandleFunc("/show", show.Show)
+	http.HandleFunc("/context", show.Context)
+	http.HandleFunc("/browse", show.Browse)
 	http.HandleFunc("/memprof", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("writing memprof")
 		if *memprofile != "" {
@@ -451,6 +490,10 @@ func main() {
 	http.HandleFunc("/results/", ResultsHandler)
 	http.HandleFunc("/perpackage-results/", PerPackageResultsHandler)
 	http.HandleFunc("/queryz", QueryzHandler)
+	http.HandleFunc("/explain", ExplainHandler)
+	http.HandleFunc("/explain.json", ExplainHandler)
+	http.HandleFunc("/shardz", ShardzHandler)
+	http.HandleFunc("/healthz", health.Healthz)
 	http.HandleFunc("/track", Track)
 
 	traced := http.NewServeMux()
@@ -0,0 +1,173 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/cmd/dcs-web/health"
+	"github.com/Debian/dcs/cmd/dcs-web/search"
+	pb "github.com/Debian/dcs/proto"
+)
+
+// planNode is a pb.QueryPlan which is easier to consume from templates and
+// JSON clients.
+type planNode struct {
+	// One of “ALL”, “NONE”, “AND” or “OR”.
+	Op string
+
+	// For AND, the trigrams are sorted by Count, i.e. in the order in which
+	// the index backend intersects their posting lists.
+	Trigrams []trigramCount `json:",omitempty"`
+	Sub      []*planNode    `json:",omitempty"`
+}
+
+type trigramCount struct {
+	Trigram string
+	Count   uint64
+}
+
+type byCount []trigramCount
+
+func (s byCount) Len() int {
+	return len(s)
+}
+
+func (s byCount) Less(i, j int) bool {
+	return s[i].Count < s[j].Count
+}
+
+func (s byCount) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func newPlanNode(plan *pb.QueryPlan) *planNode {
+	if plan == nil {
+		return nil
+	}
+	n := &planNode{
+		Op:       plan.Op.String(),
+		Trigrams: make([]trigramCount, len(plan.Trigram)),
+		Sub:      make([]*planNode, len(plan.Sub)),
+	}
+	for idx, t := range plan.Trigram {
+		n.Trigrams[idx] = trigramCount{t.Trigram, t.Count}
+	}
+	if plan.Op == pb.QueryPlan_AND {
+		sort.Stable(byCount(n.Trigrams))
+	}
+	for idx, sub := range plan.Sub {
+		n.Sub[idx] = newPlanNode(sub)
+	}
+	return n
+}
+
+// shardExplanation is the query plan of a single source backend (and its
+// index backend).
+type shardExplanation struct {
+	Backend string
+
+	// Error is set if the backend was skipped or could not be queried.
+	Error string `json:",omitempty"`
+
+	TrigramQuery string
+	Plan         *planNode
+	Candidates   uint64
+	Segments     uint32
+}
+
+type explanation struct {
+	// Query is the query as entered by the user.
+	Query string
+
+	// Regexp is the rewritten query (see search.RewriteQuery) which is sent
+	// to the backends.
+	Regexp string
+
+	// Candidates is the number of files (summed over all shards) which need
+	// to be searched, i.e. which contain all the required trigrams.
+	Candidates uint64
+
+	Shards []shardExplanation
+}
+
+// ExplainHandler shows the trigram query of the q parameter together with the
+// number of files containing each trigram and the resulting number of
+// candidate files, per shard. This helps finding out why a query is slow.
+// /explain.json returns the same information as JSON.
+func ExplainHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	if q == "" {
+		http.Error(w, "Empty query", http.StatusNotFound)
+		return
+	}
+	encoded := "?" + url.Values{"q": []string{q}}.Encode()
+	if err := validateQuery(encoded); err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fakeUrl, err := url.Parse(encoded)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rewritten := search.RewriteQuery(*fakeUrl)
+	req := &pb.ExplainRequest{Query: rewritten.Query().Get("q")}
+
+	exp := explanation{
+		Query:  q,
+		Regexp: req.Query,
+		Shards: make([]shardExplanation, len(common.SourceBackendStubs)),
+	}
+	var wg sync.WaitGroup
+	for idx, backend := range common.SourceBackendStubs {
+		shard := &exp.Shards[idx]
+		shard.Backend = common.SourceBackendAddrs[idx]
+		if health.IsKnownUnhealthy(health.SourceBackendService(idx)) ||
+			health.IsKnownUnhealthy(health.IndexBackendService(idx)) {
+			shard.Error = "skipped: backend is unhealthy"
+			continue
+		}
+		wg.Add(1)
+		go func(backend pb.SourceBackendClient, shard *shardExplanation) {
+			defer wg.Done()
+			reply, err := backend.Explain(r.Context(), req)
+			if err != nil {
+				log.Printf("[%s] explain failed: %v\n", shard.Backend, err)
+				shard.Error = err.Error()
+				return
+			}
+			shard.TrigramQuery = reply.TrigramQuery
+			shard.Plan = newPlanNode(reply.Plan)
+			shard.Candidates = reply.Candidates
+			shard.Segments = reply.Segments
+		}(backend, shard)
+	}
+	wg.Wait()
+	for _, shard := range exp.Shards {
+		exp.Candidates += shard.Candidates
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&exp); err != nil {
+			log.Printf("Could not encode explanation: %v\n", err)
+		}
+		return
+	}
+
+	if err := common.Templates.ExecuteTemplate(w, "explain.html", map[string]interface{}{
+		"q":           q,
+		"explanation": exp,
+		"version":     common.Version,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
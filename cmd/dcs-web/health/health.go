@@ -1,8 +1,9 @@
 // vim:ts=4:sw=4:noexpandtab
 
-// Health checking for sources.debian.net (and potentially other services in
-// the future), so that we can reliably redirect to the service when it is
-// available and fall back to our own /show if not.
+// Health checking for sources.debian.net and for our own source and index
+// backends, so that we can reliably redirect to the service when it is
+// available and fall back to our own /show if not, and so that queries skip
+// backends which are known to be down instead of failing half-way through.
 package health
 
 import (
@@ -10,27 +11,91 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-var status = make(chan healthRequest)
+var (
+	status    = make(chan healthRequest)
+	statusAll = make(chan chan []healthUpdate)
+
+	serviceHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_healthy",
+			Help: "Whether the most recent health check of a service succeeded (1) or not (0).",
+		},
+		[]string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(serviceHealthy)
+}
 
 type healthRequest struct {
 	service  string
-	response chan bool
+	response chan healthUpdate
 }
 
 type healthUpdate struct {
 	service string
 	healthy bool
+
+	// checked is the time at which the health check was done. It is zero
+	// for services which have not been checked yet.
+	checked time.Time
+
+	// message explains why the service is unhealthy, if it is.
+	message string
 }
 
-func periodically(checkFunc func() healthUpdate, updates chan healthUpdate) {
+func periodically(checkFunc func() healthUpdate, interval time.Duration, updates chan healthUpdate) {
 	for {
-		updates <- checkFunc()
-		time.Sleep(30 * time.Second)
+		update := checkFunc()
+		update.checked = time.Now()
+		updates <- update
+		time.Sleep(interval)
+	}
+}
+
+// SourceBackendService returns the name under which the source backend with
+// the given index (into common.SourceBackendStubs) is health-checked.
+func SourceBackendService(idx int) string {
+	return "source-backend/" + common.SourceBackendAddrs[idx]
+}
+
+// IndexBackendService returns the name under which the index backend used by
+// the source backend with the given index is health-checked.
+func IndexBackendService(idx int) string {
+	return "index-backend/" + common.SourceBackendAddrs[idx]
+}
+
+// checkBackend returns a function which health-checks grpcService on the
+// source backend behind client. Source backends report the health of their
+// index backend as the “proto.IndexBackend” service, because dcs-web cannot
+// reach index backends directly.
+func checkBackend(service, grpcService string, client healthpb.HealthClient) func() healthUpdate {
+	return func() (update healthUpdate) {
+		update.service = service
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: grpcService})
+		if err != nil {
+			log.Printf("health check: %s: %v\n", service, err)
+			update.message = err.Error()
+			return
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			log.Printf("health check: %s is %v\n", service, resp.Status)
+			update.message = resp.Status.String()
+			return
+		}
+		update.healthy = true
+		return
 	}
 }
 
@@ -56,6 +121,7 @@ func checkSDN() (update healthUpdate) {
 	req, err := http.NewRequest("GET", "https://sources.debian.org/api/ping/", nil)
 	if err != nil {
 		log.Printf("health check: could not create request: %v\n", err)
+		update.message = err.Error()
 		return
 	}
 	// We are not going to use Keep-Alive, so be upfront about it to the server.
@@ -63,11 +129,13 @@ func checkSDN() (update healthUpdate) {
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("health check: sources.debian.org did not answer to HTTP\n")
+		update.message = err.Error()
 		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		log.Printf("health check: sources.debian.org returned code %d\n", resp.StatusCode)
+		update.message = resp.Status
 		return
 	}
 	type sdnStatus struct {
@@ -77,18 +145,20 @@ func checkSDN() (update healthUpdate) {
 	decoder := json.NewDecoder(resp.Body)
 	if err := decoder.Decode(&status); err != nil {
 		log.Printf("health check: sources.debian.org returned invalid JSON: %v\n", err)
+		update.message = err.Error()
 		return
 	}
 	if status.Status != "ok" {
 		log.Printf("health check: sources.debian.org returned status == false\n")
+		update.message = "status is " + status.Status
 		return
 	}
 	update.healthy = true
 	return
 }
 
-func IsHealthy(service string) bool {
-	response := make(chan bool)
+func lookup(service string) healthUpdate {
+	response := make(chan healthUpdate)
 	request := healthRequest{
 		service:  service,
 		response: response}
@@ -96,27 +166,112 @@ func IsHealthy(service string) bool {
 	return <-response
 }
 
+func IsHealthy(service string) bool {
+	return lookup(service).healthy
+}
+
+// IsKnownUnhealthy returns true if service was health-checked at least once
+// and the most recent check failed. Services which were not checked yet are
+// optimistically assumed to be healthy.
+func IsKnownUnhealthy(service string) bool {
+	update := lookup(service)
+	return !update.checked.IsZero() && !update.healthy
+}
+
 // Internally, this just starts a go routine per service that should be health-checked.
 func StartChecking() {
 	updates := make(chan healthUpdate)
 
 	if *common.UseSourcesDebianNet {
-		go periodically(checkSDN, updates)
+		go periodically(checkSDN, 30*time.Second, updates)
+	}
+
+	for idx, client := range common.SourceBackendHealthStubs {
+		go periodically(checkBackend(SourceBackendService(idx), "proto.SourceBackend", client), 10*time.Second, updates)
+		go periodically(checkBackend(IndexBackendService(idx), "proto.IndexBackend", client), 10*time.Second, updates)
 	}
 
-	// Take updates and respond to health status requests in a single
-	// goroutine. It is not safe to write/read to a map from multiple go
-	// routines at the same time.
-	go func() {
-		health := make(map[string]bool)
-
-		for {
-			select {
-			case update := <-updates:
-				health[update.service] = update.healthy
-			case request := <-status:
-				request.response <- health[request.service]
+	go serve(updates)
+}
+
+// serve takes updates and responds to health status requests in a single
+// goroutine. It is not safe to write/read to a map from multiple go routines
+// at the same time.
+func serve(updates chan healthUpdate) {
+	health := make(map[string]healthUpdate)
+
+	for {
+		select {
+		case update := <-updates:
+			health[update.service] = update
+			if update.healthy {
+				serviceHealthy.WithLabelValues(update.service).Set(1)
+			} else {
+				serviceHealthy.WithLabelValues(update.service).Set(0)
+			}
+		case request := <-status:
+			request.response <- health[request.service]
+		case response := <-statusAll:
+			all := make([]healthUpdate, 0, len(health))
+			for _, update := range health {
+				all = append(all, update)
 			}
+			response <- all
+		}
+	}
+}
+
+type serviceStatus struct {
+	Service string
+	Healthy bool
+	Checked time.Time
+	Message string
+}
+
+type byService []serviceStatus
+
+func (s byService) Len() int {
+	return len(s)
+}
+
+func (s byService) Less(i, j int) bool {
+	return s[i].Service < s[j].Service
+}
+
+func (s byService) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// Healthz serves a page listing the health status of all checked services.
+// It responds with HTTP status 503 if any of them is unhealthy.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	response := make(chan []healthUpdate)
+	statusAll <- response
+	updates := <-response
+
+	services := make([]serviceStatus, len(updates))
+	allHealthy := true
+	for idx, update := range updates {
+		services[idx] = serviceStatus{
+			Service: update.service,
+			Healthy: update.healthy,
+			Checked: update.checked,
+			Message: update.message,
+		}
+		if !update.healthy {
+			allHealthy = false
 		}
-	}()
+	}
+	sort.Sort(byService(services))
+
+	if !allHealthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := common.Templates.ExecuteTemplate(w, "healthz.html", map[string]interface{}{
+		"services": services,
+		"healthy":  allHealthy,
+		"version":  common.Version,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,99 @@
+// vim:ts=4:sw=4:noexpandtab
+package health
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// fakeHealthClient answers health checks with a fixed status or error, like a
+// source backend reporting the health of itself and of its index backend.
+type fakeHealthClient struct {
+	status healthpb.HealthCheckResponse_ServingStatus
+	err    error
+
+	// checked is the service name of the most recent health check.
+	checked string
+}
+
+func (f *fakeHealthClient) Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	f.checked = in.Service
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &healthpb.HealthCheckResponse{Status: f.status}, nil
+}
+
+var (
+	// serve answers the requests of all tests via the package-level status
+	// channels, so it is only started once, even with -count.
+	updates   = make(chan healthUpdate)
+	serveOnce sync.Once
+)
+
+func TestBackendHealth(t *testing.T) {
+	serveOnce.Do(func() { go serve(updates) })
+
+	for _, tt := range []struct {
+		service        string
+		client         *fakeHealthClient
+		wantHealthy    bool
+		wantUnhealthy  bool
+		wantMessageSet bool
+	}{
+		{
+			service:     "source-backend/a:28082",
+			client:      &fakeHealthClient{status: healthpb.HealthCheckResponse_SERVING},
+			wantHealthy: true,
+		},
+		{
+			service:        "index-backend/a:28082",
+			client:         &fakeHealthClient{status: healthpb.HealthCheckResponse_NOT_SERVING},
+			wantUnhealthy:  true,
+			wantMessageSet: true,
+		},
+		{
+			service:        "source-backend/b:28082",
+			client:         &fakeHealthClient{err: errors.New("connection refused")},
+			wantUnhealthy:  true,
+			wantMessageSet: true,
+		},
+		// Services which were not checked yet are not known to be unhealthy.
+		{
+			service: "index-backend/b:28082",
+		},
+	} {
+		if tt.client != nil {
+			update := checkBackend(tt.service, "proto.IndexBackend", tt.client)()
+			if got, want := tt.client.checked, "proto.IndexBackend"; got != want {
+				t.Errorf("%s: checked service %q, want %q", tt.service, got, want)
+			}
+			if got := update.message != ""; got != tt.wantMessageSet {
+				t.Errorf("%s: message = %q, want message set = %v", tt.service, update.message, tt.wantMessageSet)
+			}
+			update.checked = time.Now()
+			updates <- update
+		}
+		if got := IsHealthy(tt.service); got != tt.wantHealthy {
+			t.Errorf("IsHealthy(%q) = %v, want %v", tt.service, got, tt.wantHealthy)
+		}
+		if got := IsKnownUnhealthy(tt.service); got != tt.wantUnhealthy {
+			t.Errorf("IsKnownUnhealthy(%q) = %v, want %v", tt.service, got, tt.wantUnhealthy)
+		}
+	}
+
+	// A backend which recovers is no longer known to be unhealthy.
+	service := "index-backend/a:28082"
+	update := checkBackend(service, "proto.IndexBackend", &fakeHealthClient{status: healthpb.HealthCheckResponse_SERVING})()
+	update.checked = time.Now()
+	updates <- update
+	if IsKnownUnhealthy(service) {
+		t.Errorf("IsKnownUnhealthy(%q) = true after a successful check, want false", service)
+	}
+}
@@ -22,9 +22,11 @@ import (
 	"time"
 
 	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/cmd/dcs-web/health"
 	"github.com/Debian/dcs/cmd/dcs-web/search"
 	"github.com/Debian/dcs/dpkgversion"
 	pb "github.com/Debian/dcs/proto"
+	"github.com/Debian/dcs/ranking"
 	"github.com/Debian/dcs/stringpool"
 	"github.com/golang/protobuf/proto"
 	opentracing "github.com/opentracing/opentracing-go"
@@ -57,6 +59,10 @@ var (
 	headroomPercentage = flag.Float64("headroom_percentage",
 		0.2,
 		"How much space should be kept free on the file system containing -query_results_path in order to be able to write query state. Default: 0.2, i.e. 20% of the total space should be kept free. Set to 0 to disable")
+
+	// isKnownUnhealthy reports whether a backend service is known to be down,
+	// see health.IsKnownUnhealthy. It is replaced in tests.
+	isKnownUnhealthy = health.IsKnownUnhealthy
 )
 
 const (
@@ -78,6 +84,41 @@ type Error struct {
 	ErrorType string
 }
 
+// Coverage is sent when some backends were skipped because they are known to
+// be unhealthy, i.e. the results will not cover the entire archive.
+type Coverage struct {
+	// This is set to “coverage” to distinguish the message type on the client.
+	Type string
+
+	BackendsQueried int
+	BackendsTotal   int
+}
+
+// BudgetExceeded is sent when a source backend aborted searching a file of a
+// pcre: query because verifying its matches exceeded the step or time budget.
+type BudgetExceeded struct {
+	// This is set to “budgetexceeded” to distinguish the message type on the
+	// client.
+	Type string
+
+	Path   string
+	Reason string
+}
+
+// Ranking is sent at the beginning of a query and describes the ranking
+// profile (see ranking.ParseRank) which the results are ranked with.
+type Ranking struct {
+	// This is set to “ranking” to distinguish the message type on the client.
+	Type string
+
+	Profile string
+
+	// Overridden is true when the query overrides weights of Profile.
+	Overridden bool
+
+	Weights ranking.Model
+}
+
 type ProgressUpdate struct {
 	Type           string
 	QueryId        string
@@ -127,6 +168,18 @@ type resultPointer struct {
 
 	// Used for per-package results. Points into a stringpool.StringPool
 	packageName *string
+
+	// Identifies results with identical file contents and line (dedup:yes
+	// queries only, zero otherwise).
+	dedupKey uint64
+
+	// Path of the result and of all files with identical contents, as sent by
+	// the source backend. Only set when dedupKey is set.
+	paths []string
+
+	// Paths of results from other source backends which were collapsed into
+	// this result, see collapseDuplicates.
+	merged []string
 }
 
 type pointerByRanking []resultPointer
@@ -184,6 +237,15 @@ type queryState struct {
 	allPackagesSorted []string
 
 	FirstPathRank float32
+
+	// rankingProfile and rankingModel are the ranking profile selected by the
+	// query’s rank: keyword and its weights, including overrides.
+	rankingProfile string
+	rankingModel   ranking.Model
+
+	// dedupKeys of the results which were sent to the client(s) as top 10
+	// results, so that identical results are sent only once.
+	dedupSent map[uint64]bool
 }
 
 func (qs *queryState) numResults() int {
@@ -246,21 +308,21 @@ func queryBackend(ctx context.Context, queryid, src string, backend pb.SourceBac
 	for !done {
 		msg, err := stream.Recv()
 		if err == io.EOF {
-			log.Printf("[%s] [src:%s] EOF\n", queryid, src, backend)
+			log.Printf("[%s] [src:%s] EOF\n", queryid, src)
 			return
 		}
 		if err != nil {
-			log.Printf("[%s] [src:%s] Error decoding result stream: %v\n", queryid, src, backend, err)
+			log.Printf("[%s] [src:%s] Error decoding result stream: %v\n", queryid, src, err)
 			return
 		}
 
 		buf.Reset()
 		if err := buf.Marshal(msg); err != nil {
-			log.Printf("[%s] [src:%s] Error encoding proto: %v\n", queryid, src, backend, err)
+			log.Printf("[%s] [src:%s] Error encoding proto: %v\n", queryid, src, err)
 			return
 		}
 		if _, err := tempFileWriter.Write(buf.Bytes()); err != nil {
-			log.Printf("[%s] [src:%s] Error writing proto: %v\n", queryid, src, backend, err)
+			log.Printf("[%s] [src:%s] Error writing proto: %v\n", queryid, src, err)
 			return
 		}
 
@@ -270,6 +332,12 @@ func queryBackend(ctx context.Context, queryid, src string, backend pb.SourceBac
 		case pb.SearchReply_PROGRESS_UPDATE:
 			storeProgress(queryid, backendidx, msg.ProgressUpdate)
 			orderlyFinished = msg.ProgressUpdate.FilesProcessed == msg.ProgressUpdate.FilesTotal
+		case pb.SearchReply_BUDGET_EXCEEDED:
+			addEventMarshal(queryid, &BudgetExceeded{
+				Type:   "budgetexceeded",
+				Path:   msg.BudgetExceeded.Path,
+				Reason: msg.BudgetExceeded.Reason,
+			})
 		}
 
 		bstate.tempFileOffset += int64(len(buf.Bytes()))
@@ -289,7 +357,7 @@ func queryBackend(ctx context.Context, queryid, src string, backend pb.SourceBac
 		// stream as well.
 		cancelfunc()
 	}
-	log.Printf("[%s] [src:%s] query done, disconnecting\n", queryid, src, backend)
+	log.Printf("[%s] [src:%s] query done, disconnecting\n", queryid, src)
 }
 
 // queryExistsLocked returns whether state for the query exists and whether
@@ -367,6 +435,7 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 		filesMu:        &sync.Mutex{},
 		perBackend:     make([]*perBackendState, len(common.SourceBackendStubs)),
 		tempFilesMu:    &sync.Mutex{},
+		dedupSent:      make(map[uint64]bool),
 	}
 
 	dir := filepath.Join(*queryResultsPath, queryid)
@@ -378,8 +447,30 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 	// in the code below (and above), but for that we need to carefully test it.
 	ensureEnoughSpaceAvailable()
 
+	// Skip backends which are known to be down up front: querying them would
+	// only fail half-way through the query.
+	skip := make([]bool, len(common.SourceBackendStubs))
+	queried := 0
+	for i := 0; i < len(common.SourceBackendStubs); i++ {
+		if isKnownUnhealthy(health.SourceBackendService(i)) ||
+			isKnownUnhealthy(health.IndexBackendService(i)) {
+			log.Printf("[%s] skipping unhealthy backend %s\n", queryid, common.SourceBackendAddrs[i])
+			skip[i] = true
+			continue
+		}
+		queried++
+	}
+	if queried == 0 {
+		return false, fmt.Errorf("no healthy backends available")
+	}
+
 	for i := 0; i < len(common.SourceBackendStubs); i++ {
 		querystate.filesTotal[i] = -1
+		if skip[i] {
+			// Skipped backends count as done, so that the query finishes once
+			// all other backends are done.
+			querystate.filesTotal[i] = 0
+		}
 		path := filepath.Join(dir, fmt.Sprintf("unsorted_%d.pb", i))
 		f, err := os.Create(path)
 		if err != nil {
@@ -400,6 +491,9 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 		log.Fatal(err)
 	}
 	rewritten := search.RewriteQuery(*fakeUrl)
+	rankingopts := ranking.RankingOptsFromQuery(rewritten.Query())
+	querystate.rankingProfile = rankingopts.Profile
+	querystate.rankingModel = rankingopts.Model
 	searchRequest := &pb.SearchRequest{
 		Query:        rewritten.Query().Get("q"),
 		RewrittenUrl: rewritten.String(),
@@ -409,7 +503,24 @@ func maybeStartQuery(ctx context.Context, queryid, src, query string) (bool, err
 		// Another goroutine must have raced us since we called queryExists().
 		return true, nil
 	}
+	profileModel, _ := ranking.LookupProfile(rankingopts.Profile)
+	addEventMarshal(queryid, &Ranking{
+		Type:       "ranking",
+		Profile:    rankingopts.Profile,
+		Overridden: rankingopts.Model != profileModel,
+		Weights:    rankingopts.Model,
+	})
+	if queried < len(common.SourceBackendStubs) {
+		addEventMarshal(queryid, &Coverage{
+			Type:            "coverage",
+			BackendsQueried: queried,
+			BackendsTotal:   len(common.SourceBackendStubs),
+		})
+	}
 	for idx, backend := range common.SourceBackendStubs {
+		if skip[idx] {
+			continue
+		}
 		go queryBackend(ctx, queryid, src, backend, idx, searchRequest)
 	}
 	return false, nil
@@ -517,15 +628,17 @@ func storeResult(queryid string, backendidx int, result *pb.Match, resultLen int
 	s := state[queryid]
 	stateMu.RUnlock()
 
+	postrank := result.Ranking
 	if s.FirstPathRank > 0 {
 		// Now store the combined ranking of PathRanking (pre) and Ranking (post).
 		// We add the values because they are both percentages.
 		// To make the Ranking (post) less significant, we multiply it with
-		// 1/10 * FirstPathRank. We used to use maxPathRanking here, but
+		// 1/10 * FirstPathRank (by default, see ranking.Model.Postrank). We
+		// used to use maxPathRanking here, but
 		// requiring that means delaying the search until all results are
 		// there. Instead, FirstPathRank is a good enough approximation (but
 		// different enough for each query that we can’t hardcode it).
-		result.Ranking = result.Pathrank + ((s.FirstPathRank * 0.1) * result.Ranking)
+		result.Ranking = result.Pathrank + ((s.FirstPathRank * s.rankingModel.Postrank) * result.Ranking)
 	} else {
 		// This code path (and lock acquisition) gets executed only on the
 		// first result.
@@ -539,12 +652,27 @@ func storeResult(queryid string, backendidx int, result *pb.Match, resultLen int
 	h := fnv.New64()
 	io.WriteString(h, result.Path)
 
+	var dedupKey uint64
+	var paths []string
+	if result.ContentHash != "" {
+		dh := fnv.New64()
+		fmt.Fprintf(dh, "%s:%d", result.ContentHash, result.Line)
+		dedupKey = dh.Sum64()
+		paths = append([]string{result.Path}, result.Duplicates...)
+	}
+
 	if result.Ranking > s.results[9].ranking {
 		stateMu.Lock()
 		s = state[queryid]
 		if result.Ranking <= s.results[9].ranking {
 			stateMu.Unlock()
+		} else if dedupKey != 0 && s.dedupSent[dedupKey] {
+			// An identical result was already sent.
+			stateMu.Unlock()
 		} else {
+			if dedupKey != 0 {
+				s.dedupSent[dedupKey] = true
+			}
 			// TODO: find the first s.result[] for the same package. then check again if the result is worthy of replacing that per-package result
 			// TODO: probably change the data structure so that we can do this more easily and also keep N results per package.
 
@@ -557,6 +685,10 @@ func storeResult(queryid string, backendidx int, result *pb.Match, resultLen int
 			state[queryid] = s
 			stateMu.Unlock()
 
+			if rankingLog != nil {
+				logImpression(impression(s, result, postrank))
+			}
+
 			// The result entered the top 10, so send it to the client(s) for
 			// immediate display.
 			// TODO: make this satisfy obsoletableEvent in order to skip
@@ -577,10 +709,34 @@ func storeResult(queryid string, backendidx int, result *pb.Match, resultLen int
 		offset:      bstate.tempFileOffset,
 		length:      resultLen,
 		pathHash:    h.Sum64(),
-		packageName: bstate.packagePool.Get(result.Package)})
+		packageName: bstate.packagePool.Get(result.Package),
+		dedupKey:    dedupKey,
+		paths:       paths})
 	bstate.allPackages[result.Package] = true
 }
 
+// impression returns the ranking log entry for result of the query s.
+func impression(s queryState, result *pb.Match, postrank float32) *ranking.Impression {
+	values, _ := url.ParseQuery(s.query)
+	imp := &ranking.Impression{
+		Searchterm: values.Get("q"),
+		Path:       result.Path,
+		Line:       strconv.Itoa(int(result.Line)),
+		Ranking:    result.Ranking,
+		Features: ranking.Features{
+			Postrank:      postrank,
+			FirstPathrank: s.FirstPathRank,
+		},
+	}
+	if f := result.Features; f != nil {
+		imp.Features.Inst = f.Inst
+		imp.Features.Rdep = f.Rdep
+		imp.Features.Pathmatch = f.Pathmatch
+		imp.Features.Sourcepkgmatch = f.Sourcepkgmatch
+	}
+	return imp
+}
+
 func failQuery(queryid string) {
 	failedQueries.Inc()
 	addEventMarshal(queryid, &Error{
@@ -703,6 +859,7 @@ func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) er
 		// the dcs-source-backend in queryBackend(), but then modify the
 		// ranking in storeResult().
 		match.Ranking = match.Pathrank + ((firstPathRank * 0.1) * match.Ranking)
+		match.Duplicates = append(match.Duplicates, pointer.merged...)
 		if err := WriteMatchJSON(match, f); err != nil {
 			return err
 		}
@@ -713,6 +870,28 @@ func writeFromPointers(queryid string, f io.Writer, pointers []resultPointer) er
 	return nil
 }
 
+// collapseDuplicates returns pointers without results whose dedupKey equals
+// the dedupKey of a better-ranked result. The paths of the dropped results are
+// merged into the remaining result. Source backends only deduplicate the files
+// they store, whereas this collapses identical results across source backends.
+func collapseDuplicates(pointers []resultPointer) []resultPointer {
+	collapsed := make([]resultPointer, 0, len(pointers))
+	kept := make(map[uint64]int)
+	for _, pointer := range pointers {
+		if pointer.dedupKey == 0 {
+			collapsed = append(collapsed, pointer)
+			continue
+		}
+		if idx, ok := kept[pointer.dedupKey]; ok {
+			collapsed[idx].merged = append(collapsed[idx].merged, pointer.paths...)
+			continue
+		}
+		kept[pointer.dedupKey] = len(collapsed)
+		collapsed = append(collapsed, pointer)
+	}
+	return collapsed
+}
+
 func writeToDisk(queryid string) error {
 	// Get the slice with results and unset it on the state so that processing can continue.
 	stateMu.Lock()
@@ -770,7 +949,11 @@ func writeToDisk(queryid string) error {
 	// in the code below (and above), but for that we need to carefully test it.
 	ensureEnoughSpaceAvailable()
 
-	pages := int(math.Ceil(float64(len(pointers)) / float64(resultsPerPage)))
+	// Per-package results are not collapsed: each package should list its
+	// results, regardless of whether other packages contain the same file.
+	ranked := collapseDuplicates(pointers)
+
+	pages := int(math.Ceil(float64(len(ranked)) / float64(resultsPerPage)))
 
 	// Now save the results into their package-specific files.
 	byPkgSortingStarted := time.Now()
@@ -794,7 +977,7 @@ func writeToDisk(queryid string) error {
 
 	stateMu.Lock()
 	s = state[queryid]
-	s.resultPointers = pointers
+	s.resultPointers = ranked
 	s.resultPointersByPkg = bypkg
 	s.resultPages = pages
 	state[queryid] = s
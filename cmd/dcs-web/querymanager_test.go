@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/cmd/dcs-web/health"
+	pb "github.com/Debian/dcs/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// searchLog records which fake backends were queried.
+type searchLog struct {
+	mu       sync.Mutex
+	searched []int
+}
+
+// fakeBackend is a source backend whose searches fail right away, which
+// finishes the query as soon as all queried backends were tried.
+type fakeBackend struct {
+	pb.SourceBackendClient
+
+	idx int
+	log *searchLog
+}
+
+func (f *fakeBackend) Search(ctx context.Context, in *pb.SearchRequest, opts ...grpc.CallOption) (pb.SourceBackend_SearchClient, error) {
+	f.log.mu.Lock()
+	defer f.log.mu.Unlock()
+	f.log.searched = append(f.log.searched, f.idx)
+	return nil, errors.New("fake backend: not implemented")
+}
+
+// waitDone blocks until the query with the given queryid is done and returns
+// its coverage event, if any.
+func waitDone(queryid string) *Coverage {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for !state[queryid].done {
+		state[queryid].newEvent.Wait()
+	}
+	for _, e := range state[queryid].events {
+		var c Coverage
+		if err := json.Unmarshal(e.data, &c); err != nil || c.Type != "coverage" {
+			continue
+		}
+		return &c
+	}
+	return nil
+}
+
+func TestMaybeStartQuerySkipsUnhealthy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcs-web-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldPath, oldHeadroom := *queryResultsPath, *headroomPercentage
+	oldStubs, oldAddrs := common.SourceBackendStubs, common.SourceBackendAddrs
+	oldUnhealthy := isKnownUnhealthy
+	defer func() {
+		*queryResultsPath, *headroomPercentage = oldPath, oldHeadroom
+		common.SourceBackendStubs, common.SourceBackendAddrs = oldStubs, oldAddrs
+		isKnownUnhealthy = oldUnhealthy
+	}()
+	*queryResultsPath = dir
+	*headroomPercentage = 0
+	common.SourceBackendAddrs = []string{"a:28082", "b:28082", "c:28082"}
+
+	for idx, tt := range []struct {
+		unhealthy []string
+		// wantSearched are the indexes of the queried backends, nil if
+		// the query should fail.
+		wantSearched []int
+		wantCoverage *Coverage
+	}{
+		{
+			wantSearched: []int{0, 1, 2},
+		},
+		{
+			unhealthy:    []string{health.SourceBackendService(1)},
+			wantSearched: []int{0, 2},
+			wantCoverage: &Coverage{Type: "coverage", BackendsQueried: 2, BackendsTotal: 3},
+		},
+		// A source backend whose index backend is down is skipped, too.
+		{
+			unhealthy:    []string{health.IndexBackendService(2)},
+			wantSearched: []int{0, 1},
+			wantCoverage: &Coverage{Type: "coverage", BackendsQueried: 2, BackendsTotal: 3},
+		},
+		{
+			unhealthy: []string{
+				health.SourceBackendService(0),
+				health.IndexBackendService(1),
+				health.SourceBackendService(2),
+			},
+		},
+	} {
+		unhealthy := make(map[string]bool)
+		for _, service := range tt.unhealthy {
+			unhealthy[service] = true
+		}
+		isKnownUnhealthy = func(service string) bool {
+			return unhealthy[service]
+		}
+		searches := &searchLog{}
+		common.SourceBackendStubs = make([]pb.SourceBackendClient, len(common.SourceBackendAddrs))
+		for i := range common.SourceBackendStubs {
+			common.SourceBackendStubs[i] = &fakeBackend{idx: i, log: searches}
+		}
+
+		queryid := fmt.Sprintf("test%d", idx)
+		existed, err := maybeStartQuery(context.Background(), queryid, "test", "q=foo")
+		if tt.wantSearched == nil {
+			if err == nil {
+				t.Errorf("unhealthy %v: maybeStartQuery unexpectedly succeeded", tt.unhealthy)
+			}
+			continue
+		}
+		if err != nil || existed {
+			t.Fatalf("unhealthy %v: maybeStartQuery = %v, %v, want false, nil", tt.unhealthy, existed, err)
+		}
+		coverage := waitDone(queryid)
+		searches.mu.Lock()
+		searched := searches.searched
+		searches.mu.Unlock()
+		sort.Ints(searched)
+		if !reflect.DeepEqual(searched, tt.wantSearched) {
+			t.Errorf("unhealthy %v: searched backends %v, want %v", tt.unhealthy, searched, tt.wantSearched)
+		}
+		if !reflect.DeepEqual(coverage, tt.wantCoverage) {
+			t.Errorf("unhealthy %v: coverage = %+v, want %+v", tt.unhealthy, coverage, tt.wantCoverage)
+		}
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for queryid, s := range state {
+		for _, bstate := range s.perBackend {
+			bstate.tempFile.Close()
+		}
+		delete(state, queryid)
+	}
+}
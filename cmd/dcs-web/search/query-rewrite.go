@@ -7,9 +7,11 @@ import (
 	"strings"
 )
 
+// Keywords are either “type:value” or one of the flags (currently only
+// -vendored), which have no value.
 var (
-	start = regexp.MustCompile(`(?i)^\s*(-?(?:filetype|package|pkg|path|file)):(\S+)\s+`)
-	end   = regexp.MustCompile(`(?i)\s+(-?(?:filetype|package|pkg|path|file)):(\S+)\s*$`)
+	start = regexp.MustCompile(`(?i)^\s*(?:(-?(?:filetype|package|pkg|path|file|dedup|rank|in)):(\S+)|(-vendored))\s+`)
+	end   = regexp.MustCompile(`(?i)\s+(?:(-?(?:filetype|package|pkg|path|file|dedup|rank|in)):(\S+)|(-vendored))\s*$`)
 )
 
 func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
@@ -20,9 +22,14 @@ func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
 	// extra hit for regexp is acceptable, given the simpler code.
 	matches := filtersRe.FindStringSubmatch(qstr)
 	for matches != nil {
-		// matches is [entire_match, filter_name, filter_value]
+		// matches is [entire_match, filter_name, filter_value, flag]
 		filter := strings.ToLower(matches[1])
 		value := matches[2]
+		if matches[3] != "" {
+			// -vendored becomes nvendored=1.
+			filter = strings.ToLower(matches[3])
+			value = "1"
+		}
 
 		filter = strings.Replace(filter, "pkg", "package", 1)
 		if filter == "-file" {
@@ -30,7 +37,7 @@ func rewriteFilters(query url.Values, filtersRe *regexp.Regexp) url.Values {
 		} else if strings.HasPrefix(filter, "-") {
 			filter = "n" + filter[1:]
 		}
-		if strings.HasSuffix(filter, "filetype") {
+		if strings.HasSuffix(filter, "filetype") || filter == "dedup" || filter == "in" || filter == "nin" {
 			value = strings.ToLower(value)
 		}
 		query.Add(filter, value)
@@ -140,6 +140,51 @@ func TestRewriteQuery(t *testing.T) {
 		t.Fatalf("Expected filetype %q, got %q", "c", filetype)
 	}
 
+	// Verify that the dedup: keyword is recognized (case-insensitively)
+	rewritten = rewrite(t, "/search?q=searchterm+dedup%3AYes")
+	querystr = rewritten.Query().Get("q")
+	if querystr != "searchterm" {
+		t.Fatalf("Expected search query %q, got %q", "searchterm", querystr)
+	}
+	dedup := rewritten.Query().Get("dedup")
+	if dedup != "yes" {
+		t.Fatalf("Expected dedup %q, got %q", "yes", dedup)
+	}
+
+	// Verify that the rank: keyword is recognized, with profile and overrides
+	rewritten = rewrite(t, "/search?q=rank%3Aprecise%2Cscope%3D0+searchterm")
+	querystr = rewritten.Query().Get("q")
+	if querystr != "searchterm" {
+		t.Fatalf("Expected search query %q, got %q", "searchterm", querystr)
+	}
+	rank := rewritten.Query().Get("rank")
+	if rank != "precise,scope=0" {
+		t.Fatalf("Expected rank %q, got %q", "precise,scope=0", rank)
+	}
+
+	// Verify that the in: keyword and the -vendored flag are recognized
+	rewritten = rewrite(t, "/search?q=in%3ACode+searchterm+-in%3Acomments+-vendored")
+	querystr = rewritten.Query().Get("q")
+	if querystr != "searchterm" {
+		t.Fatalf("Expected search query %q, got %q", "searchterm", querystr)
+	}
+	if in := rewritten.Query().Get("in"); in != "code" {
+		t.Fatalf("Expected in %q, got %q", "code", in)
+	}
+	if nin := rewritten.Query().Get("nin"); nin != "comments" {
+		t.Fatalf("Expected nin %q, got %q", "comments", nin)
+	}
+	if nvendored := rewritten.Query().Get("nvendored"); nvendored != "1" {
+		t.Fatalf("Expected nvendored %q, got %q", "1", nvendored)
+	}
+
+	// Verify that -vendored is only a flag as a separate word
+	rewritten = rewrite(t, "/search?q=searchterm+foo-vendored")
+	querystr = rewritten.Query().Get("q")
+	if querystr != "searchterm foo-vendored" {
+		t.Fatalf("Expected search query %q, got %q", "searchterm foo-vendored", querystr)
+	}
+
 	// Verify that accessing the map for a keyword that doesn't exist doesn't cause iterations
 	rewritten = rewrite(t, "/search?q=searchterm+package%3Ai3-WM")
 	vmap := rewritten.Query()["some_array"]
@@ -35,6 +35,28 @@ type halfRenderedResult struct {
 	SourcePackage string
 	RelativePath  string
 	Context       template.HTML
+
+	// Packages containing the exact same file (dedup:yes queries only).
+	DuplicatePackages []string
+}
+
+// duplicatePackages returns the packages (e.g. “zlib_1.2.8.dfsg-1”) of paths,
+// without duplicates.
+func duplicatePackages(paths []string) []string {
+	var packages []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		pkg := path
+		if idx := strings.Index(path, "/"); idx > -1 {
+			pkg = path[:idx]
+		}
+		if seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		packages = append(packages, pkg)
+	}
+	return packages
 }
 
 func maybeAppendContext(context []string, line string) []string {
@@ -286,7 +308,10 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var results []dcsregexp.Match
+	var results []struct {
+		dcsregexp.Match
+		Duplicates []string
+	}
 	if err := json.NewDecoder(&buffer).Decode(&results); err != nil {
 		http.Error(w,
 			fmt.Sprintf("Could not parse results from disk: %v", err),
@@ -306,13 +331,14 @@ func Search(w http.ResponseWriter, r *http.Request) {
 		sourcePackage, relativePath := splitPath(result.Path)
 
 		halfrendered[idx] = halfRenderedResult{
-			Path:          result.Path,
-			Line:          result.Line,
-			PathRank:      result.PathRank,
-			Ranking:       result.Ranking,
-			SourcePackage: sourcePackage,
-			RelativePath:  relativePath,
-			Context:       template.HTML(strings.Join(context, "<br>")),
+			Path:              result.Path,
+			Line:              result.Line,
+			PathRank:          result.PathRank,
+			Ranking:           result.Ranking,
+			SourcePackage:     sourcePackage,
+			RelativePath:      relativePath,
+			Context:           template.HTML(strings.Join(context, "<br>")),
+			DuplicatePackages: duplicatePackages(result.Duplicates),
 		}
 	}
 
@@ -0,0 +1,87 @@
+// vim:ts=4:sw=4:noexpandtab
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	pb "github.com/Debian/dcs/proto"
+)
+
+// backendStats are the statistics of all shards of one index backend.
+type backendStats struct {
+	Backend string
+
+	// Error is set if the backend could not be queried.
+	Error string
+
+	Shards []shardStats
+}
+
+type shardStats struct {
+	*pb.ShardStats
+	Loaded time.Time
+}
+
+// ShardzHandler shows statistics (file and package counts, index sizes,
+// longest posting lists and load times) of all shards of all index backends.
+func ShardzHandler(w http.ResponseWriter, r *http.Request) {
+	topN := 10
+	if top := r.FormValue("top"); top != "" {
+		var err error
+		topN, err = strconv.Atoi(top)
+		if err != nil || topN < 0 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	req := &pb.StatsRequest{TopN: uint32(topN)}
+
+	backends := make([]backendStats, len(common.SourceBackendStubs))
+	var wg sync.WaitGroup
+	for idx, backend := range common.SourceBackendStubs {
+		backends[idx].Backend = common.SourceBackendAddrs[idx]
+		wg.Add(1)
+		go func(backend pb.SourceBackendClient, stats *backendStats) {
+			defer wg.Done()
+			reply, err := backend.IndexStats(r.Context(), req)
+			if err != nil {
+				log.Printf("[%s] stats failed: %v\n", stats.Backend, err)
+				stats.Error = err.Error()
+				return
+			}
+			for _, shard := range reply.Shard {
+				stats.Shards = append(stats.Shards, shardStats{
+					ShardStats: shard,
+					Loaded:     time.Unix(shard.Loaded, 0),
+				})
+			}
+		}(backend, &backends[idx])
+	}
+	wg.Wait()
+
+	var total pb.ShardStats
+	for _, backend := range backends {
+		for _, shard := range backend.Shards {
+			total.Files += shard.Files
+			total.DeletedFiles += shard.DeletedFiles
+			total.Trigrams += shard.Trigrams
+			total.SizeBytes += shard.SizeBytes
+			total.Packages += shard.Packages
+			total.Segments += shard.Segments
+		}
+	}
+
+	if err := common.Templates.ExecuteTemplate(w, "shardz.html", map[string]interface{}{
+		"backends": backends,
+		"total":    &total,
+		"version":  common.Version,
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,123 @@
+// vim:ts=4:sw=4:noexpandtab
+package show
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Debian/dcs/cmd/dcs-web/common"
+	"github.com/Debian/dcs/cmd/dcs-web/health"
+	"github.com/Debian/dcs/proto"
+	"golang.org/x/net/context"
+)
+
+type breadcrumb struct {
+	Name string
+	Path string
+}
+
+// breadcrumbs returns one breadcrumb per path component of p, e.g. “i3-wm_4.7.2-1”,
+// “i3-wm_4.7.2-1/src” and “i3-wm_4.7.2-1/src/main.c” for “i3-wm_4.7.2-1/src/main.c”.
+func breadcrumbs(p string) []breadcrumb {
+	var result []breadcrumb
+	if p == "" {
+		return result
+	}
+	components := strings.Split(p, "/")
+	for idx, component := range components {
+		result = append(result, breadcrumb{
+			Name: component,
+			Path: strings.Join(components[:idx+1], "/"),
+		})
+	}
+	return result
+}
+
+// entry is a directory entry as displayed by browse.html.
+type entry struct {
+	Name    string
+	Path    string
+	Dir     bool
+	Symlink bool
+	Size    uint64
+}
+
+type byName []*proto.DirectoryEntry
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// listPackages returns the packages of all (healthy) source backends.
+func listPackages(ctx context.Context) ([]*proto.DirectoryEntry, error) {
+	var entries []*proto.DirectoryEntry
+	for idx, stub := range common.SourceBackendStubs {
+		if health.IsKnownUnhealthy(health.SourceBackendService(idx)) {
+			log.Printf("Skipping unhealthy source backend %d\n", idx)
+			continue
+		}
+		resp, err := stub.ListDirectory(ctx, &proto.ListDirectoryRequest{})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, resp.Entries...)
+	}
+	sort.Sort(byName(entries))
+	return entries, nil
+}
+
+// Browse displays a directory of the unpacked sources, so that users can
+// navigate to sibling files or the package root without sources.debian.org.
+func Browse(w http.ResponseWriter, r *http.Request) {
+	// path.Clean turns the empty path into ".", which we use for the root.
+	dir := strings.TrimPrefix(path.Clean("/"+r.URL.Query().Get("path")), "/")
+	log.Printf("Browsing directory %q\n", dir)
+
+	var entries []*proto.DirectoryEntry
+	if dir == "" {
+		var err error
+		entries, err = listPackages(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		shard, err := sourceBackendFor(dir + "/")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := shard.ListDirectory(r.Context(), &proto.ListDirectoryRequest{
+			Path: dir,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries = resp.Entries
+	}
+
+	listing := make([]entry, len(entries))
+	for idx, e := range entries {
+		listing[idx] = entry{
+			Name:    e.Name,
+			Path:    path.Join(dir, e.Name),
+			Dir:     e.Type == proto.DirectoryEntry_DIRECTORY,
+			Symlink: e.Type == proto.DirectoryEntry_SYMLINK,
+			Size:    e.Size,
+		}
+	}
+
+	err := common.Templates.ExecuteTemplate(w, "browse.html", map[string]interface{}{
+		"version":     common.Version,
+		"dir":         dir,
+		"breadcrumbs": breadcrumbs(dir),
+		"entries":     listing,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
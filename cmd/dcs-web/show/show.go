@@ -2,10 +2,14 @@
 package show
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
 
@@ -16,6 +20,98 @@ import (
 	"golang.org/x/net/context"
 )
 
+// showContext is the number of lines around the requested line which /show
+// displays, unless the entire file is requested with full=1. This keeps /show
+// fast for huge files.
+const showContext = 1000
+
+// maxExpandContext is the maximum number of lines around a match which /context
+// returns.
+const maxExpandContext = 50
+
+// lineWindow returns the first and last line of the numContext lines around
+// line, saturating at line 1 and at the highest possible line number.
+func lineWindow(line, numContext uint64) (first, last uint32) {
+	if line > math.MaxUint32 {
+		line = math.MaxUint32
+	}
+	first = 1
+	if line > numContext {
+		first = uint32(line - numContext)
+	}
+	last = math.MaxUint32
+	if line+numContext < math.MaxUint32 {
+		last = uint32(line + numContext)
+	}
+	return first, last
+}
+
+func sourceBackendFor(filename string) (proto.SourceBackendClient, error) {
+	idx := strings.Index(filename, "/")
+	if idx == -1 {
+		return nil, fmt.Errorf("Filename does not contain a package")
+	}
+	pkg := filename[:idx]
+	return common.SourceBackendStubs[shardmapping.TaskIdxForPackage(pkg, len(common.SourceBackendStubs))], nil
+}
+
+// Context returns the lines around the given line of a file as JSON, so that
+// clients can expand the context of a search result.
+func Context(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filename := query.Get("file")
+	line, err := strconv.ParseUint(query.Get("line"), 10, 32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if line < 1 {
+		http.Error(w, "line must be at least 1", http.StatusBadRequest)
+		return
+	}
+	numContext, err := strconv.ParseUint(query.Get("context"), 10, 32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if numContext > maxExpandContext {
+		numContext = maxExpandContext
+	}
+
+	shard, err := sourceBackendFor(filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	first, last := lineWindow(line, numContext)
+	resp, err := shard.File(r.Context(), &proto.FileRequest{
+		Path:      filename,
+		FirstLine: first,
+		LastLine:  last,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// NB: Just like the context lines of search results, the lines are
+	// HTML-escaped, so that clients can insert them as-is.
+	lines := strings.Split(strings.TrimSuffix(string(resp.Contents), "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = html.EscapeString(line)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		FirstLine uint32
+		Lines     []string
+	}{
+		FirstLine: resp.FirstLine,
+		Lines:     lines,
+	}); err != nil {
+		log.Printf("Could not encode context: %v\n", err)
+	}
+}
+
 func Show(w http.ResponseWriter, r *http.Request) {
 	query := r.URL
 	filename := query.Query().Get("file")
@@ -40,21 +136,49 @@ func Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idx := strings.Index(filename, "/")
-	if idx == -1 {
-		http.Error(w, "Filename does not contain a package", http.StatusInternalServerError)
+	shard, err := sourceBackendFor(filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	pkg := filename[:idx]
-	shard := common.SourceBackendStubs[shardmapping.TaskIdxForPackage(pkg, len(common.SourceBackendStubs))]
-	resp, err := shard.File(context.Background(), &proto.FileRequest{
-		Path: filename,
-	})
+	request := &proto.FileRequest{
+		Path:     filename,
+		Original: query.Query().Get("original") == "1",
+	}
+	full := query.Query().Get("full") == "1"
+	if !full && !request.Original {
+		center := uint64(1)
+		if line > 1 {
+			center = uint64(line)
+		}
+		request.FirstLine, request.LastLine = lineWindow(center, showContext)
+	}
+	resp, err := shard.File(context.Background(), request)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// The original of a transcoded file is not UTF-8, so it cannot be
+	// displayed as part of the page, but only downloaded.
+	if request.Original {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(filename)))
+		w.Write(resp.Contents)
+		return
+	}
+
+	// Link to the original of transcoded files.
+	var originalurl string
+	if resp.Transcoded {
+		u := *query
+		q := u.Query()
+		q.Set("original", "1")
+		u.RawQuery = q.Encode()
+		u.Fragment = ""
+		originalurl = u.String()
+	}
+
 	// NB: contents is untrusted as it can contain the contents of any file
 	// within any Debian package. Converting it to string is not a problem,
 	// though, see http://golang.org/ref/spec#Conversions, "Conversions to and
@@ -62,22 +186,42 @@ func Show(w http.ResponseWriter, r *http.Request) {
 	// yields a string whose successive bytes are the elements of the slice.".
 	// We don’t iterate over this string, we just pass it directly to the
 	// user’s browser, which can then deal with the bytes :-).
-	lines := strings.Split(string(resp.Contents), "\n")
-	highestLineNr := fmt.Sprintf("%d", len(lines))
+	lines := strings.Split(strings.TrimSuffix(string(resp.Contents), "\n"), "\n")
+	firstLine := int(resp.FirstLine)
+	lastLine := firstLine + len(lines) - 1
+	highestLineNr := fmt.Sprintf("%d", lastLine)
 
 	// Since Go templates don’t offer any way to use {{$idx+1}}, we need to
-	// pre-calculate line numbers starting from 1 here.
+	// pre-calculate line numbers starting from the first returned line here.
 	lineNumbers := make([]int, len(lines))
 	for idx, _ := range lines {
-		lineNumbers[idx] = idx + 1
+		lineNumbers[idx] = firstLine + idx
+	}
+
+	// Only a part of the file is displayed, offer a link to the entire file.
+	var fullurl string
+	if firstLine > 1 || uint32(lastLine) < resp.Lines {
+		u := *query
+		q := u.Query()
+		q.Set("full", "1")
+		u.RawQuery = q.Encode()
+		u.Fragment = "L" + strconv.Itoa(line)
+		fullurl = u.String()
 	}
 
 	err = common.Templates.ExecuteTemplate(w, "show.html", map[string]interface{}{
-		"line":     line,
-		"lines":    lines,
-		"numbers":  lineNumbers,
-		"lnrwidth": len(highestLineNr),
-		"filename": filename,
+		"line":        line,
+		"lines":       lines,
+		"numbers":     lineNumbers,
+		"lnrwidth":    len(highestLineNr),
+		"filename":    filename,
+		"basename":    path.Base(filename),
+		"breadcrumbs": breadcrumbs(path.Dir(filename)),
+		"firstline":   firstLine,
+		"lastline":    lastLine,
+		"fullurl":     fullurl,
+		"originalurl": originalurl,
+		"metadata":    resp,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
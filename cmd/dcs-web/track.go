@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"github.com/Debian/dcs/ranking"
 )
 
 var (
@@ -16,7 +18,12 @@ var (
 		"",
 		"Where to write the click.log entries (JSON-encoded, timestamped). Disabled if empty.")
 
-	clickLog *os.File
+	rankingLogPath = flag.String("ranking_log_path",
+		"",
+		"Where to write the rankings of the results shown for each query (JSON-encoded, timestamped), which dcs-learn-ranking joins with the click log. Disabled if empty.")
+
+	clickLog   *os.File
+	rankingLog *os.File
 )
 
 func Track(w http.ResponseWriter, r *http.Request) {
@@ -49,3 +56,17 @@ func Track(w http.ResponseWriter, r *http.Request) {
 		time.Now().Format("02/Jan/2006:15:04:05 -0700"),
 		string(b))
 }
+
+// logImpression writes a result shown to the user to the ranking log, in the
+// same format as the click log.
+func logImpression(imp *ranking.Impression) {
+	b, err := json.Marshal(imp)
+	if err != nil {
+		log.Printf("Could not encode impression: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(rankingLog, "%s - %s\n",
+		time.Now().Format("02/Jan/2006:15:04:05 -0700"),
+		string(b))
+}
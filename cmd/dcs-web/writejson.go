@@ -206,6 +206,44 @@ func WriteMatchJSON(match *pb.Match, w io.Writer) error {
 			return err
 		}
 	}
+	// Only present for dedup:yes queries, so keep results small otherwise.
+	if len(match.Duplicates) > 0 {
+		err = b.WriteByte(',')
+		if err != nil {
+			return err
+		}
+		_, err = b.WriteString("\"duplicates\":")
+		if err != nil {
+			return err
+		}
+		buf, err = json.Marshal(match.Duplicates)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	// Only present for struct: queries.
+	if len(match.Bindings) > 0 {
+		err = b.WriteByte(',')
+		if err != nil {
+			return err
+		}
+		_, err = b.WriteString("\"bindings\":")
+		if err != nil {
+			return err
+		}
+		buf, err = json.Marshal(match.Bindings)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte('}')
 	if err != nil {
 		return err
@@ -0,0 +1,86 @@
+// vim:ts=4:sw=4:noexpandtab
+
+// Package contenthash stores the hashes of the contents of all files of an
+// unpacked package, so that files which appear verbatim in many packages
+// (e.g. vendored copies of zlib) can be searched only once.
+//
+// The hashes of a package are stored next to its unpacked directory, with
+// Suffix appended to the package name, in the format of sha256sum(1).
+package contenthash
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Suffix is appended to the package name to form the name of the file
+// containing the content hashes of the package.
+const Suffix = ".hashes"
+
+// New returns the hash.Hash which is used for content hashes.
+func New() hash.Hash {
+	return sha256.New()
+}
+
+// String returns the hex-encoded content hash of h.
+func String(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WriteFile writes hashes, mapping file paths to content hashes, to name.
+func WriteFile(name string, hashes map[string]string) error {
+	paths := make([]string, 0, len(hashes))
+	for path := range hashes {
+		// A newline would make the file ambiguous, see ReadFile.
+		if strings.Contains(path, "\n") {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		fmt.Fprintf(w, "%s  %s\n", hashes[path], path)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads the hashes from name, as written by WriteFile.
+func ReadFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+func read(r io.Reader) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, "  ")
+		if idx == -1 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		hashes[line[idx+2:]] = line[:idx]
+	}
+	return hashes, scanner.Err()
+}
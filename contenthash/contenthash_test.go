@@ -0,0 +1,44 @@
+package contenthash
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contenthash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New()
+	io.WriteString(h, "int main() {}\n")
+	want := map[string]string{
+		"i3-wm_4.7.2-1/src/main.c":      String(h),
+		"i3-wm_4.7.2-1/src/with  two.c": String(h),
+		"zlib_1.2.8.dfsg-1/zlib.h":      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}
+	name := filepath.Join(dir, "i3-wm_4.7.2-1"+Suffix)
+	if err := WriteFile(name, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadFile() = %v, want %v", got, want)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	if _, err := read(strings.NewReader("no separator\n")); err == nil {
+		t.Fatalf("read() unexpectedly succeeded")
+	}
+}
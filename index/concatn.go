@@ -42,26 +42,62 @@ func (h *concatHeap) Push(v interface{}) {
 //	return h.At(i).(postMapReader).trigram < h.At(j).(postMapReader).trigram
 //}
 
-func ConcatN(dst string, sources ...string) {
-	//offsets := make([]uint32, len(sources))
-	ixes := make([]*Index, len(sources))
-	readers := make([]postMapReader, len(sources))
-	for i, source := range sources {
-		ixes[i] = Open(source)
+// ConcatN concatenates the indexes sources into dst. The file ids of each
+// source are offset by the number of files in the preceding sources. If a
+// source is corrupt, the returned error is a *CorruptError naming it.
+func ConcatN(dst string, sources ...string) error {
+	ixes := make([]*Index, 0, len(sources))
+	defer func() {
+		for _, ix := range ixes {
+			ix.Close()
+		}
+	}()
+	for _, source := range sources {
+		ix, err := OpenErr(source)
+		if err != nil {
+			return err
+		}
+		ixes = append(ixes, ix)
+	}
+	return ConcatIndexes(dst, ixes...)
+}
+
+// ConcatIndexes is like ConcatN, but works on already opened indexes, which
+// remain open. This allows callers to remove source files while the
+// concatenation is running. dst is removed if an error occurs.
+func ConcatIndexes(dst string, ixes ...*Index) error {
+	err := concatIndexes(dst, ixes)
+	if err != nil {
+		os.Remove(dst)
 	}
+	return err
+}
+
+func concatIndexes(dst string, ixes []*Index) (err error) {
+	defer catch(&err)
+	//offsets := make([]uint32, len(ixes))
+	readers := make([]postMapReader, len(ixes))
 
 	out := bufCreate(dst)
+	defer out.file.Close()
 	out.writeString(magic)
 
 	// Merged list of paths.
-	pathData := out.offset()
+	pathData := out.startSection()
 	out.writeString("\x00")
 
 	// Merged list of names.
-	nameData := out.offset()
+	nameData := out.startSection()
 	nameIndexFile := bufCreate("")
+	defer os.Remove(nameIndexFile.name)
+	var meta metaWriter
+	meta.init()
+	defer os.Remove(meta.records.name)
+	for _, ix := range ixes {
+		meta.enabled = meta.enabled || ix.HasMeta()
+	}
 	var offset uint32
-	for i, _ := range sources {
+	for i, _ := range ixes {
 		readers[i].init(ixes[i], []idrange{{
 			lo:  0,
 			hi:  uint32(ixes[i].numName),
@@ -71,23 +107,67 @@ func ConcatN(dst string, sources ...string) {
 		// fix up all the nameIndexFile numbers (i.e. write out.offset() + num
 		// instead of num). That could be faster than the following code, though:
 		for j := 0; j < ixes[i].numName; j++ {
-			nameIndexFile.writeUint32(out.offset() - nameData)
+			nameIndexFile.writeUint64(out.offset() - nameData)
 			out.writeString(ixes[i].Name(uint32(j)))
 			out.writeString("\x00")
+			meta.add(ixes[i].Meta(uint32(j)))
 		}
 	}
 
-	nameIndexFile.writeUint32(out.offset())
+	nameIndexFile.writeUint64(out.offset())
 
 	// Merged list of posting lists.
-	postData := out.offset()
+	postData := out.startSection()
 	var w postDataWriter
 
 	w.init(out)
+	defer os.Remove(w.postIndexFile.name)
+
+	concatPostingLists(&w, readers)
+
+	// Name index
+	nameIndex := out.startSection()
+	copyFile(out, nameIndexFile)
+
+	// Posting list index
+	postIndex := out.startSection()
+	copyFile(out, w.postIndexFile)
+
+	// File metadata
+	metaData := out.startSection()
+	meta.writeTo(out)
+
+	// Sparse n-grams, unless the files of one of the indexes would be
+	// missing from them.
+	ngramData := out.startSection()
+	var nw postDataWriter
+	nw.initNGrams(out)
+	defer os.Remove(nw.postIndexFile.name)
+	hasNGrams := true
+	for _, ix := range ixes {
+		hasNGrams = hasNGrams && ix.HasNGrams()
+	}
+	if hasNGrams {
+		for i, ix := range ixes {
+			readers[i].initNGrams(ix, readers[i].idmap)
+		}
+		concatPostingLists(&nw, readers)
+		nw.endNGrams()
+	}
+	ngramIndex := out.startSection()
+	copyFile(out, nw.postIndexFile)
+
+	out.writeTrailer([numSections]uint64{pathData, nameData, postData, nameIndex, postIndex, metaData, ngramData, ngramIndex})
+	out.flush()
+	return nil
+}
 
+// concatPostingLists writes the posting lists of readers, whose file ids are
+// mapped to consecutive ranges, to w.
+func concatPostingLists(w *postDataWriter, readers []postMapReader) {
 	h := new(concatHeap)
 	lastTrigram := ^uint32(0)
-	for i, _ := range sources {
+	for i := range readers {
 		heap.Push(h, readers[i])
 	}
 	for {
@@ -105,33 +185,13 @@ func ConcatN(dst string, sources ...string) {
 			w.trigram(nextTrigram)
 		}
 
-		reader.writePostingList(&w)
+		reader.writePostingList(w)
 		reader.nextTrigram()
 		heap.Push(h, reader)
 
 		lastTrigram = nextTrigram
 	}
-
-	// Name index
-	nameIndex := out.offset()
-	copyFile(out, nameIndexFile)
-
-	// Posting list index
-	postIndex := out.offset()
-	copyFile(out, w.postIndexFile)
-
-	out.writeUint32(pathData)
-	out.writeUint32(nameData)
-	out.writeUint32(postData)
-	out.writeUint32(nameIndex)
-	out.writeUint32(postIndex)
-	out.writeString(trailerMagic)
-	out.flush()
-
-	os.Remove(nameIndexFile.name)
-	os.Remove(w.postIndexFile.name)
-
-	for i, _ := range sources {
-		ixes[i].Close()
+	if lastTrigram != ^uint32(0) {
+		w.endTrigram()
 	}
 }
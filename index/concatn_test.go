@@ -61,6 +61,9 @@ func TestConcatN(t *testing.T) {
 	buildIndex(out3, []string{}, mergeFiles3)
 
 	ConcatN(out4, out1, out2, out3)
+	if err := Verify(out4); err != nil {
+		t.Fatal(err)
+	}
 
 	ix1 := Open(out1)
 	ix2 := Open(out2)
@@ -118,3 +121,21 @@ func TestConcatN(t *testing.T) {
 	check(ix4, "ZZZ", 10)
 	check(ix4, "aaa", 11)
 }
+
+func TestConcatNCorrupt(t *testing.T) {
+	f1, _ := ioutil.TempFile("", "index-test")
+	f2, _ := ioutil.TempFile("", "index-test")
+	f3, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f1.Name())
+	defer os.Remove(f2.Name())
+	defer os.Remove(f3.Name())
+
+	buildIndex(f1.Name(), nil, map[string]string{"/a/x": "hello world"})
+	f2.WriteString("csearch index 2\ngarbage")
+	f2.Close()
+
+	err := ConcatN(f3.Name(), f1.Name(), f2.Name())
+	if cerr, ok := err.(*CorruptError); !ok || cerr.File != f2.Name() {
+		t.Fatalf("ConcatN() = %v, want *CorruptError for %q", err, f2.Name())
+	}
+}
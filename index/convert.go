@@ -0,0 +1,54 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+// Convert writes the index src, which may use any supported version of the
+// on-disk format, to dst using the current version. Paths, names, posting
+// lists, file metadata and sparse n-grams are copied verbatim, only the
+// offsets are re-encoded.
+func Convert(dst, src string) (err error) {
+	defer catch(&err)
+	ix := open(src)
+	defer ix.Close()
+
+	out := bufCreate(dst)
+	defer out.file.Close()
+	out.writeString(magic)
+
+	pathData := out.startSection()
+	out.write(ix.slice(ix.pathData, int(ix.nameData-ix.pathData)))
+
+	// Offsets in the name index and posting list index are relative to the
+	// start of their section, so they stay valid.
+	nameData := out.startSection()
+	out.write(ix.slice(ix.nameData, int(ix.postData-ix.nameData)))
+
+	postData := out.startSection()
+	out.write(ix.slice(ix.postData, int(ix.nameIndex-ix.postData)))
+
+	nameIndex := out.startSection()
+	for i := 0; i <= ix.numName; i++ {
+		out.writeUint64(ix.offset(ix.nameIndex + uint64(i)*uint64(ix.offsetSize)))
+	}
+
+	postIndex := out.startSection()
+	for i := 0; i < ix.numPost; i++ {
+		trigram, count, offset := ix.listAt(uint32(i))
+		out.writeTrigram(trigram)
+		out.writeUint32(count)
+		out.writeUint64(offset)
+	}
+
+	// Offsets in the file metadata are relative to its start, too.
+	metaData := out.startSection()
+	out.write(ix.slice(ix.metaData, int(ix.ngramData-ix.metaData)))
+
+	// The same applies to the sparse n-gram index.
+	ngramData := out.startSection()
+	out.write(ix.slice(ix.ngramData, int(ix.ngramIndex-ix.ngramData)))
+	ngramIndex := out.startSection()
+	out.write(ix.slice(ix.ngramIndex, int(ix.checksums-ix.ngramIndex)))
+
+	out.writeTrailer([numSections]uint64{pathData, nameData, postData, nameIndex, postIndex, metaData, ngramData, ngramIndex})
+	out.flush()
+	return nil
+}
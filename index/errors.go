@@ -0,0 +1,40 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+// CorruptError is returned when an index file is malformed, e.g. truncated.
+type CorruptError struct {
+	File string
+
+	// Reason optionally describes the inconsistency, see Verify.
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	if e.Reason != "" {
+		return "corrupt index: remove " + e.File + ": " + e.Reason
+	}
+	return "corrupt index: remove " + e.File
+}
+
+// indexError aborts reading or writing an index from deep within helper
+// functions (e.g. when a posting list is corrupt). It is recovered by the
+// exported functions which return an error, see catch.
+type indexError struct {
+	err error
+}
+
+func fail(err error) {
+	panic(indexError{err})
+}
+
+// catch recovers from a fail and stores the error in *err. It must be called
+// using defer. Other panics are propagated.
+func catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(indexError)
+		if !ok {
+			panic(r)
+		}
+		*err = e.err
+	}
+}
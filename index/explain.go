@@ -0,0 +1,47 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+// QueryPlan is a Query annotated with the length of the posting list of each
+// trigram, i.e. the number of files which contain the trigram. For a sparse
+// n-gram, it is the number of files which might contain the n-gram, i.e. all
+// files if the index has no sparse n-gram index.
+type QueryPlan struct {
+	Op QueryOp
+
+	// Trigrams are in the order of Query.Trigram. For QAnd, PostingQuery
+	// starts with the shortest posting lists and stops intersecting once
+	// further trigrams barely reduce the number of files.
+	Trigrams []TrigramCount
+	Sub      []*QueryPlan
+}
+
+type TrigramCount struct {
+	Trigram string
+	Count   int
+}
+
+// Explain returns the QueryPlan of q, which describes how expensive
+// PostingQuery(q) is and how selective each trigram is.
+func (ix *Index) Explain(q *Query) (plan *QueryPlan, err error) {
+	defer catch(&err)
+	return ix.explain(q), nil
+}
+
+func (ix *Index) explain(q *Query) *QueryPlan {
+	plan := &QueryPlan{
+		Op:       q.Op,
+		Trigrams: make([]TrigramCount, len(q.Trigram)),
+		Sub:      make([]*QueryPlan, len(q.Sub)),
+	}
+	for idx, t := range q.Trigram {
+		count := ix.numName
+		if p, ok := ix.lookup(t); ok {
+			count = p.count
+		}
+		plan.Trigrams[idx] = TrigramCount{t, count}
+	}
+	for idx, sub := range q.Sub {
+		plan.Sub[idx] = ix.explain(sub)
+	}
+	return plan
+}
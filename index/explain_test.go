@@ -0,0 +1,44 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, nil, postFiles)
+	ix := Open(out)
+	defer ix.Close()
+
+	q := &Query{
+		Op:      QAnd,
+		Trigram: []string{"Goo", "Sea"},
+		Sub: []*Query{
+			{Op: QOr, Trigram: []string{"Web", "xyz"}},
+		},
+	}
+	plan, err := ix.Explain(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Op != QAnd || len(plan.Trigrams) != 2 || len(plan.Sub) != 1 {
+		t.Fatalf("unexpected plan structure: %+v", plan)
+	}
+	want := []TrigramCount{{"Goo", 3}, {"Sea", 2}}
+	for i, tc := range plan.Trigrams {
+		if tc != want[i] {
+			t.Errorf("Trigrams[%d] = %+v, want %+v", i, tc, want[i])
+		}
+	}
+	want = []TrigramCount{{"Web", 1}, {"xyz", 0}}
+	for i, tc := range plan.Sub[0].Trigrams {
+		if tc != want[i] {
+			t.Errorf("Sub[0].Trigrams[%d] = %+v, want %+v", i, tc, want[i])
+		}
+	}
+}
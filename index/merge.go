@@ -31,7 +31,6 @@ package index
 // Rename C's index onto the new index.
 
 import (
-	"encoding/binary"
 	"os"
 	"strings"
 )
@@ -44,15 +43,16 @@ type idrange struct {
 type postIndex struct {
 	tri    uint32
 	count  uint32
-	offset uint32
+	offset uint64
 }
 
 // Merge creates a new index in the file dst that corresponds to merging
 // the two indices src1 and src2.  If both src1 and src2 claim responsibility
 // for a path, src2 is assumed to be newer and is given preference.
-func Merge(dst, src1, src2 string) {
-	ix1 := Open(src1)
-	ix2 := Open(src2)
+func Merge(dst, src1, src2 string) (err error) {
+	defer catch(&err)
+	ix1 := open(src1)
+	ix2 := open(src2)
 	paths1 := ix1.Paths()
 	paths2 := ix2.Paths()
 
@@ -108,7 +108,7 @@ func Merge(dst, src1, src2 string) {
 	ix3.writeString(magic)
 
 	// Merged list of paths.
-	pathData := ix3.offset()
+	pathData := ix3.startSection()
 	mi1 := 0
 	mi2 := 0
 	last := "\x00" // not a prefix of anything
@@ -131,8 +131,11 @@ func Merge(dst, src1, src2 string) {
 	ix3.writeString("\x00")
 
 	// Merged list of names.
-	nameData := ix3.offset()
+	nameData := ix3.startSection()
 	nameIndexFile := bufCreate("")
+	var meta metaWriter
+	meta.init()
+	meta.enabled = ix1.HasMeta() || ix2.HasMeta()
 	new = 0
 	mi1 = 0
 	mi2 = 0
@@ -140,18 +143,20 @@ func Merge(dst, src1, src2 string) {
 		if mi1 < len(map1) && map1[mi1].new == new {
 			for i := map1[mi1].lo; i < map1[mi1].hi; i++ {
 				name := ix1.Name(i)
-				nameIndexFile.writeUint32(ix3.offset() - nameData)
+				nameIndexFile.writeUint64(ix3.offset() - nameData)
 				ix3.writeString(name)
 				ix3.writeString("\x00")
+				meta.add(ix1.Meta(i))
 				new++
 			}
 			mi1++
 		} else if mi2 < len(map2) && map2[mi2].new == new {
 			for i := map2[mi2].lo; i < map2[mi2].hi; i++ {
 				name := ix2.Name(i)
-				nameIndexFile.writeUint32(ix3.offset() - nameData)
+				nameIndexFile.writeUint64(ix3.offset() - nameData)
 				ix3.writeString(name)
 				ix3.writeString("\x00")
+				meta.add(ix2.Meta(i))
 				new++
 			}
 			mi2++
@@ -159,19 +164,60 @@ func Merge(dst, src1, src2 string) {
 			panic("merge: inconsistent index")
 		}
 	}
-	if new*4 != nameIndexFile.offset() {
+	if uint64(new)*8 != nameIndexFile.offset() {
 		panic("merge: inconsistent index")
 	}
-	nameIndexFile.writeUint32(ix3.offset())
+	nameIndexFile.writeUint64(ix3.offset())
 
 	// Merged list of posting lists.
-	postData := ix3.offset()
+	postData := ix3.startSection()
 	var r1 postMapReader
 	var r2 postMapReader
 	var w postDataWriter
 	r1.init(ix1, map1)
 	r2.init(ix2, map2)
 	w.init(ix3)
+	mergePostingLists(&w, &r1, &r2)
+
+	// Name index
+	nameIndex := ix3.startSection()
+	copyFile(ix3, nameIndexFile)
+
+	// Posting list index
+	postIndex := ix3.startSection()
+	copyFile(ix3, w.postIndexFile)
+
+	// File metadata
+	metaData := ix3.startSection()
+	meta.writeTo(ix3)
+
+	// Sparse n-grams, unless the files of one of the indexes would be
+	// missing from them.
+	ngramData := ix3.startSection()
+	var nw postDataWriter
+	nw.initNGrams(ix3)
+	if ix1.HasNGrams() && ix2.HasNGrams() {
+		r1.initNGrams(ix1, map1)
+		r2.initNGrams(ix2, map2)
+		mergePostingLists(&nw, &r1, &r2)
+		nw.endNGrams()
+	}
+	ngramIndex := ix3.startSection()
+	copyFile(ix3, nw.postIndexFile)
+
+	ix3.writeTrailer([numSections]uint64{pathData, nameData, postData, nameIndex, postIndex, metaData, ngramData, ngramIndex})
+	ix3.flush()
+
+	os.Remove(nameIndexFile.name)
+	os.Remove(w.postIndexFile.name)
+	os.Remove(nw.postIndexFile.name)
+	os.Remove(meta.records.name)
+	return nil
+}
+
+// mergePostingLists writes the posting lists of r1 and r2, whose file ids are
+// mapped to disjoint ranges, to w.
+func mergePostingLists(w *postDataWriter, r1, r2 *postMapReader) {
 	for {
 		if r1.trigram < r2.trigram {
 			w.trigram(r1.trigram)
@@ -210,125 +256,98 @@ func Merge(dst, src1, src2 string) {
 			w.endTrigram()
 		}
 	}
-
-	// Name index
-	nameIndex := ix3.offset()
-	copyFile(ix3, nameIndexFile)
-
-	// Posting list index
-	postIndex := ix3.offset()
-	copyFile(ix3, w.postIndexFile)
-
-	ix3.writeUint32(pathData)
-	ix3.writeUint32(nameData)
-	ix3.writeUint32(postData)
-	ix3.writeUint32(nameIndex)
-	ix3.writeUint32(postIndex)
-	ix3.writeString(trailerMagic)
-	ix3.flush()
-
-	os.Remove(nameIndexFile.name)
-	os.Remove(w.postIndexFile.name)
 }
 
 // src1 and src2 must not cover the same files. dst will contain an index that
 // contains src1 and src2.
-func Concat(dst, src1, src2 string) {
-	ix1 := Open(src1)
-	ix2 := Open(src2)
+func Concat(dst, src1, src2 string) (err error) {
+	defer catch(&err)
+	ix1 := open(src1)
+	ix2 := open(src2)
 
 	ix3 := bufCreate(dst)
 	ix3.writeString(magic)
 
 	// Merged list of paths.
-	pathData := ix3.offset()
+	pathData := ix3.startSection()
 	ix3.writeString("\x00")
 
 	// Merged list of names.
-	nameData := ix3.offset()
+	nameData := ix3.startSection()
 	nameIndexFile := bufCreate("")
+	var meta metaWriter
+	meta.init()
+	meta.enabled = ix1.HasMeta() || ix2.HasMeta()
 	for i := 0; i < ix1.numName; i++ {
-		nameIndexFile.writeUint32(ix3.offset() - nameData)
+		nameIndexFile.writeUint64(ix3.offset() - nameData)
 		ix3.writeString(ix1.Name(uint32(i)))
 		ix3.writeString("\x00")
+		meta.add(ix1.Meta(uint32(i)))
 	}
 	for i := 0; i < ix2.numName; i++ {
-		nameIndexFile.writeUint32(ix3.offset() - nameData)
+		nameIndexFile.writeUint64(ix3.offset() - nameData)
 		ix3.writeString(ix2.Name(uint32(i)))
 		ix3.writeString("\x00")
+		meta.add(ix2.Meta(uint32(i)))
 	}
 
-	nameIndexFile.writeUint32(ix3.offset())
+	nameIndexFile.writeUint64(ix3.offset())
 
 	// Merged list of posting lists.
-	postData := ix3.offset()
+	postData := ix3.startSection()
 	var r1 postMapReader
 	var r2 postMapReader
 	var w postDataWriter
 
 	w.init(ix3)
-	r1.init(ix1, []idrange{{lo: 0, hi: uint32(ix1.numName), new: 0}})
-	r2.init(ix2, []idrange{{lo: 0, hi: uint32(ix2.numName), new: uint32(ix1.numName)}})
-	for {
-		if r1.trigram < r2.trigram {
-			w.trigram(r1.trigram)
-			for r1.nextId() {
-				w.fileid(r1.fileid)
-			}
-			r1.nextTrigram()
-			w.endTrigram()
-		} else if r2.trigram < r1.trigram {
-			w.trigram(r2.trigram)
-			for r2.nextId() {
-				w.fileid(r2.fileid)
-			}
-			r2.nextTrigram()
-			w.endTrigram()
-		} else {
-			if r1.trigram == ^uint32(0) {
-				break
-			}
-			w.trigram(r1.trigram)
-			for r1.nextId() {
-				w.fileid(r1.fileid)
-			}
-			for r2.nextId() {
-				w.fileid(r2.fileid)
-			}
-			r1.nextTrigram()
-			r2.nextTrigram()
-			w.endTrigram()
-		}
-	}
+	map1 := []idrange{{lo: 0, hi: uint32(ix1.numName), new: 0}}
+	map2 := []idrange{{lo: 0, hi: uint32(ix2.numName), new: uint32(ix1.numName)}}
+	r1.init(ix1, map1)
+	r2.init(ix2, map2)
+	mergePostingLists(&w, &r1, &r2)
 
 	// Name index
-	nameIndex := ix3.offset()
+	nameIndex := ix3.startSection()
 	copyFile(ix3, nameIndexFile)
 
 	// Posting list index
-	postIndex := ix3.offset()
+	postIndex := ix3.startSection()
 	copyFile(ix3, w.postIndexFile)
 
-	ix3.writeUint32(pathData)
-	ix3.writeUint32(nameData)
-	ix3.writeUint32(postData)
-	ix3.writeUint32(nameIndex)
-	ix3.writeUint32(postIndex)
-	ix3.writeString(trailerMagic)
+	// File metadata
+	metaData := ix3.startSection()
+	meta.writeTo(ix3)
+
+	// Sparse n-grams, see Merge.
+	ngramData := ix3.startSection()
+	var nw postDataWriter
+	nw.initNGrams(ix3)
+	if ix1.HasNGrams() && ix2.HasNGrams() {
+		r1.initNGrams(ix1, map1)
+		r2.initNGrams(ix2, map2)
+		mergePostingLists(&nw, &r1, &r2)
+		nw.endNGrams()
+	}
+	ngramIndex := ix3.startSection()
+	copyFile(ix3, nw.postIndexFile)
+
+	ix3.writeTrailer([numSections]uint64{pathData, nameData, postData, nameIndex, postIndex, metaData, ngramData, ngramIndex})
 	ix3.flush()
 
 	os.Remove(nameIndexFile.name)
 	os.Remove(w.postIndexFile.name)
+	os.Remove(nw.postIndexFile.name)
+	os.Remove(meta.records.name)
+	return nil
 }
 
 type postMapReader struct {
 	ix      *Index
 	idmap   []idrange
+	ngrams  bool // read the sparse n-gram index instead of the trigrams
 	triNum  uint32
-	trigram uint32
-	count   uint32
-	offset  uint32
-	d       []byte
+	trigram uint32 // trigram or sparse n-gram key
+	ids     []uint32
 	oldid   uint32
 	fileid  uint32
 	i       int
@@ -337,6 +356,19 @@ type postMapReader struct {
 func (r *postMapReader) init(ix *Index, idmap []idrange) {
 	r.ix = ix
 	r.idmap = idmap
+	r.ngrams = false
+	r.triNum = 0
+	r.trigram = ^uint32(0)
+	r.load()
+}
+
+// initNGrams is like init, but reads the posting lists of the sparse n-gram
+// index of ix, which must have one.
+func (r *postMapReader) initNGrams(ix *Index, idmap []idrange) {
+	r.ix = ix
+	r.idmap = idmap
+	r.ngrams = true
+	r.triNum = 0
 	r.trigram = ^uint32(0)
 	r.load()
 }
@@ -347,37 +379,40 @@ func (r *postMapReader) nextTrigram() {
 }
 
 func (r *postMapReader) load() {
-	if r.triNum >= uint32(r.ix.numPost) {
+	num := r.ix.numPost
+	if r.ngrams {
+		num = r.ix.numNGram
+	}
+	if r.triNum >= uint32(num) {
 		r.trigram = ^uint32(0)
-		r.count = 0
+		r.ids = nil
 		r.fileid = ^uint32(0)
 		return
 	}
-	r.trigram, r.count, r.offset = r.ix.listAt(r.triNum * postEntrySize)
-	if r.count == 0 {
-		r.fileid = ^uint32(0)
-		return
+	var count uint32
+	var offset uint64
+	var p postingList
+	if r.ngrams {
+		r.trigram, count, offset = r.ix.ngramAt(r.triNum)
+		p = r.ix.ngramPostingListAt(int(count), offset)
+	} else {
+		r.trigram, count, offset = r.ix.listAt(r.triNum)
+		p = r.ix.postingListAt(int(count), offset)
 	}
-	r.d = r.ix.slice(r.ix.postData+r.offset+3, -1)
-	r.oldid = ^uint32(0)
+	r.ids = p.list(nil)
+	r.fileid = ^uint32(0)
 	r.i = 0
 }
 
 func (r *postMapReader) nextId() bool {
-	for r.count > 0 {
-		r.count--
-		delta64, n := binary.Uvarint(r.d)
-		delta := uint32(delta64)
-		if n <= 0 || delta == 0 {
-			corrupt(r.ix.File)
-		}
-		r.d = r.d[n:]
-		r.oldid += delta
+	for len(r.ids) > 0 {
+		r.oldid = r.ids[0]
+		r.ids = r.ids[1:]
 		for r.i < len(r.idmap) && r.idmap[r.i].hi <= r.oldid {
 			r.i++
 		}
 		if r.i >= len(r.idmap) {
-			r.count = 0
+			r.ids = nil
 			break
 		}
 		if r.oldid < r.idmap[r.i].lo {
@@ -396,49 +431,24 @@ func (r *postMapReader) nextId() bool {
 // ConcatN only (i.e. takes shortcuts that may break usage of idmap other than
 // what ConcatN does).
 func (r *postMapReader) writePostingList(w *postDataWriter) {
-	if r.count == 0 {
-		return
-	}
-
-	// The first entry is fully decoded and re-encoded because w may be in the
-	// middle of a posting list and we need to delta-encode _in relation to_
-	// the last entry.
-	r.count--
-	delta64, n := binary.Uvarint(r.d)
-	delta := uint32(delta64)
-	if n <= 0 || delta == 0 {
-		corrupt(r.ix.File)
-	}
-	r.d = r.d[n:]
-	r.oldid = r.idmap[0].new + ^uint32(0) + delta
-	w.fileid(r.oldid)
-	w.count += r.count
-
-	// If the posting list has only one entry, we’re done now.
-	if r.count == 0 {
-		r.fileid = ^uint32(0)
-		return
+	offset := r.idmap[0].new
+	for _, id := range r.ids {
+		w.ids = append(w.ids, offset+id)
 	}
-
-	// TODO: myPostingLast finds the amount of bytes and the last value. In the
-	// long run, we may want to store the last value of a posting list so that
-	// we don’t need to read the entire thing to copy it properly. The overhead
-	// is 2 * sizeof(uint32) * num_posting_lists. calculate that once we have
-	// the entire index.
-	last, totalbytes := myPostingLast(r.d, r.count, r.oldid)
-	w.out.write(r.d[:totalbytes])
-	w.last = uint32(last)
+	r.ids = nil
 	r.fileid = ^uint32(0)
 }
 
+// postDataWriter collects the file ids of each posting list, so that the
+// encoding can be chosen once the entire list is known.
 type postDataWriter struct {
 	out           *bufWriter
 	postIndexFile *bufWriter
-	buf           [10]byte
-	base          uint32
-	count, offset uint32
-	last          uint32
+	ngrams        bool // write sparse n-gram keys instead of trigrams
+	base          uint64
+	ids           []uint32
 	t             uint32
+	enc           postingEncoder
 }
 
 func (w *postDataWriter) init(out *bufWriter) {
@@ -447,28 +457,44 @@ func (w *postDataWriter) init(out *bufWriter) {
 	w.base = out.offset()
 }
 
+// initNGrams is like init, but for writing the sparse n-gram index.
+func (w *postDataWriter) initNGrams(out *bufWriter) {
+	w.init(out)
+	w.ngrams = true
+}
+
 func (w *postDataWriter) trigram(t uint32) {
-	w.offset = w.out.offset()
-	w.count = 0
+	w.ids = w.ids[:0]
 	w.t = t
-	w.last = ^uint32(0)
 }
 
 func (w *postDataWriter) fileid(id uint32) {
-	if w.count == 0 {
-		w.out.writeTrigram(w.t)
-	}
-	w.out.writeUvarint(id - w.last)
-	w.last = id
-	w.count++
+	w.ids = append(w.ids, id)
 }
 
 func (w *postDataWriter) endTrigram() {
-	if w.count == 0 {
+	if len(w.ids) == 0 {
 		return
 	}
-	w.out.writeUvarint(0)
-	w.postIndexFile.writeTrigram(w.t)
-	w.postIndexFile.writeUint32(w.count)
-	w.postIndexFile.writeUint32(w.offset - w.base)
+	w.writeList()
+}
+
+func (w *postDataWriter) writeList() {
+	offset := w.out.offset()
+	if w.ngrams {
+		w.out.writeUint32(w.t)
+		w.postIndexFile.writeUint32(w.t)
+	} else {
+		w.out.writeTrigram(w.t)
+		w.postIndexFile.writeTrigram(w.t)
+	}
+	w.out.write(w.enc.encode(w.ids))
+	w.postIndexFile.writeUint32(uint32(len(w.ids)))
+	w.postIndexFile.writeUint64(offset - w.base)
+}
+
+// endNGrams writes the entries terminating the sparse n-gram index.
+func (w *postDataWriter) endNGrams() {
+	w.trigram(^uint32(0))
+	w.writeList()
 }
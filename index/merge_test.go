@@ -53,6 +53,9 @@ func TestMerge(t *testing.T) {
 	buildIndex(out2, mergePaths2, mergeFiles2)
 
 	Merge(out3, out1, out2)
+	if err := Verify(out3); err != nil {
+		t.Fatal(err)
+	}
 
 	ix1 := Open(out1)
 	ix2 := Open(out2)
@@ -0,0 +1,148 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// FileFlags classify a file, see FileMeta.
+type FileFlags uint32
+
+const (
+	// Generated marks files which were generated by a program, e.g.
+	// configure scripts or minified JavaScript.
+	Generated FileFlags = 1 << iota
+
+	// Test marks test code and test data.
+	Test
+
+	// Vendored marks copies of third-party code, e.g. a bundled zlib.
+	Vendored
+)
+
+// FileMeta is the metadata an index stores about each file (besides its
+// name), so that it does not need to be derived from the name at query time.
+type FileMeta struct {
+	// Package and Version identify the source package containing the file.
+	Package string
+	Version string
+
+	// Language is the programming language of the file (e.g. “c”), or the
+	// empty string if it is unknown.
+	Language string
+
+	Flags FileFlags
+
+	// Size is the size of the file in bytes.
+	Size uint64
+
+	// ContentHash holds the first 8 bytes (big-endian) of the content hash
+	// of the file, see package contenthash.
+	ContentHash uint64
+}
+
+// HasMeta reports whether the index contains file metadata. Indexes of
+// version 1 and 2 never do.
+func (ix *Index) HasMeta() bool {
+	return ix.metaRecords != 0
+}
+
+// Meta returns the metadata of the file with the given fileid. It returns the
+// zero FileMeta if the index contains no file metadata (see HasMeta) or if
+// the file was added without metadata.
+func (ix *Index) Meta(fileid uint32) FileMeta {
+	if ix.metaRecords == 0 {
+		return FileMeta{}
+	}
+	if fileid >= uint32(ix.numName) {
+		corrupt(ix.File)
+	}
+	d := ix.slice(ix.metaRecords+uint64(fileid)*metaRecordSize, metaRecordSize)
+	return FileMeta{
+		Package:     ix.metaString(binary.BigEndian.Uint32(d[0:])),
+		Version:     ix.metaString(binary.BigEndian.Uint32(d[4:])),
+		Language:    ix.metaString(binary.BigEndian.Uint32(d[8:])),
+		Flags:       FileFlags(binary.BigEndian.Uint32(d[12:])),
+		Size:        binary.BigEndian.Uint64(d[16:]),
+		ContentHash: binary.BigEndian.Uint64(d[24:]),
+	}
+}
+
+// MetaErr is like Meta, but returns a *CorruptError instead of panicking if
+// the file metadata is corrupt.
+func (ix *Index) MetaErr(fileid uint32) (meta FileMeta, err error) {
+	defer catch(&err)
+	return ix.Meta(fileid), nil
+}
+
+// metaString returns the string at offset off in the string table.
+func (ix *Index) metaString(off uint32) string {
+	if off == 0 {
+		return ""
+	}
+	table := ix.slice(ix.metaData+4, int(ix.metaRecords-ix.metaData-4))
+	if int(off) >= len(table) {
+		corrupt(ix.File)
+	}
+	i := bytes.IndexByte(table[off:], 0)
+	if i < 0 {
+		corrupt(ix.File)
+	}
+	return string(table[off : int(off)+i])
+}
+
+// metaWriter collects the file records and the string table of the file
+// metadata of an index which is being written.
+type metaWriter struct {
+	// enabled is set if the file metadata should be written. Otherwise, the
+	// section is left empty.
+	enabled bool
+
+	offsets map[string]uint32
+	table   []byte
+	records *bufWriter
+}
+
+func (w *metaWriter) init() {
+	w.offsets = map[string]uint32{"": 0}
+	w.table = []byte{0}
+	w.records = bufCreate("")
+}
+
+// str returns the offset of s in the string table, adding it if necessary.
+func (w *metaWriter) str(s string) uint32 {
+	if off, ok := w.offsets[s]; ok {
+		return off
+	}
+	if strings.Contains(s, "\x00") {
+		fail(fmt.Errorf("%q: metadata has NUL byte", s))
+	}
+	off := uint32(len(w.table))
+	w.offsets[s] = off
+	w.table = append(w.table, s...)
+	w.table = append(w.table, 0)
+	return off
+}
+
+// add appends the file record for the next file.
+func (w *metaWriter) add(m FileMeta) {
+	w.records.writeUint32(w.str(m.Package))
+	w.records.writeUint32(w.str(m.Version))
+	w.records.writeUint32(w.str(m.Language))
+	w.records.writeUint32(uint32(m.Flags))
+	w.records.writeUint64(m.Size)
+	w.records.writeUint64(m.ContentHash)
+}
+
+// writeTo writes the file metadata to out, if enabled.
+func (w *metaWriter) writeTo(out *bufWriter) {
+	if !w.enabled {
+		return
+	}
+	out.writeUint32(uint32(len(w.table)))
+	out.write(w.table)
+	copyFile(out, w.records)
+}
@@ -0,0 +1,203 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Debian/dcs/contenthash"
+)
+
+// buildMetaIndex is like buildIndex, but adds each file with the metadata
+// returned by meta.
+func buildMetaIndex(out string, paths []string, fileData map[string]string, meta func(name string) FileMeta) {
+	ix := Create(out)
+	ix.AddPaths(paths)
+	var files []string
+	for name := range fileData {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		ix.AddMeta(name, strings.NewReader(fileData[name]), meta(name))
+	}
+	ix.Flush()
+}
+
+// testMeta derives the metadata of the files in mergeFiles1 and mergeFiles2
+// from their names.
+func testMeta(name string) FileMeta {
+	meta := FileMeta{
+		Package:  strings.Split(name, "/")[1],
+		Version:  "1.0-1",
+		Language: "c",
+	}
+	if strings.HasSuffix(name, "x") {
+		meta.Flags = Test
+	}
+	return meta
+}
+
+// wantMeta returns testMeta(name), including the size and content hash which
+// AddMeta computes.
+func wantMeta(name, content string) FileMeta {
+	meta := testMeta(name)
+	meta.Size = uint64(len(content))
+	h := contenthash.New()
+	h.Write([]byte(content))
+	meta.ContentHash = binary.BigEndian.Uint64(h.Sum(nil))
+	return meta
+}
+
+func checkMeta(t *testing.T, file string, want map[string]FileMeta) {
+	ix, err := OpenErr(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if err := ix.Verify(); err != nil {
+		t.Fatalf("Verify(%q) = %v, want nil", file, err)
+	}
+	if !ix.HasMeta() {
+		t.Fatalf("%s: HasMeta() = false, want true", file)
+	}
+	if got, want := ix.NumNames(), len(want); got != want {
+		t.Fatalf("%s: NumNames() = %d, want %d", file, got, want)
+	}
+	for id := 0; id < ix.NumNames(); id++ {
+		name := ix.Name(uint32(id))
+		got, err := ix.MetaErr(uint32(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want[name] {
+			t.Errorf("%s: Meta(%d) = %+v, want %+v (%s)", file, id, got, want[name], name)
+		}
+	}
+}
+
+func TestMeta(t *testing.T) {
+	f1, _ := ioutil.TempFile("", "index-test")
+	f2, _ := ioutil.TempFile("", "index-test")
+	f3, _ := ioutil.TempFile("", "index-test")
+	f4, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f1.Name())
+	defer os.Remove(f2.Name())
+	defer os.Remove(f3.Name())
+	defer os.Remove(f4.Name())
+	out1 := f1.Name()
+	out2 := f2.Name()
+	out3 := f3.Name()
+	out4 := f4.Name()
+
+	buildMetaIndex(out1, mergePaths1, mergeFiles1, testMeta)
+	buildMetaIndex(out2, mergePaths2, mergeFiles2, testMeta)
+
+	want1 := make(map[string]FileMeta)
+	for name, content := range mergeFiles1 {
+		want1[name] = wantMeta(name, content)
+	}
+	checkMeta(t, out1, want1)
+
+	if err := Convert(out4, out1); err != nil {
+		t.Fatal(err)
+	}
+	checkMeta(t, out4, want1)
+
+	if err := ConcatN(out3, out1, out2); err != nil {
+		t.Fatal(err)
+	}
+	// The files in both indexes have the same metadata, as it is derived
+	// from the name.
+	want := make(map[string]FileMeta)
+	for name, content := range mergeFiles2 {
+		want[name] = wantMeta(name, content)
+	}
+	for name, meta := range want1 {
+		if _, ok := want[name]; !ok {
+			want[name] = meta
+		}
+	}
+	// ConcatN keeps both /b/xx files, which have different contents.
+	ix := Open(out3)
+	for id := 0; id < ix.NumNames(); id++ {
+		name := ix.Name(uint32(id))
+		meta := ix.Meta(uint32(id))
+		if id < len(mergeFiles1) {
+			if meta != want1[name] {
+				t.Errorf("ConcatN: Meta(%d) = %+v, want %+v", id, meta, want1[name])
+			}
+		} else if meta != wantMeta(name, mergeFiles2[name]) {
+			t.Errorf("ConcatN: Meta(%d) = %+v, want %+v", id, meta, wantMeta(name, mergeFiles2[name]))
+		}
+	}
+	ix.Close()
+
+	if err := Merge(out3, out1, out2); err != nil {
+		t.Fatal(err)
+	}
+	// Merge drops the files of out1 in /b.
+	for name := range want {
+		if strings.HasPrefix(name, "/b/") {
+			if _, ok := mergeFiles2[name]; !ok {
+				delete(want, name)
+			}
+		}
+	}
+	checkMeta(t, out3, want)
+}
+
+func TestMetaMixed(t *testing.T) {
+	f1, _ := ioutil.TempFile("", "index-test")
+	f2, _ := ioutil.TempFile("", "index-test")
+	f3, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f1.Name())
+	defer os.Remove(f2.Name())
+	defer os.Remove(f3.Name())
+	out1 := f1.Name()
+	out2 := f2.Name()
+	out3 := f3.Name()
+
+	buildIndex(out1, mergePaths1, mergeFiles1)
+	buildMetaIndex(out2, mergePaths2, mergeFiles2, testMeta)
+
+	ix := Open(out1)
+	if ix.HasMeta() {
+		t.Errorf("HasMeta() = true for an index built using Add, want false")
+	}
+	ix.Close()
+
+	if err := ConcatN(out3, out1, out2); err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]FileMeta)
+	for name := range mergeFiles1 {
+		want[name] = FileMeta{}
+	}
+	for name, content := range mergeFiles2 {
+		if _, ok := want[name]; !ok {
+			want[name] = wantMeta(name, content)
+		}
+	}
+	// /b/xx is contained in both indexes, but only with metadata in out2.
+	delete(want, "/b/xx")
+	ix = Open(out3)
+	defer ix.Close()
+	if err := ix.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	for id := 0; id < ix.NumNames(); id++ {
+		name := ix.Name(uint32(id))
+		meta := ix.Meta(uint32(id))
+		if name == "/b/xx" {
+			continue
+		}
+		if meta != want[name] {
+			t.Errorf("Meta(%d) = %+v, want %+v (%s)", id, meta, want[name], name)
+		}
+	}
+}
@@ -7,7 +7,7 @@
 package index
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"syscall"
 )
@@ -21,11 +21,11 @@ const (
 func mmapFile(f *os.File) mmapData {
 	st, err := f.Stat()
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 	size := st.Size()
 	if int64(int(size+4095)) != size+4095 {
-		log.Fatalf("%s: too large for mmap", f.Name())
+		fail(fmt.Errorf("%s: too large for mmap", f.Name()))
 	}
 	n := int(size)
 	if n == 0 {
@@ -33,7 +33,7 @@ func mmapFile(f *os.File) mmapData {
 	}
 	data, err := syscall.Mmap(int(f.Fd()), 0, (n+4095)&^4095, _PROT_READ, _MAP_SHARED)
 	if err != nil {
-		log.Fatalf("mmap %s: %v", f.Name(), err)
+		fail(fmt.Errorf("mmap %s: %v", f.Name(), err))
 	}
 	return mmapData{f, data[:n], data}
 }
@@ -5,7 +5,7 @@
 package index
 
 import (
-	"log"
+	"fmt"
 	"os"
 	"syscall"
 )
@@ -13,11 +13,11 @@ import (
 func mmapFile(f *os.File) mmapData {
 	st, err := f.Stat()
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 	size := st.Size()
 	if int64(int(size+4095)) != size+4095 {
-		log.Fatalf("%s: too large for mmap", f.Name())
+		fail(fmt.Errorf("%s: too large for mmap", f.Name()))
 	}
 	n := int(size)
 	if n == 0 {
@@ -25,7 +25,7 @@ func mmapFile(f *os.File) mmapData {
 	}
 	data, err := syscall.Mmap(int(f.Fd()), 0, (n+4095)&^4095, syscall.PROT_READ, syscall.MAP_SHARED)
 	if err != nil {
-		log.Fatalf("mmap %s: %v", f.Name(), err)
+		fail(fmt.Errorf("mmap %s: %v", f.Name(), err))
 	}
 	return mmapData{f, data[:n], data}
 }
@@ -0,0 +1,236 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+)
+
+// Sparse n-grams.
+//
+// Queries for common words (e.g. “return”) consist of common trigrams only,
+// so the trigram index returns a large fraction of all files as candidates.
+// The sparse n-gram index additionally stores posting lists for a selection
+// of longer n-grams, which are much more selective.
+//
+// Every pair of adjacent bytes in a text gets a weight (see pairWeight). The
+// substring covering the pairs i to j (i.e. bytes i to j+1) is a sparse n-gram
+// if the weights of both pair i and pair j are larger than the weights of all
+// pairs in between. In particular, every trigram is a sparse n-gram, but most
+// longer substrings are not, so a file contains only a few sparse n-grams per
+// byte.
+//
+// Whether a substring is a sparse n-gram only depends on the substring itself,
+// so a file which contains a literal of a query also contains all sparse
+// n-grams of the literal. Hence, RegexpQuery requires the longest sparse
+// n-grams of each literal in addition to its trigrams (see sparseNGrams).
+//
+// The sparse n-gram index stores the posting lists of all sparse n-grams of
+// minNGramLen to maxNGramLen bytes (shorter ones are trigrams, which are in
+// the trigram index), keyed by a hash of the n-gram (see ngramKey). Hash
+// collisions only result in additional candidates.
+
+const (
+	minNGramLen = 4
+	maxNGramLen = 32
+)
+
+// pairWeight returns the weight of the pair of bytes a, b. The weight is a
+// hash, which makes sparse n-grams end at random positions.
+func pairWeight(a, b byte) uint32 {
+	h := (uint32(a)<<8 | uint32(b)) * 0x9e3779b1
+	h ^= h >> 15
+	h *= 0x85ebca77
+	h ^= h >> 13
+	return h
+}
+
+// ngramKey returns the key of ngram in the sparse n-gram index. Keys are never
+// ^uint32(0), which terminates lists of keys when merging indexes.
+func ngramKey(ngram []byte) uint32 {
+	key := crc32.Checksum(ngram, castagnoli)
+	if key == ^uint32(0) {
+		key--
+	}
+	return key
+}
+
+// ngramScanner finds the sparse n-grams of minNGramLen to maxNGramLen bytes
+// in a text which is passed to add byte by byte.
+type ngramScanner struct {
+	// window holds (at least) the last maxNGramLen bytes of the text, the
+	// first of which is at position start.
+	window []byte
+	start  int
+
+	// pos is the position of the next byte.
+	pos int
+
+	// stack holds the pairs which can start a sparse n-gram ending with the
+	// next pair, i.e. whose weight is larger than the weights of all later
+	// pairs, in the order of their position.
+	stack []weightedPair
+
+	// emit is called with the position and contents of each sparse n-gram.
+	// ngram is only valid during the call.
+	emit func(pos int, ngram []byte)
+}
+
+type weightedPair struct {
+	pos    int
+	weight uint32
+}
+
+func (s *ngramScanner) reset() {
+	s.window = s.window[:0]
+	s.start = 0
+	s.pos = 0
+	s.stack = s.stack[:0]
+}
+
+func (s *ngramScanner) add(c byte) {
+	if len(s.window) >= 2*maxNGramLen {
+		n := copy(s.window, s.window[len(s.window)-maxNGramLen:])
+		s.window = s.window[:n]
+		s.start = s.pos - n
+	}
+	s.window = append(s.window, c)
+	s.pos++
+	if s.pos < 2 {
+		return
+	}
+	// The pair consisting of the last two bytes.
+	j := s.pos - 2
+	w := pairWeight(s.window[len(s.window)-2], c)
+
+	// The candidates are all pairs on the stack whose distance to j is small
+	// enough. The weights of the pairs between a candidate and j are smaller
+	// than the weight of the candidate (by the invariant of the stack), and
+	// the largest of them is the weight of the candidate above it.
+	var inner uint32
+	for t := len(s.stack) - 1; t >= 0; t-- {
+		i := s.stack[t].pos
+		if j+2-i > maxNGramLen {
+			break
+		}
+		if t < len(s.stack)-1 && inner >= w {
+			break
+		}
+		if n := j + 2 - i; n >= minNGramLen {
+			s.emit(i, s.window[i-s.start:j+2-s.start])
+		}
+		inner = s.stack[t].weight
+	}
+
+	for len(s.stack) > 0 && s.stack[len(s.stack)-1].weight <= w {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+	// Pairs which are too far away to start an n-gram are not needed anymore.
+	if len(s.stack) > 0 && j+2-s.stack[0].pos > maxNGramLen {
+		s.stack = append(s.stack[:0], s.stack[1:]...)
+	}
+	s.stack = append(s.stack, weightedPair{j, w})
+}
+
+// sparseNGrams returns the sparse n-grams of s (of at least minNGramLen bytes)
+// which are not contained in a longer sparse n-gram of s. Any file containing
+// s contains all of them.
+func sparseNGrams(s string) []string {
+	type span struct{ start, end int }
+	var spans []span
+	scanner := ngramScanner{
+		emit: func(pos int, ngram []byte) {
+			spans = append(spans, span{pos, pos + len(ngram)})
+		},
+	}
+	for i := 0; i < len(s); i++ {
+		scanner.add(s[i])
+	}
+	var ngrams []string
+	for _, sp := range spans {
+		contained := false
+		for _, other := range spans {
+			if other != sp && other.start <= sp.start && sp.end <= other.end {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			ngrams = append(ngrams, s[sp.start:sp.end])
+		}
+	}
+	return ngrams
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int {
+	return len(s)
+}
+
+func (s uint32Slice) Less(i, j int) bool {
+	return s[i] < s[j]
+}
+
+func (s uint32Slice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// uniqueKeys sorts keys and removes duplicates.
+func uniqueKeys(keys []uint32) []uint32 {
+	sort.Sort(uint32Slice(keys))
+	n := 0
+	for i, key := range keys {
+		if i == 0 || key != keys[n-1] {
+			keys[n] = key
+			n++
+		}
+	}
+	return keys[:n]
+}
+
+// HasNGrams reports whether the index contains a sparse n-gram index. Queries
+// on indexes without one only use the trigrams of a query.
+func (ix *Index) HasNGrams() bool {
+	return ix.ngramIndex < ix.checksums
+}
+
+// ngramAt returns the sparse n-gram index entry number n.
+func (ix *Index) ngramAt(n uint32) (key, count uint32, offset uint64) {
+	d := ix.slice(ix.ngramIndex+uint64(n)*ngramEntrySize, ngramEntrySize)
+	return binary.BigEndian.Uint32(d), binary.BigEndian.Uint32(d[4:]), binary.BigEndian.Uint64(d[8:])
+}
+
+// findNGramList is like findList, but for a key of the sparse n-gram index.
+func (ix *Index) findNGramList(key uint32) (count int, offset uint64) {
+	d := ix.slice(ix.ngramIndex, ngramEntrySize*ix.numNGram)
+	i := sort.Search(ix.numNGram, func(i int) bool {
+		return binary.BigEndian.Uint32(d[i*ngramEntrySize:]) >= key
+	})
+	if i >= ix.numNGram || binary.BigEndian.Uint32(d[i*ngramEntrySize:]) != key {
+		return 0, 0
+	}
+	d = d[i*ngramEntrySize:]
+	return int(binary.BigEndian.Uint32(d[4:])), binary.BigEndian.Uint64(d[8:])
+}
+
+// ngramPostingListAt is like postingListAt, but for the list of sparse n-gram
+// posting lists.
+func (ix *Index) ngramPostingListAt(count int, offset uint64) postingList {
+	return ix.decodePostingList(count, ix.ngramData+offset+4)
+}
+
+// lookup returns the posting list of t, which is a trigram or a sparse n-gram.
+// ok is false if t is a sparse n-gram and the index has no sparse n-gram
+// index, i.e. if any file might contain t.
+func (ix *Index) lookup(t string) (p postingList, ok bool) {
+	if len(t) == 3 {
+		return ix.findPostingList(uint32(t[0])<<16 | uint32(t[1])<<8 | uint32(t[2])), true
+	}
+	if !ix.HasNGrams() {
+		return postingList{}, false
+	}
+	count, offset := ix.findNGramList(ngramKey([]byte(t)))
+	return ix.ngramPostingListAt(count, offset), true
+}
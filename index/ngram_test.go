@@ -0,0 +1,322 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type ngramSpan struct {
+	pos, len int
+}
+
+// scanNGrams returns the sparse n-grams ngramScanner finds in text.
+func scanNGrams(text string) map[ngramSpan]bool {
+	found := make(map[ngramSpan]bool)
+	s := ngramScanner{
+		emit: func(pos int, ngram []byte) {
+			if got, want := string(ngram), text[pos:pos+len(ngram)]; got != want {
+				panic("ngramScanner emitted " + got + ", not " + want)
+			}
+			found[ngramSpan{pos, len(ngram)}] = true
+		},
+	}
+	for i := 0; i < len(text); i++ {
+		s.add(text[i])
+	}
+	return found
+}
+
+// bruteForceNGrams returns the sparse n-grams of text according to their
+// definition.
+func bruteForceNGrams(text string) map[ngramSpan]bool {
+	want := make(map[ngramSpan]bool)
+	for i := 0; i+1 < len(text); i++ {
+		wi := pairWeight(text[i], text[i+1])
+		var inner uint32
+		for j := i + 1; j+1 < len(text) && j+2-i <= maxNGramLen; j++ {
+			wj := pairWeight(text[j], text[j+1])
+			if j+2-i >= minNGramLen && inner < wi && inner < wj {
+				want[ngramSpan{i, j + 2 - i}] = true
+			}
+			if wj > inner {
+				inner = wj
+			}
+		}
+	}
+	return want
+}
+
+func randomText(r *rand.Rand, n int, alphabet string) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func TestNGramScanner(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, alphabet := range []string{"ab", "abcd", "abcdefghijklmnopqrstuvwxyz "} {
+		for n := 0; n < 300; n += 7 {
+			text := randomText(r, n, alphabet)
+			got := scanNGrams(text)
+			want := bruteForceNGrams(text)
+			for span := range want {
+				if !got[span] {
+					t.Errorf("%q: n-gram %q at %d not found", text, text[span.pos:span.pos+span.len], span.pos)
+				}
+			}
+			for span := range got {
+				if !want[span] {
+					t.Errorf("%q: %q at %d is not a sparse n-gram", text, text[span.pos:span.pos+span.len], span.pos)
+				}
+			}
+		}
+	}
+}
+
+func TestSparseNGramsContained(t *testing.T) {
+	// Every file containing a literal must contain the n-grams RegexpQuery
+	// requires for it.
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		literal := randomText(r, 4+r.Intn(60), "abcdefgh")
+		text := randomText(r, r.Intn(50), "abcdefgh") + literal + randomText(r, r.Intn(50), "abcdefgh")
+		keys := make(map[uint32]bool)
+		s := ngramScanner{
+			emit: func(pos int, ngram []byte) {
+				keys[ngramKey(ngram)] = true
+			},
+		}
+		for j := 0; j < len(text); j++ {
+			s.add(text[j])
+		}
+		for _, ngram := range sparseNGrams(literal) {
+			if len(ngram) < minNGramLen || len(ngram) > maxNGramLen || !strings.Contains(literal, ngram) {
+				t.Fatalf("sparseNGrams(%q) returned %q", literal, ngram)
+			}
+			if !keys[ngramKey([]byte(ngram))] {
+				t.Errorf("%q: n-gram %q of %q not indexed", text, ngram, literal)
+			}
+		}
+	}
+}
+
+var ngramFiles = map[string]string{
+	"/a/return.c":   "int f(void) {\n\treturn 0;\n}\n",
+	"/a/retu.c":     "int retu;\nint rn;\nint turn;\n",
+	"/a/include.c":  "#include <stdio.h>\n",
+	"/b/inc.c":      "/* incl lude clud */\n",
+	"/b/potatoes":   "give me all the potatoes",
+	"/b/empty":      "",
+	"/c/tomatoes.h": "tomatoes and potatoes",
+}
+
+func buildNGramIndex(out string, fileData map[string]string, sparse bool) {
+	ix := Create(out)
+	ix.SparseNGrams = sparse
+	ix.AddPaths([]string{"/a", "/b", "/c"})
+	var files []string
+	for name := range fileData {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		ix.Add(name, strings.NewReader(fileData[name]))
+	}
+	ix.Flush()
+}
+
+// candidates returns the names of the files PostingQuery returns for the
+// regular expression expr.
+func candidates(t testing.TB, ix *Index, expr string) []string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, id := range ix.PostingQuery(RegexpQuery(re)) {
+		names = append(names, ix.Name(id))
+	}
+	return names
+}
+
+func TestNGramIndex(t *testing.T) {
+	var files []string
+	for i := 0; i < 4; i++ {
+		f, _ := ioutil.TempFile("", "index-test")
+		defer os.Remove(f.Name())
+		files = append(files, f.Name())
+	}
+	trigrams, ngrams, concat, mixed := files[0], files[1], files[2], files[3]
+	buildNGramIndex(trigrams, ngramFiles, false)
+	buildNGramIndex(ngrams, ngramFiles, true)
+
+	for _, file := range []string{trigrams, ngrams} {
+		if err := Verify(file); err != nil {
+			t.Fatalf("Verify(%q) = %v", file, err)
+		}
+	}
+
+	ixT := Open(trigrams)
+	defer ixT.Close()
+	ixN := Open(ngrams)
+	defer ixN.Close()
+	if ixT.HasNGrams() {
+		t.Errorf("HasNGrams() = true for an index without sparse n-grams")
+	}
+	if !ixN.HasNGrams() {
+		t.Fatalf("HasNGrams() = false for an index with sparse n-grams")
+	}
+
+	for _, expr := range []string{"return", "include", "potatoes", "tomatoes|potatoes", "int (retu|turn)", "stdio\\.h"} {
+		re := regexp.MustCompile(expr)
+		got := candidates(t, ixN, expr)
+		all := candidates(t, ixT, expr)
+		allSet := make(map[string]bool)
+		for _, name := range all {
+			allSet[name] = true
+		}
+		gotSet := make(map[string]bool)
+		for _, name := range got {
+			gotSet[name] = true
+			if !allSet[name] {
+				t.Errorf("%s: candidate %s not a candidate of the trigram index", expr, name)
+			}
+		}
+		for name, content := range ngramFiles {
+			if re.MatchString(content) && !gotSet[name] {
+				t.Errorf("%s: matching file %s not a candidate", expr, name)
+			}
+		}
+	}
+	// The trigrams of “return” and “include” are all contained in
+	// /a/retu.c and /b/inc.c, respectively, but their n-grams are not.
+	if got, want := candidates(t, ixN, "return"), []string{"/a/return.c"}; !equalStrings(got, want) {
+		t.Errorf("candidates(return) = %q, want %q", got, want)
+	}
+	if got, want := candidates(t, ixN, "include"), []string{"/a/include.c"}; !equalStrings(got, want) {
+		t.Errorf("candidates(include) = %q, want %q", got, want)
+	}
+
+	// Concatenating indexes with sparse n-grams keeps them.
+	if err := ConcatN(concat, ngrams, ngrams); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(concat); err != nil {
+		t.Fatal(err)
+	}
+	ix := Open(concat)
+	if !ix.HasNGrams() {
+		t.Errorf("ConcatN: HasNGrams() = false, want true")
+	}
+	if got := candidates(t, ix, "include"); len(got) != 2 || got[0] != "/a/include.c" || got[1] != "/a/include.c" {
+		t.Errorf("ConcatN: candidates(include) = %q, want /a/include.c twice", got)
+	}
+	ix.Close()
+
+	// Merge only keeps the sparse n-grams if both sources have them, even
+	// if (as here) no file of the first source remains.
+	if err := Merge(concat, trigrams, ngrams); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(concat); err != nil {
+		t.Fatal(err)
+	}
+	ix = Open(concat)
+	if ix.HasNGrams() {
+		t.Errorf("Merge: HasNGrams() = true for a source without sparse n-grams")
+	}
+	ix.Close()
+
+	// A single source without sparse n-grams drops them, as the files of
+	// that source would be missing from the sparse n-gram posting lists.
+	if err := ConcatN(mixed, ngrams, trigrams); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(mixed); err != nil {
+		t.Fatal(err)
+	}
+	ix = Open(mixed)
+	defer ix.Close()
+	if ix.HasNGrams() {
+		t.Errorf("ConcatN: HasNGrams() = true for a source without sparse n-grams")
+	}
+	if got := candidates(t, ix, "return"); len(got) != 4 {
+		t.Errorf("ConcatN: candidates(return) = %q, want both return.c and retu.c twice", got)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BenchmarkNGramCandidates indexes the Go files in the vendor directory with
+// and without sparse n-grams and reports the number of candidates of each
+// query, which is the number of files the source backends need to search.
+func BenchmarkNGramCandidates(b *testing.B) {
+	fileData := make(map[string]string)
+	filepath.Walk("../vendor", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			fileData[path] = string(data)
+		}
+		return nil
+	})
+	if len(fileData) == 0 {
+		b.Skip("no files in ../vendor")
+	}
+	var ixes []*Index
+	for _, sparse := range []bool{false, true} {
+		f, err := ioutil.TempFile("", "index-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+		buildNGramIndex(f.Name(), fileData, sparse)
+		ix := Open(f.Name())
+		defer ix.Close()
+		ixes = append(ixes, ix)
+	}
+
+	queries := []string{
+		"return nil",
+		"include",
+		"errors.New",
+		"func main",
+		"NewReader",
+		"if err != nil",
+	}
+	for _, query := range queries {
+		expr := regexp.QuoteMeta(query)
+		b.Run(query, func(b *testing.B) {
+			trigrams := len(candidates(b, ixes[0], expr))
+			var ngrams int
+			for i := 0; i < b.N; i++ {
+				ngrams = len(candidates(b, ixes[1], expr))
+			}
+			b.ReportMetric(float64(trigrams), "trigram-candidates")
+			b.ReportMetric(float64(ngrams), "candidates")
+		})
+	}
+}
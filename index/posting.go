@@ -0,0 +1,310 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Posting list encodings, see read.go for the on-disk format. Plain delta
+// lists have no encoding byte.
+const (
+	postingDeltas = 0
+	postingBlocks = 1
+	postingBitmap = 2
+
+	// postingBlockSize is the number of file ids per block of the block
+	// encoding.
+	postingBlockSize = 128
+
+	// minEncodedCount is the minimum length of posting lists which are
+	// written using the block or bitmap encoding. Shorter lists are cheap to
+	// decode in their entirety.
+	minEncodedCount = 2 * postingBlockSize
+)
+
+// postingEncoder encodes posting lists, choosing the encoding per list.
+type postingEncoder struct {
+	buf    []byte
+	deltas []byte
+	starts []int
+}
+
+// appendDeltas appends the delta list of ids (including the terminating zero)
+// to buf. If starts is non-nil, the offset of every postingBlockSize'th file
+// id within the delta list is appended to it.
+func appendDeltas(buf []byte, ids []uint32, starts *[]int) []byte {
+	var tmp [binary.MaxVarintLen32]byte
+	begin := len(buf)
+	last := ^uint32(0)
+	for i, id := range ids {
+		if starts != nil && i%postingBlockSize == 0 {
+			*starts = append(*starts, len(buf)-begin)
+		}
+		n := binary.PutUvarint(tmp[:], uint64(id-last))
+		buf = append(buf, tmp[:n]...)
+		last = id
+	}
+	return append(buf, 0)
+}
+
+// encode returns the encoding of ids, which must be sorted, as it follows the
+// trigram in the list of posting lists. The result is only valid until the
+// next call.
+func (e *postingEncoder) encode(ids []uint32) []byte {
+	if len(ids) < minEncodedCount {
+		e.buf = appendDeltas(e.buf[:0], ids, nil)
+		return e.buf
+	}
+	e.starts = e.starts[:0]
+	e.deltas = appendDeltas(e.deltas[:0], ids, &e.starts)
+
+	first := ids[0] &^ 7
+	bitmapLen := (ids[len(ids)-1]-first)/8 + 1
+	if uint64(bitmapLen)+8 <= uint64(len(e.deltas))+8*uint64(len(e.starts)) {
+		e.buf = append(e.buf[:0], 0, postingBitmap)
+		e.buf = appendUint32(e.buf, first)
+		e.buf = appendUint32(e.buf, bitmapLen)
+		bitmap := make([]byte, bitmapLen)
+		for _, id := range ids {
+			bitmap[(id-first)/8] |= 1 << ((id - first) % 8)
+		}
+		e.buf = append(e.buf, bitmap...)
+		return e.buf
+	}
+
+	e.buf = append(e.buf[:0], 0, postingBlocks)
+	for b, start := range e.starts {
+		end := (b + 1) * postingBlockSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		e.buf = appendUint32(e.buf, ids[end-1])
+		e.buf = appendUint32(e.buf, uint32(start))
+	}
+	e.buf = append(e.buf, e.deltas...)
+	return e.buf
+}
+
+func appendUint32(buf []byte, x uint32) []byte {
+	return append(buf, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
+// postingList is a posting list of an index in any encoding.
+type postingList struct {
+	ix       *Index
+	encoding byte
+	count    int
+
+	// d is the delta list (for postingDeltas and postingBlocks) or the
+	// bitmap (for postingBitmap).
+	d []byte
+
+	// skip is the skip table of postingBlocks.
+	skip []byte
+
+	// first is the file id of the first bit of postingBitmap.
+	first uint32
+}
+
+// postingListAt returns the posting list with count entries at offset in the
+// list of posting lists.
+func (ix *Index) postingListAt(count int, offset uint64) postingList {
+	return ix.decodePostingList(count, ix.postData+offset+3)
+}
+
+// decodePostingList returns the posting list with count entries whose data
+// (i.e. without the trigram) starts at offset off in the index data.
+func (ix *Index) decodePostingList(count int, off uint64) postingList {
+	p := postingList{ix: ix, count: count}
+	if count == 0 {
+		return p
+	}
+	p.d = ix.slice(off, -1)
+	if ix.version < 3 || p.d[0] != 0 {
+		return p
+	}
+	if len(p.d) < 2 {
+		corrupt(ix.File)
+	}
+	p.encoding = p.d[1]
+	switch p.encoding {
+	case postingBlocks:
+		n := 8 * ((count + postingBlockSize - 1) / postingBlockSize)
+		if len(p.d) < 2+n {
+			corrupt(ix.File)
+		}
+		p.skip = p.d[2 : 2+n]
+		p.d = p.d[2+n:]
+	case postingBitmap:
+		if len(p.d) < 2+8 {
+			corrupt(ix.File)
+		}
+		p.first = binary.BigEndian.Uint32(p.d[2:])
+		n := binary.BigEndian.Uint32(p.d[6:])
+		if uint64(len(p.d)) < 2+8+uint64(n) {
+			corrupt(ix.File)
+		}
+		p.d = p.d[10 : 10+n]
+	default:
+		corrupt(ix.File)
+	}
+	return p
+}
+
+func (ix *Index) findPostingList(trigram uint32) postingList {
+	count, offset := ix.findList(trigram)
+	return ix.postingListAt(count, offset)
+}
+
+// list returns the file ids of p which are contained in restrict (unless
+// restrict is nil).
+func (p *postingList) list(restrict []uint32) []uint32 {
+	if p.encoding != postingBitmap {
+		return myPostingList(p.d, p.count, restrict)
+	}
+	if restrict != nil {
+		return p.bitmapAnd(restrict)
+	}
+	result := make([]uint32, 0, p.count)
+	for i, b := range p.d {
+		for bit := uint32(0); b != 0; bit++ {
+			if b&1 != 0 {
+				result = append(result, p.first+uint32(i)*8+bit)
+			}
+			b >>= 1
+		}
+	}
+	if len(result) != p.count {
+		corrupt(p.ix.File)
+	}
+	return result
+}
+
+// and returns the file ids contained in both p and list (and restrict, unless
+// restrict is nil).
+func (p *postingList) and(list []uint32, restrict []uint32) []uint32 {
+	if p.encoding == postingDeltas || p.count == 0 {
+		return myPostingAnd(p.d, p.count, list, restrict)
+	}
+	if restrict != nil {
+		list = intersect(list, restrict)
+	}
+	if p.encoding == postingBitmap {
+		return p.bitmapAnd(list)
+	}
+	// Decoding only the blocks which can contain the file ids in list pays
+	// off if list touches only a small fraction of the blocks.
+	if len(list)*8 >= len(p.skip)/8 {
+		return myPostingAnd(p.d, p.count, list, nil)
+	}
+	return p.blockAnd(list)
+}
+
+// or returns the file ids contained in list or in p (and restrict, unless
+// restrict is nil).
+func (p *postingList) or(list []uint32, restrict []uint32) []uint32 {
+	if p.encoding != postingBitmap {
+		return myPostingOr(p.d, p.count, list, restrict)
+	}
+	return mergeOr(list, p.list(restrict))
+}
+
+func (p *postingList) bitmapAnd(list []uint32) []uint32 {
+	var result []uint32
+	for _, id := range list {
+		if id < p.first {
+			continue
+		}
+		bit := id - p.first
+		if int(bit/8) >= len(p.d) {
+			break
+		}
+		if p.d[bit/8]&(1<<(bit%8)) != 0 {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+func (p *postingList) blockLast(b int) uint32 {
+	return binary.BigEndian.Uint32(p.skip[8*b:])
+}
+
+// decodeBlock appends the file ids of block b to ids.
+func (p *postingList) decodeBlock(b int, ids []uint32) []uint32 {
+	fileid := ^uint32(0)
+	if b > 0 {
+		fileid = p.blockLast(b - 1)
+	}
+	start := binary.BigEndian.Uint32(p.skip[8*b+4:])
+	if int(start) >= len(p.d) {
+		corrupt(p.ix.File)
+	}
+	d := p.d[start:]
+	n := p.count - b*postingBlockSize
+	if n > postingBlockSize {
+		n = postingBlockSize
+	}
+	for i := 0; i < n; i++ {
+		delta, l := binary.Uvarint(d)
+		if l <= 0 || delta == 0 {
+			corrupt(p.ix.File)
+		}
+		d = d[l:]
+		fileid += uint32(delta)
+		ids = append(ids, fileid)
+	}
+	return ids
+}
+
+// blockAnd is like and, but uses the skip table to decode only the blocks
+// which can contain the file ids of list.
+func (p *postingList) blockAnd(list []uint32) []uint32 {
+	var result, block []uint32
+	blocks := len(p.skip) / 8
+	b := 0
+	decoded := -1
+	for _, id := range list {
+		if p.blockLast(b) < id {
+			from := b
+			b = from + sort.Search(blocks-from, func(i int) bool {
+				return p.blockLast(from+i) >= id
+			})
+			if b == blocks {
+				break
+			}
+		}
+		if decoded != b {
+			block = p.decodeBlock(b, block[:0])
+			decoded = b
+		}
+		i := sort.Search(len(block), func(i int) bool {
+			return block[i] >= id
+		})
+		if i < len(block) && block[i] == id {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// intersect returns the file ids contained in both l1 and l2.
+func intersect(l1, l2 []uint32) []uint32 {
+	var l []uint32
+	i := 0
+	j := 0
+	for i < len(l1) && j < len(l2) {
+		switch {
+		case l1[i] < l2[j]:
+			i++
+		case l1[i] > l2[j]:
+			j++
+		default:
+			l = append(l, l1[i])
+			i++
+			j++
+		}
+	}
+	return l
+}
@@ -0,0 +1,307 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"testing"
+)
+
+var benchIndex = flag.String("bench_index",
+	"",
+	"Path to an index file (e.g. a shard of a production deployment) which BenchmarkIndex re-encodes and queries.")
+
+const encodingFiles = 6000
+
+// encodingFileData returns files whose posting lists use all encodings: "aaa"
+// is contained in every file (bitmap), "bbb" in every 17th file (blocks) and
+// "ccc" in every 1000th file (deltas).
+func encodingFileData(n int) map[string]string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		content := "aaa"
+		if i%17 == 0 {
+			content += " bbb"
+		}
+		if i%1000 == 0 {
+			content += " ccc"
+		}
+		files[fmt.Sprintf("/src/%05d", i)] = content
+	}
+	return files
+}
+
+func every(n, step int) []uint32 {
+	var ids []uint32
+	for i := 0; i < n; i += step {
+		ids = append(ids, uint32(i))
+	}
+	return ids
+}
+
+func TestPostingEncoder(t *testing.T) {
+	var enc postingEncoder
+	for _, test := range []struct {
+		ids  []uint32
+		want byte
+	}{
+		{every(encodingFiles, 1000), postingDeltas},
+		{every(encodingFiles, 17), postingBlocks},
+		{every(encodingFiles, 1), postingBitmap},
+		{every(encodingFiles, 3), postingBitmap},
+	} {
+		d := enc.encode(test.ids)
+		got := byte(postingDeltas)
+		if d[0] == 0 {
+			got = d[1]
+		}
+		if got != test.want {
+			t.Errorf("encode(%d ids) uses encoding %d, want %d", len(test.ids), got, test.want)
+		}
+	}
+}
+
+func TestPostingEncodings(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, []string{"/src"}, encodingFileData(encodingFiles))
+	if err := Verify(out); err != nil {
+		t.Fatalf("Verify(%q) = %v, want nil", out, err)
+	}
+
+	f2, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f2.Name())
+	concatenated := f2.Name()
+	if err := ConcatN(concatenated, out, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(concatenated); err != nil {
+		t.Fatalf("Verify(%q) = %v, want nil", concatenated, err)
+	}
+
+	aaa := tri('a', 'a', 'a')
+	bbb := tri('b', 'b', 'b')
+	ccc := tri('c', 'c', 'c')
+	for _, test := range []struct {
+		file string
+		n    int
+	}{
+		{out, encodingFiles},
+		// The second copy of the files in a concatenated index changes
+		// neither the encodings nor which lists are contained in each other.
+		{concatenated, 2 * encodingFiles},
+	} {
+		ix := Open(test.file)
+		if got, want := ix.PostingList(aaa), every(test.n, 1); !equalList(got, want) {
+			t.Errorf("%s: PostingList(aaa) has %d entries, want %d", test.file, len(got), len(want))
+		}
+		bbbList := every(encodingFiles, 17)
+		cccList := every(encodingFiles, 1000)
+		if test.n > encodingFiles {
+			for _, id := range every(encodingFiles, 17) {
+				bbbList = append(bbbList, encodingFiles+id)
+			}
+			for _, id := range every(encodingFiles, 1000) {
+				cccList = append(cccList, encodingFiles+id)
+			}
+		}
+		if got := ix.PostingList(bbb); !equalList(got, bbbList) {
+			t.Errorf("%s: PostingList(bbb) has %d entries, want %d", test.file, len(got), len(bbbList))
+		}
+		if got := ix.PostingList(ccc); !equalList(got, cccList) {
+			t.Errorf("%s: PostingList(ccc) = %v, want %v", test.file, got, cccList)
+		}
+
+		// bbb and ccc are both contained in every 17000th file.
+		both := intersect(bbbList, cccList)
+		if got := ix.PostingAnd(cccList, bbb); !equalList(got, both) {
+			t.Errorf("%s: PostingAnd(ccc, bbb) = %v, want %v", test.file, got, both)
+		}
+		if got := ix.PostingAnd(bbbList, ccc); !equalList(got, both) {
+			t.Errorf("%s: PostingAnd(bbb, ccc) = %v, want %v", test.file, got, both)
+		}
+		if got := ix.PostingAnd(cccList, aaa); !equalList(got, cccList) {
+			t.Errorf("%s: PostingAnd(ccc, aaa) = %v, want %v", test.file, got, cccList)
+		}
+		if got := ix.postingAnd(bbbList, aaa, cccList); !equalList(got, both) {
+			t.Errorf("%s: postingAnd(bbb, aaa, ccc) = %v, want %v", test.file, got, both)
+		}
+		if got := ix.postingList(aaa, cccList); !equalList(got, cccList) {
+			t.Errorf("%s: postingList(aaa, ccc) = %v, want %v", test.file, got, cccList)
+		}
+		if got := ix.postingList(bbb, cccList); !equalList(got, both) {
+			t.Errorf("%s: postingList(bbb, ccc) = %v, want %v", test.file, got, both)
+		}
+		if got := ix.PostingOr(cccList, bbb); !equalList(got, mergeOr(cccList, bbbList)) {
+			t.Errorf("%s: PostingOr(ccc, bbb) has %d entries, want %d", test.file, len(got), len(mergeOr(cccList, bbbList)))
+		}
+		// restrict only applies to the posting list, not to list.
+		if got, want := ix.postingOr(cccList, aaa, bbbList), mergeOr(cccList, bbbList); !equalList(got, want) {
+			t.Errorf("%s: postingOr(ccc, aaa, bbb) has %d entries, want %d", test.file, len(got), len(want))
+		}
+		ix.Close()
+	}
+}
+
+// memPostingList returns a posting list of ids, encoded by enc, without
+// writing an index file.
+func memPostingList(enc *postingEncoder, ids []uint32) postingList {
+	ix := &Index{version: 4}
+	ix.data.d = append([]byte("xyz"), enc.encode(ids)...)
+	return ix.postingListAt(len(ids), 0)
+}
+
+func TestPostingListAnd(t *testing.T) {
+	const n = 100000
+	r := rand.New(rand.NewSource(1))
+	var enc postingEncoder
+	for _, density := range []float64{0.01, 0.05, 0.5} {
+		ids := randomList(r, n, density)
+		p := memPostingList(&enc, ids)
+		if got := p.list(nil); !equalList(got, ids) {
+			t.Errorf("encoding %d: list() has %d entries, want %d", p.encoding, len(got), len(ids))
+		}
+		// Short lists result in blockAnd for the block encoding.
+		for _, listDensity := range []float64{0.0001, 0.001, 0.1} {
+			list := randomList(r, n, listDensity)
+			restrict := randomList(r, n, 0.5)
+			if got, want := p.and(list, nil), intersect(list, ids); !equalList(got, want) {
+				t.Errorf("encoding %d: and(%d ids) = %v, want %v", p.encoding, len(list), got, want)
+			}
+			if got, want := p.and(list, restrict), intersect(intersect(list, ids), restrict); !equalList(got, want) {
+				t.Errorf("encoding %d: and(%d ids, restrict) = %v, want %v", p.encoding, len(list), got, want)
+			}
+			if got, want := p.list(list), intersect(list, ids); !equalList(got, want) {
+				t.Errorf("encoding %d: list(%d ids) = %v, want %v", p.encoding, len(list), got, want)
+			}
+			if got, want := p.or(list, nil), mergeOr(list, ids); !equalList(got, want) {
+				t.Errorf("encoding %d: or(%d ids) has %d entries, want %d", p.encoding, len(list), len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestVerifyCorruptSkipTable(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, []string{"/src"}, encodingFileData(encodingFiles))
+
+	ix := Open(out)
+	count, offset := ix.findList(tri('b', 'b', 'b'))
+	if p := ix.postingListAt(count, offset); p.encoding != postingBlocks {
+		t.Fatalf("posting list of bbb uses encoding %d, want %d", p.encoding, postingBlocks)
+	}
+	// Change the last file id of the first block in the skip table.
+	off := ix.postData + offset + 3 + 2 + 3
+	ix.Close()
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[off] ^= 0x01
+	path := writeTempIndex(t, string(data))
+	defer os.Remove(path)
+	ix = Open(path)
+	defer ix.Close()
+	// Skip the checksums, which would catch the corruption first.
+	err = ix.verifyPostingLists()
+	if _, ok := err.(*CorruptError); !ok {
+		t.Fatalf("verifyPostingLists() = %v, want a *CorruptError", err)
+	}
+}
+
+// randomList returns a sorted list of file ids below n, each of which is
+// contained with probability p.
+func randomList(r *rand.Rand, n int, p float64) []uint32 {
+	var ids []uint32
+	for i := 0; i < n; i++ {
+		if r.Float64() < p {
+			ids = append(ids, uint32(i))
+		}
+	}
+	return ids
+}
+
+// benchmarkPostingAnd intersects a posting list containing the given fraction
+// of 1000000 files with a list of 20 files.
+func benchmarkPostingAnd(b *testing.B, density float64, encoding byte) {
+	const n = 1000000
+	r := rand.New(rand.NewSource(1))
+	ids := randomList(r, n, density)
+	list := randomList(r, n, 0.00002)
+
+	var p postingList
+	if encoding == postingDeltas {
+		ix := &Index{version: 4}
+		ix.data.d = appendDeltas([]byte("xyz"), ids, nil)
+		p = ix.postingListAt(len(ids), 0)
+	} else {
+		var enc postingEncoder
+		if p = memPostingList(&enc, ids); p.encoding != encoding {
+			b.Skipf("density %f results in encoding %d, not %d", density, p.encoding, encoding)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.and(list, nil)
+	}
+}
+
+func BenchmarkPostingAndSparseDeltas(b *testing.B) { benchmarkPostingAnd(b, 0.05, postingDeltas) }
+func BenchmarkPostingAndSparseBlocks(b *testing.B) { benchmarkPostingAnd(b, 0.05, postingBlocks) }
+func BenchmarkPostingAndDenseDeltas(b *testing.B)  { benchmarkPostingAnd(b, 0.5, postingDeltas) }
+func BenchmarkPostingAndDenseBitmap(b *testing.B)  { benchmarkPostingAnd(b, 0.5, postingBitmap) }
+
+// BenchmarkIndex compares the time it takes to query the index specified by
+// -bench_index with the time it takes to query the same index re-encoded in
+// the current format.
+func BenchmarkIndex(b *testing.B) {
+	if *benchIndex == "" {
+		b.Skip("-bench_index not specified")
+	}
+	f, err := ioutil.TempFile("", "index-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err := ConcatN(f.Name(), *benchIndex); err != nil {
+		b.Fatal(err)
+	}
+
+	queries := []string{
+		"int main",
+		"package main",
+		"#include <stdio.h>",
+		"return",
+		"i18n",
+		"XCreateWindow",
+	}
+	for _, file := range []string{*benchIndex, f.Name()} {
+		ix, err := OpenErr(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer ix.Close()
+		for _, query := range queries {
+			re, err := syntax.Parse(regexp.QuoteMeta(query), syntax.Perl)
+			if err != nil {
+				b.Fatal(err)
+			}
+			q := RegexpQuery(re)
+			b.Run(fmt.Sprintf("v%d/%s", ix.Version(), query), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ix.PostingQuery(q)
+				}
+			})
+		}
+	}
+}
@@ -8,12 +8,16 @@ package index
 //
 // An index stored on disk has the format:
 //
-//	"csearch index 1\n"
+//	"csearch index 3\n"
 //	list of paths
 //	list of names
 //	list of posting lists
 //	name index
 //	posting list index
+//	file metadata
+//	list of sparse n-gram posting lists
+//	sparse n-gram index
+//	checksums
 //	trailer
 //
 // The list of paths is a sorted sequence of NUL-terminated file or directory names.
@@ -39,15 +43,43 @@ package index
 // not recorded at all.  The list of posting lists ends with an entry
 // with trigram "\xff\xff\xff" and a delta list consisting a single zero.
 //
+// Long posting lists can use a different encoding, which is chosen per list
+// when writing the index (see posting.go). Since a delta is never zero, such
+// lists are marked by a zero byte following the trigram:
+//
+//	trigram [3]
+//	"\x00"
+//	encoding [1]
+//	data...
+//
+// With the block encoding (1), the data is a skip table followed by a delta
+// list as described above. The skip table has an entry for each block of 128
+// file IDs (the last block may be shorter):
+//
+//	last file ID in block [4]
+//	offset of block in delta list [4]
+//
+// This allows decoding only those blocks which can contain a given file ID.
+// With the bitmap encoding (2), used for very dense lists, the data is
+//
+//	first file ID [4]
+//	bitmap length [4]
+//	bitmap [bitmap length]
+//
+// Bit i of the bitmap (byte i/8, least significant bit first) is set if
+// the list contains file ID first file ID + i.
+//
 // The indexes enable efficient random access to the lists.  The name
-// index is a sequence of 4-byte big-endian values listing the byte
+// index is a sequence of 8-byte big-endian values listing the byte
 // offset in the name list where each name begins.  The posting list
 // index is a sequence of index entries describing each successive
 // posting list.  Each index entry has the form:
 //
 //	trigram [3]
 //	file count [4]
-//	offset [4]
+//	offset [8]
+//
+// File IDs are 32-bit, so the file count always fits into 4 bytes.
 //
 // Index entries are only written for the non-empty posting lists,
 // so finding the posting list for a specific trigram requires a
@@ -55,28 +87,100 @@ package index
 // of the possible trigrams are never seen, so omitting the missing
 // ones represents a significant storage savings.
 //
+// The file metadata is empty if none of the files have metadata (e.g. in an
+// index concatenated from indexes of older versions). Otherwise, it has the
+// form:
+//
+//	string table length [4]
+//	string table [string table length]
+//	file records...
+//
+// The string table is a sequence of NUL-terminated strings, starting with the
+// empty string. There is one file record per file, in file ID order:
+//
+//	package [4]
+//	version [4]
+//	language [4]
+//	flags [4]
+//	size [8]
+//	content hash [8]
+//
+// Package, version and language are offsets of strings in the string table,
+// offset 0 meaning unknown. Each string is stored only once, so the offset of
+// the package name identifies the package within the index. See FileMeta for
+// the remaining fields.
+//
+// The sparse n-gram index (see ngram.go) is optional, i.e. both of its sections
+// are empty if the index was written without it. Otherwise, the list of
+// sparse n-gram posting lists is a sequence of posting lists of the form
+//
+//	key [4]
+//	deltas [v]...
+//
+// in any of the encodings described above, and the sparse n-gram index has an
+// entry for each of them, sorted by key:
+//
+//	key [4]
+//	file count [4]
+//	offset [8]
+//
+// The key is a hash of the n-gram, and the offset is relative to the start of
+// the list of sparse n-gram posting lists. Both sections end with an entry for
+// key 0xffffffff and an empty delta list, which distinguishes an empty sparse
+// n-gram index from a missing one.
+//
+// The checksums are big-endian CRC-32C (Castagnoli) checksums of each of the
+// eight sections above (in the same order), followed by the checksum of the
+// entire file up to this point, i.e. including the section checksums. They are
+// only checked by Verify.
+//
 // The trailer has the form:
 //
-//	offset of path list [4]
-//	offset of name list [4]
-//	offset of posting lists [4]
-//	offset of name index [4]
-//	offset of posting list index [4]
+//	offset of path list [8]
+//	offset of name list [8]
+//	offset of posting lists [8]
+//	offset of name index [8]
+//	offset of posting list index [8]
+//	offset of file metadata [8]
+//	offset of list of sparse n-gram posting lists [8]
+//	offset of sparse n-gram index [8]
+//	offset of checksums [8]
 //	"\ncsearch trailr\n"
+//
+// Version 2 of the format ("csearch index 2\n") has no file metadata, no
+// sparse n-gram index and no checksums (and hence none of their offsets in the
+// trailer), and only uses delta lists for posting lists. Version 1 ("csearch
+// index 1\n") additionally uses 4-byte offsets (in the name index, the posting
+// list index and the trailer), which limits an index to 4 GiB. Open reads all
+// versions, all writers in this package write version 3. Convert converts an
+// index of any version to version 3.
 
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"log"
 	"os"
 	"runtime"
 	"sort"
+	"strings"
 	"syscall"
 )
 
 const (
-	magic        = "csearch index 1\n"
+	magicV1      = "csearch index 1\n"
+	magicV2      = "csearch index 2\n"
+	magic        = "csearch index 3\n"
 	trailerMagic = "\ncsearch trailr\n"
+
+	// numSections is the number of sections of the current version.
+	numSections = 8
+
+	// ngramEntrySize is the size of an entry of the sparse n-gram index.
+	ngramEntrySize = 4 + 4 + 8
+
+	// metaRecordSize is the size of a file record in the file metadata.
+	metaRecordSize = 4 + 4 + 4 + 4 + 8 + 8
 )
 
 // An Index implements read-only access to a trigram index.
@@ -84,47 +188,155 @@ type Index struct {
 	File      string
 	Verbose   bool
 	data      mmapData
-	pathData  uint32
-	nameData  uint32
-	postData  uint32
-	nameIndex uint32
-	postIndex uint32
-	numName   int
-	numPost   int
+	version   int
+	pathData  uint64
+	nameData  uint64
+	postData  uint64
+	nameIndex uint64
+	postIndex uint64
+	// metaData is the offset of the file metadata, ngramData and ngramIndex
+	// are the offsets of the sections of the sparse n-gram index, and
+	// checksums is the offset of the checksum section. All of them are
+	// empty for indexes of version 1 and 2.
+	metaData   uint64
+	ngramData  uint64
+	ngramIndex uint64
+	checksums  uint64
+	// metaRecords is the offset of the first file record, or 0 if the file
+	// metadata is empty.
+	metaRecords uint64
+	numName     int
+	numPost     int
+	numNGram    int
+
+	// offsetSize is the size of an offset in bytes, i.e. 4 for version 1
+	// and 8 otherwise.
+	offsetSize    int
+	postEntrySize uint64
+}
+
+// Open opens the index file. It terminates the program if file cannot be read
+// or is corrupt, see OpenErr.
+func Open(file string) *Index {
+	ix, err := OpenErr(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ix
 }
 
-const postEntrySize = 3 + 4 + 4
+// OpenErr is like Open, but returns an error instead of terminating the
+// program. Corrupt index files result in a *CorruptError.
+//
+// Note that the index is only validated superficially: an index can still turn
+// out to be corrupt when querying it, see PostingQueryErr and NameErr.
+func OpenErr(file string) (ix *Index, err error) {
+	defer catch(&err)
+	return open(file), nil
+}
 
-func Open(file string) *Index {
+func open(file string) (ix *Index) {
 	mm := mmap(file)
-	if len(mm.d) < 4*4+len(trailerMagic) || string(mm.d[len(mm.d)-len(trailerMagic):]) != trailerMagic {
+	ix = &Index{data: mm}
+	ix.File = file
+	defer func() {
+		if r := recover(); r != nil {
+			ix.Close()
+			panic(r)
+		}
+	}()
+	// Number of offsets in the trailer.
+	offsets := 5
+	switch {
+	case bytes.HasPrefix(mm.d, []byte(magic)):
+		ix.version = 3
+		ix.offsetSize = 8
+		offsets = numSections + 1
+	case bytes.HasPrefix(mm.d, []byte(magicV2)):
+		ix.version = 2
+		ix.offsetSize = 8
+	case bytes.HasPrefix(mm.d, []byte(magicV1)):
+		ix.version = 1
+		ix.offsetSize = 4
+	default:
 		corrupt(file)
 	}
-	n := uint32(len(mm.d) - len(trailerMagic) - 5*4)
-	ix := &Index{data: mm}
-	ix.File = file
-	ix.pathData = ix.uint32(n)
-	ix.nameData = ix.uint32(n + 4)
-	ix.postData = ix.uint32(n + 8)
-	ix.nameIndex = ix.uint32(n + 12)
-	ix.postIndex = ix.uint32(n + 16)
-	ix.numName = int((ix.postIndex-ix.nameIndex)/4) - 1
-	ix.numPost = int((n - ix.postIndex) / postEntrySize)
+	ix.postEntrySize = uint64(3 + 4 + ix.offsetSize)
+	if len(mm.d) < len(magic)+offsets*ix.offsetSize+len(trailerMagic) || string(mm.d[len(mm.d)-len(trailerMagic):]) != trailerMagic {
+		corrupt(file)
+	}
+	n := uint64(len(mm.d) - len(trailerMagic) - offsets*ix.offsetSize)
+	o := uint64(ix.offsetSize)
+	ix.pathData = ix.offset(n)
+	ix.nameData = ix.offset(n + o)
+	ix.postData = ix.offset(n + 2*o)
+	ix.nameIndex = ix.offset(n + 3*o)
+	ix.postIndex = ix.offset(n + 4*o)
+	ix.metaData = n
+	ix.ngramData = n
+	ix.ngramIndex = n
+	ix.checksums = n
+	if ix.version >= 3 {
+		ix.metaData = ix.offset(n + 5*o)
+		ix.ngramData = ix.offset(n + 6*o)
+		ix.ngramIndex = ix.offset(n + 7*o)
+		ix.checksums = ix.offset(n + 8*o)
+		// One checksum per section plus one for the entire file.
+		if ix.checksums+4*(numSections+1) != n {
+			corrupt(file)
+		}
+	}
+	if ix.pathData > ix.nameData ||
+		ix.nameData > ix.postData ||
+		ix.postData > ix.nameIndex ||
+		ix.nameIndex+o > ix.postIndex ||
+		ix.postIndex > ix.metaData ||
+		ix.metaData > ix.ngramData ||
+		ix.ngramData > ix.ngramIndex ||
+		ix.ngramIndex > ix.checksums ||
+		(ix.metaData-ix.postIndex)%ix.postEntrySize != 0 ||
+		(ix.checksums-ix.ngramIndex)%ngramEntrySize != 0 {
+		corrupt(file)
+	}
+	ix.numName = int((ix.postIndex-ix.nameIndex)/o) - 1
+	ix.numPost = int((ix.metaData - ix.postIndex) / ix.postEntrySize)
+	ix.numNGram = int((ix.checksums - ix.ngramIndex) / ngramEntrySize)
+	if ix.metaData < ix.ngramData {
+		ix.metaRecords = ix.metaData + 4 + uint64(ix.uint32(ix.metaData))
+		if ix.metaRecords > ix.ngramData ||
+			ix.ngramData-ix.metaRecords != uint64(ix.numName)*metaRecordSize {
+			corrupt(file)
+		}
+	}
 	return ix
 }
 
-func (ix *Index) Close() {
-	if err := syscall.Munmap(ix.data.orig); err != nil {
-		log.Fatalf("munmap: %v", err)
+// Version returns the version of the on-disk format of the index.
+func (ix *Index) Version() int {
+	return ix.version
+}
+
+// NumNames returns the number of files in the index. File ids range from 0 to
+// NumNames()-1.
+func (ix *Index) NumNames() int {
+	return ix.numName
+}
+
+func (ix *Index) Close() error {
+	if ix.data.orig != nil {
+		if err := syscall.Munmap(ix.data.orig); err != nil {
+			ix.data.f.Close()
+			return fmt.Errorf("munmap %s: %v", ix.File, err)
+		}
 	}
-	ix.data.f.Close()
+	return ix.data.f.Close()
 }
 
 // slice returns the slice of index data starting at the given byte offset.
 // If n >= 0, the slice must have length at least n and is truncated to length n.
-func (ix *Index) slice(off uint32, n int) []byte {
+func (ix *Index) slice(off uint64, n int) []byte {
 	o := int(off)
-	if uint32(o) != off || n >= 0 && o+n > len(ix.data.d) {
+	if uint64(o) != off || o > len(ix.data.d) || n >= 0 && o+n > len(ix.data.d) {
 		corrupt(ix.File)
 	}
 	if n < 0 {
@@ -134,12 +346,21 @@ func (ix *Index) slice(off uint32, n int) []byte {
 }
 
 // uint32 returns the uint32 value at the given offset in the index data.
-func (ix *Index) uint32(off uint32) uint32 {
+func (ix *Index) uint32(off uint64) uint32 {
 	return binary.BigEndian.Uint32(ix.slice(off, 4))
 }
 
+// offset returns the offset (4 or 8 bytes, depending on the version) at the
+// given offset in the index data.
+func (ix *Index) offset(off uint64) uint64 {
+	if ix.offsetSize == 4 {
+		return uint64(ix.uint32(off))
+	}
+	return binary.BigEndian.Uint64(ix.slice(off, 8))
+}
+
 // uvarint returns the varint value at the given offset in the index data.
-func (ix *Index) uvarint(off uint32) uint32 {
+func (ix *Index) uvarint(off uint64) uint32 {
 	v, n := binary.Uvarint(ix.slice(off, -1))
 	if n <= 0 {
 		corrupt(ix.File)
@@ -157,18 +378,18 @@ func (ix *Index) Paths() []string {
 			break
 		}
 		x = append(x, string(s))
-		off += uint32(len(s) + 1)
+		off += uint64(len(s) + 1)
 	}
 	return x
 }
 
 // NameBytes returns the name corresponding to the given fileid.
 func (ix *Index) NameBytes(fileid uint32) []byte {
-	off := ix.uint32(ix.nameIndex + 4*fileid)
+	off := ix.offset(ix.nameIndex + uint64(ix.offsetSize)*uint64(fileid))
 	return ix.str(ix.nameData + off)
 }
 
-func (ix *Index) str(off uint32) []byte {
+func (ix *Index) str(off uint64) []byte {
 	str := ix.slice(off, -1)
 	i := bytes.IndexByte(str, '\x00')
 	if i < 0 {
@@ -182,111 +403,59 @@ func (ix *Index) Name(fileid uint32) string {
 	return string(ix.NameBytes(fileid))
 }
 
-// listAt returns the index list entry at the given offset.
-func (ix *Index) listAt(off uint32) (trigram, count, offset uint32) {
-	d := ix.slice(ix.postIndex+off, postEntrySize)
-	trigram = uint32(d[0])<<16 | uint32(d[1])<<8 | uint32(d[2])
-	count = binary.BigEndian.Uint32(d[3:])
-	offset = binary.BigEndian.Uint32(d[3+4:])
-	return
+// NameErr is like Name, but returns a *CorruptError instead of panicking if
+// the name index is corrupt.
+func (ix *Index) NameErr(fileid uint32) (name string, err error) {
+	defer catch(&err)
+	return ix.Name(fileid), nil
 }
 
-func (ix *Index) dumpPosting() {
-	d := ix.slice(ix.postIndex, postEntrySize*ix.numPost)
-	for i := 0; i < ix.numPost; i++ {
-		j := i * postEntrySize
-		t := uint32(d[j])<<16 | uint32(d[j+1])<<8 | uint32(d[j+2])
-		count := int(binary.BigEndian.Uint32(d[j+3:]))
-		offset := binary.BigEndian.Uint32(d[j+3+4:])
-		log.Printf("%#x: %d at %d", t, count, offset)
+// postEntryOffset decodes the offset of the posting list index entry d.
+func (ix *Index) postEntryOffset(d []byte) uint64 {
+	if ix.offsetSize == 4 {
+		return uint64(binary.BigEndian.Uint32(d[3+4:]))
 	}
+	return binary.BigEndian.Uint64(d[3+4:])
+}
+
+// listAt returns the index list entry number n.
+func (ix *Index) listAt(n uint32) (trigram, count uint32, offset uint64) {
+	d := ix.slice(ix.postIndex+uint64(n)*ix.postEntrySize, int(ix.postEntrySize))
+	trigram = uint32(d[0])<<16 | uint32(d[1])<<8 | uint32(d[2])
+	count = binary.BigEndian.Uint32(d[3:])
+	offset = ix.postEntryOffset(d)
+	return
 }
 
-func (ix *Index) findList(trigram uint32) (count int, offset uint32) {
+func (ix *Index) findList(trigram uint32) (count int, offset uint64) {
 	// binary search
-	d := ix.slice(ix.postIndex, postEntrySize*ix.numPost)
+	size := int(ix.postEntrySize)
+	d := ix.slice(ix.postIndex, size*ix.numPost)
 	i := sort.Search(ix.numPost, func(i int) bool {
-		i *= postEntrySize
+		i *= size
 		t := uint32(d[i])<<16 | uint32(d[i+1])<<8 | uint32(d[i+2])
 		return t >= trigram
 	})
 	if i >= ix.numPost {
 		return 0, 0
 	}
-	i *= postEntrySize
+	i *= size
 	t := uint32(d[i])<<16 | uint32(d[i+1])<<8 | uint32(d[i+2])
 	if t != trigram {
 		return 0, 0
 	}
 	count = int(binary.BigEndian.Uint32(d[i+3:]))
-	offset = binary.BigEndian.Uint32(d[i+3+4:])
+	offset = ix.postEntryOffset(d[i:])
 	return
 }
 
-type postReader struct {
-	ix       *Index
-	count    int
-	offset   uint32
-	fileid   uint32
-	d        []byte
-	restrict []uint32
-}
-
-func (r *postReader) init(ix *Index, trigram uint32, restrict []uint32) {
-	count, offset := ix.findList(trigram)
-	if count == 0 {
-		return
-	}
-	r.ix = ix
-	r.count = count
-	r.offset = offset
-	r.fileid = ^uint32(0)
-	r.d = ix.slice(ix.postData+offset+3, -1)
-	r.restrict = restrict
-}
-
-func (r *postReader) max() int {
-	return int(r.count)
-}
-
-func (r *postReader) next() bool {
-	for r.count > 0 {
-		r.count--
-		delta64, n := binary.Uvarint(r.d)
-		delta := uint32(delta64)
-		if n <= 0 || delta == 0 {
-			corrupt(r.ix.File)
-		}
-		r.d = r.d[n:]
-		r.fileid += delta
-		if r.restrict != nil {
-			i := 0
-			for i < len(r.restrict) && r.restrict[i] < r.fileid {
-				i++
-			}
-			r.restrict = r.restrict[i:]
-			if len(r.restrict) == 0 || r.restrict[0] != r.fileid {
-				continue
-			}
-		}
-		return true
-	}
-	// list should end with terminating 0 delta
-	if r.d != nil && (len(r.d) == 0 || r.d[0] != 0) {
-		corrupt(r.ix.File)
-	}
-	r.fileid = ^uint32(0)
-	return false
-}
-
 func (ix *Index) PostingList(trigram uint32) []uint32 {
 	return ix.postingList(trigram, nil)
 }
 
 func (ix *Index) postingList(trigram uint32, restrict []uint32) []uint32 {
-	var r postReader
-	r.init(ix, trigram, restrict)
-	return myPostingList(r.d, r.max(), restrict)
+	p := ix.findPostingList(trigram)
+	return p.list(restrict)
 }
 
 func (ix *Index) PostingAnd(list []uint32, trigram uint32) []uint32 {
@@ -294,9 +463,8 @@ func (ix *Index) PostingAnd(list []uint32, trigram uint32) []uint32 {
 }
 
 func (ix *Index) postingAnd(list []uint32, trigram uint32, restrict []uint32) []uint32 {
-	var r postReader
-	r.init(ix, trigram, restrict)
-	return myPostingAnd(r.d, r.max(), list, restrict)
+	p := ix.findPostingList(trigram)
+	return p.and(list, restrict)
 }
 
 func (ix *Index) PostingOr(list []uint32, trigram uint32) []uint32 {
@@ -304,18 +472,24 @@ func (ix *Index) PostingOr(list []uint32, trigram uint32) []uint32 {
 }
 
 func (ix *Index) postingOr(list []uint32, trigram uint32, restrict []uint32) []uint32 {
-	var r postReader
-	r.init(ix, trigram, restrict)
-	return myPostingOr(r.d, r.max(), list, restrict)
+	p := ix.findPostingList(trigram)
+	return p.or(list, restrict)
 }
 
 func (ix *Index) PostingQuery(q *Query) []uint32 {
 	return ix.postingQuery(q, nil)
 }
 
+// PostingQueryErr is like PostingQuery, but returns a *CorruptError instead
+// of panicking if a posting list is corrupt.
+func (ix *Index) PostingQueryErr(q *Query) (post []uint32, err error) {
+	defer catch(&err)
+	return ix.postingQuery(q, nil), nil
+}
+
 // Implements sort.Interface
 type trigramCnt struct {
-	trigram uint32
+	p       postingList
 	count   int
 	listcnt int
 }
@@ -351,11 +525,27 @@ func (ix *Index) postingQuery(q *Query, restrict []uint32) (ret []uint32) {
 	case QAnd:
 		// "Query planner": we first sort the posting lists by their
 		// length (ascending)
-		withCount := make(trigramCnts, len(q.Trigram))
-		for idx, t := range q.Trigram {
-			tri := uint32(t[0])<<16 | uint32(t[1])<<8 | uint32(t[2])
-			count, _ := ix.findList(tri)
-			withCount[idx] = trigramCnt{tri, count, 0}
+		withCount := make(trigramCnts, 0, len(q.Trigram))
+		var ngrams []string
+		for _, t := range q.Trigram {
+			if len(t) == 3 {
+				continue
+			}
+			// Without a sparse n-gram index, any file might contain the
+			// n-gram.
+			if p, ok := ix.lookup(t); ok {
+				withCount = append(withCount, trigramCnt{p, p.count, 0})
+				ngrams = append(ngrams, t)
+			}
+		}
+		for _, t := range q.Trigram {
+			// Trigrams of an n-gram barely reduce the number of files
+			// any further, but would make the loop below stop early.
+			if len(t) > 3 || containedIn(t, ngrams) {
+				continue
+			}
+			p, _ := ix.lookup(t)
+			withCount = append(withCount, trigramCnt{p, p.count, 0})
 		}
 		sort.Sort(withCount)
 
@@ -363,9 +553,9 @@ func (ix *Index) postingQuery(q *Query, restrict []uint32) (ret []uint32) {
 		for idx, t := range withCount {
 			previous := len(list)
 			if list == nil {
-				list = ix.postingList(t.trigram, restrict)
+				list = t.p.list(restrict)
 			} else {
-				list = ix.postingAnd(list, t.trigram, restrict)
+				list = t.p.and(list, restrict)
 			}
 			if len(list) == 0 {
 				return nil
@@ -394,11 +584,14 @@ func (ix *Index) postingQuery(q *Query, restrict []uint32) (ret []uint32) {
 		}
 	case QOr:
 		for _, t := range q.Trigram {
-			tri := uint32(t[0])<<16 | uint32(t[1])<<8 | uint32(t[2])
+			p, ok := ix.lookup(t)
+			if !ok {
+				return ix.postingQuery(allQuery, restrict)
+			}
 			if list == nil {
-				list = ix.postingList(tri, restrict)
+				list = p.list(restrict)
 			} else {
-				list = ix.postingOr(list, tri, restrict)
+				list = p.or(list, restrict)
 			}
 		}
 		for _, sub := range q.Sub {
@@ -409,6 +602,16 @@ func (ix *Index) postingQuery(q *Query, restrict []uint32) (ret []uint32) {
 	return list
 }
 
+// containedIn reports whether t is a substring of any of ngrams.
+func containedIn(t string, ngrams []string) bool {
+	for _, ngram := range ngrams {
+		if strings.Contains(ngram, t) {
+			return true
+		}
+	}
+	return false
+}
+
 func mergeOr(l1, l2 []uint32) []uint32 {
 	var l []uint32
 	i := 0
@@ -431,7 +634,7 @@ func mergeOr(l1, l2 []uint32) []uint32 {
 }
 
 func corrupt(file string) {
-	log.Fatal("corrupt index: remove " + file)
+	fail(&CorruptError{File: file})
 }
 
 // An mmapData is mmap'ed read-only data from a file.
@@ -445,7 +648,7 @@ type mmapData struct {
 func mmap(file string) mmapData {
 	f, err := os.Open(file)
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 	return mmapFile(f)
 }
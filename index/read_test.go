@@ -58,3 +58,23 @@ func equalList(x, y []uint32) bool {
 	}
 	return true
 }
+
+func TestOpenErrCorrupt(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, nil, postFiles)
+
+	// Truncating the index destroys the trailer.
+	if err := os.Truncate(out, 100); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := OpenErr(out)
+	if err == nil {
+		ix.Close()
+		t.Fatalf("OpenErr(%q) unexpectedly succeeded", out)
+	}
+	if cerr, ok := err.(*CorruptError); !ok || cerr.File != out {
+		t.Fatalf("OpenErr(%q) = %v, want *CorruptError", out, err)
+	}
+}
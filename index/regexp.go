@@ -19,6 +19,10 @@ import (
 // quite a bit more.  We can then filter target files by whether they match
 // the Query (using a trigram index) before running the comparatively
 // more expensive regexp machinery.
+//
+// Trigram holds trigrams as well as sparse n-grams (see ngram.go) longer than
+// three bytes, which are only used if the index contains a sparse n-gram
+// index.
 type Query struct {
 	Op      QueryOp
 	Trigram []string
@@ -272,6 +276,11 @@ func (q *Query) andTrigrams(t stringSet) *Query {
 		for i := 0; i+3 <= len(tt); i++ {
 			trig.add(tt[i : i+3])
 		}
+		if len(tt) >= minNGramLen {
+			for _, ngram := range sparseNGrams(tt) {
+				trig.add(ngram)
+			}
+		}
 		trig.clean(false)
 		//println(tt, "trig", strings.Join(trig, ","))
 		or = or.or(&Query{Op: QAnd, Trigram: trig})
@@ -13,10 +13,10 @@ var queryTests = []struct {
 	re string
 	q  string
 }{
-	{`Abcdef`, `"Abc" "bcd" "cde" "def"`},
-	{`(abc)(def)`, `"abc" "bcd" "cde" "def"`},
+	{`Abcdef`, `"Abc" "bcd" "bcdef" "cde" "def"`},
+	{`(abc)(def)`, `"abc" "bcd" "bcdef" "cde" "def"`},
 	{`abc.*(def|ghi)`, `"abc" ("def"|"ghi")`},
-	{`abc(def|ghi)`, `"abc" ("bcd" "cde" "def")|("bcg" "cgh" "ghi")`},
+	{`abc(def|ghi)`, `"abc" ("bcd" "bcdef" "cde" "def")|("bcg" "bcghi" "cgh" "ghi")`},
 	{`a+hello`, `"ahe" "ell" "hel" "llo"`},
 	{`(a+hello|b+world)`, `("ahe" "ell" "hel" "llo")|("bwo" "orl" "rld" "wor")`},
 	{`a*bbb`, `"bbb"`},
@@ -0,0 +1,90 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Stats describes the size and contents of an index.
+type Stats struct {
+	// Files is the number of files, see NumNames.
+	Files int
+
+	// Trigrams is the number of distinct trigrams, i.e. posting lists.
+	Trigrams int
+
+	// Size is the size of the index file in bytes.
+	Size uint64
+
+	// PostingSize is the size of all posting lists in bytes.
+	PostingSize uint64
+
+	// Longest holds the longest posting lists, longest first.
+	Longest []TrigramCount
+}
+
+// countHeap is a min-heap of TrigramCounts, so that the shortest of the
+// longest posting lists found so far can be replaced.
+type countHeap []TrigramCount
+
+func (h countHeap) Len() int {
+	return len(h)
+}
+
+func (h countHeap) Less(i, j int) bool {
+	return h[i].Count < h[j].Count
+}
+
+func (h countHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *countHeap) Push(v interface{}) {
+	*h = append(*h, v.(TrigramCount))
+}
+
+func (h *countHeap) Pop() (v interface{}) {
+	*h, v = (*h)[:h.Len()-1], (*h)[h.Len()-1]
+	return
+}
+
+// Stats returns statistics about the index, including its n longest posting
+// lists. Finding the longest posting lists requires reading the entire
+// posting list index, so n should be 0 if they are not needed.
+func (ix *Index) Stats(n int) (stats Stats, err error) {
+	defer catch(&err)
+	stats = Stats{
+		Files:       ix.numName,
+		Size:        uint64(len(ix.data.d)),
+		PostingSize: ix.nameIndex - ix.postData,
+	}
+	stats.Trigrams = ix.numPost
+	if ix.numPost > 0 {
+		// The last posting list is the empty 0xffffff end marker.
+		stats.Trigrams--
+	}
+	if n <= 0 {
+		return stats, nil
+	}
+	h := make(countHeap, 0, n)
+	for i := 0; i < stats.Trigrams; i++ {
+		trigram, count, _ := ix.listAt(uint32(i))
+		if len(h) == n && int(count) <= h[0].Count {
+			continue
+		}
+		tc := TrigramCount{
+			Trigram: string([]byte{byte(trigram >> 16), byte(trigram >> 8), byte(trigram)}),
+			Count:   int(count),
+		}
+		if len(h) < n {
+			heap.Push(&h, tc)
+		} else {
+			h[0] = tc
+			heap.Fix(&h, 0)
+		}
+	}
+	sort.Sort(sort.Reverse(h))
+	stats.Longest = h
+	return stats, nil
+}
@@ -0,0 +1,75 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	path := writeTempIndex(t, trivialIndex)
+	defer os.Remove(path)
+	ix := Open(path)
+	defer ix.Close()
+
+	stats, err := ix.Stats(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stats.Files, 6; got != want {
+		t.Errorf("Files = %d, want %d", got, want)
+	}
+	if got, want := stats.Trigrams, 11; got != want {
+		t.Errorf("Trigrams = %d, want %d", got, want)
+	}
+	if got, want := stats.Size, uint64(len(trivialIndex)); got != want {
+		t.Errorf("Size = %d, want %d", got, want)
+	}
+	if got, want := stats.PostingSize, uint64(62); got != want {
+		t.Errorf("PostingSize = %d, want %d", got, want)
+	}
+	if len(stats.Longest) != 3 {
+		t.Fatalf("len(Longest) = %d, want 3", len(stats.Longest))
+	}
+	// "\nab", "abc" and "bc\n" each occur in two files, all others in one.
+	for _, tc := range stats.Longest {
+		if tc.Count != 2 {
+			t.Errorf("Longest contains %+v, want only posting lists of length 2", tc)
+		}
+	}
+
+	stats, err = ix.Stats(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Longest != nil {
+		t.Errorf("Stats(0).Longest = %v, want nil", stats.Longest)
+	}
+}
+
+func TestStatsOrder(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, nil, postFiles)
+	ix := Open(out)
+	defer ix.Close()
+
+	stats, err := ix.Stats(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stats.Longest), stats.Trigrams; got != want {
+		t.Fatalf("len(Longest) = %d, want all %d trigrams", got, want)
+	}
+	// “Goo” is contained in 3 files, none is contained in more.
+	if got, want := stats.Longest[0].Count, 3; got != want {
+		t.Errorf("Longest[0].Count = %d, want %d", got, want)
+	}
+	for i := 1; i < len(stats.Longest); i++ {
+		if stats.Longest[i].Count > stats.Longest[i-1].Count {
+			t.Fatalf("Longest not sorted: %+v", stats.Longest)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+)
+
+// Verify opens the index file and checks it for consistency, see
+// (*Index).Verify.
+func Verify(file string) error {
+	ix, err := OpenErr(file)
+	if err != nil {
+		return err
+	}
+	defer ix.Close()
+	return ix.Verify()
+}
+
+// Verify reads the entire index and returns a *CorruptError describing the
+// first inconsistency it finds: a checksum mismatch (only for indexes of
+// version 3 and newer), names which are not NUL-terminated, unsorted trigrams
+// in the posting list index, offsets out of range, file ids which are not
+// strictly increasing or out of range, skip tables and bitmaps (only for
+// indexes of version 3 and newer) which do not match their posting lists, or
+// file metadata referring to strings outside of its string table. The sparse
+// n-gram index is checked like the posting lists.
+func (ix *Index) Verify() error {
+	if err := ix.verifyChecksums(); err != nil {
+		return err
+	}
+	if err := ix.verifyNames(); err != nil {
+		return err
+	}
+	if err := ix.verifyMeta(); err != nil {
+		return err
+	}
+	if err := ix.verifyPostingLists(); err != nil {
+		return err
+	}
+	return ix.verifyNGrams()
+}
+
+func (ix *Index) corruptf(format string, args ...interface{}) error {
+	return &CorruptError{
+		File:   ix.File,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+func (ix *Index) verifyChecksums() error {
+	if ix.version < 3 {
+		return nil
+	}
+	d := ix.data.d
+	sections := []struct {
+		name       string
+		start, end uint64
+	}{
+		{"list of paths", ix.pathData, ix.nameData},
+		{"list of names", ix.nameData, ix.postData},
+		{"list of posting lists", ix.postData, ix.nameIndex},
+		{"name index", ix.nameIndex, ix.postIndex},
+		{"posting list index", ix.postIndex, ix.metaData},
+		{"file metadata", ix.metaData, ix.ngramData},
+		{"list of sparse n-gram posting lists", ix.ngramData, ix.ngramIndex},
+		{"sparse n-gram index", ix.ngramIndex, ix.checksums},
+	}
+	for i, s := range sections {
+		want := binary.BigEndian.Uint32(d[ix.checksums+uint64(4*i):])
+		if got := crc32.Checksum(d[s.start:s.end], castagnoli); got != want {
+			return ix.corruptf("checksum mismatch in %s: got %08x, want %08x", s.name, got, want)
+		}
+	}
+	end := ix.checksums + 4*numSections
+	want := binary.BigEndian.Uint32(d[end:])
+	if got := crc32.Checksum(d[:end], castagnoli); got != want {
+		return ix.corruptf("file checksum mismatch: got %08x, want %08x", got, want)
+	}
+	return nil
+}
+
+func (ix *Index) verifyNames() error {
+	names := ix.data.d[ix.nameData:ix.postData]
+	o := uint64(ix.offsetSize)
+	var last uint64
+	for id := 0; id < ix.numName; id++ {
+		off := ix.offset(ix.nameIndex + uint64(id)*o)
+		if id > 0 && off <= last {
+			return ix.corruptf("name offsets of file %d not increasing: %d after %d", id, off, last)
+		}
+		if off >= uint64(len(names)) {
+			return ix.corruptf("name offset of file %d out of range: %d", id, off)
+		}
+		if bytes.IndexByte(names[off:], 0) == -1 {
+			return ix.corruptf("name of file %d not NUL-terminated", id)
+		}
+		last = off
+	}
+	return nil
+}
+
+func (ix *Index) verifyMeta() error {
+	if !ix.HasMeta() {
+		return nil
+	}
+	table := ix.data.d[ix.metaData+4 : ix.metaRecords]
+	if len(table) == 0 || table[0] != 0 || table[len(table)-1] != 0 {
+		return ix.corruptf("string table of file metadata not NUL-terminated")
+	}
+	for id := 0; id < ix.numName; id++ {
+		d := ix.data.d[ix.metaRecords+uint64(id)*metaRecordSize:]
+		for _, off := range []uint32{
+			binary.BigEndian.Uint32(d[0:]),
+			binary.BigEndian.Uint32(d[4:]),
+			binary.BigEndian.Uint32(d[8:]),
+		} {
+			if int(off) >= len(table) || off > 0 && table[off-1] != 0 {
+				return ix.corruptf("file metadata of file %d refers to invalid string offset %d", id, off)
+			}
+		}
+	}
+	return nil
+}
+
+func (ix *Index) verifyPostingLists() error {
+	lists := ix.data.d[ix.postData:ix.nameIndex]
+	var (
+		lastTrigram uint32
+		end         uint64
+	)
+	for i := 0; i < ix.numPost; i++ {
+		trigram, count, offset := ix.listAt(uint32(i))
+		if i > 0 && trigram <= lastTrigram {
+			return ix.corruptf("trigram %#x not sorted after %#x", trigram, lastTrigram)
+		}
+		lastTrigram = trigram
+		if count == 0 {
+			// Only the final entry (trigram "\xff\xff\xff") may be empty.
+			if trigram != 1<<24-1 {
+				return ix.corruptf("empty posting list for trigram %#x", trigram)
+			}
+			continue
+		}
+		if offset < end || offset+3 > uint64(len(lists)) {
+			return ix.corruptf("posting list offset for trigram %#x out of range: %d", trigram, offset)
+		}
+		d := lists[offset:]
+		if t := uint32(d[0])<<16 | uint32(d[1])<<8 | uint32(d[2]); t != trigram {
+			return ix.corruptf("posting list for trigram %#x starts with trigram %#x", trigram, t)
+		}
+		d = d[3:]
+		var err error
+		if ix.version >= 3 && len(d) > 0 && d[0] == 0 {
+			d, err = ix.verifyEncoded("trigram", trigram, count, d)
+		} else {
+			d, err = ix.verifyDeltas("trigram", trigram, count, d, nil)
+		}
+		if err != nil {
+			return err
+		}
+		end = uint64(len(lists) - len(d))
+	}
+	return nil
+}
+
+func (ix *Index) verifyNGrams() error {
+	if !ix.HasNGrams() {
+		return nil
+	}
+	lists := ix.data.d[ix.ngramData:ix.ngramIndex]
+	var (
+		lastKey uint32
+		end     uint64
+	)
+	for i := 0; i < ix.numNGram; i++ {
+		key, count, offset := ix.ngramAt(uint32(i))
+		if i > 0 && key <= lastKey {
+			return ix.corruptf("n-gram key %#x not sorted after %#x", key, lastKey)
+		}
+		lastKey = key
+		if (count == 0) != (key == ^uint32(0)) {
+			return ix.corruptf("posting list for n-gram key %#x has %d entries", key, count)
+		}
+		if offset < end || offset+4 > uint64(len(lists)) {
+			return ix.corruptf("posting list offset for n-gram key %#x out of range: %d", key, offset)
+		}
+		d := lists[offset:]
+		if k := binary.BigEndian.Uint32(d); k != key {
+			return ix.corruptf("posting list for n-gram key %#x starts with key %#x", key, k)
+		}
+		d = d[4:]
+		var err error
+		if len(d) > 0 && d[0] == 0 && count > 0 {
+			d, err = ix.verifyEncoded("n-gram key", key, count, d)
+		} else {
+			d, err = ix.verifyDeltas("n-gram key", key, count, d, nil)
+		}
+		if err != nil {
+			return err
+		}
+		end = uint64(len(lists) - len(d))
+	}
+	if lastKey != ^uint32(0) {
+		return ix.corruptf("sparse n-gram index not terminated")
+	}
+	return nil
+}
+
+// verifyDeltas checks the delta list of count file ids (including the
+// terminator) at the start of d and returns the remainder of d. kind and key
+// identify the list in errors. If skip is non-nil, the delta list is checked
+// against the skip table of the block encoding.
+func (ix *Index) verifyDeltas(kind string, key, count uint32, d, skip []byte) ([]byte, error) {
+	start := len(d)
+	fileid := ^uint32(0)
+	for j := uint32(0); j < count; j++ {
+		if skip != nil && j%postingBlockSize == 0 {
+			b := j / postingBlockSize
+			if off := binary.BigEndian.Uint32(skip[8*b+4:]); int(off) != start-len(d) {
+				return nil, ix.corruptf("skip table offset of block %d in posting list for %s %#x is %d, want %d", b, kind, key, off, start-len(d))
+			}
+		}
+		delta, n := binary.Uvarint(d)
+		if n <= 0 || delta == 0 || delta > uint64(ix.numName) {
+			return nil, ix.corruptf("invalid delta in posting list for %s %#x", kind, key)
+		}
+		d = d[n:]
+		fileid += uint32(delta)
+		if fileid >= uint32(ix.numName) {
+			return nil, ix.corruptf("file id %d out of range in posting list for %s %#x", fileid, kind, key)
+		}
+		if skip != nil && (j%postingBlockSize == postingBlockSize-1 || j == count-1) {
+			b := j / postingBlockSize
+			if last := binary.BigEndian.Uint32(skip[8*b:]); last != fileid {
+				return nil, ix.corruptf("skip table of posting list for %s %#x claims block %d ends with file id %d, not %d", kind, key, b, last, fileid)
+			}
+		}
+	}
+	if delta, n := binary.Uvarint(d); n <= 0 || delta != 0 {
+		return nil, ix.corruptf("posting list for %s %#x has more than %d entries", kind, key, count)
+	}
+	return d[1:], nil
+}
+
+// verifyEncoded checks the posting list of count file ids in the block or
+// bitmap encoding at the start of d and returns the remainder of d.
+func (ix *Index) verifyEncoded(kind string, key, count uint32, d []byte) ([]byte, error) {
+	if len(d) < 2 {
+		return nil, ix.corruptf("posting list for %s %#x truncated", kind, key)
+	}
+	switch d[1] {
+	case postingBlocks:
+		n := 8 * int((count+postingBlockSize-1)/postingBlockSize)
+		if len(d) < 2+n {
+			return nil, ix.corruptf("skip table of posting list for %s %#x truncated", kind, key)
+		}
+		return ix.verifyDeltas(kind, key, count, d[2+n:], d[2:2+n])
+
+	case postingBitmap:
+		if len(d) < 2+8 {
+			return nil, ix.corruptf("bitmap of posting list for %s %#x truncated", kind, key)
+		}
+		first := binary.BigEndian.Uint32(d[2:])
+		n := binary.BigEndian.Uint32(d[6:])
+		if uint64(len(d)) < 2+8+uint64(n) {
+			return nil, ix.corruptf("bitmap of posting list for %s %#x truncated", kind, key)
+		}
+		bitmap := d[10 : 10+n]
+		var ones uint32
+		for i, b := range bitmap {
+			if b == 0 {
+				continue
+			}
+			ones += uint32(bits.OnesCount8(b))
+			if last := uint64(first) + uint64(i)*8 + uint64(7-bits.LeadingZeros8(b)); last >= uint64(ix.numName) {
+				return nil, ix.corruptf("file id %d out of range in posting list for %s %#x", last, kind, key)
+			}
+		}
+		if ones != count {
+			return nil, ix.corruptf("bitmap of posting list for %s %#x has %d entries, want %d", kind, key, ones, count)
+		}
+		return d[10+n:], nil
+	}
+	return nil, ix.corruptf("unknown encoding %d of posting list for %s %#x", d[1], kind, key)
+}
@@ -0,0 +1,76 @@
+// vim:ts=4:sw=4:noexpandtab
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeTempIndex(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "index-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestVerify(t *testing.T) {
+	f, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(f.Name())
+	out := f.Name()
+	buildIndex(out, []string{"/src"}, postFiles)
+	if err := Verify(out); err != nil {
+		t.Fatalf("Verify(%q) = %v, want nil", out, err)
+	}
+}
+
+func TestVerifyOlderVersions(t *testing.T) {
+	for _, data := range []string{trivialIndexV1, trivialIndexV2} {
+		path := writeTempIndex(t, data)
+		defer os.Remove(path)
+		ix, err := OpenErr(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l := ix.PostingList(tri('a', 'b', 'c')); !equalList(l, []uint32{0, 3}) {
+			t.Errorf("version %d: PostingList(abc) = %v, want [0 3]", ix.Version(), l)
+		}
+		if err := ix.Verify(); err != nil {
+			t.Errorf("version %d: Verify() = %v, want nil", ix.Version(), err)
+		}
+		ix.Close()
+	}
+}
+
+func TestVerifyCorrupt(t *testing.T) {
+	// Flip a byte in the posting list of "abc".
+	off := strings.Index(trivialIndex, "abc"+fileList(0, 3)) + 3
+	corrupted := []byte(trivialIndex)
+	corrupted[off] ^= 0x02
+
+	path := writeTempIndex(t, string(corrupted))
+	defer os.Remove(path)
+	err := Verify(path)
+	ce, ok := err.(*CorruptError)
+	if !ok {
+		t.Fatalf("Verify() = %v, want a *CorruptError", err)
+	}
+	if !strings.Contains(ce.Reason, "list of posting lists") {
+		t.Errorf("Reason = %q, want a checksum mismatch in the list of posting lists", ce.Reason)
+	}
+
+	// Without checksums, the posting list itself is checked.
+	corrupted = []byte(trivialIndexV2)
+	corrupted[strings.Index(trivialIndexV2, "abc"+fileList(0, 3))+3] = 0
+	path = writeTempIndex(t, string(corrupted))
+	defer os.Remove(path)
+	if err := Verify(path); err == nil {
+		t.Errorf("Verify() = nil for a corrupt posting list in version 2")
+	}
+}
@@ -5,7 +5,10 @@
 package index
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"log"
@@ -13,6 +16,7 @@ import (
 	"strings"
 	"unsafe"
 
+	"github.com/Debian/dcs/contenthash"
 	"github.com/google/codesearch/sparse"
 )
 
@@ -43,13 +47,18 @@ type IndexWriter struct {
 	LogSkip bool // log information about skipped files
 	Verbose bool // log status using package log
 
+	// SparseNGrams makes the index contain a sparse n-gram index (see
+	// ngram.go) in addition to the trigram index. It must be set before the
+	// first file is added.
+	SparseNGrams bool
+
 	trigram *sparse.Set // trigrams for the current file
 	buf     [8]byte     // scratch buffer
 
 	paths []string
 
 	nameData   *bufWriter // temp file holding list of names
-	nameLen    uint32     // number of bytes written to nameData
+	nameLen    uint64     // number of bytes written to nameData
 	nameIndex  *bufWriter // temp file holding name index
 	numName    int        // number of names written
 	totalBytes int64
@@ -58,6 +67,14 @@ type IndexWriter struct {
 	postFile  []*os.File  // flushed post entries
 	postIndex *bufWriter  // temp file holding posting list index
 
+	meta metaWriter // file metadata, written if AddMeta was used
+
+	ngrams        ngramScanner // finds the sparse n-grams of the current file
+	ngramKeys     []uint32     // sparse n-gram keys of the current file
+	ngramPost     []postEntry  // list of (n-gram key, file#) pairs
+	ngramPostFile []*os.File   // flushed n-gram post entries
+	ngramIndex    *bufWriter   // temp file holding sparse n-gram index
+
 	inbuf []byte     // input buffer
 	main  *bufWriter // main index file
 
@@ -67,9 +84,21 @@ type IndexWriter struct {
 
 const npost = 64 << 20 / 8 // 64 MB worth of post entries
 
-// Create returns a new IndexWriter that will write the index to file.
+// Create returns a new IndexWriter that will write the index to file. It
+// terminates the program if file cannot be created, see CreateErr.
 func Create(file string) *IndexWriter {
-	return &IndexWriter{
+	ix, err := CreateErr(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ix
+}
+
+// CreateErr is like Create, but returns an error instead of terminating the
+// program.
+func CreateErr(file string) (ix *IndexWriter, err error) {
+	defer catch(&err)
+	ix = &IndexWriter{
 		// 1 << 24 = 16777216, how many numbers can be represented by 3 uint8_t’s.
 		trigram:   sparse.NewSet(1 << 24),
 		nameData:  bufCreate(""),
@@ -79,6 +108,11 @@ func Create(file string) *IndexWriter {
 		post:      make([]postEntry, 0, npost),
 		inbuf:     make([]byte, 16384),
 	}
+	ix.meta.init()
+	ix.ngrams.emit = func(pos int, ngram []byte) {
+		ix.ngramKeys = append(ix.ngramKeys, ngramKey(ngram))
+	}
+	return ix, nil
 }
 
 // A postEntry is an in-memory (trigram, file#) pair.
@@ -107,6 +141,11 @@ const (
 	maxTextTrigrams = 20000
 )
 
+// ErrInvalidUTF8 is returned by Add for files which are not valid UTF-8.
+// Such files can be transcoded to UTF-8 (see package transcode) and added
+// again.
+var ErrInvalidUTF8 = errors.New("invalid UTF-8, ignoring")
+
 // AddPaths adds the given paths to the index's list of paths.
 func (ix *IndexWriter) AddPaths(paths []string) {
 	ix.paths = append(ix.paths, paths...)
@@ -124,10 +163,38 @@ func (ix *IndexWriter) AddFile(name string, indexname string) error {
 	return ix.Add(indexname, f)
 }
 
+// AddFileMeta is like AddFile, but also records meta, see AddMeta.
+func (ix *IndexWriter) AddFileMeta(name string, indexname string, meta FileMeta) error {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	defer f.Close()
+	return ix.AddMeta(indexname, f, meta)
+}
+
 // Add adds the file f to the index under the given name.
 // It logs errors using package log.
-func (ix *IndexWriter) Add(name string, f io.Reader) error {
+func (ix *IndexWriter) Add(name string, f io.Reader) (err error) {
+	return ix.add(name, f, FileMeta{})
+}
+
+// AddMeta is like Add, but also records meta for the file. The Size and
+// ContentHash of meta are computed from the contents of f. Once AddMeta was
+// called, the index contains file metadata, which is empty for the files
+// added using Add.
+func (ix *IndexWriter) AddMeta(name string, f io.Reader, meta FileMeta) error {
+	ix.meta.enabled = true
+	return ix.add(name, f, meta)
+}
+
+func (ix *IndexWriter) add(name string, f io.Reader, meta FileMeta) (err error) {
+	defer catch(&err)
 	ix.trigram.Reset()
+	ix.ngrams.reset()
+	ix.ngramKeys = ix.ngramKeys[:0]
+	h := contenthash.New()
 	var (
 		c       = byte(0)
 		i       = 0
@@ -152,6 +219,7 @@ func (ix *IndexWriter) Add(name string, f io.Reader) error {
 				return errors.New("0-length read")
 			}
 			buf = buf[:n]
+			h.Write(buf)
 			i = 0
 		}
 		c = buf[i]
@@ -160,11 +228,14 @@ func (ix *IndexWriter) Add(name string, f io.Reader) error {
 		if n++; n >= 3 {
 			ix.trigram.Add(tv)
 		}
+		if ix.SparseNGrams {
+			ix.ngrams.add(c)
+		}
 		if !validUTF8((tv>>8)&0xFF, tv&0xFF) {
 			if ix.LogSkip {
 				log.Printf("%s: invalid UTF-8, ignoring\n", name)
 			}
-			return errors.New("invalid UTF-8, ignoring")
+			return ErrInvalidUTF8
 		}
 		if n > maxFileLen {
 			if ix.LogSkip {
@@ -195,40 +266,63 @@ func (ix *IndexWriter) Add(name string, f io.Reader) error {
 	}
 
 	fileid := ix.addName(name)
+	if meta != (FileMeta{}) {
+		meta.Size = uint64(n)
+		meta.ContentHash = binary.BigEndian.Uint64(h.Sum(nil))
+	}
+	ix.meta.add(meta)
 	for _, trigram := range ix.trigram.Dense() {
 		if len(ix.post) >= cap(ix.post) {
 			ix.flushPost()
 		}
 		ix.post = append(ix.post, makePostEntry(trigram, fileid))
 	}
+	if ix.SparseNGrams {
+		if ix.ngramPost == nil {
+			ix.ngramPost = make([]postEntry, 0, npost)
+		}
+		for _, key := range uniqueKeys(ix.ngramKeys) {
+			if len(ix.ngramPost) >= cap(ix.ngramPost) {
+				ix.flushNGramPost()
+			}
+			ix.ngramPost = append(ix.ngramPost, makePostEntry(key, fileid))
+		}
+	}
 
 	return nil
 }
 
 // Flush flushes the index entry to the target file.
-func (ix *IndexWriter) Flush() {
+func (ix *IndexWriter) Flush() (err error) {
+	defer catch(&err)
 	ix.addName("")
 
-	var off [5]uint32
+	var off [numSections]uint64
 	ix.main.writeString(magic)
-	off[0] = ix.main.offset()
+	off[0] = ix.main.startSection()
 	for _, p := range ix.paths {
 		ix.main.writeString(p)
 		ix.main.writeString("\x00")
 	}
 	ix.main.writeString("\x00")
-	off[1] = ix.main.offset()
+	off[1] = ix.main.startSection()
 	copyFile(ix.main, ix.nameData)
-	off[2] = ix.main.offset()
+	off[2] = ix.main.startSection()
 	ix.mergePost(ix.main)
-	off[3] = ix.main.offset()
+	off[3] = ix.main.startSection()
 	copyFile(ix.main, ix.nameIndex)
-	off[4] = ix.main.offset()
+	off[4] = ix.main.startSection()
 	copyFile(ix.main, ix.postIndex)
-	for _, v := range off {
-		ix.main.writeUint32(v)
+	off[5] = ix.main.startSection()
+	ix.meta.writeTo(ix.main)
+	off[6] = ix.main.startSection()
+	ngramIndex := bufCreate("")
+	if ix.SparseNGrams {
+		ix.mergeNGramPost(ix.main, ngramIndex)
 	}
-	ix.main.writeString(trailerMagic)
+	off[7] = ix.main.startSection()
+	copyFile(ix.main, ngramIndex)
+	ix.main.writeTrailer(off)
 
 	os.Remove(ix.nameData.name)
 	for _, f := range ix.postFile {
@@ -236,17 +330,23 @@ func (ix *IndexWriter) Flush() {
 	}
 	os.Remove(ix.nameIndex.name)
 	os.Remove(ix.postIndex.name)
+	os.Remove(ix.meta.records.name)
+	for _, f := range ix.ngramPostFile {
+		os.Remove(f.Name())
+	}
+	os.Remove(ngramIndex.name)
 
 	log.Printf("%d data bytes, %d index bytes", ix.totalBytes, ix.main.offset())
 
 	ix.main.flush()
+	return nil
 }
 
 func copyFile(dst, src *bufWriter) {
 	dst.flush()
-	_, err := io.Copy(dst.file, src.finish())
+	_, err := io.Copy(dst, src.finish())
 	if err != nil {
-		log.Fatalf("copying %s to %s: %v", src.name, dst.name, err)
+		fail(fmt.Errorf("copying %s to %s: %v", src.name, dst.name, err))
 	}
 }
 
@@ -254,10 +354,10 @@ func copyFile(dst, src *bufWriter) {
 // It returns the assigned file ID number.
 func (ix *IndexWriter) addName(name string) uint32 {
 	if strings.Contains(name, "\x00") {
-		log.Fatalf("%q: file has NUL byte in name", name)
+		fail(fmt.Errorf("%q: file has NUL byte in name", name))
 	}
 
-	ix.nameIndex.writeUint32(ix.nameData.offset())
+	ix.nameIndex.writeUint64(ix.nameData.offset())
 	ix.nameData.writeString(name)
 	ix.nameData.writeByte(0)
 	id := ix.numName
@@ -268,28 +368,41 @@ func (ix *IndexWriter) addName(name string) uint32 {
 // flushPost writes ix.post to a new temporary file and
 // clears the slice.
 func (ix *IndexWriter) flushPost() {
+	ix.sortPost(ix.post)
+	ix.postFile = append(ix.postFile, ix.writePostFile(ix.post))
+	ix.post = ix.post[:0]
+}
+
+// flushNGramPost is like flushPost, but for ix.ngramPost.
+func (ix *IndexWriter) flushNGramPost() {
+	ix.sortNGramPost(ix.ngramPost)
+	ix.ngramPostFile = append(ix.ngramPostFile, ix.writePostFile(ix.ngramPost))
+	ix.ngramPost = ix.ngramPost[:0]
+}
+
+// writePostFile writes the sorted post entries to a new temporary file and
+// returns it, positioned at the start.
+func (ix *IndexWriter) writePostFile(post []postEntry) *os.File {
 	w, err := ioutil.TempFile("", "csearch-index")
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 	if ix.Verbose {
-		log.Printf("flush %d entries to %s", len(ix.post), w.Name())
+		log.Printf("flush %d entries to %s", len(post), w.Name())
 	}
-	ix.sortPost(ix.post)
 
-	// Write the raw ix.post array to disk as is.
+	// Write the raw post array to disk as is.
 	// This process is the one reading it back in, so byte order is not a concern.
-	data := (*[npost * 8]byte)(unsafe.Pointer(&ix.post[0]))[:len(ix.post)*8]
+	data := (*[npost * 8]byte)(unsafe.Pointer(&post[0]))[:len(post)*8]
 	if n, err := w.Write(data); err != nil || n < len(data) {
 		if err != nil {
-			log.Fatal(err)
+			fail(err)
 		}
-		log.Fatalf("short write writing %s", w.Name())
+		fail(fmt.Errorf("short write writing %s", w.Name()))
 	}
 
-	ix.post = ix.post[:0]
 	w.Seek(0, 0)
-	ix.postFile = append(ix.postFile, w)
+	return w
 }
 
 // mergePost reads the flushed index entries and merges them
@@ -307,6 +420,10 @@ func (ix *IndexWriter) mergePost(out *bufWriter) {
 	npost := 0
 	e := h.next()
 	offset0 := out.offset()
+	var (
+		ids []uint32
+		enc postingEncoder
+	)
 	for {
 		npost++
 		offset := out.offset() - offset0
@@ -316,20 +433,17 @@ func (ix *IndexWriter) mergePost(out *bufWriter) {
 		ix.buf[2] = byte(trigram)
 
 		// posting list
-		fileid := ^uint32(0)
-		nfile := uint32(0)
-		out.write(ix.buf[:3])
+		ids = ids[:0]
 		for ; e.trigram() == trigram && trigram != 1<<24-1; e = h.next() {
-			out.writeUvarint(e.fileid() - fileid)
-			fileid = e.fileid()
-			nfile++
+			ids = append(ids, e.fileid())
 		}
-		out.writeUvarint(0)
+		out.write(ix.buf[:3])
+		out.write(enc.encode(ids))
 
 		// index entry
 		ix.postIndex.write(ix.buf[:3])
-		ix.postIndex.writeUint32(nfile)
-		ix.postIndex.writeUint32(offset)
+		ix.postIndex.writeUint32(uint32(len(ids)))
+		ix.postIndex.writeUint64(offset)
 
 		if trigram == 1<<24-1 {
 			break
@@ -337,6 +451,34 @@ func (ix *IndexWriter) mergePost(out *bufWriter) {
 	}
 }
 
+// mergeNGramPost is like mergePost, but for the sparse n-gram index, whose
+// entries it writes to index.
+func (ix *IndexWriter) mergeNGramPost(out, index *bufWriter) {
+	var h postHeap
+	for _, f := range ix.ngramPostFile {
+		h.addFile(f)
+	}
+	ix.sortNGramPost(ix.ngramPost)
+	h.addMem(ix.ngramPost)
+
+	w := postDataWriter{
+		out:           out,
+		postIndexFile: index,
+		ngrams:        true,
+		base:          out.offset(),
+	}
+	for !h.empty() {
+		e := h.next()
+		if key := e.trigram(); key != w.t || len(w.ids) == 0 {
+			w.endTrigram()
+			w.trigram(key)
+		}
+		w.fileid(e.fileid())
+	}
+	w.endTrigram()
+	w.endNGrams()
+}
+
 // A postChunk represents a chunk of post entries flushed to disk or
 // still in memory.
 type postChunk struct {
@@ -467,8 +609,17 @@ type bufWriter struct {
 	file *os.File
 	buf  []byte
 	tmp  [8]byte
+
+	// crc is the checksum of everything written to file so far, section the
+	// checksum of everything since the last startSection and sums the
+	// checksums of all completed sections.
+	crc     uint32
+	section uint32
+	sums    []uint32
 }
 
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 // bufCreate creates a new file with the given name and returns a
 // corresponding bufWriter.  If name is empty, bufCreate uses a
 // temporary file.
@@ -483,7 +634,7 @@ func bufCreate(name string) *bufWriter {
 		f, err = ioutil.TempFile("", "csearch")
 	}
 	if err != nil {
-		log.Fatal(err)
+		fail(err)
 	}
 	return &bufWriter{
 		name: f.Name(),
@@ -497,8 +648,8 @@ func (b *bufWriter) write(x []byte) {
 	if len(x) > n {
 		b.flush()
 		if len(x) >= cap(b.buf) {
-			if _, err := b.file.Write(x); err != nil {
-				log.Fatalf("writing %s: %v", b.name, err)
+			if _, err := b.Write(x); err != nil {
+				fail(fmt.Errorf("writing %s: %v", b.name, err))
 			}
 			return
 		}
@@ -518,8 +669,8 @@ func (b *bufWriter) writeString(s string) {
 	if len(s) > n {
 		b.flush()
 		if len(s) >= cap(b.buf) {
-			if _, err := b.file.WriteString(s); err != nil {
-				log.Fatalf("writing %s: %v", b.name, err)
+			if _, err := b.Write([]byte(s)); err != nil {
+				fail(fmt.Errorf("writing %s: %v", b.name, err))
 			}
 			return
 		}
@@ -527,23 +678,57 @@ func (b *bufWriter) writeString(s string) {
 	b.buf = append(b.buf, s...)
 }
 
+// Write writes x to the file, bypassing the buffer. It updates the checksums
+// and implements io.Writer for copyFile.
+func (b *bufWriter) Write(x []byte) (int, error) {
+	b.crc = crc32.Update(b.crc, castagnoli, x)
+	b.section = crc32.Update(b.section, castagnoli, x)
+	return b.file.Write(x)
+}
+
+// startSection completes the checksum of the current section of the index and
+// returns the offset at which the next section starts.
+func (b *bufWriter) startSection() uint64 {
+	b.flush()
+	b.sums = append(b.sums, b.section)
+	b.section = 0
+	return b.offset()
+}
+
+// writeTrailer completes the file metadata and writes the checksums and the
+// trailer. off holds the offsets of the sections.
+func (b *bufWriter) writeTrailer(off [numSections]uint64) {
+	checksums := b.startSection()
+	// The first checksum covers the header, which is not a section.
+	if len(b.sums) != 1+numSections {
+		panic("index: writeTrailer called after an unexpected number of sections")
+	}
+	for _, sum := range b.sums[1:] {
+		b.writeUint32(sum)
+	}
+	b.flush()
+	b.writeUint32(b.crc)
+	for _, v := range off {
+		b.writeUint64(v)
+	}
+	b.writeUint64(checksums)
+	b.writeString(trailerMagic)
+}
+
 // offset returns the current write offset.
-func (b *bufWriter) offset() uint32 {
+func (b *bufWriter) offset() uint64 {
 	off, _ := b.file.Seek(0, 1)
 	off += int64(len(b.buf))
-	if int64(uint32(off)) != off {
-		log.Fatalf("index is larger than 4GB")
-	}
-	return uint32(off)
+	return uint64(off)
 }
 
 func (b *bufWriter) flush() {
 	if len(b.buf) == 0 {
 		return
 	}
-	_, err := b.file.Write(b.buf)
+	_, err := b.Write(b.buf)
 	if err != nil {
-		log.Fatalf("writing %s: %v", b.name, err)
+		fail(fmt.Errorf("writing %s: %v", b.name, err))
 	}
 	b.buf = b.buf[:0]
 }
@@ -570,6 +755,13 @@ func (b *bufWriter) writeUint32(x uint32) {
 	b.buf = append(b.buf, byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
 }
 
+func (b *bufWriter) writeUint64(x uint64) {
+	if cap(b.buf)-len(b.buf) < 8 {
+		b.flush()
+	}
+	b.buf = append(b.buf, byte(x>>56), byte(x>>48), byte(x>>40), byte(x>>32), byte(x>>24), byte(x>>16), byte(x>>8), byte(x))
+}
+
 func (b *bufWriter) writeUvarint(x uint32) {
 	if cap(b.buf)-len(b.buf) < 5 {
 		b.flush()
@@ -606,48 +798,47 @@ func validUTF8(c1, c2 uint32) bool {
 }
 
 func (ix *IndexWriter) sortPost(post []postEntry) {
+	ix.radixSort(post, 24)
+}
+
+// sortNGramPost is like sortPost, but sorts entries by their sparse n-gram
+// key, which uses all 32 bits.
+func (ix *IndexWriter) sortNGramPost(post []postEntry) {
+	ix.radixSort(post, 32)
+}
+
+// radixSort sorts post by the lowest bits bits of the trigram using rounds of
+// sortK-bit radix sort.
+func (ix *IndexWriter) radixSort(post []postEntry, bits uint) {
 	if len(post) > len(ix.sortTmp) {
 		ix.sortTmp = make([]postEntry, len(post))
 	}
 	tmp := ix.sortTmp[:len(post)]
+	orig := post
 
 	const k = sortK
-	for i := range ix.sortN {
-		ix.sortN[i] = 0
-	}
-	for _, p := range post {
-		r := uintptr(p>>32) & (1<<k - 1)
-		ix.sortN[r]++
-	}
-	tot := 0
-	for i, count := range ix.sortN {
-		ix.sortN[i] = tot
-		tot += count
-	}
-	for _, p := range post {
-		r := uintptr(p>>32) & (1<<k - 1)
-		o := ix.sortN[r]
-		ix.sortN[r]++
-		tmp[o] = p
-	}
-	tmp, post = post, tmp
-
-	for i := range ix.sortN {
-		ix.sortN[i] = 0
-	}
-	for _, p := range post {
-		r := uintptr(p>>(32+k)) & (1<<k - 1)
-		ix.sortN[r]++
-	}
-	tot = 0
-	for i, count := range ix.sortN {
-		ix.sortN[i] = tot
-		tot += count
-	}
-	for _, p := range post {
-		r := uintptr(p>>(32+k)) & (1<<k - 1)
-		o := ix.sortN[r]
-		ix.sortN[r]++
-		tmp[o] = p
+	for shift := uint(32); shift < 32+bits; shift += k {
+		for i := range ix.sortN {
+			ix.sortN[i] = 0
+		}
+		for _, p := range post {
+			r := uintptr(p>>shift) & (1<<k - 1)
+			ix.sortN[r]++
+		}
+		tot := 0
+		for i, count := range ix.sortN {
+			ix.sortN[i] = tot
+			tot += count
+		}
+		for _, p := range post {
+			r := uintptr(p>>shift) & (1<<k - 1)
+			o := ix.sortN[r]
+			ix.sortN[r]++
+			tmp[o] = p
+		}
+		tmp, post = post, tmp
+	}
+	if len(post) > 0 && &post[0] != &orig[0] {
+		copy(orig, post)
 	}
 }
@@ -6,6 +6,8 @@ package index
 
 import (
 	"bytes"
+	"encoding/binary"
+	"hash/crc32"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -22,7 +24,75 @@ var trivialFiles = map[string]string{
 	"file5":    "\nxyzw\n",
 }
 
-var trivialIndex = join(
+// trivialIndexV2 is trivialIndex in version 2 of the format, which has no
+// checksums.
+var trivialIndexV2 = join(
+	// header
+	"csearch index 2\n",
+
+	// list of paths
+	"\x00",
+
+	// list of names
+	"afile4\x00",
+	"f0\x00",
+	"file1\x00",
+	"file3\x00",
+	"file5\x00",
+	"thefile2\x00",
+	"\x00",
+
+	// list of posting lists
+	"\na\n", fileList(2), // file1
+	"\nab", fileList(3, 5), // file3, thefile2
+	"\nda", fileList(0), // afile4
+	"\nxy", fileList(4), // file5
+	"ab\n", fileList(5), // thefile2
+	"abc", fileList(0, 3), // afile4, file3
+	"bc\n", fileList(0, 3), // afile4, file3
+	"dab", fileList(0), // afile4
+	"xyz", fileList(4), // file5
+	"yzw", fileList(4), // file5
+	"zw\n", fileList(4), // file5
+	"\xff\xff\xff", fileList(),
+
+	// name index
+	u64(0),
+	u64(6+1),
+	u64(6+1+2+1),
+	u64(6+1+2+1+5+1),
+	u64(6+1+2+1+5+1+5+1),
+	u64(6+1+2+1+5+1+5+1+5+1),
+	u64(6+1+2+1+5+1+5+1+5+1+8+1),
+
+	// posting list index,
+	"\na\n", u32(1), u64(0),
+	"\nab", u32(2), u64(5),
+	"\nda", u32(1), u64(5+6),
+	"\nxy", u32(1), u64(5+6+5),
+	"ab\n", u32(1), u64(5+6+5+5),
+	"abc", u32(2), u64(5+6+5+5+5),
+	"bc\n", u32(2), u64(5+6+5+5+5+6),
+	"dab", u32(1), u64(5+6+5+5+5+6+6),
+	"xyz", u32(1), u64(5+6+5+5+5+6+6+5),
+	"yzw", u32(1), u64(5+6+5+5+5+6+6+5+5),
+	"zw\n", u32(1), u64(5+6+5+5+5+6+6+5+5+5),
+	"\xff\xff\xff", u32(0), u64(5+6+5+5+5+6+6+5+5+5+5),
+
+	// trailer
+	u64(16),
+	u64(16+1),
+	u64(16+1+38),
+	u64(16+1+38+62),
+	u64(16+1+38+62+56),
+
+	"\ncsearch trailr\n",
+)
+
+var trivialIndex = checksummed(trivialIndexV2)
+
+// trivialIndexV1 is trivialIndex in version 1 of the format, see read.go.
+var trivialIndexV1 = join(
 	// header
 	"csearch index 1\n",
 
@@ -85,10 +155,44 @@ var trivialIndex = join(
 	"\ncsearch trailr\n",
 )
 
+// checksummed converts an index in version 2 of the format to the current
+// version by adding the (empty) file metadata, the (empty) sparse n-gram index
+// and the checksums section. The index must only contain short posting lists,
+// which are encoded the same in all versions.
+func checksummed(v2 string) string {
+	trailer := v2[len(v2)-len(trailerMagic)-5*8:]
+	var off [numSections]uint64
+	for i := 0; i < 5; i++ {
+		off[i] = binary.BigEndian.Uint64([]byte(trailer[8*i:]))
+	}
+	data := magic + v2[len(magic):len(v2)-len(trailer)]
+	// The file metadata and the sparse n-gram index are empty, i.e. start at
+	// the checksums.
+	checksums := uint64(len(data))
+	for i := 5; i < numSections; i++ {
+		off[i] = checksums
+	}
+	bounds := append(off[:], checksums)
+	var sums string
+	for i := range off {
+		sums += u32(crc32.Checksum([]byte(data[bounds[i]:bounds[i+1]]), castagnoli))
+	}
+	data += sums
+	data += u32(crc32.Checksum([]byte(data), castagnoli))
+	for _, o := range off {
+		data += u64(o)
+	}
+	return data + u64(checksums) + trailerMagic
+}
+
 func join(s ...string) string {
 	return strings.Join(s, "")
 }
 
+func u64(x uint64) string {
+	return u32(uint32(x>>32)) + u32(uint32(x))
+}
+
 func u32(x uint32) string {
 	var buf [4]byte
 	buf[0] = byte(x >> 24)
@@ -163,3 +267,40 @@ func TestTrivialWrite(t *testing.T) {
 func TestTrivialWriteDisk(t *testing.T) {
 	testTrivialWrite(t, true)
 }
+
+func TestConvertV1(t *testing.T) {
+	src, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(src.Name())
+	src.WriteString(trivialIndexV1)
+	src.Close()
+
+	ix := Open(src.Name())
+	if got, want := ix.Version(), 1; got != want {
+		t.Errorf("Version() = %d, want %d", got, want)
+	}
+	if got, want := ix.Name(0), "afile4"; got != want {
+		t.Errorf("Name(0) = %q, want %q", got, want)
+	}
+	if l := ix.PostingList(tri('a', 'b', 'c')); !equalList(l, []uint32{0, 3}) {
+		t.Errorf("PostingList(abc) = %v, want [0 3]", l)
+	}
+	ix.Close()
+
+	dst, _ := ioutil.TempFile("", "index-test")
+	defer os.Remove(dst.Name())
+	dst.Close()
+	Convert(dst.Name(), src.Name())
+
+	data, err := ioutil.ReadFile(dst.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte(trivialIndex)
+	if !bytes.Equal(data, want) {
+		i := 0
+		for i < len(data) && i < len(want) && data[i] == want[i] {
+			i++
+		}
+		t.Fatalf("wrong index:\nhave: %q %q\nwant: %q %q", data[:i], data[i:], want[:i], want[i:])
+	}
+}
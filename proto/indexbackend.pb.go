@@ -10,14 +10,34 @@ It is generated from these files:
 
 It has these top-level messages:
 	FilesRequest
+	FileMeta
 	FilesReply
 	ReplaceIndexRequest
 	ReplaceIndexReply
+	AddSegmentRequest
+	AddSegmentReply
+	DeletePackagesRequest
+	DeletePackagesReply
+	SegmentsRequest
+	SegmentsReply
+	ExplainRequest
+	TrigramCount
+	QueryPlan
+	ExplainReply
+	StatsRequest
+	ShardStats
+	StatsReply
 	FileRequest
 	FileReply
+	ListDirectoryRequest
+	DirectoryEntry
+	ListDirectoryReply
 	SearchRequest
 	Match
+	RankingFeatures
+	Binding
 	ProgressUpdate
+	BudgetExceeded
 	SearchReply
 */
 package proto
@@ -42,10 +62,55 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto1.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type QueryPlan_Op int32
+
+const (
+	QueryPlan_ALL  QueryPlan_Op = 0
+	QueryPlan_NONE QueryPlan_Op = 1
+	QueryPlan_AND  QueryPlan_Op = 2
+	QueryPlan_OR   QueryPlan_Op = 3
+)
+
+var QueryPlan_Op_name = map[int32]string{
+	0: "ALL",
+	1: "NONE",
+	2: "AND",
+	3: "OR",
+}
+var QueryPlan_Op_value = map[string]int32{
+	"ALL":  0,
+	"NONE": 1,
+	"AND":  2,
+	"OR":   3,
+}
+
+func (x QueryPlan_Op) String() string {
+	return proto1.EnumName(QueryPlan_Op_name, int32(x))
+}
+func (QueryPlan_Op) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{13, 0} }
+
 type FilesRequest struct {
 	// Text query (e.g. “i3Font”) which will be translated into a trigram query
 	// (e.g. "3Fo" "Fon" "i3F" "ont").
 	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
+	// Regular expressions which all must (package) or must not (npackage)
+	// match the source package name (e.g. “i3-wm”) of a file, see the
+	// package: and -package: keywords. Files of excluded packages are
+	// skipped as a whole.
+	Package  []string `protobuf:"bytes,2,rep,name=package" json:"package,omitempty"`
+	Npackage []string `protobuf:"bytes,3,rep,name=npackage" json:"npackage,omitempty"`
+	// Regular expressions which all must (path) or must not (npath) match the
+	// path of a file, see the path: and -path: keywords.
+	Path  []string `protobuf:"bytes,4,rep,name=path" json:"path,omitempty"`
+	Npath []string `protobuf:"bytes,5,rep,name=npath" json:"npath,omitempty"`
+	// File name suffixes (e.g. “.c”), of which the lower-cased suffix of a
+	// file must (suffix) or must not (nsuffix) be one, see the filetype: and
+	// -filetype: keywords.
+	Suffix  []string `protobuf:"bytes,6,rep,name=suffix" json:"suffix,omitempty"`
+	Nsuffix []string `protobuf:"bytes,7,rep,name=nsuffix" json:"nsuffix,omitempty"`
+	// Whether to exclude copies of third-party code (see FileMeta.vendored),
+	// see the -vendored keyword.
+	Nvendored bool `protobuf:"varint,8,opt,name=nvendored" json:"nvendored,omitempty"`
 }
 
 func (m *FilesRequest) Reset()                    { *m = FilesRequest{} }
@@ -60,17 +125,148 @@ func (m *FilesRequest) GetQuery() string {
 	return ""
 }
 
+func (m *FilesRequest) GetPackage() []string {
+	if m != nil {
+		return m.Package
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetNpackage() []string {
+	if m != nil {
+		return m.Npackage
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetPath() []string {
+	if m != nil {
+		return m.Path
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetNpath() []string {
+	if m != nil {
+		return m.Npath
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetSuffix() []string {
+	if m != nil {
+		return m.Suffix
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetNsuffix() []string {
+	if m != nil {
+		return m.Nsuffix
+	}
+	return nil
+}
+
+func (m *FilesRequest) GetNvendored() bool {
+	if m != nil {
+		return m.Nvendored
+	}
+	return false
+}
+
+// FileMeta is the metadata stored in the index for each file, see
+// index.FileMeta. Files of indexes without metadata have an empty package.
+type FileMeta struct {
+	// Source package name (e.g. “i3-wm”) and version (e.g. “4.13-1”).
+	Package string `protobuf:"bytes,1,opt,name=package" json:"package,omitempty"`
+	Version string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	// Programming language (e.g. “c”), or empty if unknown.
+	Language string `protobuf:"bytes,3,opt,name=language" json:"language,omitempty"`
+	// Size in bytes.
+	Size uint64 `protobuf:"varint,4,opt,name=size" json:"size,omitempty"`
+	// First 8 bytes of the content hash, see package contenthash.
+	ContentHash uint64 `protobuf:"fixed64,5,opt,name=content_hash,json=contentHash" json:"content_hash,omitempty"`
+	// Whether the file was generated by a program (e.g. a configure script).
+	Generated bool `protobuf:"varint,6,opt,name=generated" json:"generated,omitempty"`
+	// Whether the file is test code or test data.
+	Test bool `protobuf:"varint,7,opt,name=test" json:"test,omitempty"`
+	// Whether the file is a copy of third-party code (e.g. a bundled zlib).
+	Vendored bool `protobuf:"varint,8,opt,name=vendored" json:"vendored,omitempty"`
+}
+
+func (m *FileMeta) Reset()                    { *m = FileMeta{} }
+func (m *FileMeta) String() string            { return proto1.CompactTextString(m) }
+func (*FileMeta) ProtoMessage()               {}
+func (*FileMeta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *FileMeta) GetPackage() string {
+	if m != nil {
+		return m.Package
+	}
+	return ""
+}
+
+func (m *FileMeta) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *FileMeta) GetLanguage() string {
+	if m != nil {
+		return m.Language
+	}
+	return ""
+}
+
+func (m *FileMeta) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *FileMeta) GetContentHash() uint64 {
+	if m != nil {
+		return m.ContentHash
+	}
+	return 0
+}
+
+func (m *FileMeta) GetGenerated() bool {
+	if m != nil {
+		return m.Generated
+	}
+	return false
+}
+
+func (m *FileMeta) GetTest() bool {
+	if m != nil {
+		return m.Test
+	}
+	return false
+}
+
+func (m *FileMeta) GetVendored() bool {
+	if m != nil {
+		return m.Vendored
+	}
+	return false
+}
+
 type FilesReply struct {
 	// A path which match the requested trigram query (likely to match
 	// the regular expression from which the trigram query was derived, but can
 	// contain false positives).
-	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Path string    `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Meta *FileMeta `protobuf:"bytes,2,opt,name=meta" json:"meta,omitempty"`
 }
 
 func (m *FilesReply) Reset()                    { *m = FilesReply{} }
 func (m *FilesReply) String() string            { return proto1.CompactTextString(m) }
 func (*FilesReply) ProtoMessage()               {}
-func (*FilesReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*FilesReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *FilesReply) GetPath() string {
 	if m != nil {
@@ -79,14 +275,30 @@ func (m *FilesReply) GetPath() string {
 	return ""
 }
 
+func (m *FilesReply) GetMeta() *FileMeta {
+	if m != nil {
+		return m.Meta
+	}
+	return nil
+}
+
 type ReplaceIndexRequest struct {
 	ReplacementPath string `protobuf:"bytes,1,opt,name=replacement_path,json=replacementPath" json:"replacement_path,omitempty"`
+	// Generation up to which (inclusive) delta segments and tombstones are
+	// contained in the replacement index, i.e. the generation returned by
+	// Segments when the replacement index was started. The default of 0 means
+	// the replacement index contains everything, so all delta segments and
+	// tombstones are dropped.
+	Generation uint64 `protobuf:"varint,2,opt,name=generation" json:"generation,omitempty"`
+	// File name of the base index of the shard to modify (e.g. “full.idx”).
+	// May be empty if the backend serves only one shard.
+	Shard string `protobuf:"bytes,3,opt,name=shard" json:"shard,omitempty"`
 }
 
 func (m *ReplaceIndexRequest) Reset()                    { *m = ReplaceIndexRequest{} }
 func (m *ReplaceIndexRequest) String() string            { return proto1.CompactTextString(m) }
 func (*ReplaceIndexRequest) ProtoMessage()               {}
-func (*ReplaceIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*ReplaceIndexRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *ReplaceIndexRequest) GetReplacementPath() string {
 	if m != nil {
@@ -95,19 +307,474 @@ func (m *ReplaceIndexRequest) GetReplacementPath() string {
 	return ""
 }
 
+func (m *ReplaceIndexRequest) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+func (m *ReplaceIndexRequest) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
 type ReplaceIndexReply struct {
 }
 
 func (m *ReplaceIndexReply) Reset()                    { *m = ReplaceIndexReply{} }
 func (m *ReplaceIndexReply) String() string            { return proto1.CompactTextString(m) }
 func (*ReplaceIndexReply) ProtoMessage()               {}
-func (*ReplaceIndexReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*ReplaceIndexReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type AddSegmentRequest struct {
+	// File name of an index within the directory of -index_path, containing
+	// packages which are not yet part of the loaded index.
+	SegmentPath string `protobuf:"bytes,1,opt,name=segment_path,json=segmentPath" json:"segment_path,omitempty"`
+	// See ReplaceIndexRequest.shard.
+	Shard string `protobuf:"bytes,2,opt,name=shard" json:"shard,omitempty"`
+}
+
+func (m *AddSegmentRequest) Reset()                    { *m = AddSegmentRequest{} }
+func (m *AddSegmentRequest) String() string            { return proto1.CompactTextString(m) }
+func (*AddSegmentRequest) ProtoMessage()               {}
+func (*AddSegmentRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *AddSegmentRequest) GetSegmentPath() string {
+	if m != nil {
+		return m.SegmentPath
+	}
+	return ""
+}
+
+func (m *AddSegmentRequest) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+type AddSegmentReply struct {
+	// Generation of the newly added segment.
+	Generation uint64 `protobuf:"varint,1,opt,name=generation" json:"generation,omitempty"`
+}
+
+func (m *AddSegmentReply) Reset()                    { *m = AddSegmentReply{} }
+func (m *AddSegmentReply) String() string            { return proto1.CompactTextString(m) }
+func (*AddSegmentReply) ProtoMessage()               {}
+func (*AddSegmentReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *AddSegmentReply) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+type DeletePackagesRequest struct {
+	// Package names (e.g. “i3-wm_4.13-1”) whose files should no longer be
+	// returned.
+	Package []string `protobuf:"bytes,1,rep,name=package" json:"package,omitempty"`
+	// See ReplaceIndexRequest.shard.
+	Shard string `protobuf:"bytes,2,opt,name=shard" json:"shard,omitempty"`
+}
+
+func (m *DeletePackagesRequest) Reset()                    { *m = DeletePackagesRequest{} }
+func (m *DeletePackagesRequest) String() string            { return proto1.CompactTextString(m) }
+func (*DeletePackagesRequest) ProtoMessage()               {}
+func (*DeletePackagesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *DeletePackagesRequest) GetPackage() []string {
+	if m != nil {
+		return m.Package
+	}
+	return nil
+}
+
+func (m *DeletePackagesRequest) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+type DeletePackagesReply struct {
+	// Generation of the tombstones.
+	Generation uint64 `protobuf:"varint,1,opt,name=generation" json:"generation,omitempty"`
+}
+
+func (m *DeletePackagesReply) Reset()                    { *m = DeletePackagesReply{} }
+func (m *DeletePackagesReply) String() string            { return proto1.CompactTextString(m) }
+func (*DeletePackagesReply) ProtoMessage()               {}
+func (*DeletePackagesReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *DeletePackagesReply) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+type SegmentsRequest struct {
+	// See ReplaceIndexRequest.shard.
+	Shard string `protobuf:"bytes,1,opt,name=shard" json:"shard,omitempty"`
+}
+
+func (m *SegmentsRequest) Reset()                    { *m = SegmentsRequest{} }
+func (m *SegmentsRequest) String() string            { return proto1.CompactTextString(m) }
+func (*SegmentsRequest) ProtoMessage()               {}
+func (*SegmentsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *SegmentsRequest) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+type SegmentsReply struct {
+	// Most recent generation, incremented by every AddSegment and
+	// DeletePackages call.
+	Generation uint64 `protobuf:"varint,1,opt,name=generation" json:"generation,omitempty"`
+	// Number of delta segments on top of the base index.
+	Segments uint32 `protobuf:"varint,2,opt,name=segments" json:"segments,omitempty"`
+	// Names of all packages which are contained in the loaded index and not
+	// deleted.
+	Package []string `protobuf:"bytes,3,rep,name=package" json:"package,omitempty"`
+}
+
+func (m *SegmentsReply) Reset()                    { *m = SegmentsReply{} }
+func (m *SegmentsReply) String() string            { return proto1.CompactTextString(m) }
+func (*SegmentsReply) ProtoMessage()               {}
+func (*SegmentsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *SegmentsReply) GetGeneration() uint64 {
+	if m != nil {
+		return m.Generation
+	}
+	return 0
+}
+
+func (m *SegmentsReply) GetSegments() uint32 {
+	if m != nil {
+		return m.Segments
+	}
+	return 0
+}
+
+func (m *SegmentsReply) GetPackage() []string {
+	if m != nil {
+		return m.Package
+	}
+	return nil
+}
+
+type ExplainRequest struct {
+	// Text query, see FilesRequest.query.
+	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
+}
+
+func (m *ExplainRequest) Reset()                    { *m = ExplainRequest{} }
+func (m *ExplainRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ExplainRequest) ProtoMessage()               {}
+func (*ExplainRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *ExplainRequest) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+type TrigramCount struct {
+	Trigram string `protobuf:"bytes,1,opt,name=trigram" json:"trigram,omitempty"`
+	// Number of files containing the trigram (summed over all segments,
+	// including files of deleted packages).
+	Count uint64 `protobuf:"varint,2,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *TrigramCount) Reset()                    { *m = TrigramCount{} }
+func (m *TrigramCount) String() string            { return proto1.CompactTextString(m) }
+func (*TrigramCount) ProtoMessage()               {}
+func (*TrigramCount) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *TrigramCount) GetTrigram() string {
+	if m != nil {
+		return m.Trigram
+	}
+	return ""
+}
+
+func (m *TrigramCount) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+// QueryPlan is the trigram query derived from a regular expression (see
+// index.Query), annotated with posting list lengths.
+type QueryPlan struct {
+	Op QueryPlan_Op `protobuf:"varint,1,opt,name=op,enum=proto.QueryPlan_Op" json:"op,omitempty"`
+	// In query order. For AND, the shortest posting lists are intersected
+	// first.
+	Trigram []*TrigramCount `protobuf:"bytes,2,rep,name=trigram" json:"trigram,omitempty"`
+	Sub     []*QueryPlan    `protobuf:"bytes,3,rep,name=sub" json:"sub,omitempty"`
+}
+
+func (m *QueryPlan) Reset()                    { *m = QueryPlan{} }
+func (m *QueryPlan) String() string            { return proto1.CompactTextString(m) }
+func (*QueryPlan) ProtoMessage()               {}
+func (*QueryPlan) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *QueryPlan) GetOp() QueryPlan_Op {
+	if m != nil {
+		return m.Op
+	}
+	return QueryPlan_ALL
+}
+
+func (m *QueryPlan) GetTrigram() []*TrigramCount {
+	if m != nil {
+		return m.Trigram
+	}
+	return nil
+}
+
+func (m *QueryPlan) GetSub() []*QueryPlan {
+	if m != nil {
+		return m.Sub
+	}
+	return nil
+}
+
+type ExplainReply struct {
+	// Textual representation of the trigram query, e.g. ("3Fo" "Fon" "i3F").
+	TrigramQuery string     `protobuf:"bytes,1,opt,name=trigram_query,json=trigramQuery" json:"trigram_query,omitempty"`
+	Plan         *QueryPlan `protobuf:"bytes,2,opt,name=plan" json:"plan,omitempty"`
+	// Number of files which Files would return for the query.
+	Candidates uint64 `protobuf:"varint,3,opt,name=candidates" json:"candidates,omitempty"`
+	// Number of segments (over all shards) the query was evaluated on.
+	Segments uint32 `protobuf:"varint,4,opt,name=segments" json:"segments,omitempty"`
+}
+
+func (m *ExplainReply) Reset()                    { *m = ExplainReply{} }
+func (m *ExplainReply) String() string            { return proto1.CompactTextString(m) }
+func (*ExplainReply) ProtoMessage()               {}
+func (*ExplainReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *ExplainReply) GetTrigramQuery() string {
+	if m != nil {
+		return m.TrigramQuery
+	}
+	return ""
+}
+
+func (m *ExplainReply) GetPlan() *QueryPlan {
+	if m != nil {
+		return m.Plan
+	}
+	return nil
+}
+
+func (m *ExplainReply) GetCandidates() uint64 {
+	if m != nil {
+		return m.Candidates
+	}
+	return 0
+}
+
+func (m *ExplainReply) GetSegments() uint32 {
+	if m != nil {
+		return m.Segments
+	}
+	return 0
+}
+
+type StatsRequest struct {
+	// See ReplaceIndexRequest.shard. An empty shard returns statistics for all
+	// shards.
+	Shard string `protobuf:"bytes,1,opt,name=shard" json:"shard,omitempty"`
+	// Number of longest posting lists to return per shard.
+	TopN uint32 `protobuf:"varint,2,opt,name=top_n,json=topN" json:"top_n,omitempty"`
+	// Whether to return the names of all packages.
+	IncludePackages bool `protobuf:"varint,3,opt,name=include_packages,json=includePackages" json:"include_packages,omitempty"`
+}
+
+func (m *StatsRequest) Reset()                    { *m = StatsRequest{} }
+func (m *StatsRequest) String() string            { return proto1.CompactTextString(m) }
+func (*StatsRequest) ProtoMessage()               {}
+func (*StatsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *StatsRequest) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+func (m *StatsRequest) GetTopN() uint32 {
+	if m != nil {
+		return m.TopN
+	}
+	return 0
+}
+
+func (m *StatsRequest) GetIncludePackages() bool {
+	if m != nil {
+		return m.IncludePackages
+	}
+	return false
+}
+
+type ShardStats struct {
+	// File name of the base index, e.g. “full.idx”.
+	Shard string `protobuf:"bytes,1,opt,name=shard" json:"shard,omitempty"`
+	// Number of files which are not deleted.
+	Files uint64 `protobuf:"varint,2,opt,name=files" json:"files,omitempty"`
+	// Number of files of deleted packages which are still contained in the
+	// index files.
+	DeletedFiles uint64 `protobuf:"varint,3,opt,name=deleted_files,json=deletedFiles" json:"deleted_files,omitempty"`
+	// Number of posting lists, summed over all segments.
+	Trigrams uint64 `protobuf:"varint,4,opt,name=trigrams" json:"trigrams,omitempty"`
+	// Size of all index files (base index and delta segments) in bytes.
+	SizeBytes uint64 `protobuf:"varint,5,opt,name=size_bytes,json=sizeBytes" json:"size_bytes,omitempty"`
+	// Number of packages which are not deleted.
+	Packages uint64 `protobuf:"varint,6,opt,name=packages" json:"packages,omitempty"`
+	// Number of delta segments on top of the base index.
+	Segments uint32 `protobuf:"varint,7,opt,name=segments" json:"segments,omitempty"`
+	// The top_n longest posting lists, longest first. Counts of the same
+	// trigram in different segments are added up.
+	Longest []*TrigramCount `protobuf:"bytes,8,rep,name=longest" json:"longest,omitempty"`
+	// Time it took to load the base index and all segments when the shard was
+	// loaded (at startup or by ReplaceIndex), in seconds.
+	LoadSeconds float64 `protobuf:"fixed64,9,opt,name=load_seconds,json=loadSeconds" json:"load_seconds,omitempty"`
+	// Time at which the shard was loaded, in seconds since the UNIX epoch.
+	Loaded int64 `protobuf:"varint,10,opt,name=loaded" json:"loaded,omitempty"`
+	// Only set if include_packages was set.
+	Package []string `protobuf:"bytes,11,rep,name=package" json:"package,omitempty"`
+}
+
+func (m *ShardStats) Reset()                    { *m = ShardStats{} }
+func (m *ShardStats) String() string            { return proto1.CompactTextString(m) }
+func (*ShardStats) ProtoMessage()               {}
+func (*ShardStats) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *ShardStats) GetShard() string {
+	if m != nil {
+		return m.Shard
+	}
+	return ""
+}
+
+func (m *ShardStats) GetFiles() uint64 {
+	if m != nil {
+		return m.Files
+	}
+	return 0
+}
+
+func (m *ShardStats) GetDeletedFiles() uint64 {
+	if m != nil {
+		return m.DeletedFiles
+	}
+	return 0
+}
+
+func (m *ShardStats) GetTrigrams() uint64 {
+	if m != nil {
+		return m.Trigrams
+	}
+	return 0
+}
+
+func (m *ShardStats) GetSizeBytes() uint64 {
+	if m != nil {
+		return m.SizeBytes
+	}
+	return 0
+}
+
+func (m *ShardStats) GetPackages() uint64 {
+	if m != nil {
+		return m.Packages
+	}
+	return 0
+}
+
+func (m *ShardStats) GetSegments() uint32 {
+	if m != nil {
+		return m.Segments
+	}
+	return 0
+}
+
+func (m *ShardStats) GetLongest() []*TrigramCount {
+	if m != nil {
+		return m.Longest
+	}
+	return nil
+}
+
+func (m *ShardStats) GetLoadSeconds() float64 {
+	if m != nil {
+		return m.LoadSeconds
+	}
+	return 0
+}
+
+func (m *ShardStats) GetLoaded() int64 {
+	if m != nil {
+		return m.Loaded
+	}
+	return 0
+}
+
+func (m *ShardStats) GetPackage() []string {
+	if m != nil {
+		return m.Package
+	}
+	return nil
+}
+
+type StatsReply struct {
+	Shard []*ShardStats `protobuf:"bytes,1,rep,name=shard" json:"shard,omitempty"`
+}
+
+func (m *StatsReply) Reset()                    { *m = StatsReply{} }
+func (m *StatsReply) String() string            { return proto1.CompactTextString(m) }
+func (*StatsReply) ProtoMessage()               {}
+func (*StatsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *StatsReply) GetShard() []*ShardStats {
+	if m != nil {
+		return m.Shard
+	}
+	return nil
+}
 
 func init() {
 	proto1.RegisterType((*FilesRequest)(nil), "proto.FilesRequest")
+	proto1.RegisterType((*FileMeta)(nil), "proto.FileMeta")
 	proto1.RegisterType((*FilesReply)(nil), "proto.FilesReply")
 	proto1.RegisterType((*ReplaceIndexRequest)(nil), "proto.ReplaceIndexRequest")
 	proto1.RegisterType((*ReplaceIndexReply)(nil), "proto.ReplaceIndexReply")
+	proto1.RegisterType((*AddSegmentRequest)(nil), "proto.AddSegmentRequest")
+	proto1.RegisterType((*AddSegmentReply)(nil), "proto.AddSegmentReply")
+	proto1.RegisterType((*DeletePackagesRequest)(nil), "proto.DeletePackagesRequest")
+	proto1.RegisterType((*DeletePackagesReply)(nil), "proto.DeletePackagesReply")
+	proto1.RegisterType((*SegmentsRequest)(nil), "proto.SegmentsRequest")
+	proto1.RegisterType((*SegmentsReply)(nil), "proto.SegmentsReply")
+	proto1.RegisterType((*ExplainRequest)(nil), "proto.ExplainRequest")
+	proto1.RegisterType((*TrigramCount)(nil), "proto.TrigramCount")
+	proto1.RegisterType((*QueryPlan)(nil), "proto.QueryPlan")
+	proto1.RegisterType((*ExplainReply)(nil), "proto.ExplainReply")
+	proto1.RegisterType((*StatsRequest)(nil), "proto.StatsRequest")
+	proto1.RegisterType((*ShardStats)(nil), "proto.ShardStats")
+	proto1.RegisterType((*StatsReply)(nil), "proto.StatsReply")
+	proto1.RegisterEnum("proto.QueryPlan_Op", QueryPlan_Op_name, QueryPlan_Op_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -128,6 +795,20 @@ type IndexBackendClient interface {
 	// system level, the specified file is mv'ed to the file specified by
 	// -index_path.
 	ReplaceIndex(ctx context.Context, in *ReplaceIndexRequest, opts ...grpc.CallOption) (*ReplaceIndexReply, error)
+	// Loads the specified index as a delta segment on top of the loaded index.
+	// On a file system level, the specified file is mv'ed next to the file
+	// specified by -index_path.
+	AddSegment(ctx context.Context, in *AddSegmentRequest, opts ...grpc.CallOption) (*AddSegmentReply, error)
+	// Tombstones the specified packages, i.e. removes them from query results
+	// without rewriting any index.
+	DeletePackages(ctx context.Context, in *DeletePackagesRequest, opts ...grpc.CallOption) (*DeletePackagesReply, error)
+	// Segments returns the state of the loaded index, see SegmentsReply.
+	Segments(ctx context.Context, in *SegmentsRequest, opts ...grpc.CallOption) (*SegmentsReply, error)
+	// Explain returns the trigram query for the specified query together with
+	// the posting list lengths and number of candidate files.
+	Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainReply, error)
+	// Stats returns statistics about the loaded shards, see ShardStats.
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error)
 }
 
 type indexBackendClient struct {
@@ -179,6 +860,51 @@ func (c *indexBackendClient) ReplaceIndex(ctx context.Context, in *ReplaceIndexR
 	return out, nil
 }
 
+func (c *indexBackendClient) AddSegment(ctx context.Context, in *AddSegmentRequest, opts ...grpc.CallOption) (*AddSegmentReply, error) {
+	out := new(AddSegmentReply)
+	err := grpc.Invoke(ctx, "/proto.IndexBackend/AddSegment", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexBackendClient) DeletePackages(ctx context.Context, in *DeletePackagesRequest, opts ...grpc.CallOption) (*DeletePackagesReply, error) {
+	out := new(DeletePackagesReply)
+	err := grpc.Invoke(ctx, "/proto.IndexBackend/DeletePackages", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexBackendClient) Segments(ctx context.Context, in *SegmentsRequest, opts ...grpc.CallOption) (*SegmentsReply, error) {
+	out := new(SegmentsReply)
+	err := grpc.Invoke(ctx, "/proto.IndexBackend/Segments", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexBackendClient) Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainReply, error) {
+	out := new(ExplainReply)
+	err := grpc.Invoke(ctx, "/proto.IndexBackend/Explain", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *indexBackendClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error) {
+	out := new(StatsReply)
+	err := grpc.Invoke(ctx, "/proto.IndexBackend/Stats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for IndexBackend service
 
 type IndexBackendServer interface {
@@ -189,6 +915,20 @@ type IndexBackendServer interface {
 	// system level, the specified file is mv'ed to the file specified by
 	// -index_path.
 	ReplaceIndex(context.Context, *ReplaceIndexRequest) (*ReplaceIndexReply, error)
+	// Loads the specified index as a delta segment on top of the loaded index.
+	// On a file system level, the specified file is mv'ed next to the file
+	// specified by -index_path.
+	AddSegment(context.Context, *AddSegmentRequest) (*AddSegmentReply, error)
+	// Tombstones the specified packages, i.e. removes them from query results
+	// without rewriting any index.
+	DeletePackages(context.Context, *DeletePackagesRequest) (*DeletePackagesReply, error)
+	// Segments returns the state of the loaded index, see SegmentsReply.
+	Segments(context.Context, *SegmentsRequest) (*SegmentsReply, error)
+	// Explain returns the trigram query for the specified query together with
+	// the posting list lengths and number of candidate files.
+	Explain(context.Context, *ExplainRequest) (*ExplainReply, error)
+	// Stats returns statistics about the loaded shards, see ShardStats.
+	Stats(context.Context, *StatsRequest) (*StatsReply, error)
 }
 
 func RegisterIndexBackendServer(s *grpc.Server, srv IndexBackendServer) {
@@ -234,6 +974,96 @@ func _IndexBackend_ReplaceIndex_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _IndexBackend_AddSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexBackendServer).AddSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.IndexBackend/AddSegment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexBackendServer).AddSegment(ctx, req.(*AddSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexBackend_DeletePackages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeletePackagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexBackendServer).DeletePackages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.IndexBackend/DeletePackages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexBackendServer).DeletePackages(ctx, req.(*DeletePackagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexBackend_Segments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexBackendServer).Segments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.IndexBackend/Segments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexBackendServer).Segments(ctx, req.(*SegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexBackend_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexBackendServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.IndexBackend/Explain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexBackendServer).Explain(ctx, req.(*ExplainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IndexBackend_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IndexBackendServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.IndexBackend/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IndexBackendServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _IndexBackend_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.IndexBackend",
 	HandlerType: (*IndexBackendServer)(nil),
@@ -242,6 +1072,26 @@ var _IndexBackend_serviceDesc = grpc.ServiceDesc{
 			MethodName: "ReplaceIndex",
 			Handler:    _IndexBackend_ReplaceIndex_Handler,
 		},
+		{
+			MethodName: "AddSegment",
+			Handler:    _IndexBackend_AddSegment_Handler,
+		},
+		{
+			MethodName: "DeletePackages",
+			Handler:    _IndexBackend_DeletePackages_Handler,
+		},
+		{
+			MethodName: "Segments",
+			Handler:    _IndexBackend_Segments_Handler,
+		},
+		{
+			MethodName: "Explain",
+			Handler:    _IndexBackend_Explain_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _IndexBackend_Stats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -256,18 +1106,67 @@ var _IndexBackend_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("indexbackend.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 202 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0xca, 0xcc, 0x4b, 0x49,
-	0xad, 0x48, 0x4a, 0x4c, 0xce, 0x4e, 0xcd, 0x4b, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62,
-	0x05, 0x53, 0x4a, 0x2a, 0x5c, 0x3c, 0x6e, 0x99, 0x39, 0xa9, 0xc5, 0x41, 0xa9, 0x85, 0xa5, 0xa9,
-	0xc5, 0x25, 0x42, 0x22, 0x5c, 0xac, 0x85, 0xa5, 0xa9, 0x45, 0x95, 0x12, 0x8c, 0x0a, 0x8c, 0x1a,
-	0x9c, 0x41, 0x10, 0x8e, 0x92, 0x02, 0x17, 0x17, 0x54, 0x55, 0x41, 0x4e, 0xa5, 0x90, 0x10, 0x17,
-	0x4b, 0x41, 0x62, 0x49, 0x06, 0x54, 0x09, 0x98, 0xad, 0xe4, 0xc0, 0x25, 0x0c, 0x92, 0x4c, 0x4c,
-	0x4e, 0xf5, 0x04, 0xd9, 0x05, 0x33, 0x4e, 0x93, 0x4b, 0xa0, 0x08, 0x22, 0x9c, 0x9b, 0x9a, 0x57,
-	0x12, 0x8f, 0xa4, 0x8d, 0x1f, 0x49, 0x3c, 0x00, 0x64, 0x82, 0x30, 0x97, 0x20, 0xaa, 0x09, 0x05,
-	0x39, 0x95, 0x46, 0xdd, 0x8c, 0x5c, 0x3c, 0x60, 0xae, 0x13, 0xc4, 0xf1, 0x42, 0xc6, 0x5c, 0xac,
-	0x60, 0x97, 0x08, 0x09, 0x43, 0xfc, 0xa1, 0x87, 0xec, 0x7a, 0x29, 0x41, 0x54, 0xc1, 0x82, 0x9c,
-	0x4a, 0x25, 0x06, 0x03, 0x46, 0x21, 0x37, 0x2e, 0x1e, 0x64, 0xa3, 0x85, 0xa4, 0xa0, 0xca, 0xb0,
-	0xb8, 0x58, 0x4a, 0x02, 0xab, 0x1c, 0xd8, 0xa4, 0x24, 0x36, 0xb0, 0x94, 0x31, 0x20, 0x00, 0x00,
-	0xff, 0xff, 0x41, 0x0d, 0x3e, 0x0b, 0x50, 0x01, 0x00, 0x00,
+	// 985 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0x5d, 0x6e, 0xdb, 0x46,
+	0x10, 0x0e, 0x29, 0xea, 0x6f, 0x44, 0xdb, 0xd2, 0xca, 0x09, 0x08, 0x22, 0x2d, 0x14, 0xba, 0x68,
+	0xd4, 0x87, 0x18, 0x8d, 0x83, 0xa0, 0x40, 0x1f, 0x8a, 0x26, 0x8d, 0xd3, 0x16, 0x70, 0x6d, 0x97,
+	0xee, 0xbb, 0xb0, 0xd6, 0xae, 0x65, 0x22, 0xf4, 0x92, 0x21, 0x29, 0xc3, 0xea, 0x3d, 0x7a, 0x8c,
+	0x9e, 0xa2, 0x57, 0xc8, 0x7b, 0xaf, 0x52, 0xcc, 0xee, 0x90, 0x22, 0x65, 0x25, 0xcd, 0x93, 0x38,
+	0xdf, 0xec, 0xce, 0xcf, 0xb7, 0x33, 0x9f, 0x80, 0x45, 0x4a, 0xc8, 0xbb, 0x4b, 0x3e, 0x7f, 0x27,
+	0x95, 0x38, 0x4c, 0xb3, 0xa4, 0x48, 0x58, 0x5b, 0xff, 0x04, 0x1f, 0x2c, 0x70, 0xdf, 0x46, 0xb1,
+	0xcc, 0x43, 0xf9, 0x7e, 0x29, 0xf3, 0x82, 0xed, 0x43, 0xfb, 0xfd, 0x52, 0x66, 0x2b, 0xcf, 0x9a,
+	0x58, 0xd3, 0x7e, 0x68, 0x0c, 0xe6, 0x41, 0x37, 0xe5, 0xf3, 0x77, 0x7c, 0x21, 0x3d, 0x7b, 0xd2,
+	0x9a, 0xf6, 0xc3, 0xd2, 0x64, 0x3e, 0xf4, 0x54, 0xe9, 0x6a, 0x69, 0x57, 0x65, 0x33, 0x06, 0x4e,
+	0xca, 0x8b, 0x6b, 0xcf, 0xd1, 0xb8, 0xfe, 0xc6, 0xf8, 0x4a, 0x83, 0x6d, 0x0d, 0x1a, 0x83, 0x3d,
+	0x82, 0x4e, 0xbe, 0xbc, 0xba, 0x8a, 0xee, 0xbc, 0x8e, 0x86, 0xc9, 0xc2, 0xbc, 0x8a, 0x1c, 0x5d,
+	0x93, 0x97, 0x4c, 0xf6, 0x18, 0xfa, 0xea, 0x56, 0x2a, 0x91, 0x64, 0x52, 0x78, 0xbd, 0x89, 0x35,
+	0xed, 0x85, 0x6b, 0x20, 0xf8, 0xd7, 0x82, 0x1e, 0xb6, 0xf5, 0x9b, 0x2c, 0x78, 0xbd, 0x78, 0xd3,
+	0x54, 0x55, 0xbc, 0x07, 0xdd, 0x5b, 0x99, 0xe5, 0x51, 0xa2, 0x3c, 0xdb, 0x78, 0xc8, 0xc4, 0xb6,
+	0x62, 0xae, 0x16, 0x4b, 0xd3, 0x16, 0xba, 0x2a, 0x1b, 0xdb, 0xca, 0xa3, 0x3f, 0xa5, 0xe7, 0x4c,
+	0xac, 0xa9, 0x13, 0xea, 0x6f, 0xf6, 0x04, 0xdc, 0x79, 0xa2, 0x0a, 0xa9, 0x8a, 0xd9, 0x35, 0xcf,
+	0xb1, 0x3b, 0x6b, 0xda, 0x09, 0x07, 0x84, 0xfd, 0xc2, 0xf3, 0x6b, 0xac, 0x78, 0x21, 0x95, 0xcc,
+	0x78, 0x21, 0x85, 0xd7, 0x31, 0x15, 0x57, 0x00, 0x06, 0x2d, 0x64, 0x5e, 0x78, 0x5d, 0xed, 0xd0,
+	0xdf, 0x58, 0xc4, 0x46, 0x8b, 0x95, 0x1d, 0x1c, 0x03, 0xd0, 0xbb, 0xa5, 0xf1, 0xaa, 0x62, 0xda,
+	0xf4, 0xa7, 0xbf, 0xd9, 0x01, 0x38, 0x37, 0xb2, 0xe0, 0xba, 0xb3, 0xc1, 0xd1, 0x9e, 0x79, 0xf7,
+	0xc3, 0x92, 0x95, 0x50, 0x3b, 0x83, 0x5b, 0x18, 0x63, 0x04, 0x3e, 0x97, 0xbf, 0xe2, 0x8c, 0x94,
+	0x53, 0xf0, 0x0d, 0x0c, 0x33, 0x03, 0xdf, 0x60, 0x4b, 0xb5, 0xd8, 0x7b, 0x35, 0xfc, 0x1c, 0xd3,
+	0x7c, 0x09, 0x40, 0x5d, 0x94, 0x34, 0x3a, 0x61, 0x0d, 0xc1, 0x07, 0xcf, 0xaf, 0x79, 0x26, 0x88,
+	0x46, 0x63, 0x04, 0x63, 0x18, 0x35, 0xf3, 0xa6, 0xf1, 0x2a, 0x38, 0x81, 0xd1, 0x2b, 0x21, 0x2e,
+	0xe4, 0x02, 0x83, 0x97, 0xa5, 0x3c, 0x01, 0x37, 0x97, 0x8b, 0xcd, 0x32, 0x06, 0x84, 0x9d, 0xd3,
+	0x4c, 0x99, 0x14, 0x76, 0x3d, 0xc5, 0x73, 0xd8, 0xab, 0x47, 0x43, 0x9a, 0x9a, 0xb5, 0x5a, 0x9b,
+	0xb5, 0x06, 0x3f, 0xc3, 0xc3, 0x37, 0x32, 0x96, 0x85, 0x3c, 0x37, 0x03, 0x52, 0x6d, 0x45, 0x63,
+	0x84, 0x1a, 0xf3, 0xbf, 0x3d, 0xf7, 0x4b, 0x18, 0x6f, 0x06, 0xfa, 0x9c, 0xfc, 0x4f, 0x61, 0x8f,
+	0xea, 0xad, 0xef, 0xa3, 0x89, 0x6f, 0xd5, 0xe3, 0x4b, 0xd8, 0x59, 0x1f, 0xfc, 0x8c, 0xc8, 0x38,
+	0x4a, 0xc4, 0x58, 0xae, 0x2b, 0xdd, 0x09, 0x2b, 0xbb, 0xde, 0x5c, 0xab, 0xd1, 0x5c, 0xf0, 0x35,
+	0xec, 0x1e, 0xdf, 0xa5, 0x31, 0x8f, 0xd4, 0x27, 0xe5, 0x21, 0xf8, 0x01, 0xdc, 0x3f, 0xb2, 0x68,
+	0x91, 0xf1, 0x9b, 0x9f, 0x92, 0xa5, 0xd2, 0x74, 0x15, 0xc6, 0x2e, 0x37, 0x8e, 0x4c, 0xbc, 0x3f,
+	0xc7, 0x23, 0x34, 0x28, 0xc6, 0x08, 0xfe, 0xb6, 0xa0, 0xff, 0x3b, 0x46, 0x3a, 0x8f, 0xb9, 0x62,
+	0x07, 0x60, 0x27, 0xa9, 0xbe, 0xb8, 0x7b, 0x34, 0xa6, 0xb1, 0xad, 0xbc, 0x87, 0x67, 0x69, 0x68,
+	0x27, 0x29, 0x7b, 0xb6, 0x4e, 0x81, 0x8a, 0x34, 0xa8, 0x4e, 0xd6, 0x0b, 0x59, 0xe7, 0x0d, 0xa0,
+	0x95, 0x2f, 0x2f, 0x75, 0x7f, 0x83, 0xa3, 0xe1, 0x66, 0xd0, 0x10, 0x9d, 0xc1, 0x14, 0xec, 0xb3,
+	0x94, 0x75, 0xa1, 0xf5, 0xea, 0xe4, 0x64, 0xf8, 0x80, 0xf5, 0xc0, 0x39, 0x3d, 0x3b, 0x3d, 0x1e,
+	0x5a, 0x1a, 0x3a, 0x7d, 0x33, 0xb4, 0x59, 0x07, 0xec, 0xb3, 0x70, 0xd8, 0x0a, 0xfe, 0xb2, 0xc0,
+	0xad, 0x88, 0x41, 0xfa, 0x0f, 0x60, 0x87, 0x32, 0xcd, 0xea, 0xf4, 0xb8, 0x04, 0xea, 0x44, 0xec,
+	0x2b, 0x70, 0xd2, 0x98, 0x2b, 0x5a, 0xc8, 0xfb, 0x45, 0x68, 0x2f, 0xbe, 0xe4, 0x9c, 0x2b, 0x11,
+	0x09, 0x5e, 0xc8, 0x5c, 0x2f, 0x8d, 0x13, 0xd6, 0x90, 0xc6, 0x4b, 0x3a, 0xcd, 0x97, 0x0c, 0x04,
+	0xb8, 0x17, 0x05, 0xff, 0x9f, 0xe1, 0x61, 0x63, 0x68, 0x17, 0x49, 0x3a, 0x53, 0x34, 0x08, 0x4e,
+	0x91, 0xa4, 0xa7, 0xb8, 0xf1, 0x91, 0x9a, 0xc7, 0x4b, 0x21, 0x67, 0xf4, 0xfa, 0x26, 0x79, 0x2f,
+	0xdc, 0x23, 0xbc, 0x1c, 0xe5, 0xe0, 0x83, 0x0d, 0x70, 0x81, 0x91, 0x74, 0xae, 0x8f, 0x24, 0xd9,
+	0x87, 0xf6, 0x15, 0xea, 0x53, 0xf9, 0xd0, 0xda, 0x40, 0x9e, 0x84, 0xde, 0x0b, 0x31, 0x33, 0x5e,
+	0xd3, 0x9f, 0x4b, 0xa0, 0x56, 0x34, 0xec, 0x90, 0x78, 0xcb, 0x49, 0x63, 0x2b, 0x9b, 0x7d, 0x01,
+	0x80, 0x7a, 0x3b, 0xbb, 0x5c, 0x21, 0x3b, 0x6d, 0xed, 0xed, 0x23, 0xf2, 0x7a, 0x45, 0xe4, 0x54,
+	0xd5, 0x77, 0xcc, 0xd5, 0xd2, 0x6e, 0x10, 0xd7, 0xdd, 0x58, 0x81, 0x67, 0xd0, 0x8d, 0x13, 0xb5,
+	0x40, 0x01, 0xee, 0x7d, 0x62, 0x9a, 0xe8, 0x0c, 0x6a, 0x52, 0x9c, 0x70, 0x31, 0xcb, 0xe5, 0x3c,
+	0x51, 0x22, 0xf7, 0xfa, 0x13, 0x6b, 0x6a, 0x85, 0x03, 0xc4, 0x2e, 0x0c, 0x84, 0xff, 0x68, 0x68,
+	0x4a, 0xe1, 0xc1, 0xc4, 0x9a, 0xb6, 0x42, 0xb2, 0xea, 0xcb, 0x36, 0x68, 0x2e, 0xdb, 0x4b, 0x00,
+	0x7a, 0x3c, 0x9c, 0xa8, 0xa7, 0x6b, 0x56, 0xb1, 0x9e, 0x11, 0xd5, 0xb3, 0xe6, 0x9d, 0x88, 0x3e,
+	0xfa, 0xa7, 0x05, 0xae, 0xd6, 0xd0, 0xd7, 0xe6, 0xff, 0x9d, 0xbd, 0x80, 0xb6, 0xe1, 0x71, 0x5c,
+	0x93, 0xfc, 0x72, 0x24, 0xfc, 0x51, 0x13, 0x44, 0xd9, 0x7d, 0xf0, 0xad, 0xc5, 0xde, 0x82, 0x5b,
+	0xd7, 0x63, 0xe6, 0xd3, 0xb1, 0x2d, 0x7f, 0x0e, 0xbe, 0xb7, 0xd5, 0xa7, 0x23, 0xb1, 0x1f, 0x01,
+	0xd6, 0xa2, 0xcb, 0xca, 0x93, 0xf7, 0x54, 0xdd, 0x7f, 0xb4, 0xc5, 0x63, 0x22, 0x9c, 0xc0, 0x6e,
+	0x53, 0x3a, 0xd9, 0x63, 0x3a, 0xbb, 0x55, 0x9a, 0x7d, 0xff, 0x23, 0x5e, 0x13, 0xed, 0x7b, 0xe8,
+	0x95, 0x42, 0xc9, 0xca, 0x9c, 0x1b, 0x12, 0xeb, 0xef, 0xdf, 0xc3, 0xcd, 0xdd, 0xef, 0xa0, 0x4b,
+	0x4b, 0xce, 0x1e, 0xd2, 0x91, 0xa6, 0x1a, 0xfa, 0xe3, 0x4d, 0xd8, 0x5c, 0x7c, 0x0e, 0x6d, 0xb3,
+	0x1a, 0xa5, 0xbf, 0xbe, 0x94, 0xfe, 0xa8, 0x09, 0xea, 0x2b, 0x97, 0x1d, 0x8d, 0xbd, 0xf8, 0x6f,
+	0x00, 0x2c, 0xbf, 0xb3, 0xca, 0xab, 0x09, 0x00, 0x00,
 }
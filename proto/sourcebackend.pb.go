@@ -17,29 +17,67 @@ var _ = proto1.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
+type DirectoryEntry_Type int32
+
+const (
+	DirectoryEntry_FILE      DirectoryEntry_Type = 0
+	DirectoryEntry_DIRECTORY DirectoryEntry_Type = 1
+	DirectoryEntry_SYMLINK   DirectoryEntry_Type = 2
+)
+
+var DirectoryEntry_Type_name = map[int32]string{
+	0: "FILE",
+	1: "DIRECTORY",
+	2: "SYMLINK",
+}
+var DirectoryEntry_Type_value = map[string]int32{
+	"FILE":      0,
+	"DIRECTORY": 1,
+	"SYMLINK":   2,
+}
+
+func (x DirectoryEntry_Type) String() string {
+	return proto1.EnumName(DirectoryEntry_Type_name, int32(x))
+}
+func (DirectoryEntry_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{3, 0} }
+
 type SearchReply_Type int32
 
 const (
 	SearchReply_MATCH           SearchReply_Type = 0
 	SearchReply_PROGRESS_UPDATE SearchReply_Type = 1
+	SearchReply_BUDGET_EXCEEDED SearchReply_Type = 2
 )
 
 var SearchReply_Type_name = map[int32]string{
 	0: "MATCH",
 	1: "PROGRESS_UPDATE",
+	2: "BUDGET_EXCEEDED",
 }
 var SearchReply_Type_value = map[string]int32{
 	"MATCH":           0,
 	"PROGRESS_UPDATE": 1,
+	"BUDGET_EXCEEDED": 2,
 }
 
 func (x SearchReply_Type) String() string {
 	return proto1.EnumName(SearchReply_Type_name, int32(x))
 }
-func (SearchReply_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{5, 0} }
+func (SearchReply_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{11, 0} }
 
 type FileRequest struct {
 	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// If first_line is non-zero, only the lines [first_line, last_line] (1-based,
+	// inclusive) are returned. last_line must not be smaller than first_line.
+	FirstLine uint32 `protobuf:"varint,2,opt,name=first_line,json=firstLine" json:"first_line,omitempty"`
+	LastLine  uint32 `protobuf:"varint,3,opt,name=last_line,json=lastLine" json:"last_line,omitempty"`
+	// If length is non-zero (and first_line is zero), only length bytes starting
+	// at offset are returned.
+	Offset uint64 `protobuf:"varint,4,opt,name=offset" json:"offset,omitempty"`
+	Length uint64 `protobuf:"varint,5,opt,name=length" json:"length,omitempty"`
+	// Files which are not valid UTF-8 are returned in their UTF-8 transcoding
+	// (see package transcode), unless original is set.
+	Original bool `protobuf:"varint,6,opt,name=original" json:"original,omitempty"`
 }
 
 func (m *FileRequest) Reset()                    { *m = FileRequest{} }
@@ -54,8 +92,65 @@ func (m *FileRequest) GetPath() string {
 	return ""
 }
 
+func (m *FileRequest) GetFirstLine() uint32 {
+	if m != nil {
+		return m.FirstLine
+	}
+	return 0
+}
+
+func (m *FileRequest) GetLastLine() uint32 {
+	if m != nil {
+		return m.LastLine
+	}
+	return 0
+}
+
+func (m *FileRequest) GetOffset() uint64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *FileRequest) GetLength() uint64 {
+	if m != nil {
+		return m.Length
+	}
+	return 0
+}
+
+func (m *FileRequest) GetOriginal() bool {
+	if m != nil {
+		return m.Original
+	}
+	return false
+}
+
 type FileReply struct {
+	// Contents of the requested range (or the entire file if no range was
+	// requested).
 	Contents []byte `protobuf:"bytes,1,opt,name=contents,proto3" json:"contents,omitempty"`
+	// Size of the entire file in bytes.
+	Size uint64 `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	// Number of lines in the entire file. Compressed files store it (see
+	// package seekable), so it is cheap even if only a range was requested.
+	// Uncompressed files are read entirely to count their lines.
+	Lines uint32 `protobuf:"varint,3,opt,name=lines" json:"lines,omitempty"`
+	// Line number of the first line in contents (1 unless a range was
+	// requested). For byte ranges, the file is read up to offset to count the
+	// preceding lines.
+	FirstLine uint32 `protobuf:"varint,4,opt,name=first_line,json=firstLine" json:"first_line,omitempty"`
+	// Detected encoding of the file, e.g. “utf-8” or “shift_jis”.
+	Encoding string `protobuf:"bytes,5,opt,name=encoding" json:"encoding,omitempty"`
+	// Detected language of the file (see ranking.Language), e.g. “c”. Empty if
+	// unknown.
+	Language string `protobuf:"bytes,6,opt,name=language" json:"language,omitempty"`
+	// Version of the source package containing the file, e.g. “4.7.2-1”.
+	PackageVersion string `protobuf:"bytes,7,opt,name=package_version,json=packageVersion" json:"package_version,omitempty"`
+	// Whether contents is the UTF-8 transcoding of the file (whose original
+	// encoding is encoding), see FileRequest.original.
+	Transcoded bool `protobuf:"varint,8,opt,name=transcoded" json:"transcoded,omitempty"`
 }
 
 func (m *FileReply) Reset()                    { *m = FileReply{} }
@@ -70,6 +165,123 @@ func (m *FileReply) GetContents() []byte {
 	return nil
 }
 
+func (m *FileReply) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *FileReply) GetLines() uint32 {
+	if m != nil {
+		return m.Lines
+	}
+	return 0
+}
+
+func (m *FileReply) GetFirstLine() uint32 {
+	if m != nil {
+		return m.FirstLine
+	}
+	return 0
+}
+
+func (m *FileReply) GetEncoding() string {
+	if m != nil {
+		return m.Encoding
+	}
+	return ""
+}
+
+func (m *FileReply) GetLanguage() string {
+	if m != nil {
+		return m.Language
+	}
+	return ""
+}
+
+func (m *FileReply) GetPackageVersion() string {
+	if m != nil {
+		return m.PackageVersion
+	}
+	return ""
+}
+
+func (m *FileReply) GetTranscoded() bool {
+	if m != nil {
+		return m.Transcoded
+	}
+	return false
+}
+
+type ListDirectoryRequest struct {
+	// Path of the directory relative to the unpacked sources, e.g.
+	// “i3-wm_4.7.2-1/src”. The empty path lists all packages of the backend.
+	Path string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+}
+
+func (m *ListDirectoryRequest) Reset()                    { *m = ListDirectoryRequest{} }
+func (m *ListDirectoryRequest) String() string            { return proto1.CompactTextString(m) }
+func (*ListDirectoryRequest) ProtoMessage()               {}
+func (*ListDirectoryRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+
+func (m *ListDirectoryRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type DirectoryEntry struct {
+	Name string              `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Type DirectoryEntry_Type `protobuf:"varint,2,opt,name=type,enum=proto.DirectoryEntry_Type" json:"type,omitempty"`
+	// Size in bytes, only set for files.
+	Size uint64 `protobuf:"varint,3,opt,name=size" json:"size,omitempty"`
+}
+
+func (m *DirectoryEntry) Reset()                    { *m = DirectoryEntry{} }
+func (m *DirectoryEntry) String() string            { return proto1.CompactTextString(m) }
+func (*DirectoryEntry) ProtoMessage()               {}
+func (*DirectoryEntry) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+
+func (m *DirectoryEntry) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *DirectoryEntry) GetType() DirectoryEntry_Type {
+	if m != nil {
+		return m.Type
+	}
+	return DirectoryEntry_FILE
+}
+
+func (m *DirectoryEntry) GetSize() uint64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+type ListDirectoryReply struct {
+	// Entries of the directory, sorted by name.
+	Entries []*DirectoryEntry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *ListDirectoryReply) Reset()                    { *m = ListDirectoryReply{} }
+func (m *ListDirectoryReply) String() string            { return proto1.CompactTextString(m) }
+func (*ListDirectoryReply) ProtoMessage()               {}
+func (*ListDirectoryReply) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+
+func (m *ListDirectoryReply) GetEntries() []*DirectoryEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
 type SearchRequest struct {
 	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
 	// Rewritten URL (after RewriteQuery()) with all the parameters that
@@ -80,7 +292,7 @@ type SearchRequest struct {
 func (m *SearchRequest) Reset()                    { *m = SearchRequest{} }
 func (m *SearchRequest) String() string            { return proto1.CompactTextString(m) }
 func (*SearchRequest) ProtoMessage()               {}
-func (*SearchRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+func (*SearchRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
 
 func (m *SearchRequest) GetQuery() string {
 	if m != nil {
@@ -112,12 +324,24 @@ type Match struct {
 	Pathrank float32 `protobuf:"fixed32,8,opt,name=pathrank" json:"pathrank,omitempty"`
 	Ranking  float32 `protobuf:"fixed32,9,opt,name=ranking" json:"ranking,omitempty"`
 	Package  string  `protobuf:"bytes,10,opt,name=package" json:"package,omitempty"`
+	// Content hash of the file (see package contenthash). Only set for dedup:yes
+	// queries.
+	ContentHash string `protobuf:"bytes,11,opt,name=content_hash,json=contentHash" json:"content_hash,omitempty"`
+	// Paths of other files with the exact same contents, which were not
+	// searched separately. Only set for dedup:yes queries.
+	Duplicates []string `protobuf:"bytes,12,rep,name=duplicates" json:"duplicates,omitempty"`
+	// Bindings of the holes of a struct: query, in the order of their first
+	// occurrence in the pattern.
+	Bindings []*Binding `protobuf:"bytes,13,rep,name=bindings" json:"bindings,omitempty"`
+	// Values of the ranking signals of the match, for learning ranking weights
+	// (see ranking.Features).
+	Features *RankingFeatures `protobuf:"bytes,14,opt,name=features" json:"features,omitempty"`
 }
 
 func (m *Match) Reset()                    { *m = Match{} }
 func (m *Match) String() string            { return proto1.CompactTextString(m) }
 func (*Match) ProtoMessage()               {}
-func (*Match) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+func (*Match) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{6} }
 
 func (m *Match) GetPath() string {
 	if m != nil {
@@ -189,6 +413,99 @@ func (m *Match) GetPackage() string {
 	return ""
 }
 
+func (m *Match) GetContentHash() string {
+	if m != nil {
+		return m.ContentHash
+	}
+	return ""
+}
+
+func (m *Match) GetDuplicates() []string {
+	if m != nil {
+		return m.Duplicates
+	}
+	return nil
+}
+
+func (m *Match) GetBindings() []*Binding {
+	if m != nil {
+		return m.Bindings
+	}
+	return nil
+}
+
+func (m *Match) GetFeatures() *RankingFeatures {
+	if m != nil {
+		return m.Features
+	}
+	return nil
+}
+
+type RankingFeatures struct {
+	Inst           float32 `protobuf:"fixed32,1,opt,name=inst" json:"inst,omitempty"`
+	Rdep           float32 `protobuf:"fixed32,2,opt,name=rdep" json:"rdep,omitempty"`
+	Pathmatch      float32 `protobuf:"fixed32,3,opt,name=pathmatch" json:"pathmatch,omitempty"`
+	Sourcepkgmatch float32 `protobuf:"fixed32,4,opt,name=sourcepkgmatch" json:"sourcepkgmatch,omitempty"`
+}
+
+func (m *RankingFeatures) Reset()                    { *m = RankingFeatures{} }
+func (m *RankingFeatures) String() string            { return proto1.CompactTextString(m) }
+func (*RankingFeatures) ProtoMessage()               {}
+func (*RankingFeatures) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{7} }
+
+func (m *RankingFeatures) GetInst() float32 {
+	if m != nil {
+		return m.Inst
+	}
+	return 0
+}
+
+func (m *RankingFeatures) GetRdep() float32 {
+	if m != nil {
+		return m.Rdep
+	}
+	return 0
+}
+
+func (m *RankingFeatures) GetPathmatch() float32 {
+	if m != nil {
+		return m.Pathmatch
+	}
+	return 0
+}
+
+func (m *RankingFeatures) GetSourcepkgmatch() float32 {
+	if m != nil {
+		return m.Sourcepkgmatch
+	}
+	return 0
+}
+
+// Binding is the text a hole of a struct: query matched.
+type Binding struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Binding) Reset()                    { *m = Binding{} }
+func (m *Binding) String() string            { return proto1.CompactTextString(m) }
+func (*Binding) ProtoMessage()               {}
+func (*Binding) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{8} }
+
+func (m *Binding) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Binding) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
 type ProgressUpdate struct {
 	FilesProcessed uint64 `protobuf:"varint,1,opt,name=files_processed,json=filesProcessed" json:"files_processed,omitempty"`
 	FilesTotal     uint64 `protobuf:"varint,2,opt,name=files_total,json=filesTotal" json:"files_total,omitempty"`
@@ -197,7 +514,7 @@ type ProgressUpdate struct {
 func (m *ProgressUpdate) Reset()                    { *m = ProgressUpdate{} }
 func (m *ProgressUpdate) String() string            { return proto1.CompactTextString(m) }
 func (*ProgressUpdate) ProtoMessage()               {}
-func (*ProgressUpdate) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+func (*ProgressUpdate) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{9} }
 
 func (m *ProgressUpdate) GetFilesProcessed() uint64 {
 	if m != nil {
@@ -213,16 +530,44 @@ func (m *ProgressUpdate) GetFilesTotal() uint64 {
 	return 0
 }
 
+// BudgetExceeded is sent for a file whose search in pcre: mode was aborted
+// because verifying its candidate lines exceeded the step or time budget. The
+// matches found before were sent.
+type BudgetExceeded struct {
+	Path   string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *BudgetExceeded) Reset()                    { *m = BudgetExceeded{} }
+func (m *BudgetExceeded) String() string            { return proto1.CompactTextString(m) }
+func (*BudgetExceeded) ProtoMessage()               {}
+func (*BudgetExceeded) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{10} }
+
+func (m *BudgetExceeded) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *BudgetExceeded) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
 type SearchReply struct {
 	Type           SearchReply_Type `protobuf:"varint,1,opt,name=type,enum=proto.SearchReply_Type" json:"type,omitempty"`
 	Match          *Match           `protobuf:"bytes,2,opt,name=match" json:"match,omitempty"`
 	ProgressUpdate *ProgressUpdate  `protobuf:"bytes,3,opt,name=progress_update,json=progressUpdate" json:"progress_update,omitempty"`
+	BudgetExceeded *BudgetExceeded  `protobuf:"bytes,4,opt,name=budget_exceeded,json=budgetExceeded" json:"budget_exceeded,omitempty"`
 }
 
 func (m *SearchReply) Reset()                    { *m = SearchReply{} }
 func (m *SearchReply) String() string            { return proto1.CompactTextString(m) }
 func (*SearchReply) ProtoMessage()               {}
-func (*SearchReply) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+func (*SearchReply) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{11} }
 
 func (m *SearchReply) GetType() SearchReply_Type {
 	if m != nil {
@@ -245,13 +590,27 @@ func (m *SearchReply) GetProgressUpdate() *ProgressUpdate {
 	return nil
 }
 
+func (m *SearchReply) GetBudgetExceeded() *BudgetExceeded {
+	if m != nil {
+		return m.BudgetExceeded
+	}
+	return nil
+}
+
 func init() {
 	proto1.RegisterType((*FileRequest)(nil), "proto.FileRequest")
 	proto1.RegisterType((*FileReply)(nil), "proto.FileReply")
+	proto1.RegisterType((*ListDirectoryRequest)(nil), "proto.ListDirectoryRequest")
+	proto1.RegisterType((*DirectoryEntry)(nil), "proto.DirectoryEntry")
+	proto1.RegisterType((*ListDirectoryReply)(nil), "proto.ListDirectoryReply")
 	proto1.RegisterType((*SearchRequest)(nil), "proto.SearchRequest")
 	proto1.RegisterType((*Match)(nil), "proto.Match")
+	proto1.RegisterType((*RankingFeatures)(nil), "proto.RankingFeatures")
+	proto1.RegisterType((*Binding)(nil), "proto.Binding")
 	proto1.RegisterType((*ProgressUpdate)(nil), "proto.ProgressUpdate")
+	proto1.RegisterType((*BudgetExceeded)(nil), "proto.BudgetExceeded")
 	proto1.RegisterType((*SearchReply)(nil), "proto.SearchReply")
+	proto1.RegisterEnum("proto.DirectoryEntry_Type", DirectoryEntry_Type_name, DirectoryEntry_Type_value)
 	proto1.RegisterEnum("proto.SearchReply_Type", SearchReply_Type_name, SearchReply_Type_value)
 }
 
@@ -268,8 +627,16 @@ const _ = grpc.SupportPackageIsVersion4
 type SourceBackendClient interface {
 	// File reads the file and returns its contents.
 	File(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileReply, error)
+	// ListDirectory returns the entries of the directory.
+	ListDirectory(ctx context.Context, in *ListDirectoryRequest, opts ...grpc.CallOption) (*ListDirectoryReply, error)
 	// Search performs the given query and streams matches/progress updates.
 	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (SourceBackend_SearchClient, error)
+	// Explain forwards the request to the index backend, see
+	// IndexBackend.Explain.
+	Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainReply, error)
+	// IndexStats forwards the request to the index backend, see
+	// IndexBackend.Stats.
+	IndexStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error)
 }
 
 type sourceBackendClient struct {
@@ -289,6 +656,15 @@ func (c *sourceBackendClient) File(ctx context.Context, in *FileRequest, opts ..
 	return out, nil
 }
 
+func (c *sourceBackendClient) ListDirectory(ctx context.Context, in *ListDirectoryRequest, opts ...grpc.CallOption) (*ListDirectoryReply, error) {
+	out := new(ListDirectoryReply)
+	err := grpc.Invoke(ctx, "/proto.SourceBackend/ListDirectory", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *sourceBackendClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (SourceBackend_SearchClient, error) {
 	stream, err := grpc.NewClientStream(ctx, &_SourceBackend_serviceDesc.Streams[0], c.cc, "/proto.SourceBackend/Search", opts...)
 	if err != nil {
@@ -321,13 +697,39 @@ func (x *sourceBackendSearchClient) Recv() (*SearchReply, error) {
 	return m, nil
 }
 
+func (c *sourceBackendClient) Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainReply, error) {
+	out := new(ExplainReply)
+	err := grpc.Invoke(ctx, "/proto.SourceBackend/Explain", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sourceBackendClient) IndexStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsReply, error) {
+	out := new(StatsReply)
+	err := grpc.Invoke(ctx, "/proto.SourceBackend/IndexStats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for SourceBackend service
 
 type SourceBackendServer interface {
 	// File reads the file and returns its contents.
 	File(context.Context, *FileRequest) (*FileReply, error)
+	// ListDirectory returns the entries of the directory.
+	ListDirectory(context.Context, *ListDirectoryRequest) (*ListDirectoryReply, error)
 	// Search performs the given query and streams matches/progress updates.
 	Search(*SearchRequest, SourceBackend_SearchServer) error
+	// Explain forwards the request to the index backend, see
+	// IndexBackend.Explain.
+	Explain(context.Context, *ExplainRequest) (*ExplainReply, error)
+	// IndexStats forwards the request to the index backend, see
+	// IndexBackend.Stats.
+	IndexStats(context.Context, *StatsRequest) (*StatsReply, error)
 }
 
 func RegisterSourceBackendServer(s *grpc.Server, srv SourceBackendServer) {
@@ -352,6 +754,24 @@ func _SourceBackend_File_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SourceBackend_ListDirectory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDirectoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).ListDirectory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.SourceBackend/ListDirectory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).ListDirectory(ctx, req.(*ListDirectoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _SourceBackend_Search_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(SearchRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -373,6 +793,42 @@ func (x *sourceBackendSearchServer) Send(m *SearchReply) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _SourceBackend_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.SourceBackend/Explain",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).Explain(ctx, req.(*ExplainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SourceBackend_IndexStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SourceBackendServer).IndexStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.SourceBackend/IndexStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SourceBackendServer).IndexStats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "proto.SourceBackend",
 	HandlerType: (*SourceBackendServer)(nil),
@@ -381,6 +837,18 @@ var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 			MethodName: "File",
 			Handler:    _SourceBackend_File_Handler,
 		},
+		{
+			MethodName: "ListDirectory",
+			Handler:    _SourceBackend_ListDirectory_Handler,
+		},
+		{
+			MethodName: "Explain",
+			Handler:    _SourceBackend_Explain_Handler,
+		},
+		{
+			MethodName: "IndexStats",
+			Handler:    _SourceBackend_IndexStats_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -395,36 +863,70 @@ var _SourceBackend_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("sourcebackend.proto", fileDescriptor1) }
 
 var fileDescriptor1 = []byte{
-	// 481 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x52, 0xdd, 0x6e, 0xd3, 0x4c,
-	0x10, 0x8d, 0xfb, 0xd9, 0x69, 0x33, 0xf9, 0xd5, 0xb6, 0x9f, 0x58, 0xf5, 0x86, 0xb2, 0x48, 0xb4,
-	0x12, 0x52, 0x44, 0x8c, 0xc4, 0x25, 0x52, 0x81, 0x02, 0x42, 0xaa, 0x88, 0x36, 0xc9, 0x0d, 0x37,
-	0x91, 0xeb, 0x0c, 0x89, 0x15, 0x63, 0x6f, 0xd7, 0x6b, 0xb5, 0x7e, 0x41, 0xde, 0x87, 0x37, 0x40,
-	0x3b, 0x6b, 0xa7, 0x0d, 0x70, 0xb5, 0x7b, 0xce, 0x9c, 0x9d, 0x33, 0x3b, 0x33, 0x70, 0x5c, 0xe4,
-	0xa5, 0x8e, 0xf1, 0x26, 0x8a, 0xb7, 0x98, 0xad, 0xc6, 0x4a, 0xe7, 0x26, 0x67, 0x01, 0x1d, 0xe2,
-	0x19, 0x74, 0x3f, 0x26, 0x29, 0x4a, 0xbc, 0x2d, 0xb1, 0x30, 0x8c, 0x81, 0xaf, 0x22, 0xb3, 0xe1,
-	0xde, 0x99, 0x77, 0xd1, 0x91, 0x74, 0x17, 0xe7, 0xd0, 0x71, 0x12, 0x95, 0x56, 0xec, 0x14, 0x8e,
-	0xe2, 0x3c, 0x33, 0x98, 0x99, 0x82, 0x44, 0x3d, 0xb9, 0xc3, 0xe2, 0x0b, 0xf4, 0x67, 0x18, 0xe9,
-	0x78, 0xd3, 0x64, 0x3b, 0x81, 0xe0, 0xb6, 0x44, 0x5d, 0xd5, 0xe9, 0x1c, 0x60, 0xcf, 0xa1, 0xaf,
-	0xf1, 0x4e, 0x27, 0xc6, 0x60, 0xb6, 0x2c, 0x75, 0xca, 0x0f, 0x28, 0xda, 0xdb, 0x91, 0x0b, 0x9d,
-	0x8a, 0x5f, 0x1e, 0x04, 0xd7, 0x91, 0x89, 0x37, 0xff, 0x2a, 0xc9, 0x72, 0x69, 0x92, 0x21, 0xbd,
-	0xec, 0x4b, 0xba, 0x5b, 0xb3, 0xd8, 0xdc, 0xab, 0x90, 0xff, 0xe7, 0xcc, 0x08, 0x34, 0xec, 0x84,
-	0xfb, 0x0f, 0xec, 0x84, 0x71, 0x38, 0xa4, 0xaa, 0xef, 0x0d, 0x0f, 0x88, 0x6f, 0x60, 0xad, 0xcf,
-	0x26, 0xbc, 0xbd, 0xd3, 0x67, 0x93, 0x86, 0x0d, 0xf9, 0xe1, 0x03, 0x1b, 0xda, 0x5e, 0xd8, 0x6a,
-	0x74, 0x94, 0x6d, 0xf9, 0xd1, 0x99, 0x77, 0x71, 0x20, 0x77, 0xd8, 0x3a, 0xd8, 0x33, 0xc9, 0xd6,
-	0xbc, 0x43, 0xa1, 0x06, 0xda, 0x88, 0x8a, 0xe2, 0x6d, 0xb4, 0x46, 0x0e, 0xce, 0xbb, 0x86, 0xe2,
-	0x1b, 0x0c, 0xa6, 0x3a, 0x5f, 0x6b, 0x2c, 0x8a, 0x85, 0x5a, 0x45, 0x06, 0xd9, 0x39, 0x0c, 0xbf,
-	0x27, 0x29, 0x16, 0x4b, 0xa5, 0xf3, 0x18, 0x8b, 0x02, 0x57, 0xd4, 0x06, 0x5f, 0x0e, 0x88, 0x9e,
-	0x36, 0x2c, 0x7b, 0x0a, 0x5d, 0x27, 0x34, 0xb9, 0x89, 0x5c, 0x47, 0x7d, 0x09, 0x44, 0xcd, 0x2d,
-	0x23, 0x7e, 0x7a, 0xd0, 0x6d, 0x86, 0x63, 0xe7, 0xf8, 0x12, 0x7c, 0x53, 0x29, 0xa4, 0x74, 0x83,
-	0xf0, 0x89, 0x5b, 0x8a, 0xf1, 0x23, 0xc5, 0x78, 0x5e, 0x29, 0x94, 0x24, 0x62, 0x02, 0x82, 0x1f,
-	0x76, 0x16, 0x94, 0xb7, 0x1b, 0xf6, 0x6a, 0x35, 0xcd, 0x47, 0xba, 0x10, 0x7b, 0x0b, 0x43, 0x55,
-	0x17, 0xbf, 0x2c, 0xa9, 0x7a, 0x1a, 0x44, 0x37, 0xfc, 0xbf, 0x56, 0xef, 0x7f, 0x4d, 0x0e, 0xd4,
-	0x1e, 0x16, 0x2f, 0xc0, 0xb7, 0x8e, 0xac, 0x03, 0xc1, 0xf5, 0xe5, 0xfc, 0xfd, 0xe7, 0x51, 0x8b,
-	0x1d, 0xc3, 0x70, 0x2a, 0xbf, 0x7e, 0x92, 0x57, 0xb3, 0xd9, 0x72, 0x31, 0xfd, 0x70, 0x39, 0xbf,
-	0x1a, 0x79, 0xe1, 0x1d, 0xf4, 0x67, 0xb4, 0xce, 0xef, 0xdc, 0x3a, 0xb3, 0x31, 0xf8, 0x76, 0x3d,
-	0x19, 0xab, 0x7d, 0x1e, 0xad, 0xf3, 0xe9, 0x68, 0x8f, 0x53, 0x69, 0x25, 0x5a, 0xec, 0x0d, 0xb4,
-	0xdd, 0x37, 0xd9, 0xc9, 0x1f, 0xbf, 0x76, 0x6f, 0xd8, 0xdf, 0xbd, 0x10, 0xad, 0x57, 0xde, 0x4d,
-	0x9b, 0xe8, 0xd7, 0xbf, 0x03, 0x00, 0x00, 0xff, 0xff, 0x52, 0x9f, 0x87, 0x0d, 0x4e, 0x03, 0x00,
-	0x00,
+	// 1026 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x56, 0xdb, 0x6e, 0xe3, 0x44,
+	0x18, 0xae, 0x53, 0xa7, 0x89, 0xff, 0x34, 0x6e, 0x98, 0x2d, 0xc5, 0x64, 0x39, 0x04, 0x23, 0x41,
+	0xb4, 0xa0, 0x42, 0xb3, 0x12, 0x5c, 0x80, 0x56, 0xda, 0x36, 0xee, 0x6e, 0xa1, 0x65, 0xab, 0x49,
+	0x8a, 0x58, 0x6e, 0xa2, 0xa9, 0x3d, 0x4d, 0xac, 0x7a, 0xc7, 0xde, 0x99, 0xc9, 0xd2, 0x70, 0xc3,
+	0x4b, 0x20, 0x6e, 0x78, 0x02, 0xae, 0x79, 0x32, 0xde, 0x00, 0xcd, 0xc1, 0x69, 0x1c, 0x22, 0xae,
+	0x32, 0xdf, 0xf7, 0x7f, 0xe3, 0xf9, 0x8f, 0x33, 0x81, 0x07, 0x22, 0x9f, 0xf3, 0x98, 0x5e, 0x93,
+	0xf8, 0x96, 0xb2, 0xe4, 0xb0, 0xe0, 0xb9, 0xcc, 0x51, 0x5d, 0xff, 0x74, 0x51, 0xca, 0x12, 0x7a,
+	0x57, 0x31, 0x85, 0x7f, 0x39, 0xd0, 0x3a, 0x4d, 0x33, 0x8a, 0xe9, 0xeb, 0x39, 0x15, 0x12, 0x21,
+	0x70, 0x0b, 0x22, 0x67, 0x81, 0xd3, 0x73, 0xfa, 0x1e, 0xd6, 0x6b, 0xf4, 0x3e, 0xc0, 0x4d, 0xca,
+	0x85, 0x9c, 0x64, 0x29, 0xa3, 0x41, 0xad, 0xe7, 0xf4, 0xdb, 0xd8, 0xd3, 0xcc, 0x79, 0xca, 0x28,
+	0x7a, 0x08, 0x5e, 0x46, 0x4a, 0xeb, 0xb6, 0xb6, 0x36, 0x33, 0x62, 0x8d, 0x07, 0xb0, 0x93, 0xdf,
+	0xdc, 0x08, 0x2a, 0x03, 0xb7, 0xe7, 0xf4, 0x5d, 0x6c, 0x91, 0xe2, 0x33, 0xca, 0xa6, 0x72, 0x16,
+	0xd4, 0x0d, 0x6f, 0x10, 0xea, 0x42, 0x33, 0xe7, 0xe9, 0x34, 0x65, 0x24, 0x0b, 0x76, 0x7a, 0x4e,
+	0xbf, 0x89, 0x97, 0x38, 0xfc, 0xc7, 0x01, 0xcf, 0xf8, 0x5a, 0x64, 0x0b, 0xa5, 0x8c, 0x73, 0x26,
+	0x29, 0x93, 0x42, 0x7b, 0xbb, 0x8b, 0x97, 0x58, 0x45, 0x21, 0xd2, 0x5f, 0x8d, 0xaf, 0x2e, 0xd6,
+	0x6b, 0xb4, 0x0f, 0x75, 0xe5, 0xa1, 0xb0, 0x2e, 0x1a, 0xb0, 0x16, 0x9b, 0xbb, 0x1e, 0x5b, 0x17,
+	0x9a, 0x94, 0xc5, 0x79, 0x92, 0xb2, 0xa9, 0x76, 0xd4, 0xc3, 0x4b, 0xac, 0x6c, 0x19, 0x61, 0xd3,
+	0x39, 0x99, 0x52, 0xed, 0xaa, 0x87, 0x97, 0x18, 0x7d, 0x0a, 0x7b, 0x05, 0x89, 0x6f, 0xc9, 0x94,
+	0x4e, 0xde, 0x50, 0x2e, 0xd2, 0x9c, 0x05, 0x0d, 0x2d, 0xf1, 0x2d, 0xfd, 0xa3, 0x61, 0xd1, 0x07,
+	0x00, 0x92, 0x13, 0x26, 0xe2, 0x3c, 0xa1, 0x49, 0xd0, 0xd4, 0x11, 0xaf, 0x30, 0xe1, 0x23, 0xd8,
+	0x3f, 0x4f, 0x85, 0x1c, 0xa6, 0x9c, 0xc6, 0x32, 0xe7, 0x8b, 0xff, 0xa9, 0x53, 0xf8, 0x87, 0x03,
+	0xfe, 0x52, 0x18, 0x31, 0xc9, 0x17, 0x4a, 0xc6, 0xc8, 0x2b, 0x5a, 0xca, 0xd4, 0x1a, 0x1d, 0x82,
+	0x2b, 0x17, 0x85, 0x49, 0x8e, 0x3f, 0xe8, 0x9a, 0x46, 0x38, 0xac, 0x6e, 0x3c, 0x1c, 0x2f, 0x0a,
+	0x8a, 0xb5, 0x6e, 0x99, 0xcc, 0xed, 0xfb, 0x64, 0x86, 0x9f, 0x83, 0xab, 0x14, 0xa8, 0x09, 0xee,
+	0xe9, 0xd9, 0x79, 0xd4, 0xd9, 0x42, 0x6d, 0xf0, 0x86, 0x67, 0x38, 0x3a, 0x19, 0xbf, 0xc0, 0x2f,
+	0x3b, 0x0e, 0x6a, 0x41, 0x63, 0xf4, 0xf2, 0xe2, 0xfc, 0xec, 0x87, 0xef, 0x3b, 0xb5, 0x30, 0x02,
+	0xb4, 0x16, 0x84, 0x2a, 0xe0, 0x17, 0xd0, 0xa0, 0x4c, 0xf2, 0x94, 0xaa, 0xfa, 0x6d, 0xf7, 0x5b,
+	0x83, 0xb7, 0x37, 0xba, 0x82, 0x4b, 0x55, 0xf8, 0x1d, 0xb4, 0x47, 0x94, 0xf0, 0x78, 0x56, 0x26,
+	0x61, 0x1f, 0xea, 0xaf, 0xe7, 0x94, 0x2f, 0x6c, 0x78, 0x06, 0xa0, 0x8f, 0xa1, 0xcd, 0xe9, 0x2f,
+	0x3c, 0x95, 0x92, 0xb2, 0xc9, 0x9c, 0x67, 0x3a, 0x50, 0x0f, 0xef, 0x2e, 0xc9, 0x2b, 0x9e, 0x85,
+	0xbf, 0x6f, 0x43, 0xfd, 0x82, 0xc8, 0x78, 0xb6, 0xb1, 0xe3, 0x11, 0xb8, 0x2b, 0xbd, 0xae, 0xd7,
+	0xea, 0xb0, 0x58, 0xde, 0x15, 0x03, 0x9d, 0x07, 0x0f, 0x1b, 0x50, 0xb2, 0x47, 0x81, 0x7b, 0xcf,
+	0x1e, 0xa1, 0x00, 0x1a, 0xba, 0x17, 0xef, 0xa4, 0xed, 0x9a, 0x12, 0x5a, 0x3d, 0x3b, 0xb2, 0x1d,
+	0x63, 0x40, 0xc9, 0x0e, 0x6c, 0x93, 0x18, 0xa0, 0x1a, 0x4c, 0x79, 0xc3, 0x09, 0xbb, 0xd5, 0x9d,
+	0x51, 0xc3, 0x4b, 0xac, 0x4e, 0x50, 0xbf, 0xaa, 0x2f, 0x3d, 0x6d, 0x2a, 0xa1, 0xb2, 0xd8, 0x1e,
+	0x0b, 0xc0, 0x9c, 0x6d, 0x21, 0xfa, 0x08, 0x76, 0xed, 0x84, 0x4c, 0x66, 0x44, 0xcc, 0x82, 0x96,
+	0x36, 0xb7, 0x2c, 0xf7, 0x9c, 0x88, 0x99, 0x6a, 0xc7, 0x64, 0x5e, 0x64, 0x69, 0x4c, 0x24, 0x15,
+	0xc1, 0x6e, 0x6f, 0xbb, 0xef, 0xe1, 0x15, 0x06, 0x3d, 0x82, 0xe6, 0x75, 0xca, 0x54, 0xfb, 0x8b,
+	0xa0, 0xad, 0x8b, 0xe6, 0xdb, 0xa2, 0x1d, 0x1b, 0x1a, 0x2f, 0xed, 0x68, 0x00, 0xcd, 0x1b, 0x4a,
+	0xe4, 0x9c, 0x53, 0x11, 0xf8, 0x3d, 0xa7, 0xdf, 0x1a, 0x1c, 0x58, 0x2d, 0x36, 0xae, 0x9e, 0x5a,
+	0x2b, 0x5e, 0xea, 0xc2, 0xdf, 0x60, 0x6f, 0xcd, 0xa8, 0x6a, 0x91, 0x32, 0x21, 0x75, 0x7d, 0x6a,
+	0x58, 0xaf, 0x15, 0xc7, 0x13, 0x5a, 0xe8, 0xfa, 0xd4, 0xb0, 0x5e, 0xa3, 0xf7, 0xc0, 0x53, 0xd9,
+	0x79, 0xa5, 0x8a, 0xaa, 0x6b, 0x54, 0xc3, 0xf7, 0x04, 0xfa, 0x04, 0x7c, 0x73, 0x33, 0x16, 0xb7,
+	0x53, 0x23, 0x71, 0xb5, 0x64, 0x8d, 0x0d, 0x1f, 0x43, 0xc3, 0x46, 0xb2, 0x71, 0x76, 0xf6, 0xa1,
+	0xfe, 0x86, 0x64, 0x73, 0x6a, 0x7b, 0xca, 0x80, 0xf0, 0x67, 0xf0, 0x2f, 0x79, 0x3e, 0xe5, 0x54,
+	0x88, 0xab, 0x22, 0x21, 0x52, 0xcf, 0xff, 0x4d, 0x9a, 0x51, 0x31, 0x29, 0x78, 0x1e, 0x53, 0x21,
+	0x68, 0xa2, 0x3f, 0xe3, 0x62, 0x5f, 0xd3, 0x97, 0x25, 0x8b, 0x3e, 0x84, 0x96, 0x11, 0xca, 0x5c,
+	0x92, 0xcc, 0x5e, 0x58, 0xa0, 0xa9, 0xb1, 0x62, 0xc2, 0x6f, 0xc1, 0x3f, 0x9e, 0x27, 0x53, 0x2a,
+	0xa3, 0xbb, 0x98, 0xd2, 0x84, 0x26, 0x1b, 0x1b, 0xf6, 0x00, 0x76, 0x38, 0x25, 0x22, 0x67, 0xd6,
+	0x31, 0x8b, 0xc2, 0x3f, 0x6b, 0xd0, 0x2a, 0x67, 0x46, 0xcd, 0xdc, 0x67, 0x76, 0xf6, 0x1d, 0x3d,
+	0xfb, 0xef, 0xd8, 0x7a, 0xac, 0x28, 0x56, 0x07, 0x3f, 0x84, 0xba, 0x49, 0x55, 0x4d, 0x57, 0x6f,
+	0xd7, 0xaa, 0xf5, 0xd8, 0x60, 0x63, 0x42, 0x4f, 0x60, 0xaf, 0xb0, 0xa1, 0x4f, 0xe6, 0x3a, 0x76,
+	0x9d, 0xfb, 0xfb, 0x61, 0xae, 0x26, 0x06, 0xfb, 0x45, 0x35, 0x51, 0x4f, 0x60, 0xef, 0x5a, 0x87,
+	0x37, 0xa1, 0x36, 0xbe, 0xc0, 0xad, 0xec, 0xaf, 0x06, 0x8f, 0xfd, 0xeb, 0x0a, 0x0e, 0xbf, 0xb1,
+	0x17, 0x91, 0x07, 0xf5, 0x8b, 0xa7, 0xe3, 0x93, 0xe7, 0x9d, 0x2d, 0xf4, 0x00, 0xf6, 0x2e, 0xf1,
+	0x8b, 0x67, 0x38, 0x1a, 0x8d, 0x26, 0x57, 0x97, 0xc3, 0xa7, 0xe3, 0xa8, 0xe3, 0x28, 0xf2, 0xf8,
+	0x6a, 0xf8, 0x2c, 0x1a, 0x4f, 0xa2, 0x9f, 0x4e, 0xa2, 0x68, 0x18, 0x0d, 0x3b, 0xb5, 0xc1, 0xdf,
+	0x35, 0x68, 0x8f, 0x74, 0xfd, 0x8f, 0xcd, 0xa3, 0xa8, 0xee, 0x46, 0xf5, 0xc2, 0x20, 0x64, 0x4f,
+	0x5f, 0x79, 0x1a, 0xbb, 0x9d, 0x0a, 0x57, 0x64, 0x8b, 0x70, 0x0b, 0x9d, 0x41, 0xbb, 0x72, 0xb3,
+	0xa1, 0x87, 0x56, 0xb4, 0xe9, 0xd2, 0xee, 0xbe, 0xbb, 0xd9, 0x68, 0x3e, 0xf5, 0x15, 0xec, 0x98,
+	0x3a, 0xa0, 0xfd, 0xb5, 0xb2, 0x98, 0xcd, 0xe8, 0xbf, 0xc5, 0x0a, 0xb7, 0xbe, 0x74, 0xd0, 0xd7,
+	0xd0, 0x88, 0xee, 0x8a, 0x8c, 0xa4, 0x0c, 0x95, 0x39, 0xb3, 0xb8, 0xdc, 0xf9, 0x60, 0x9d, 0x2e,
+	0x0f, 0x84, 0x33, 0xf5, 0x87, 0x60, 0x24, 0x89, 0x14, 0xa8, 0x14, 0x69, 0x54, 0xee, 0x7c, 0xab,
+	0x4a, 0xea, 0x7d, 0xd7, 0x3b, 0x9a, 0x7b, 0xfc, 0xef, 0x00, 0x1a, 0x2e, 0x9c, 0xab, 0x6b, 0x08,
+	0x00, 0x00,
 }
@@ -0,0 +1,136 @@
+// vim:ts=4:sw=4:noexpandtab
+
+package ranking
+
+import (
+	"path"
+	"strings"
+
+	"github.com/Debian/dcs/index"
+)
+
+// testDirs are directory names which contain test code or test data.
+var testDirs = map[string]bool{
+	"test":      true,
+	"tests":     true,
+	"testing":   true,
+	"testsuite": true,
+	"testdata":  true,
+	"t":         true, // perl
+	"spec":      true, // ruby
+	"__tests__": true, // javascript
+}
+
+// vendorDirs are directory names which contain copies of third-party code.
+var vendorDirs = map[string]bool{
+	"vendor":       true,
+	"third_party":  true,
+	"third-party":  true,
+	"thirdparty":   true,
+	"3rdparty":     true,
+	"node_modules": true,
+	"bundled":      true,
+}
+
+// embeddedLibs are libraries of which many packages contain a copy in a
+// directory named after the library, possibly with a version (e.g.
+// “zlib-1.2.8”).
+var embeddedLibs = []string{
+	"zlib",
+	"libpng",
+	"libjpeg",
+	"expat",
+	"bzip2",
+	"lz4",
+	"zstd",
+	"gtest",
+	"googletest",
+	"gnulib",
+}
+
+// isVendorDir reports whether the directory name dir (lower-cased) of the
+// source package pkg contains third-party code. The library’s own source
+// package (e.g. expat with its expat/lib directory) does not embed it.
+func isVendorDir(pkg, dir string) bool {
+	if vendorDirs[dir] {
+		return true
+	}
+	for _, lib := range embeddedLibs {
+		if !strings.HasPrefix(dir, lib) || isLibPackage(pkg, lib) {
+			continue
+		}
+		if rest := dir[len(lib):]; rest == "" || rest[0] == '-' || rest[0] == '_' {
+			return true
+		}
+	}
+	return false
+}
+
+// isLibPackage reports whether the source package pkg is named after lib,
+// possibly with a “lib” prefix, version or suffix, e.g. libpng1.6 for
+// libpng, libzstd for zstd or libjpeg-turbo for libjpeg.
+func isLibPackage(pkg, lib string) bool {
+	pkg = strings.TrimPrefix(pkg, "lib")
+	lib = strings.TrimPrefix(lib, "lib")
+	if !strings.HasPrefix(pkg, lib) {
+		return false
+	}
+	rest := pkg[len(lib):]
+	return rest == "" || rest[0] < 'a' || rest[0] > 'z'
+}
+
+// generatedFiles are file names of well-known generated files, mostly
+// produced by autotools.
+var generatedFiles = map[string]bool{
+	"configure":    true,
+	"Makefile.in":  true,
+	"aclocal.m4":   true,
+	"config.guess": true,
+	"config.sub":   true,
+	"ltmain.sh":    true,
+	"depcomp":      true,
+	"install-sh":   true,
+	"missing":      true,
+}
+
+// generatedSuffixes are file name suffixes of generated files.
+var generatedSuffixes = []string{
+	".min.js",
+	".pb.go",
+	".pb.cc",
+	".pb.h",
+	"_pb2.py",
+}
+
+// FileFlags classifies the file at filepath (relative to the unpacked source
+// package pkg, e.g. “zlib”) based on its name, see index.FileFlags.
+func FileFlags(pkg, filepath string) index.FileFlags {
+	var flags index.FileFlags
+	dir, file := path.Split(filepath)
+	for _, component := range strings.Split(dir, "/") {
+		if testDirs[component] {
+			flags |= index.Test
+		}
+		if isVendorDir(pkg, strings.ToLower(component)) {
+			flags |= index.Vendored
+		}
+	}
+	base := strings.TrimSuffix(file, path.Ext(file))
+	if strings.HasPrefix(file, "test_") ||
+		strings.HasSuffix(base, "_test") ||
+		strings.HasSuffix(base, "Test") ||
+		strings.HasSuffix(base, ".test") ||
+		strings.HasSuffix(base, "_spec") {
+		flags |= index.Test
+	}
+	if generatedFiles[file] {
+		flags |= index.Generated
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			flags |= index.Generated
+			break
+		}
+	}
+	return flags
+}
@@ -0,0 +1,45 @@
+// vim:ts=4:sw=4:noexpandtab
+
+package ranking
+
+import (
+	"path"
+	"strings"
+)
+
+// languageBySuffix maps file suffixes to the names used by the filetype:
+// keyword (see addSuffixesForFiletype). Suffixes which are used by multiple
+// languages (e.g. “.h”) map to the most common one.
+var languageBySuffix = map[string]string{
+	".c":    "c",
+	".h":    "c",
+	".m":    "objc",
+	".mm":   "objc++",
+	".cc":   "c++",
+	".cpp":  "c++",
+	".cxx":  "c++",
+	".hpp":  "c++",
+	".hxx":  "c++",
+	".pl":   "perl",
+	".pm":   "perl",
+	".t":    "perl",
+	".php":  "php",
+	".py":   "python",
+	".go":   "go",
+	".java": "java",
+	".rb":   "ruby",
+	".sh":   "shell",
+	".bash": "shell",
+	".zsh":  "shell",
+	".vala": "vala",
+	".vapi": "vala",
+	".erl":  "erlang",
+	".js":   "javascript",
+	".json": "json",
+}
+
+// Language returns the language of the file at filepath based on its suffix,
+// or the empty string if the language is unknown.
+func Language(filepath string) string {
+	return languageBySuffix[strings.ToLower(path.Ext(filepath))]
+}
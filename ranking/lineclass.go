@@ -0,0 +1,255 @@
+// vim:ts=4:sw=4:noexpandtab
+
+package ranking
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"strings"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/regexp"
+)
+
+// LineClass classifies the text at which a line matched (see ClassifyLine).
+type LineClass uint8
+
+const (
+	LineCode LineClass = iota
+	LineComment
+	LineString
+)
+
+func (c LineClass) String() string {
+	switch c {
+	case LineComment:
+		return "comments"
+	case LineString:
+		return "strings"
+	}
+	return "code"
+}
+
+// ParseLineClass parses the value of the in: keyword.
+func ParseLineClass(value string) (LineClass, error) {
+	switch value {
+	case "code":
+		return LineCode, nil
+	case "comments", "comment":
+		return LineComment, nil
+	case "strings", "string":
+		return LineString, nil
+	}
+	return LineCode, fmt.Errorf("in: unknown value %q (available: code, comments, strings)", value)
+}
+
+// syntax describes the comments and string literals of a language, as far as
+// ClassifyLine is concerned.
+type syntax struct {
+	lineComment []string
+
+	blockStart, blockEnd string
+
+	quotes string
+
+	// wordComment is set if lineComment must be at the beginning of a word,
+	// as in shell, where e.g. $# is not a comment.
+	wordComment bool
+}
+
+var (
+	cSyntax = &syntax{
+		lineComment: []string{"//"},
+		blockStart:  "/*",
+		blockEnd:    "*/",
+		quotes:      `"'`,
+	}
+	// Go and JavaScript also have raw string/template literals.
+	backtickSyntax = &syntax{
+		lineComment: []string{"//"},
+		blockStart:  "/*",
+		blockEnd:    "*/",
+		quotes:      "\"'`",
+	}
+	hashSyntax = &syntax{
+		lineComment: []string{"#"},
+		quotes:      `"'`,
+		wordComment: true,
+	}
+	lispSyntax = &syntax{
+		lineComment: []string{";"},
+		quotes:      `"`,
+	}
+	dashSyntax = &syntax{
+		lineComment: []string{"--"},
+		quotes:      `"'`,
+	}
+	m4Syntax = &syntax{
+		lineComment: []string{"dnl ", "#"},
+		wordComment: true,
+	}
+	markupSyntax = &syntax{
+		blockStart: "<!--",
+		blockEnd:   "-->",
+		quotes:     `"`,
+	}
+)
+
+var syntaxBySuffix = map[string]*syntax{
+	".c":     cSyntax,
+	".h":     cSyntax,
+	".cc":    cSyntax,
+	".cpp":   cSyntax,
+	".cxx":   cSyntax,
+	".hh":    cSyntax,
+	".hpp":   cSyntax,
+	".hxx":   cSyntax,
+	".m":     cSyntax,
+	".mm":    cSyntax,
+	".java":  cSyntax,
+	".cs":    cSyntax,
+	".rs":    cSyntax,
+	".swift": cSyntax,
+	".kt":    cSyntax,
+	".scala": cSyntax,
+	".php":   cSyntax,
+	".vala":  cSyntax,
+	".dart":  cSyntax,
+	".css":   cSyntax,
+	".go":    backtickSyntax,
+	".js":    backtickSyntax,
+	".ts":    backtickSyntax,
+	".sh":    hashSyntax,
+	".bash":  hashSyntax,
+	".py":    hashSyntax,
+	".pl":    hashSyntax,
+	".pm":    hashSyntax,
+	".rb":    hashSyntax,
+	".mk":    hashSyntax,
+	".cmake": hashSyntax,
+	".r":     hashSyntax,
+	".tcl":   hashSyntax,
+	".awk":   hashSyntax,
+	".yaml":  hashSyntax,
+	".yml":   hashSyntax,
+	".el":    lispSyntax,
+	".lisp":  lispSyntax,
+	".scm":   lispSyntax,
+	".clj":   lispSyntax,
+	".sql":   dashSyntax,
+	".hs":    dashSyntax,
+	".lua":   dashSyntax,
+	".adb":   dashSyntax,
+	".ads":   dashSyntax,
+	".m4":    m4Syntax,
+	".ac":    m4Syntax,
+	".html":  markupSyntax,
+	".xml":   markupSyntax,
+}
+
+var syntaxByName = map[string]*syntax{
+	"Makefile":       hashSyntax,
+	"makefile":       hashSyntax,
+	"GNUmakefile":    hashSyntax,
+	"CMakeLists.txt": hashSyntax,
+	"rules":          hashSyntax, // debian/rules
+}
+
+func syntaxFor(p string) *syntax {
+	name := path.Base(p)
+	if s, ok := syntaxByName[name]; ok {
+		return s
+	}
+	return syntaxBySuffix[strings.ToLower(path.Ext(name))]
+}
+
+// isCommentContinuation reports whether the (trimmed) line continues a
+// block comment, e.g. “* Returns the window.” or “*/”. Dereferences such as
+// “*p = 0;” are not mistaken for comments.
+func isCommentContinuation(trimmed string) bool {
+	return trimmed == "*" ||
+		strings.HasPrefix(trimmed, "* ") ||
+		strings.HasPrefix(trimmed, "*\t") ||
+		strings.HasPrefix(trimmed, "*/") ||
+		strings.HasPrefix(trimmed, "**")
+}
+
+// ClassifyLine classifies the text at byte offset pos of line, a line of the
+// file at path p, based on the comment and string syntax of the file’s
+// language. Only line is looked at, so a block comment or string literal
+// which starts on an earlier line is not recognized, except for the common
+// style of continuing block comments with a leading *. Lines of files in
+// unknown languages are LineCode.
+func ClassifyLine(p, line string, pos int) LineClass {
+	s := syntaxFor(p)
+	if s == nil {
+		return LineCode
+	}
+	if pos > len(line) {
+		pos = len(line)
+	}
+	class := LineCode
+	if s.blockStart == "/*" && isCommentContinuation(strings.TrimSpace(line)) {
+		class = LineComment
+	}
+	var quote byte
+	for i := 0; i < pos; i++ {
+		switch class {
+		case LineComment:
+			if s.blockEnd != "" && strings.HasPrefix(line[i:], s.blockEnd) {
+				class = LineCode
+				i += len(s.blockEnd) - 1
+			}
+
+		case LineString:
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == quote {
+				class = LineCode
+			}
+
+		default:
+			for _, marker := range s.lineComment {
+				if strings.HasPrefix(line[i:], marker) &&
+					(!s.wordComment || i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+					return LineComment
+				}
+			}
+			if s.blockStart != "" && strings.HasPrefix(line[i:], s.blockStart) {
+				class = LineComment
+				i += len(s.blockStart) - 1
+			} else if strings.IndexByte(s.quotes, line[i]) > -1 {
+				class = LineString
+				quote = line[i]
+			}
+		}
+	}
+	return class
+}
+
+// Classes are the classifications of a match.
+type Classes struct {
+	// File are the flags of the file (see FileFlags).
+	File index.FileFlags
+
+	Line LineClass
+}
+
+// ClassifyMatch classifies match, which is in a file with the given flags, at
+// the first occurrence of the query in the line (or at the first non-space
+// character if the query does not occur in the line, e.g. because it spans
+// multiple lines).
+func ClassifyMatch(flags index.FileFlags, match *regexp.Match, querystr *QueryStr) Classes {
+	// The context lines are HTML-escaped, but the query applies to the
+	// source text.
+	line := html.UnescapeString(match.Context)
+	pos := len(line) - len(strings.TrimLeft(line, " \t"))
+	if loc := querystr.anywhereRegexp.FindStringIndex(line); loc != nil {
+		pos = loc[0]
+	}
+	return Classes{
+		File: flags,
+		Line: ClassifyLine(match.Path, line, pos),
+	}
+}
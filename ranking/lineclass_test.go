@@ -0,0 +1,106 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Debian/dcs/index"
+	"github.com/Debian/dcs/regexp"
+)
+
+func TestClassifyLine(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		line string // the match is at the first “@”, which is removed
+		want LineClass
+	}{
+		{"main.c", "\t@window = create();", LineCode},
+		{"main.c", "\tcreate(); // @window", LineComment},
+		{"main.c", "/* @window */", LineComment},
+		{"main.c", "/* window */ @create();", LineCode},
+		{"main.c", " * Creates the @window.", LineComment},
+		{"main.c", " */ @create();", LineCode},
+		{"main.c", "*@p = 0;", LineCode},
+		{"main.c", `printf("@window\n");`, LineString},
+		{"main.c", `printf("\"", @window);`, LineCode},
+		{"main.c", `printf("//"); @window();`, LineCode},
+		{"main.go", "s := `@window`", LineString},
+		{"main.py", "# @window", LineComment},
+		{"main.py", "x = '#' + @window", LineCode},
+		{"main.sh", "echo $# @window", LineCode},
+		{"main.sh", "echo foo # @window", LineComment},
+		{"debian/rules", "# @window", LineComment},
+		{"main.el", "(foo) ; @window", LineComment},
+		{"main.sql", "SELECT 1; -- @window", LineComment},
+		// Lines of files in unknown languages are always code.
+		{"README", "# @window", LineCode},
+	} {
+		pos := strings.Index(tt.line, "@")
+		line := tt.line[:pos] + tt.line[pos+1:]
+		if got := ClassifyLine(tt.path, line, pos); got != tt.want {
+			t.Errorf("ClassifyLine(%q, %q) = %v, want %v", tt.path, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFileFlags(t *testing.T) {
+	for _, tt := range []struct {
+		pkg  string
+		path string
+		want index.FileFlags
+	}{
+		{"i3-wm", "src/main.c", 0},
+		{"i3-wm", "tests/main.c", index.Test},
+		{"i3-wm", "configure", index.Generated},
+		{"docker.io", "vendor/github.com/foo/bar.go", index.Vendored},
+		{"chromium", "src/third_party/zlib/inflate.c", index.Vendored},
+		{"mysql", "zlib-1.2.8/inflate.c", index.Vendored},
+		{"mysql", "zlibext/inflate.c", 0},
+		{"docker.io", "vendor/foo/bar_test.go", index.Vendored | index.Test},
+		// A library’s own source package does not embed it, but copies
+		// next to the original are still vendored.
+		{"googletest", "googletest/src/gtest.cc", 0},
+		{"googletest", "googletest/third_party/zlib/inflate.c", index.Vendored},
+		{"expat", "expat/lib/xmlparse.c", 0},
+		{"libpng1.6", "libpng/png.c", 0},
+		{"libzstd", "zstd/lib/zstd.h", 0},
+		{"libzstd", "contrib/zlib/inflate.c", index.Vendored},
+		{"libjpeg-turbo", "libjpeg/jdapimin.c", 0},
+		{"protobuf", "third_party/googletest/googletest/src/gtest.cc", index.Vendored},
+		{"protobuf", "googletest/src/gtest.cc", index.Vendored},
+		{"expatmod", "expat/lib/xmlparse.c", index.Vendored},
+		{"", "expat/lib/xmlparse.c", index.Vendored},
+	} {
+		if got := FileFlags(tt.pkg, tt.path); got != tt.want {
+			t.Errorf("FileFlags(%q, %q) = %v, want %v", tt.pkg, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPostRankClasses(t *testing.T) {
+	qs := NewQueryStr("window")
+	match := regexp.Match{Path: "main.c", Context: "// window"}
+	classes := ClassifyMatch(index.Vendored, &match, &qs)
+	if classes.Line != LineComment {
+		t.Fatalf("ClassifyMatch(%q).Line = %v, want %v", match.Context, classes.Line, LineComment)
+	}
+	opts := RankingOpts{Lineclass: true, Pathclass: true}
+	if got, want := PostRank(opts, &match, &qs, classes), float32(0.5*0.5); !approxEqual(got, want) {
+		t.Errorf("PostRank(%q in vendored file) = %v, want %v", match.Context, got, want)
+	}
+	if got, want := PostRank(opts, &match, &qs, Classes{}), float32(1); !approxEqual(got, want) {
+		t.Errorf("PostRank(code) = %v, want %v", got, want)
+	}
+}
+
+func TestKeepLine(t *testing.T) {
+	opts := RankingOpts{Nin: []LineClass{LineComment}}
+	if opts.KeepLine(LineComment) || !opts.KeepLine(LineCode) || !opts.KeepLine(LineString) {
+		t.Errorf("-in:comments does not exclude exactly comments")
+	}
+	opts = RankingOpts{In: []LineClass{LineCode}}
+	if !opts.KeepLine(LineCode) || opts.KeepLine(LineComment) || opts.KeepLine(LineString) {
+		t.Errorf("in:code does not include exactly code")
+	}
+}
@@ -0,0 +1,222 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Model contains the weights with which the ranking signals are combined for
+// weighted ranking (see RankingOpts.Weighted). The weights can be learnt
+// from the click log using dcs-learn-ranking.
+type Model struct {
+	// Pre-ranking: weights of the popcon installation count and the amount
+	// of reverse dependencies of the source package (see StoredRanking).
+	Inst float32 `json:"inst"`
+	Rdep float32 `json:"rdep"`
+
+	// Pre-ranking: weights of QueryStr.Match on the path and on the source
+	// package name.
+	Pathmatch      float32 `json:"pathmatch"`
+	Sourcepkgmatch float32 `json:"sourcepkgmatch"`
+
+	// Pre-ranking: weight of the file type ranking (see
+	// addSuffixesForFiletype).
+	Filetype float32 `json:"filetype"`
+
+	// Post-ranking: the scope and line match rankings (see PostRank) are
+	// factors, which are raised to the power of their weight, i.e. 0 turns
+	// them off.
+	Scope     float32 `json:"scope"`
+	Linematch float32 `json:"linematch"`
+
+	// Post-ranking: like Scope and Linematch, the exponents of the factors
+	// which down-rank matches in comments and string literals (see
+	// ClassifyLine) and in test, generated and vendored files (see
+	// FileFlags).
+	Lineclass float32 `json:"lineclass"`
+	Pathclass float32 `json:"pathclass"`
+
+	// Postrank is the weight of the post-ranking (see PostRank) relative to
+	// the pre-ranking of the first result of a query, when dcs-web combines
+	// pre- and post-ranking.
+	Postrank float32 `json:"postrank"`
+}
+
+// DefaultModel contains the weights determined in the thesis.
+var DefaultModel = Model{
+	Inst:           0.3840,
+	Rdep:           0.3427,
+	Pathmatch:      0.1460,
+	Sourcepkgmatch: 0.0008,
+	Filetype:       1,
+	Scope:          1,
+	Linematch:      1,
+	Lineclass:      1,
+	Pathclass:      1,
+	Postrank:       0.1,
+}
+
+var model = DefaultModel
+
+// ReadModel reads the ranking model from |path|, as written by WriteModel.
+// Weights missing in the file keep their default. ReadModel must be called
+// before RankingOptsFromQuery() and ReadProfiles() are called.
+func ReadModel(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	m := DefaultModel
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return err
+	}
+	model = m
+	return nil
+}
+
+// ActiveModel returns the model read by ReadModel, or DefaultModel.
+func ActiveModel() Model {
+	return model
+}
+
+// WriteModel atomically writes m to |path|.
+func WriteModel(path string, m Model) error {
+	b, err := json.MarshalIndent(&m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "ranking-model")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Features are the values of the ranking signals of a result, i.e. what a
+// Model weighs.
+type Features struct {
+	Inst           float32 `json:"inst"`
+	Rdep           float32 `json:"rdep"`
+	Pathmatch      float32 `json:"pathmatch"`
+	Sourcepkgmatch float32 `json:"sourcepkgmatch"`
+
+	// Postrank is the post-ranking of the result, FirstPathrank the
+	// pre-ranking of the first result of the query.
+	Postrank      float32 `json:"postrank"`
+	FirstPathrank float32 `json:"firstpathrank"`
+}
+
+func (m Model) weights() [5]float64 {
+	return [5]float64{
+		float64(m.Inst),
+		float64(m.Rdep),
+		float64(m.Pathmatch),
+		float64(m.Sourcepkgmatch),
+		float64(m.Postrank),
+	}
+}
+
+func (f Features) values() [5]float64 {
+	return [5]float64{
+		float64(f.Inst),
+		float64(f.Rdep),
+		float64(f.Pathmatch),
+		float64(f.Sourcepkgmatch),
+		float64(f.FirstPathrank * f.Postrank),
+	}
+}
+
+// Score returns the part of the final ranking of a result with features f
+// which depends on the weights of m.
+func (m Model) Score(f Features) float32 {
+	w, x := m.weights(), f.values()
+	var score float64
+	for i := range w {
+		score += w[i] * x[i]
+	}
+	return float32(score)
+}
+
+// Impression is a result dcs-web showed for Searchterm (the query as
+// entered by the user), as written to its ranking log.
+type Impression struct {
+	Searchterm string   `json:"searchterm"`
+	Path       string   `json:"path"`
+	Line       string   `json:"line"`
+	Ranking    float32  `json:"ranking"`
+	Features   Features `json:"features"`
+}
+
+// Pair is a clicked result together with a result of the same query which
+// was not clicked.
+type Pair struct {
+	Clicked, Skipped Features
+}
+
+// FitOpts control FitModel.
+type FitOpts struct {
+	// Iterations over all pairs.
+	Iterations int
+
+	// LearningRate of the gradient descent.
+	LearningRate float64
+
+	// Regularization pulls the weights towards those of the initial model,
+	// so that weights which the pairs carry no information about (and the
+	// scale of all weights) stay put.
+	Regularization float64
+}
+
+// FitModel returns the weights which, starting at init, best rank the
+// clicked result of each pair above the skipped one, using gradient descent
+// on the pairwise logistic loss (as in RankNet). Weights are never negative.
+// Only the weights of Features are fitted, the others are those of init.
+func FitModel(init Model, pairs []Pair, opts FitOpts) Model {
+	w0 := init.weights()
+	w := w0
+	if len(pairs) == 0 {
+		return init
+	}
+	for it := 0; it < opts.Iterations; it++ {
+		var grad [5]float64
+		for _, p := range pairs {
+			c, s := p.Clicked.values(), p.Skipped.values()
+			var diff float64
+			for i := range w {
+				diff += w[i] * (c[i] - s[i])
+			}
+			// d/dw log(1 + exp(-diff)) = -sigmoid(-diff) * (c - s)
+			g := -1 / (1 + math.Exp(diff))
+			for i := range w {
+				grad[i] += g * (c[i] - s[i])
+			}
+		}
+		for i := range w {
+			grad[i] = grad[i]/float64(len(pairs)) + opts.Regularization*(w[i]-w0[i])
+			w[i] -= opts.LearningRate * grad[i]
+			if w[i] < 0 {
+				w[i] = 0
+			}
+		}
+	}
+	m := init
+	m.Inst = float32(w[0])
+	m.Rdep = float32(w[1])
+	m.Pathmatch = float32(w[2])
+	m.Sourcepkgmatch = float32(w[3])
+	m.Postrank = float32(w[4])
+	return m
+}
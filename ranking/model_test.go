@@ -0,0 +1,81 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModelRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ranking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { model = DefaultModel }()
+
+	path := filepath.Join(dir, "model.json")
+	want := Model{Inst: 1, Rdep: 2, Pathmatch: 3, Sourcepkgmatch: 4, Postrank: 5}
+	if err := WriteModel(path, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadModel(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := ActiveModel(); got != want {
+		t.Fatalf("ReadModel() = %+v, want %+v", got, want)
+	}
+
+	// Weights missing in the file keep their default.
+	if err := ioutil.WriteFile(path, []byte(`{"inst": 0.5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadModel(path); err != nil {
+		t.Fatal(err)
+	}
+	want = DefaultModel
+	want.Inst = 0.5
+	if got := ActiveModel(); got != want {
+		t.Fatalf("ReadModel() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFitModel(t *testing.T) {
+	// Users prefer results whose path matches the query over results of
+	// popular packages.
+	var pairs []Pair
+	for i := 0; i < 10; i++ {
+		pairs = append(pairs, Pair{
+			Clicked: Features{Inst: 0.1, Pathmatch: 1},
+			Skipped: Features{Inst: 0.5, Pathmatch: 0.5},
+		})
+	}
+	// Rdep, Sourcepkgmatch and Postrank do not differ.
+	initial := DefaultModel
+	if initial.Score(pairs[0].Clicked) > initial.Score(pairs[0].Skipped) {
+		t.Fatalf("DefaultModel already ranks the clicked result higher")
+	}
+	got := FitModel(initial, pairs, FitOpts{
+		Iterations:     1000,
+		LearningRate:   0.1,
+		Regularization: 0.01,
+	})
+	if got.Score(pairs[0].Clicked) <= got.Score(pairs[0].Skipped) {
+		t.Errorf("FitModel() = %+v, which ranks the skipped result higher", got)
+	}
+	if got.Pathmatch <= initial.Pathmatch || got.Inst >= initial.Inst {
+		t.Errorf("FitModel() = %+v, want higher Pathmatch and lower Inst than %+v", got, initial)
+	}
+	if got.Rdep != initial.Rdep || got.Sourcepkgmatch != initial.Sourcepkgmatch || got.Postrank != initial.Postrank {
+		t.Errorf("FitModel() = %+v changed weights without information", got)
+	}
+	if got.Inst < 0 {
+		t.Errorf("FitModel() = %+v has negative weights", got)
+	}
+
+	if got := FitModel(initial, nil, FitOpts{Iterations: 10}); got != initial {
+		t.Errorf("FitModel() without pairs = %+v, want %+v", got, initial)
+	}
+}
@@ -41,12 +41,66 @@ type RankingOpts struct {
 	// match the line?
 	Linematch bool
 
+	// post-ranking: is the match in a comment or string literal (see
+	// ClassifyLine)?
+	Lineclass bool
+
+	// post-ranking: is the match in a test, generated or vendored file (see
+	// FileFlags)?
+	Pathclass bool
+
 	// meta: turns on all rankings and uses 'optimal' weights (as determined in
-	// the thesis).
+	// the thesis, learnt from the click log or specified by the ranking
+	// profile).
 	Weighted bool
+
+	// Profile is the name of the ranking profile selected by the rank:
+	// keyword, and Model its weights (including per-query overrides), which
+	// are used when Weighted is set.
+	Profile string
+	Model   Model
+
+	// In and Nin are the line classes from the in: and -in: keywords, which
+	// matches must (not) be in.
+	In, Nin []LineClass
+
+	// Nvendored is set by the -vendored keyword, which excludes vendored
+	// files.
+	Nvendored bool
+}
+
+// KeepLine reports whether matches of the given class pass the in: and -in:
+// keywords.
+func (opts *RankingOpts) KeepLine(class LineClass) bool {
+	for _, c := range opts.Nin {
+		if c == class {
+			return false
+		}
+	}
+	if len(opts.In) == 0 {
+		return true
+	}
+	for _, c := range opts.In {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// lineClassesFromQuery returns the line classes of all values of the given
+// parameter. Invalid values are rejected by dcs-web (see ParseLineClass), so
+// they are skipped.
+func lineClassesFromQuery(query url.Values, name string) []LineClass {
+	var classes []LineClass
+	for _, value := range query[name] {
+		if class, err := ParseLineClass(value); err == nil {
+			classes = append(classes, class)
+		}
+	}
+	return classes
 }
 
-// TODO: parse floats which specify the weight of each ranking
 func boolFromQuery(query url.Values, name string) bool {
 	intval, err := strconv.ParseInt(query.Get(name), 10, 8)
 	if err != nil {
@@ -134,11 +188,24 @@ func RankingOptsFromQuery(query url.Values) RankingOpts {
 	result.Sourcepkgmatch = boolFromQuery(query, "sourcepkgmatch")
 	result.Scope = boolFromQuery(query, "scope")
 	result.Linematch = boolFromQuery(query, "linematch")
+	result.Lineclass = boolFromQuery(query, "lineclass")
+	result.Pathclass = boolFromQuery(query, "pathclass")
+	result.In = lineClassesFromQuery(query, "in")
+	result.Nin = lineClassesFromQuery(query, "nin")
+	result.Nvendored = boolFromQuery(query, "nvendored")
 	// Special case: weighted is the default, so assume true if unset.
 	if _, ok := query["weighted"]; !ok {
 		result.Weighted = true
 	} else {
 		result.Weighted = boolFromQuery(query, "weighted")
 	}
+	// Invalid rank: keywords are rejected by dcs-web (see ParseRank), so
+	// just fall back to the default profile.
+	var err error
+	result.Profile, result.Model, err = ParseRank(query.Get("rank"))
+	if err != nil {
+		result.Profile = DefaultProfile
+		result.Model, _ = LookupProfile(DefaultProfile)
+	}
 	return result
 }
@@ -3,12 +3,17 @@
 // Post-ranking happens on the source backend (because it has the source files
 // in the kernel’s page cache). In the post-ranking phase we can do (limited)
 // source file level analysis, such as in which scope the query string was
-// matched (comment, top-level, sub-level).
+// matched (top-level, sub-level) and whether it was matched in a comment or
+// string literal (see ClassifyLine). Whether the file is a test, generated or
+// third-party code (see FileFlags) is also taken into account here.
 package ranking
 
 import (
+	"html"
+	"math"
 	"unicode"
 
+	"github.com/Debian/dcs/index"
 	"github.com/Debian/dcs/regexp"
 )
 
@@ -25,15 +30,45 @@ func countSpaces(line string) int32 {
 	return spaces
 }
 
-func PostRank(opts RankingOpts, match *regexp.Match, querystr *QueryStr) float32 {
+// weigh returns the ranking factor raised to the power of weight.
+func weigh(factor, weight float32) float32 {
+	if weight == 1 {
+		return factor
+	}
+	return float32(math.Pow(float64(factor), float64(weight)))
+}
+
+// lineClassRanking punishes matches in comments and string literals, which
+// are less likely to be what the user is looking for than code.
+var lineClassRanking = map[LineClass]float32{
+	LineCode:    1,
+	LineString:  0.75,
+	LineComment: 0.5,
+}
+
+// fileFlagRanking punishes matches in tests, generated files and copies of
+// third-party code, as the user is typically looking for the original.
+var fileFlagRanking = map[index.FileFlags]float32{
+	index.Test:      0.75,
+	index.Generated: 0.5,
+	index.Vendored:  0.5,
+}
+
+// PostRank ranks match, whose classification is classes (see ClassifyMatch).
+func PostRank(opts RankingOpts, match *regexp.Match, querystr *QueryStr, classes Classes) float32 {
 	totalRanking := float32(1)
 
-	line := match.Context
+	// The context lines are HTML-escaped, but the query applies to the
+	// source text.
+	line := html.UnescapeString(match.Context)
 
 	if opts.Scope || opts.Weighted {
 		// Ranking: In which scope is the match? The higher the scope, the more
 		// important it is.
 		scopeRanking := 1.0 - (float32(countSpaces(line)) / 100.0)
+		if opts.Weighted {
+			scopeRanking = weigh(scopeRanking, opts.Model.Scope)
+		}
 		totalRanking *= scopeRanking
 	}
 
@@ -42,13 +77,38 @@ func PostRank(opts RankingOpts, match *regexp.Match, querystr *QueryStr) float32
 		// line? If yes, earlier matches are better (such as function names versus
 		// parameter types).
 		index := querystr.boundaryRegexp.FindStringIndex(line)
+		// Punish the lines in which there was no word boundary match.
+		matchRanking := float32(0.5)
 		if index != nil {
-			matchRanking := 0.75 + (0.25 * (1.0 - float32(index[0])/float32(len(line))))
-			totalRanking *= matchRanking
-		} else {
-			// Punish the lines in which there was no word boundary match.
-			totalRanking *= 0.5
+			matchRanking = 0.75 + (0.25 * (1.0 - float32(index[0])/float32(len(line))))
+		}
+		if opts.Weighted {
+			matchRanking = weigh(matchRanking, opts.Model.Linematch)
+		}
+		totalRanking *= matchRanking
+	}
+
+	if opts.Lineclass || opts.Weighted {
+		// Ranking: Is the match in code, a comment or a string literal?
+		classRanking := lineClassRanking[classes.Line]
+		if opts.Weighted {
+			classRanking = weigh(classRanking, opts.Model.Lineclass)
+		}
+		totalRanking *= classRanking
+	}
+
+	if opts.Pathclass || opts.Weighted {
+		// Ranking: Is the match in a test, generated or vendored file?
+		classRanking := float32(1)
+		for flag, ranking := range fileFlagRanking {
+			if classes.File&flag != 0 {
+				classRanking *= ranking
+			}
+		}
+		if opts.Weighted {
+			classRanking = weigh(classRanking, opts.Model.Pathclass)
 		}
+		totalRanking *= classRanking
 	}
 
 	return totalRanking
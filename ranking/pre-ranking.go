@@ -16,6 +16,8 @@ import (
 	"os"
 	"path"
 	"strings"
+
+	"github.com/Debian/dcs/index"
 )
 
 // Represents an entry from our ranking database (determined by using the
@@ -41,11 +43,26 @@ func ReadRankingData(path string) error {
 	return json.NewDecoder(f).Decode(&storedRanking)
 }
 
+// LookupStoredRanking returns the pre-computed ranking of sourcePackage.
+func LookupStoredRanking(sourcePackage string) StoredRanking {
+	return storedRanking[sourcePackage]
+}
+
 // The regular expression trigram index provides us a path to a potential
 // result. This data structure represents such a path and allows for ranking
 // and sorting each path.
 type ResultPath struct {
-	Path         string
+	Path string
+
+	// Package is the source package of the file according to the file
+	// metadata of the index, or empty if the index has no metadata. In the
+	// latter case, Rank derives the package from Path.
+	Package string
+
+	// Flags classify the file according to the file metadata of the index.
+	// Without metadata, Rank derives them from Path (see FileFlags).
+	Flags index.FileFlags
+
 	SourcePkgIdx [2]int
 	Ranking      float32
 }
@@ -58,8 +75,8 @@ func (rp *ResultPath) Rank(opts *RankingOpts) {
 	// lookup table: 6.8s
 
 	rp.SourcePkgIdx[0] = 0
-	rp.SourcePkgIdx[1] = 0
-	for i := 0; i < len(rp.Path); i++ {
+	rp.SourcePkgIdx[1] = len(rp.Package)
+	for i := 0; rp.Package == "" && i < len(rp.Path); i++ {
 		if rp.Path[i] == '_' {
 			rp.SourcePkgIdx[1] = i
 			break
@@ -68,6 +85,11 @@ func (rp *ResultPath) Rank(opts *RankingOpts) {
 	if rp.SourcePkgIdx[1] == 0 {
 		log.Fatalf("Invalid path in result: %s", rp.Path)
 	}
+	if rp.Package == "" {
+		if idx := strings.IndexByte(rp.Path, '/'); idx > -1 {
+			rp.Flags = FileFlags(rp.Path[:rp.SourcePkgIdx[1]], rp.Path[idx+1:])
+		}
+	}
 
 	sourcePackage := rp.Path[rp.SourcePkgIdx[0]:rp.SourcePkgIdx[1]]
 	ranking := storedRanking[sourcePackage]
@@ -81,6 +103,9 @@ func (rp *ResultPath) Rank(opts *RankingOpts) {
 	if (opts.Filetype || opts.Weighted) && len(opts.Suffixes) > 0 {
 		suffix := strings.ToLower(path.Ext(rp.Path))
 		if val, exists := opts.Suffixes[suffix]; exists {
+			if opts.Weighted {
+				val *= opts.Model.Filetype
+			}
 			rp.Ranking += val
 		} else {
 			// With a ranking of -1, the result will be thrown away.
@@ -96,8 +121,8 @@ func (rp *ResultPath) Rank(opts *RankingOpts) {
 		}
 	}
 	if opts.Weighted {
-		rp.Ranking += 0.3840 * ranking.Inst
-		rp.Ranking += 0.3427 * ranking.Rdep
+		rp.Ranking += opts.Model.Inst * ranking.Inst
+		rp.Ranking += opts.Model.Rdep * ranking.Rdep
 	}
 }
 
@@ -0,0 +1,148 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultProfile is the name of the ranking profile used for queries without
+// rank: keyword. Unless the profiles file defines it, it uses the weights of
+// ActiveModel.
+const DefaultProfile = "default"
+
+var profiles = make(map[string]Model)
+
+// ReadProfiles reads named ranking profiles from |path|: a JSON object
+// mapping profile names to weights in the format of WriteModel, e.g.
+//
+//	{"precise": {"pathmatch": 0.5, "scope": 2}}
+//
+// Weights missing in a profile are those of ActiveModel, so ReadModel must
+// be called first.
+func ReadProfiles(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(f).Decode(&raw); err != nil {
+		return err
+	}
+	read := make(map[string]Model, len(raw))
+	for name, b := range raw {
+		if strings.ContainsAny(name, ",=") {
+			return fmt.Errorf("invalid profile name %q: must not contain , or =", name)
+		}
+		m := ActiveModel()
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("profile %q: %v", name, err)
+		}
+		read[name] = m
+	}
+	profiles = read
+	return nil
+}
+
+// LookupProfile returns the weights of the profile with the given name.
+func LookupProfile(name string) (Model, bool) {
+	if m, ok := profiles[name]; ok {
+		return m, true
+	}
+	if name == DefaultProfile {
+		return ActiveModel(), true
+	}
+	return Model{}, false
+}
+
+// Profiles returns the names of all profiles.
+func Profiles() []string {
+	names := []string{DefaultProfile}
+	for name := range profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// weight returns a pointer to the weight of m with the given name (as used
+// in the JSON format), or nil.
+func (m *Model) weight(name string) *float32 {
+	switch name {
+	case "inst":
+		return &m.Inst
+	case "rdep":
+		return &m.Rdep
+	case "pathmatch":
+		return &m.Pathmatch
+	case "sourcepkgmatch":
+		return &m.Sourcepkgmatch
+	case "filetype":
+		return &m.Filetype
+	case "scope":
+		return &m.Scope
+	case "linematch":
+		return &m.Linematch
+	case "lineclass":
+		return &m.Lineclass
+	case "pathclass":
+		return &m.Pathclass
+	case "postrank":
+		return &m.Postrank
+	}
+	return nil
+}
+
+// ParseRank parses the value of the rank: keyword, which selects a profile
+// and/or overrides weights for experimentation, e.g. “precise”,
+// “scope=0,linematch=2” or “precise,inst=0”. At most one profile can be
+// selected, and weights must be finite and non-negative. It returns the name
+// of the profile (DefaultProfile if none was selected) and the resulting
+// weights.
+func ParseRank(value string) (string, Model, error) {
+	var name string
+	var overrides []string
+	for _, part := range strings.Split(value, ",") {
+		switch {
+		case part == "":
+			continue
+		case strings.Contains(part, "="):
+			overrides = append(overrides, part)
+		case name != "":
+			return "", Model{}, fmt.Errorf("rank: selects more than one profile (%q and %q)", name, part)
+		default:
+			name = part
+		}
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	m, ok := LookupProfile(name)
+	if !ok {
+		return "", Model{}, fmt.Errorf("rank: unknown ranking profile %q (available: %s)", name, strings.Join(Profiles(), ", "))
+	}
+	for _, override := range overrides {
+		idx := strings.Index(override, "=")
+		w := m.weight(override[:idx])
+		if w == nil {
+			return "", Model{}, fmt.Errorf("rank: unknown weight %q", override[:idx])
+		}
+		val, err := strconv.ParseFloat(override[idx+1:], 32)
+		if err != nil {
+			return "", Model{}, fmt.Errorf("rank: invalid weight %q: %v", override, err)
+		}
+		if math.IsNaN(val) || math.IsInf(val, 0) || val < 0 {
+			return "", Model{}, fmt.Errorf("rank: invalid weight %q: must be a finite, non-negative number", override)
+		}
+		*w = float32(val)
+	}
+	return name, m, nil
+}
@@ -0,0 +1,121 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Debian/dcs/regexp"
+)
+
+func writeProfiles(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "ranking-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "profiles.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRank(t *testing.T) {
+	path := writeProfiles(t, `{"precise": {"pathmatch": 0.5, "scope": 2}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	if err := ReadProfiles(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { profiles = make(map[string]Model) }()
+
+	precise := DefaultModel
+	precise.Pathmatch = 0.5
+	precise.Scope = 2
+	noscope := DefaultModel
+	noscope.Scope = 0
+	noscope.Linematch = 2
+	preciseNoinst := precise
+	preciseNoinst.Inst = 0
+
+	for _, tt := range []struct {
+		value   string
+		profile string
+		want    Model
+	}{
+		{"", DefaultProfile, DefaultModel},
+		{"default", DefaultProfile, DefaultModel},
+		// Weights missing in a profile are those of the active model.
+		{"precise", "precise", precise},
+		{"scope=0,linematch=2", DefaultProfile, noscope},
+		{"precise,inst=0", "precise", preciseNoinst},
+		{"inst=0,precise", "precise", preciseNoinst},
+		{"default,scope=0,linematch=2", DefaultProfile, noscope},
+	} {
+		profile, m, err := ParseRank(tt.value)
+		if err != nil {
+			t.Errorf("ParseRank(%q): %v", tt.value, err)
+			continue
+		}
+		if profile != tt.profile || !reflect.DeepEqual(m, tt.want) {
+			t.Errorf("ParseRank(%q) = %q, %+v, want %q, %+v", tt.value, profile, m, tt.profile, tt.want)
+		}
+	}
+
+	for _, value := range []string{
+		"fuzzy",
+		"precise,default",
+		"default,precise",
+		"default,default",
+		"scope",
+		"typo=1",
+		"scope=x",
+		"scope=NaN",
+		"scope=Inf",
+		"scope=+inf",
+		"scope=-inf",
+		"scope=-1",
+		"scope=1e40",
+	} {
+		if _, _, err := ParseRank(value); err == nil {
+			t.Errorf("ParseRank(%q) unexpectedly succeeded", value)
+		}
+	}
+
+	if got, want := Profiles(), []string{DefaultProfile, "precise"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Profiles() = %v, want %v", got, want)
+	}
+}
+
+func TestReadProfilesInvalidName(t *testing.T) {
+	path := writeProfiles(t, `{"a,b": {}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	err := ReadProfiles(path)
+	if err == nil || !strings.Contains(err.Error(), "invalid profile name") {
+		t.Fatalf("ReadProfiles(%q) = %v, want invalid profile name error", path, err)
+	}
+}
+
+func TestPostRankWeights(t *testing.T) {
+	qs := NewQueryStr("x[0-9]")
+	match := regexp.Match{Context: "int xy1;"}
+	for _, tt := range []struct {
+		linematch float32
+		want      float32
+	}{
+		{1, 0.5},
+		{2, 0.25},
+		// A weight of 0 turns the line match ranking off.
+		{0, 1},
+	} {
+		opts := RankingOpts{Weighted: true, Model: DefaultModel}
+		opts.Model.Scope = 0
+		opts.Model.Linematch = tt.linematch
+		if got := PostRank(opts, &match, &qs, Classes{}); !approxEqual(got, tt.want) {
+			t.Errorf("PostRank(linematch=%v) = %v, want %v", tt.linematch, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,9 @@
 package ranking
 
 import (
-	"fmt"
 	"regexp"
-	"strings"
+
+	dcsregexp "github.com/Debian/dcs/regexp"
 )
 
 // Represents a query string with pre-compiled regular expressions for faster
@@ -15,17 +15,29 @@ type QueryStr struct {
 	anywhereRegexp *regexp.Regexp
 }
 
+// NewQueryStr parses query like the backends do (i.e. including pcre: and
+// struct: queries, whose RE2 approximation is used) and derives a variant
+// with enforced word boundaries and one matching anywhere. Both are
+// case-insensitive: a path or line containing “Foo” is relevant for the query
+// “foo”, too.
 func NewQueryStr(query string) QueryStr {
-	var result QueryStr
-	result.query = query
-	// Remove (?i) at the beginning of the query, which (at least currently)
-	// means case-insensitive.
-	strippedQuery := strings.Replace(query, "(?i)", "", 1)
-	// XXX: This only works for very simple (one-word) queries.
-	quotedQuery := regexp.QuoteMeta(strippedQuery)
-	fmt.Printf("quoted query: %s\n", quotedQuery)
-	result.boundaryRegexp = regexp.MustCompile(`(?i)\b` + quotedQuery + `\b`)
-	result.anywhereRegexp = regexp.MustCompile(`(?i)` + quotedQuery)
+	result := QueryStr{query: query}
+	// Invalid queries are rejected before ranking, but fall back to
+	// matching the query literally just in case.
+	expr := regexp.QuoteMeta(query)
+	if re, err := dcsregexp.CompileQuery(query); err == nil {
+		expr = re.Syntax.String()
+	}
+	var err error
+	result.boundaryRegexp, err = regexp.Compile(`(?i)\b(?:` + expr + `)\b`)
+	if err == nil {
+		result.anywhereRegexp, err = regexp.Compile(`(?i)(?:` + expr + `)`)
+	}
+	if err != nil {
+		expr = regexp.QuoteMeta(query)
+		result.boundaryRegexp = regexp.MustCompile(`(?i)\b` + expr + `\b`)
+		result.anywhereRegexp = regexp.MustCompile(`(?i)` + expr)
+	}
 	return result
 }
 
@@ -0,0 +1,88 @@
+// vim:ts=4:sw=4:noexpandtab
+package ranking
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Debian/dcs/regexp"
+)
+
+var queryStrTests = []struct {
+	query string
+	path  string
+	want  float32
+}{
+	// Word boundary match at the beginning.
+	{"i3", "i3/main.c", 1},
+	// Word boundary match in the middle.
+	{"main", "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	// Match without word boundaries.
+	{"mai", "i3/main.c", 0.5 + 0.25*(1-3.0/9)},
+	// No match at all.
+	{"xorg", "i3/main.c", 0.5},
+
+	// Alternations match if any alternative does.
+	{"xorg|main", "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	{"foo|ai", "i3/main.c", 0.5 + 0.25*(1-4.0/9)},
+
+	// Character classes and repetitions.
+	{"i[0-9]", "i3/main.c", 1},
+	{`ma\w+`, "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	{"i3.main", "i3/main.c", 1},
+	{"[xyz]+", "i3/main.c", 0.5},
+
+	// Case-insensitive queries, including only partially case-insensitive
+	// ones. Ranking is always case-insensitive.
+	{"(?i)MAIN", "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	{"i3/(?i:MAIN)", "i3/main.c", 1},
+	{"MAIN", "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+
+	// Special characters of the query are not matched literally.
+	{`main\.c`, "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	{`main\.c`, "i3/mainxc", 0.5},
+
+	// pcre: and struct: queries use their approximation.
+	{`pcre:(ma)in(?=\.c)`, "i3/main.c", 0.75 + 0.25*(1-3.0/9)},
+	{`struct:main(:[a])`, "i3/main(void)", 0.5 + 0.25*(1-3.0/13)},
+
+	// Queries which do not compile are matched literally.
+	{`main(`, "i3/main(x", 0.75 + 0.25*(1-3.0/9)},
+}
+
+// approxEqual reports whether the rankings a and b are equal up to rounding
+// errors.
+func approxEqual(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-6
+}
+
+func TestQueryStrMatch(t *testing.T) {
+	for _, tt := range queryStrTests {
+		qs := NewQueryStr(tt.query)
+		path := tt.path
+		if got := qs.Match(&path); !approxEqual(got, tt.want) {
+			t.Errorf("NewQueryStr(%#q).Match(%q) = %v, want %v", tt.query, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPostRankLinematch(t *testing.T) {
+	opts := RankingOpts{Linematch: true}
+	for _, tt := range []struct {
+		query   string
+		context string
+		want    float32
+	}{
+		// The context is HTML-escaped, the query is not.
+		{"a < b", "if (a &lt; b)", 0.75 + 0.25*(1-4.0/10)},
+		{"(?i)A|ZZZ", "a = 1;", 1},
+		{"x[0-9]", "int x1;", 0.75 + 0.25*(1-4.0/7)},
+		{"x[0-9]", "int xy1;", 0.5},
+	} {
+		qs := NewQueryStr(tt.query)
+		match := regexp.Match{Context: tt.context}
+		if got := PostRank(opts, &match, &qs, Classes{}); !approxEqual(got, tt.want) {
+			t.Errorf("PostRank(%#q, %q) = %v, want %v", tt.query, tt.context, got, tt.want)
+		}
+	}
+}
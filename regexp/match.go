@@ -11,13 +11,26 @@ import (
 	"fmt"
 	"html"
 	"io"
-	"os"
 	"regexp/syntax"
 	"sort"
+	"time"
 
+	"github.com/Debian/dcs/seekable"
+	"github.com/Debian/dcs/transcode"
 	"github.com/google/codesearch/sparse"
 )
 
+// MaxDFAStates limits the number of DFA states each Regexp caches. Each state
+// takes a little over 2 KiB, and patterns like (a|b)*a(a|b){20} have millions
+// of states. When the limit is reached, the cache is flushed and rebuilt
+// as needed.
+var MaxDFAStates = 2048
+
+// minBytesPerState is the minimum number of bytes the matcher needs to scan
+// per DFA state it creates between two cache flushes: below that, the cache
+// is thrashing, and the matcher falls back to simulating the NFA (like RE2).
+const minBytesPerState = 10
+
 // A matcher holds the state for running regular expression search.
 type matcher struct {
 	prog      *syntax.Prog       // compiled program
@@ -25,6 +38,28 @@ type matcher struct {
 	start     *dstate            // start state
 	startLine *dstate            // start state for beginning of line
 	z1, z2    nstate             // two temporary nstates
+
+	maxStates int   // see MaxDFAStates
+	scanned   int64 // bytes scanned so far, updated after each match
+	pos       int64 // scanned position of the byte being computed
+	lastReset int64 // pos at the last cache flush
+	resets    int   // number of cache flushes
+	nfa       bool  // whether the matcher fell back to the NFA
+}
+
+// MatchStats describes the work of the DFA of a Regexp.
+type MatchStats struct {
+	// DFAStates is the number of currently cached DFA states.
+	DFAStates int
+
+	// CacheResets is the number of times the DFA state cache was flushed
+	// because it exceeded MaxDFAStates.
+	CacheResets int
+
+	// NFA is true if the cache flushes were so frequent that the Regexp
+	// fell back to simulating the NFA, which is slower, but does not need
+	// memory per state.
+	NFA bool
 }
 
 // An nstate corresponds to an NFA state.
@@ -128,21 +163,39 @@ func init() {
 // init initializes the matcher.
 func (m *matcher) init(prog *syntax.Prog) error {
 	m.prog = prog
-	m.dstate = make(map[string]*dstate)
+	m.maxStates = MaxDFAStates
 
 	m.z1.q.Init(uint32(len(prog.Inst)))
 	m.z2.q.Init(uint32(len(prog.Inst)))
 
-	m.addq(&m.z1.q, uint32(prog.Start), syntax.EmptyBeginLine|syntax.EmptyBeginText)
+	m.reset()
+	return nil
+}
+
+// reset flushes the DFA state cache and recomputes the start states.
+// dstates computed before remain valid, but are no longer cached.
+func (m *matcher) reset() {
+	m.dstate = make(map[string]*dstate)
+	m.start = nil
+	m.startLine = nil
+
+	m.z1.q.Reset()
+	m.addq(&m.z1.q, uint32(m.prog.Start), syntax.EmptyBeginLine|syntax.EmptyBeginText)
 	m.z1.flag = flagBOL | flagBOT
 	m.start = m.cache(&m.z1)
 
 	m.z1.q.Reset()
-	m.addq(&m.z1.q, uint32(prog.Start), syntax.EmptyBeginLine)
+	m.addq(&m.z1.q, uint32(m.prog.Start), syntax.EmptyBeginLine)
 	m.z1.flag = flagBOL
 	m.startLine = m.cache(&m.z1)
+}
 
-	return nil
+func (m *matcher) stats() MatchStats {
+	return MatchStats{
+		DFAStates:   len(m.dstate),
+		CacheResets: m.resets,
+		NFA:         m.nfa,
+	}
 }
 
 // stepEmpty steps runq to nextq expanding according to flag.
@@ -209,8 +262,18 @@ const endText = -1
 
 // computeNext computes the next DFA state if we're in d reading c (an input byte or endText).
 func (m *matcher) computeNext(d *dstate, c int) *dstate {
+	m.z1.dec(d.enc)
+	if m.step(c) {
+		return &dmatch
+	}
+	return m.cache(&m.z1)
+}
+
+// step steps the NFA state in m.z1 reading c (an input byte or endText),
+// leaving the next state in m.z1. It returns true if a match ends
+// immediately before c.
+func (m *matcher) step(c int) bool {
 	this, next := &m.z1, &m.z2
-	this.dec(d.enc)
 
 	// compute flags in effect before c
 	flag := syntax.EmptyOp(0)
@@ -258,10 +321,7 @@ func (m *matcher) computeNext(d *dstate, c int) *dstate {
 	}
 
 	// re-add start, process rune + expand according to flags.
-	if m.stepByte(&this.q, &next.q, c, flag) {
-		return &dmatch
-	}
-	return m.cache(next)
+	return m.stepByte(&this.q, &next.q, c, flag)
 }
 
 func (m *matcher) cache(z *nstate) *dstate {
@@ -271,6 +331,18 @@ func (m *matcher) cache(z *nstate) *dstate {
 		return d
 	}
 
+	if m.maxStates > 0 && len(m.dstate) >= m.maxStates && m.startLine != nil {
+		if m.pos-m.lastReset < minBytesPerState*int64(m.maxStates) {
+			m.nfa = true
+		}
+		m.resets++
+		m.lastReset = m.pos
+		m.reset()
+		if d := m.dstate[enc]; d != nil {
+			return d
+		}
+	}
+
 	d = &dstate{enc: enc}
 	m.dstate[enc] = d
 	d.matchNL = m.computeNext(d, '\n') == &dmatch
@@ -279,12 +351,26 @@ func (m *matcher) cache(z *nstate) *dstate {
 }
 
 func (m *matcher) match(b []byte, beginText, endText bool) (end int) {
+	end = m.dfaMatch(b, beginText, endText)
+	if end < 0 {
+		m.scanned += int64(len(b))
+	} else {
+		m.scanned += int64(end)
+	}
+	return end
+}
+
+func (m *matcher) dfaMatch(b []byte, beginText, endText bool) (end int) {
 	//	fmt.Printf("%v\n", m.prog)
 
 	d := m.startLine
 	if beginText {
 		d = m.start
 	}
+	if m.nfa {
+		m.z1.dec(d.enc)
+		return m.nfaMatch(b, 0, endText)
+	}
 	//	m.z1.dec(d.enc)
 	//	fmt.Printf("%v (%v)\n", &m.z1, d==&dmatch)
 	for i, c := range b {
@@ -296,7 +382,13 @@ func (m *matcher) match(b []byte, beginText, endText bool) (end int) {
 				}
 				d1 = m.startLine
 			} else {
+				m.pos = m.scanned + int64(i)
 				d1 = m.computeNext(d, int(c))
+				if m.nfa && d1 != &dmatch {
+					// The cache is thrashing: continue without it.
+					m.z1.dec(d1.enc)
+					return m.nfaMatch(b, i+1, endText)
+				}
 			}
 			d.next[c] = d1
 		}
@@ -311,10 +403,24 @@ func (m *matcher) match(b []byte, beginText, endText bool) (end int) {
 }
 
 func (m *matcher) matchString(b string, beginText, endText bool) (end int) {
+	end = m.dfaMatchString(b, beginText, endText)
+	if end < 0 {
+		m.scanned += int64(len(b))
+	} else {
+		m.scanned += int64(end)
+	}
+	return end
+}
+
+func (m *matcher) dfaMatchString(b string, beginText, endText bool) (end int) {
 	d := m.startLine
 	if beginText {
 		d = m.start
 	}
+	if m.nfa {
+		m.z1.dec(d.enc)
+		return m.nfaMatch([]byte(b), 0, endText)
+	}
 	for i := 0; i < len(b); i++ {
 		c := b[i]
 		d1 := d.next[c]
@@ -325,7 +431,12 @@ func (m *matcher) matchString(b string, beginText, endText bool) (end int) {
 				}
 				d1 = m.startLine
 			} else {
+				m.pos = m.scanned + int64(i)
 				d1 = m.computeNext(d, int(c))
+				if m.nfa && d1 != &dmatch {
+					m.z1.dec(d1.enc)
+					return m.nfaMatch([]byte(b), i+1, endText)
+				}
 			}
 			d.next[c] = d1
 		}
@@ -337,6 +448,40 @@ func (m *matcher) matchString(b string, beginText, endText bool) (end int) {
 	return -1
 }
 
+// nfaMatch continues matching b at position i by simulating the NFA, whose
+// state at i is in m.z1. It behaves like the DFA, but does not cache any
+// states.
+func (m *matcher) nfaMatch(b []byte, i int, eot bool) (end int) {
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c == '\n' {
+			if m.step('\n') {
+				return i
+			}
+			m.z1.dec(m.startLine.enc)
+			continue
+		}
+		if m.step(int(c)) {
+			// Like dmatch: the match ends with the line.
+			if nl := bytes.IndexByte(b[i:], '\n'); nl >= 0 {
+				return i + nl
+			}
+			return len(b)
+		}
+	}
+	enc := m.z1.enc()
+	if m.step('\n') {
+		return len(b)
+	}
+	if eot {
+		m.z1.dec(enc)
+		if m.step(endText) {
+			return len(b)
+		}
+	}
+	return -1
+}
+
 // isWordByte reports whether the byte c is a word character: ASCII only.
 // This is used to implement \b and \B.  This is not right for Unicode, but:
 //	- it's hard to get right in a byte-at-a-time matching world
@@ -362,6 +507,18 @@ type Grep struct {
 
 	Match bool
 
+	// MaxSteps and MaxTime limit the work spent verifying the candidate
+	// lines of a single file in PCRE mode (see CompilePCRE), or matching a
+	// single file in structural mode (see CompileStruct). Zero means no
+	// limit.
+	MaxSteps int
+	MaxTime  time.Duration
+
+	// BudgetErr is a *BudgetError if the verification of the last file
+	// was aborted because it exceeded MaxSteps or MaxTime, nil otherwise.
+	// The matches found up to that point are still returned.
+	BudgetErr error
+
 	buf []byte
 }
 
@@ -372,8 +529,21 @@ func (g *Grep) AddFlags() {
 	flag.BoolVar(&g.H, "h", false, "omit file names")
 }
 
+// File greps the file name, which is transparently decompressed if it was
+// stored compressed (see seekable.OpenFile).
 func (g *Grep) File(name string) []Match {
-	f, err := os.Open(name)
+	return g.file(name, name)
+}
+
+// Transcoded greps the UTF-8 transcoding the importer stored next to the file
+// name (see package transcode), matching what the index contains. The matches
+// refer to name.
+func (g *Grep) Transcoded(name string) []Match {
+	return g.file(name+transcode.Suffix, name)
+}
+
+func (g *Grep) file(path, name string) []Match {
+	f, err := seekable.OpenFile(path)
 	if err != nil {
 		fmt.Fprintf(g.Stderr, "%s\n", err)
 		return []Match{}
@@ -413,6 +583,10 @@ type Match struct {
 	// contents of line (Line + 2)
 	Ctxn2 string
 
+	// Bindings of the holes of a structural pattern (see CompileStruct),
+	// in the order of their first occurrence in the pattern.
+	Bindings []Binding
+
 	// This will be filled in by the source backend
 	PathRank float32
 	Ranking  float32
@@ -420,6 +594,13 @@ type Match struct {
 
 func (g *Grep) Reader(r io.Reader, name string) []Match {
 	var result []Match
+	g.BudgetErr = nil
+	if g.Regexp.structural != nil {
+		return g.structReader(r, name)
+	}
+	if pcre := g.Regexp.pcre; pcre != nil {
+		pcre.reset(g.MaxSteps, g.MaxTime)
+	}
 	if g.buf == nil {
 		// 1024KB
 		g.buf = make([]byte, 1<<20)
@@ -470,12 +651,31 @@ func (g *Grep) Reader(r io.Reader, name string) []Match {
 			if m1 < chunkStart {
 				break
 			}
-			g.Match = true
 			lineStart := bytes.LastIndex(buf[chunkStart:m1], nl) + 1 + chunkStart
 			lineEnd := m1 + 1
 			if lineEnd > end {
 				lineEnd = end
 			}
+			if pcre := g.Regexp.pcre; pcre != nil {
+				text := buf[lineStart:end]
+				if i := bytes.IndexByte(text, '\n'); i >= 0 {
+					text = text[:i]
+				}
+				ok, err := pcre.matchLine(text)
+				if err != nil {
+					g.BudgetErr = err
+					return result
+				}
+				if !ok {
+					// The approximation matched, but the pattern
+					// does not.
+					lineno += countNL(buf[chunkStart:lineStart])
+					lineno++
+					chunkStart = lineEnd
+					continue
+				}
+			}
+			g.Match = true
 			//fmt.Printf("matching line: %s", buf[lineStart:lineEnd])
 
 			lineno += countNL(buf[chunkStart:lineStart])
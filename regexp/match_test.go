@@ -1,6 +1,9 @@
 package regexp
 
 import (
+	"math/rand"
+	"reflect"
+	stdregexp "regexp"
 	"strings"
 	"testing"
 )
@@ -110,3 +113,86 @@ func TestMatchContextBefore(t *testing.T) {
 		t.Errorf("Context -2 wrong: %s", matches[0].Ctxp2)
 	}
 }
+
+// withMaxDFAStates compiles expr with MaxDFAStates set to max.
+func withMaxDFAStates(t *testing.T, expr string, max int) *Regexp {
+	defer func(old int) { MaxDFAStates = old }(MaxDFAStates)
+	MaxDFAStates = max
+	re, err := Compile(expr)
+	if err != nil {
+		t.Fatalf("Compile(%#q): %v", expr, err)
+	}
+	return re
+}
+
+func TestMatchSmallDFACache(t *testing.T) {
+	// The results must not depend on the cache size, nor on whether the
+	// matcher falls back to the NFA.
+	for _, max := range []int{1, 2, 4} {
+		for _, tt := range matchTests {
+			re := withMaxDFAStates(t, "(?m)"+tt.re, max)
+			lines := grep(re, []byte(tt.s))
+			if !reflect.DeepEqual(lines, tt.m) {
+				t.Errorf("MaxDFAStates=%d: grep(%#q, %q) = %v, want %v", max, tt.re, tt.s, lines, tt.m)
+			}
+		}
+	}
+}
+
+func TestMatchDFACacheLimit(t *testing.T) {
+	// (a|b)*a(a|b){n} needs 2^n DFA states.
+	const expr = `(a|b)*a(a|b){10}c`
+	want := stdregexp.MustCompile(expr)
+	r := rand.New(rand.NewSource(1))
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		line := randomLine(r, 20+r.Intn(40))
+		if r.Intn(2) == 0 {
+			line += "c"
+		}
+		lines = append(lines, line)
+	}
+	text := strings.Join(lines, "\n") + "\n"
+
+	for _, tt := range []struct {
+		max int
+		nfa bool
+	}{
+		{4096, false},
+		{16, true},
+	} {
+		re := withMaxDFAStates(t, expr, tt.max)
+		var got []int
+		// Search the text several times, like Grep does for many files.
+		for i := 0; i < 3; i++ {
+			got = grep(re, []byte(text))
+		}
+		var wantLines []int
+		for i, line := range lines {
+			if want.MatchString(line) {
+				wantLines = append(wantLines, i+1)
+			}
+		}
+		if !reflect.DeepEqual(got, wantLines) {
+			t.Errorf("MaxDFAStates=%d: matched lines %v, want %v", tt.max, got, wantLines)
+		}
+		stats := re.Stats()
+		if stats.DFAStates > tt.max {
+			t.Errorf("MaxDFAStates=%d: %d states cached", tt.max, stats.DFAStates)
+		}
+		if resets := stats.CacheResets; (resets > 0) != tt.nfa {
+			t.Errorf("MaxDFAStates=%d: %d cache resets", tt.max, resets)
+		}
+		if stats.NFA != tt.nfa {
+			t.Errorf("MaxDFAStates=%d: NFA = %v, want %v", tt.max, stats.NFA, tt.nfa)
+		}
+	}
+}
+
+func randomLine(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = "ab"[r.Intn(2)]
+	}
+	return string(b)
+}
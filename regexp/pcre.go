@@ -0,0 +1,1066 @@
+// vim:ts=4:sw=4:noexpandtab
+package regexp
+
+import (
+	"bytes"
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PCRE mode.
+//
+// Queries starting with PCREPrefix use (a subset of) the Perl-compatible
+// syntax, which adds backreferences (\1, \k<name>), lookahead (?=…) (?!…),
+// lookbehind (?<=…) (?<!…), atomic groups (?>…) and possessive quantifiers to
+// the RE2 syntax. Such patterns cannot be matched by automata, so a PCRE
+// Regexp consists of two parts:
+//
+// The RE2 approximation of the pattern (Regexp.Syntax) matches every line
+// the pattern matches (and probably more): lookarounds are replaced by empty
+// matches and backreferences by their group. It is used for the trigram
+// query and by the DFA to find candidate lines.
+//
+// Each candidate line is then verified by a backtracking matcher, which can
+// take time exponential in the length of the line. Grep hence limits the
+// steps and time spent verifying the lines of each file, see Grep.MaxSteps.
+//
+// Like the DFA, the backtracking matcher works on single lines, i.e. ^ and $
+// match at the beginning and end of each line.
+
+// PCREPrefix marks queries in PCRE mode, see CompileQuery.
+const PCREPrefix = "pcre:"
+
+// CompileQuery compiles a search query: if query starts with PCREPrefix or
+// StructPrefix, the remainder is compiled using CompilePCRE or CompileStruct,
+// respectively, otherwise query is compiled using Compile.
+func CompileQuery(query string) (*Regexp, error) {
+	switch {
+	case strings.HasPrefix(query, PCREPrefix):
+		return CompilePCRE(strings.TrimPrefix(query, PCREPrefix))
+	case strings.HasPrefix(query, StructPrefix):
+		return CompileStruct(strings.TrimPrefix(query, StructPrefix))
+	}
+	return Compile(query)
+}
+
+// CompilePCRE parses a regular expression in PCRE syntax. The Syntax of the
+// returned Regexp is its RE2 approximation, and Match only reports lines
+// which the backtracking matcher verified.
+func CompilePCRE(expr string) (*Regexp, error) {
+	p := pcreParser{src: expr, names: make(map[string]int)}
+	root, err := p.parse()
+	if err != nil {
+		return nil, &syntax.Error{Code: syntax.ErrorCode(err.Error()), Expr: expr}
+	}
+	prog := &pcreProg{root: root, ncap: p.ncap, groups: p.groups}
+	approx := prog.approx(root, make(map[int]bool))
+	r, err := compile(expr, approx)
+	if err != nil {
+		return nil, err
+	}
+	r.pcre = &backtracker{prog: prog}
+	return r, nil
+}
+
+// BudgetError is the error Grep reports for a file whose verification
+// exceeded Grep.MaxSteps or Grep.MaxTime.
+type BudgetError struct {
+	Steps   int           // steps taken when verification was aborted
+	Elapsed time.Duration // time spent verifying the file
+	Time    bool          // whether the time budget (not the step budget) was exceeded
+	Depth   bool          // whether maxDepth (not a budget) was exceeded
+}
+
+func (e *BudgetError) Error() string {
+	if e.Depth {
+		return fmt.Sprintf("verification exceeded the recursion depth of %d after %v (%d steps)", maxDepth, e.Elapsed, e.Steps)
+	}
+	if e.Time {
+		return fmt.Sprintf("verification exceeded the time budget after %v (%d steps)", e.Elapsed, e.Steps)
+	}
+	return fmt.Sprintf("verification exceeded the step budget of %d steps after %v", e.Steps, e.Elapsed)
+}
+
+type pcreOp uint8
+
+const (
+	pEmpty          pcreOp = iota
+	pRune                  // a single rune matching re
+	pBeginLine             // ^, \A
+	pEndLine               // $, \z, \Z
+	pWordBoundary          // \b
+	pNoWordBoundary        // \B
+	pConcat
+	pAlternate
+	pCapture    // group cap
+	pRepeat     // sub[0] min to max (-1: unbounded) times
+	pAtomic     // (?>…), possessive quantifiers
+	pLookahead  // (?=…), or (?!…) if negate
+	pLookbehind // (?<=…), or (?<!…) if negate
+	pBackref    // \cap
+)
+
+type pcreNode struct {
+	op       pcreOp
+	re       *syntax.Regexp // pRune
+	sub      []*pcreNode
+	min, max int  // pRepeat
+	lazy     bool // pRepeat
+	negate   bool // pLookahead, pLookbehind
+	cap      int  // pCapture, pBackref
+	fold     bool // pBackref
+}
+
+type pcreProg struct {
+	root   *pcreNode
+	ncap   int
+	groups map[int]*pcreNode
+}
+
+// maxRepeat is the largest count of a repetition, like in RE2.
+const maxRepeat = 1000
+
+type pcreParser struct {
+	src    string
+	pos    int
+	flags  syntax.Flags // syntax.FoldCase, syntax.DotNL
+	ncap   int
+	names  map[string]int
+	groups map[int]*pcreNode
+}
+
+func (p *pcreParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format, args...)
+}
+
+func (p *pcreParser) parse() (n *pcreNode, err error) {
+	p.groups = make(map[int]*pcreNode)
+	n, err = p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected ) at position %d", p.pos)
+	}
+	// Backreferences may only refer to existing groups.
+	var check func(n *pcreNode) error
+	check = func(n *pcreNode) error {
+		if n.op == pBackref && n.cap > p.ncap {
+			return p.errorf("invalid backreference \\%d", n.cap)
+		}
+		for _, sub := range n.sub {
+			if err := check(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return n, check(n)
+}
+
+func (p *pcreParser) more() bool {
+	return p.pos < len(p.src)
+}
+
+func (p *pcreParser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *pcreParser) parseAlternate() (*pcreNode, error) {
+	flags := p.flags
+	defer func() { p.flags = flags }()
+	var alts []*pcreNode
+	for {
+		n, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, n)
+		if !p.peek("|") {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return &pcreNode{op: pAlternate, sub: alts}, nil
+}
+
+func (p *pcreParser) parseConcat() (*pcreNode, error) {
+	var subs []*pcreNode
+	for p.more() && !p.peek("|") && !p.peek(")") {
+		n, err := p.parseAtom()
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			continue
+		}
+		if n, err = p.parseQuantifier(n); err != nil {
+			return nil, err
+		}
+		subs = append(subs, n)
+	}
+	switch len(subs) {
+	case 0:
+		return &pcreNode{op: pEmpty}, nil
+	case 1:
+		return subs[0], nil
+	}
+	return &pcreNode{op: pConcat, sub: subs}, nil
+}
+
+func (p *pcreParser) parseQuantifier(n *pcreNode) (*pcreNode, error) {
+	for p.more() {
+		min, max := -1, -1
+		start := p.pos
+		switch p.src[p.pos] {
+		case '*':
+			min, max = 0, -1
+			p.pos++
+		case '+':
+			min, max = 1, -1
+			p.pos++
+		case '?':
+			min, max = 0, 1
+			p.pos++
+		case '{':
+			var ok bool
+			if min, max, ok = p.parseRepeat(); !ok {
+				// Like in PCRE, { is a literal unless it starts a
+				// repetition.
+				return n, nil
+			}
+		default:
+			return n, nil
+		}
+		switch n.op {
+		case pEmpty, pBeginLine, pEndLine, pWordBoundary, pNoWordBoundary, pLookahead, pLookbehind:
+			if min > 0 {
+				min = 1
+			}
+			if max != 0 {
+				max = 1
+			}
+		case pRepeat:
+			return nil, p.errorf("invalid nested repetition operator %s", p.src[start:p.pos])
+		}
+		rep := &pcreNode{op: pRepeat, sub: []*pcreNode{n}, min: min, max: max}
+		if p.peek("?") {
+			rep.lazy = true
+			p.pos++
+		} else if p.peek("+") {
+			p.pos++
+			rep = &pcreNode{op: pAtomic, sub: []*pcreNode{rep}}
+		}
+		n = rep
+	}
+	return n, nil
+}
+
+// parseRepeat parses {n}, {n,} or {n,m} at p.pos.
+func (p *pcreParser) parseRepeat() (min, max int, ok bool) {
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end < 0 {
+		return 0, 0, false
+	}
+	spec := p.src[p.pos+1 : p.pos+end]
+	lo, hi := spec, spec
+	if i := strings.IndexByte(spec, ','); i >= 0 {
+		lo, hi = spec[:i], spec[i+1:]
+	}
+	var err error
+	if min, err = strconv.Atoi(lo); err != nil || min < 0 || min > maxRepeat {
+		return 0, 0, false
+	}
+	max = -1
+	if hi != "" {
+		if max, err = strconv.Atoi(hi); err != nil || max < min || max > maxRepeat {
+			return 0, 0, false
+		}
+	}
+	p.pos += end + 1
+	return min, max, true
+}
+
+func (p *pcreParser) runeNode(re *syntax.Regexp) *pcreNode {
+	return &pcreNode{op: pRune, re: re}
+}
+
+// literal returns a node matching the rune r, honoring (?i).
+func (p *pcreParser) literal(r rune) *pcreNode {
+	if p.flags&syntax.FoldCase != 0 {
+		// Like package regexp/syntax, which the matcher relies on, use
+		// the smallest rune of the case folding orbit.
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		r = min
+	}
+	return p.runeNode(&syntax.Regexp{
+		Op:    syntax.OpLiteral,
+		Rune:  []rune{r},
+		Flags: p.flags & syntax.FoldCase,
+	})
+}
+
+// parseSingle parses expr (a character class or escape sequence), which
+// must match a single rune, using package regexp/syntax.
+func (p *pcreParser) parseSingle(expr string) (*pcreNode, error) {
+	re, err := syntax.Parse(expr, syntax.Perl|p.flags)
+	if err != nil {
+		return nil, err
+	}
+	switch re.Op {
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+	case syntax.OpLiteral:
+		if len(re.Rune) != 1 {
+			return nil, p.errorf("unsupported escape sequence %s", expr)
+		}
+	case syntax.OpNoMatch:
+		// E.g. [^\D\d]
+	default:
+		return nil, p.errorf("unsupported escape sequence %s", expr)
+	}
+	return p.runeNode(re), nil
+}
+
+func (p *pcreParser) parseAtom() (*pcreNode, error) {
+	c, w := utf8.DecodeRuneInString(p.src[p.pos:])
+	switch c {
+	case '(':
+		return p.parseGroup()
+	case '[':
+		end, err := p.classEnd()
+		if err != nil {
+			return nil, err
+		}
+		class := p.src[p.pos:end]
+		p.pos = end
+		return p.parseSingle(class)
+	case '.':
+		p.pos++
+		if p.flags&syntax.DotNL != 0 {
+			return p.runeNode(&syntax.Regexp{Op: syntax.OpAnyChar}), nil
+		}
+		return p.runeNode(&syntax.Regexp{Op: syntax.OpAnyCharNotNL}), nil
+	case '^':
+		p.pos++
+		return &pcreNode{op: pBeginLine}, nil
+	case '$':
+		p.pos++
+		return &pcreNode{op: pEndLine}, nil
+	case '\\':
+		return p.parseEscape()
+	case '*', '+', '?':
+		return nil, p.errorf("missing argument to repetition operator %c", c)
+	}
+	p.pos += w
+	return p.literal(c), nil
+}
+
+// classEnd returns the position after the character class starting at p.pos.
+func (p *pcreParser) classEnd() (int, error) {
+	i := p.pos + 1
+	if i < len(p.src) && p.src[i] == '^' {
+		i++
+	}
+	// A ] at the start of the class is a literal.
+	if i < len(p.src) && p.src[i] == ']' {
+		i++
+	}
+	for i < len(p.src) {
+		switch {
+		case p.src[i] == '\\':
+			i += 2
+		case strings.HasPrefix(p.src[i:], "[:"):
+			end := strings.Index(p.src[i+2:], ":]")
+			if end < 0 {
+				i++
+				continue
+			}
+			i += 2 + end + 2
+		case p.src[i] == ']':
+			return i + 1, nil
+		default:
+			i++
+		}
+	}
+	return 0, p.errorf("missing closing ]: %s", p.src[p.pos:])
+}
+
+func (p *pcreParser) parseEscape() (*pcreNode, error) {
+	if p.pos+1 >= len(p.src) {
+		return nil, p.errorf("trailing backslash at end of expression")
+	}
+	c := p.src[p.pos+1]
+	switch {
+	case c >= '1' && c <= '9':
+		p.pos++
+		start := p.pos
+		for p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		n, _ := strconv.Atoi(p.src[start:p.pos])
+		return p.backref(n), nil
+	case c == 'k' || c == 'g':
+		p.pos += 2
+		return p.parseNamedBackref(c)
+	case c == 'b':
+		p.pos += 2
+		return &pcreNode{op: pWordBoundary}, nil
+	case c == 'B':
+		p.pos += 2
+		return &pcreNode{op: pNoWordBoundary}, nil
+	case c == 'A':
+		p.pos += 2
+		return &pcreNode{op: pBeginLine}, nil
+	case c == 'z' || c == 'Z':
+		p.pos += 2
+		return &pcreNode{op: pEndLine}, nil
+	case c == 'Q':
+		p.pos += 2
+		end := strings.Index(p.src[p.pos:], `\E`)
+		quoted := p.src[p.pos:]
+		if end >= 0 {
+			quoted = p.src[p.pos : p.pos+end]
+			p.pos += end + 2
+		} else {
+			p.pos = len(p.src)
+		}
+		var subs []*pcreNode
+		for _, r := range quoted {
+			subs = append(subs, p.literal(r))
+		}
+		return &pcreNode{op: pConcat, sub: subs}, nil
+	case c == 'E':
+		// \E without \Q is ignored, like in PCRE.
+		p.pos += 2
+		return nil, nil
+	}
+	// All other escape sequences match a single rune.
+	end := p.pos + 2
+	if c == 'p' || c == 'P' || c == 'x' {
+		if end < len(p.src) && p.src[end] == '{' {
+			if i := strings.IndexByte(p.src[end:], '}'); i >= 0 {
+				end += i + 1
+			}
+		} else if c == 'x' {
+			end += 2
+		} else {
+			end++
+		}
+	} else if c >= utf8.RuneSelf {
+		_, w := utf8.DecodeRuneInString(p.src[p.pos+1:])
+		end = p.pos + 1 + w
+	}
+	if end > len(p.src) {
+		end = len(p.src)
+	}
+	escape := p.src[p.pos:end]
+	p.pos = end
+	return p.parseSingle(escape)
+}
+
+func (p *pcreParser) backref(n int) *pcreNode {
+	return &pcreNode{op: pBackref, cap: n, fold: p.flags&syntax.FoldCase != 0}
+}
+
+// parseNamedBackref parses the remainder of \k<name>, \k'name', \k{name},
+// \g{name}, \g{n} or \gn.
+func (p *pcreParser) parseNamedBackref(c byte) (*pcreNode, error) {
+	if !p.more() {
+		return nil, p.errorf("invalid backreference \\%c", c)
+	}
+	var closing byte
+	switch p.src[p.pos] {
+	case '<':
+		closing = '>'
+	case '\'':
+		closing = '\''
+	case '{':
+		closing = '}'
+	default:
+		if c == 'g' {
+			start := p.pos
+			for p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+				p.pos++
+			}
+			if n, err := strconv.Atoi(p.src[start:p.pos]); err == nil {
+				return p.backref(n), nil
+			}
+		}
+		return nil, p.errorf("invalid backreference \\%c", c)
+	}
+	end := strings.IndexByte(p.src[p.pos+1:], closing)
+	if end < 0 {
+		return nil, p.errorf("invalid backreference \\%c", c)
+	}
+	name := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return p.namedBackref(name)
+}
+
+func (p *pcreParser) namedBackref(name string) (*pcreNode, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return p.backref(n), nil
+	}
+	n, ok := p.names[name]
+	if !ok {
+		return nil, p.errorf("backreference to unknown group %q", name)
+	}
+	return p.backref(n), nil
+}
+
+func (p *pcreParser) parseGroup() (*pcreNode, error) {
+	p.pos++ // (
+	var (
+		op     = pCapture
+		negate bool
+		name   string
+	)
+	switch {
+	case p.peek("?:"):
+		op = pConcat
+		p.pos += 2
+	case p.peek("?>"):
+		op = pAtomic
+		p.pos += 2
+	case p.peek("?="), p.peek("?!"):
+		op = pLookahead
+		negate = p.peek("?!")
+		p.pos += 2
+	case p.peek("?<="), p.peek("?<!"):
+		op = pLookbehind
+		negate = p.peek("?<!")
+		p.pos += 3
+	case p.peek("?P="):
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			return nil, p.errorf("missing closing )")
+		}
+		name := p.src[p.pos+3 : p.pos+end]
+		p.pos += end + 1
+		return p.namedBackref(name)
+	case p.peek("?P<"), p.peek("?<"), p.peek("?'"):
+		start := p.pos + 2
+		closing := byte('>')
+		if p.peek("?P<") {
+			start++
+		} else if p.peek("?'") {
+			closing = '\''
+		}
+		end := strings.IndexByte(p.src[start:], closing)
+		if end < 0 {
+			return nil, p.errorf("invalid named capture")
+		}
+		name = p.src[start : start+end]
+		if name == "" {
+			return nil, p.errorf("invalid named capture")
+		}
+		if _, ok := p.names[name]; ok {
+			return nil, p.errorf("duplicate capture group name %q", name)
+		}
+		p.pos = start + end + 1
+	case p.peek("?"):
+		// Flags, either for the remainder of the enclosing group, e.g.
+		// (?i), or for a group, e.g. (?i:…).
+		p.pos++
+		flags := p.flags
+		on := true
+		for {
+			if !p.more() {
+				return nil, p.errorf("missing closing )")
+			}
+			c := p.src[p.pos]
+			p.pos++
+			var f syntax.Flags
+			switch c {
+			case 'i':
+				f = syntax.FoldCase
+			case 's':
+				f = syntax.DotNL
+			case 'm', 'U':
+				// ^ and $ always match at line boundaries; lazy
+				// by default is not supported.
+				if c == 'U' {
+					return nil, p.errorf("unsupported flag U")
+				}
+			case '-':
+				on = false
+				continue
+			case ')':
+				p.flags = flags
+				return nil, nil
+			case ':':
+				outer := p.flags
+				p.flags = flags
+				n, err := p.parseAlternate()
+				p.flags = outer
+				if err != nil {
+					return nil, err
+				}
+				if !p.peek(")") {
+					return nil, p.errorf("missing closing )")
+				}
+				p.pos++
+				return n, nil
+			default:
+				return nil, p.errorf("invalid or unsupported flag %c", c)
+			}
+			if on {
+				flags |= f
+			} else {
+				flags &^= f
+			}
+		}
+	}
+	var cap int
+	if op == pCapture {
+		p.ncap++
+		cap = p.ncap
+		if name != "" {
+			p.names[name] = cap
+		}
+	}
+	sub, err := p.parseAlternate()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek(")") {
+		return nil, p.errorf("missing closing )")
+	}
+	p.pos++
+	switch op {
+	case pConcat:
+		return sub, nil
+	case pCapture:
+		n := &pcreNode{op: pCapture, cap: cap, sub: []*pcreNode{sub}}
+		p.groups[cap] = n
+		return n, nil
+	}
+	return &pcreNode{op: op, negate: negate, sub: []*pcreNode{sub}}, nil
+}
+
+// anyLine matches any (remainder of a) line, see approx.
+var anyLine = &syntax.Regexp{
+	Op:  syntax.OpStar,
+	Sub: []*syntax.Regexp{{Op: syntax.OpAnyCharNotNL}},
+}
+
+// approx returns an RE2 regular expression which matches (at least) all
+// lines n matches. inProgress holds the groups whose approximation is being
+// computed, which backreferences within the group cannot use.
+func (prog *pcreProg) approx(n *pcreNode, inProgress map[int]bool) *syntax.Regexp {
+	switch n.op {
+	case pRune:
+		re := *n.re
+		return &re
+	case pBeginLine:
+		return &syntax.Regexp{Op: syntax.OpBeginLine}
+	case pEndLine:
+		return &syntax.Regexp{Op: syntax.OpEndLine}
+	case pWordBoundary:
+		return &syntax.Regexp{Op: syntax.OpWordBoundary}
+	case pNoWordBoundary:
+		return &syntax.Regexp{Op: syntax.OpNoWordBoundary}
+	case pConcat:
+		re := &syntax.Regexp{Op: syntax.OpConcat}
+		for _, sub := range n.sub {
+			s := prog.approx(sub, inProgress)
+			// Merge runs of literals, so that they are analyzed as
+			// strings (instead of sets of single runes).
+			if len(re.Sub) > 0 {
+				last := re.Sub[len(re.Sub)-1]
+				if last.Op == syntax.OpLiteral && s.Op == syntax.OpLiteral && last.Flags == s.Flags {
+					last.Rune = append(last.Rune, s.Rune...)
+					continue
+				}
+			}
+			re.Sub = append(re.Sub, s)
+		}
+		return re
+	case pAlternate:
+		re := &syntax.Regexp{Op: syntax.OpAlternate}
+		for _, sub := range n.sub {
+			re.Sub = append(re.Sub, prog.approx(sub, inProgress))
+		}
+		return re
+	case pCapture:
+		inProgress[n.cap] = true
+		re := prog.approx(n.sub[0], inProgress)
+		delete(inProgress, n.cap)
+		return re
+	case pRepeat:
+		return &syntax.Regexp{
+			Op:  syntax.OpRepeat,
+			Min: n.min,
+			Max: n.max,
+			Sub: []*syntax.Regexp{prog.approx(n.sub[0], inProgress)},
+		}
+	case pAtomic:
+		return prog.approx(n.sub[0], inProgress)
+	case pBackref:
+		// A backreference matches the text its group matched, which the
+		// group’s approximation also matches. Case-insensitive
+		// backreferences and references to an enclosing group match
+		// (nearly) anything.
+		group, ok := prog.groups[n.cap]
+		if !ok || n.fold || inProgress[n.cap] {
+			return anyLine
+		}
+		return prog.approx(group, inProgress)
+	}
+	// pEmpty and lookarounds, which do not consume any text.
+	return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+}
+
+// maxDepth limits the recursion depth of the backtracking matchers, which
+// grows with the length of the text a pattern like (ab)* consumes. Without
+// a limit, long lines (e.g. minified JavaScript) overflow the stack, which is
+// fatal.
+const maxDepth = 1 << 16
+
+// budgetExceeded is panicked by budget.step and recovered by the matchers.
+type budgetExceeded struct {
+	time  bool
+	depth bool
+}
+
+// budget limits the steps and time the backtracking matchers (PCRE and
+// structural) spend on a file.
+type budget struct {
+	steps    int
+	maxSteps int
+	depth    int
+	start    time.Time
+	deadline time.Time
+}
+
+// reset starts a new budget of maxSteps steps and maxTime (zero: unlimited).
+func (b *budget) reset(maxSteps int, maxTime time.Duration) {
+	b.steps = 0
+	b.maxSteps = maxSteps
+	b.depth = 0
+	b.start = time.Now()
+	b.deadline = time.Time{}
+	if maxTime > 0 {
+		b.deadline = b.start.Add(maxTime)
+	}
+}
+
+func (b *budget) step() {
+	b.steps++
+	if b.maxSteps > 0 && b.steps > b.maxSteps {
+		panic(budgetExceeded{})
+	}
+	if b.steps%1024 == 0 && !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		panic(budgetExceeded{time: true})
+	}
+}
+
+// enter is step for a recursive call, which leave must be called after.
+func (b *budget) enter() {
+	b.step()
+	b.depth++
+	if b.depth > maxDepth {
+		panic(budgetExceeded{depth: true})
+	}
+}
+
+func (b *budget) leave() {
+	b.depth--
+}
+
+// recover turns r, a value recovered from a panic, into a *BudgetError.
+// Panics other than budgetExceeded are propagated.
+func (b *budget) recover(r interface{}) error {
+	be, ok := r.(budgetExceeded)
+	if !ok {
+		panic(r)
+	}
+	return &BudgetError{
+		Steps:   b.steps,
+		Elapsed: time.Since(b.start),
+		Time:    be.time,
+		Depth:   be.depth,
+	}
+}
+
+// backtracker verifies lines using the pcreProg.
+type backtracker struct {
+	budget
+
+	prog *pcreProg
+	line []byte
+	caps []int
+	ends []int // see matchRuneRepeat
+}
+
+// matchLine reports whether the pattern matches line (without its newline).
+// It returns a *BudgetError if the budget set by reset is exhausted.
+func (b *backtracker) matchLine(line []byte) (matched bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = b.budget.recover(r)
+		}
+	}()
+	b.line = line
+	if cap(b.caps) < 2*(b.prog.ncap+1) {
+		b.caps = make([]int, 2*(b.prog.ncap+1))
+	}
+	b.caps = b.caps[:2*(b.prog.ncap+1)]
+	// A budget error can leave iterations of matchRuneRepeat behind.
+	b.ends = b.ends[:0]
+	accept := func(int) bool { return true }
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && !utf8.RuneStart(line[i]) {
+			continue
+		}
+		for j := range b.caps {
+			b.caps[j] = -1
+		}
+		if b.match(b.prog.root, i, accept) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b *backtracker) isWordAt(i int) bool {
+	return i >= 0 && i < len(b.line) && isWordByte(int(b.line[i]))
+}
+
+// match reports whether n matches at position i of the line followed by
+// whatever k accepts (k is called with the position after n).
+func (b *backtracker) match(n *pcreNode, i int, k func(int) bool) bool {
+	b.enter()
+	matched := b.matchNode(n, i, k)
+	b.leave()
+	return matched
+}
+
+func (b *backtracker) matchNode(n *pcreNode, i int, k func(int) bool) bool {
+	switch n.op {
+	case pEmpty:
+		return k(i)
+
+	case pRune:
+		if i >= len(b.line) {
+			return false
+		}
+		r, w := utf8.DecodeRune(b.line[i:])
+		if !matchRune(n.re, r) {
+			return false
+		}
+		return k(i + w)
+
+	case pBeginLine:
+		return i == 0 && k(i)
+
+	case pEndLine:
+		return i == len(b.line) && k(i)
+
+	case pWordBoundary, pNoWordBoundary:
+		boundary := b.isWordAt(i-1) != b.isWordAt(i)
+		return boundary == (n.op == pWordBoundary) && k(i)
+
+	case pConcat:
+		return b.matchConcat(n.sub, i, k)
+
+	case pAlternate:
+		for _, sub := range n.sub {
+			if b.match(sub, i, k) {
+				return true
+			}
+		}
+		return false
+
+	case pCapture:
+		c := 2 * n.cap
+		return b.match(n.sub[0], i, func(j int) bool {
+			start, end := b.caps[c], b.caps[c+1]
+			b.caps[c], b.caps[c+1] = i, j
+			if k(j) {
+				return true
+			}
+			b.caps[c], b.caps[c+1] = start, end
+			return false
+		})
+
+	case pRepeat:
+		if n.sub[0].op == pRune {
+			return b.matchRuneRepeat(n, i, k)
+		}
+		return b.matchRepeat(n, 0, i, k)
+
+	case pAtomic:
+		end := -1
+		if !b.match(n.sub[0], i, func(j int) bool {
+			end = j
+			return true
+		}) {
+			return false
+		}
+		return k(end)
+
+	case pLookahead:
+		matched := b.match(n.sub[0], i, func(int) bool { return true })
+		return matched != n.negate && k(i)
+
+	case pLookbehind:
+		matched := false
+		for j := i; j >= 0 && !matched; j-- {
+			if j < len(b.line) && !utf8.RuneStart(b.line[j]) {
+				continue
+			}
+			matched = b.match(n.sub[0], j, func(end int) bool { return end == i })
+		}
+		return matched != n.negate && k(i)
+
+	case pBackref:
+		start, end := b.caps[2*n.cap], b.caps[2*n.cap+1]
+		if start < 0 {
+			// Like in PCRE, a backreference to a group which did not
+			// participate in the match fails.
+			return false
+		}
+		ref := b.line[start:end]
+		if i+len(ref) > len(b.line) {
+			return false
+		}
+		text := b.line[i : i+len(ref)]
+		if n.fold {
+			if !bytes.EqualFold(ref, text) {
+				return false
+			}
+		} else if !bytes.Equal(ref, text) {
+			return false
+		}
+		return k(i + len(ref))
+	}
+	bug()
+	return false
+}
+
+func (b *backtracker) matchConcat(subs []*pcreNode, i int, k func(int) bool) bool {
+	if len(subs) == 0 {
+		return k(i)
+	}
+	return b.match(subs[0], i, func(j int) bool {
+		return b.matchConcat(subs[1:], j, k)
+	})
+}
+
+// matchRepeat matches the remaining iterations of n, count of which were
+// matched already.
+func (b *backtracker) matchRepeat(n *pcreNode, count, i int, k func(int) bool) bool {
+	more := func() bool {
+		if n.max != -1 && count >= n.max {
+			return false
+		}
+		return b.match(n.sub[0], i, func(j int) bool {
+			// Iterations which match the empty string can only help to
+			// reach the minimum count.
+			if j == i && count >= n.min {
+				return false
+			}
+			return b.matchRepeat(n, count+1, j, k)
+		})
+	}
+	if n.lazy {
+		return count >= n.min && k(i) || more()
+	}
+	return more() || count >= n.min && k(i)
+}
+
+// matchRuneRepeat is matchRepeat for repetitions of a single rune, e.g.
+// [a-z ]*, which it matches without recursing once per iteration.
+func (b *backtracker) matchRuneRepeat(n *pcreNode, i int, k func(int) bool) bool {
+	re := n.sub[0].re
+	// next returns the position after the rune at j, or -1 if it does not
+	// match.
+	next := func(j int) int {
+		b.step()
+		if j >= len(b.line) {
+			return -1
+		}
+		r, w := utf8.DecodeRune(b.line[j:])
+		if !matchRune(re, r) {
+			return -1
+		}
+		return j + w
+	}
+	if n.lazy {
+		for count := 0; ; count++ {
+			if count >= n.min && k(i) {
+				return true
+			}
+			if count == n.max {
+				return false
+			}
+			if i = next(i); i == -1 {
+				return false
+			}
+		}
+	}
+	// Record the end of every iteration on b.ends (shared with the
+	// repetitions k matches) to backtrack through them.
+	base := len(b.ends)
+	b.ends = append(b.ends, i)
+	for count := 0; n.max == -1 || count < n.max; count++ {
+		j := next(i)
+		if j == -1 {
+			break
+		}
+		i = j
+		b.ends = append(b.ends, i)
+	}
+	matched := false
+	for count := len(b.ends) - base - 1; count >= n.min && !matched; count-- {
+		matched = k(b.ends[base+count])
+	}
+	b.ends = b.ends[:base]
+	return matched
+}
+
+// matchRune reports whether r matches re, which matches a single rune (see
+// parseSingle).
+func matchRune(re *syntax.Regexp, r rune) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Rune[0] == r {
+			return true
+		}
+		if re.Flags&syntax.FoldCase == 0 {
+			return false
+		}
+		for f := unicode.SimpleFold(re.Rune[0]); f != re.Rune[0]; f = unicode.SimpleFold(f) {
+			if f == r {
+				return true
+			}
+		}
+		return false
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= r && r <= re.Rune[i+1] {
+				return true
+			}
+		}
+		return false
+	case syntax.OpAnyChar:
+		return true
+	case syntax.OpAnyCharNotNL:
+		return r != '\n'
+	}
+	return false
+}
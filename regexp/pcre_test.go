@@ -0,0 +1,223 @@
+// vim:ts=4:sw=4:noexpandtab
+package regexp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pcreTests = []struct {
+	re    string
+	line  string
+	match bool
+}{
+	// Backreferences
+	{`(\w+) = \1`, "a = a;", true},
+	{`(\w+) = \1`, "a = b;", false},
+	{`(\w+) \1`, "hello hello", true},
+	{`(\w+) \1`, "hello world", false},
+	{`\b(\w+) \1\b`, "the the", true},
+	{`\b(\w+) \1\b`, "the then", false},
+	{`(a|b)\1`, "ab", false},
+	{`(a|b)\1`, "abb", true},
+	{`(a)|\1b`, "b", false},
+	{`(?<word>\w+)-\k<word>`, "foo-foo", true},
+	{`(?P<word>\w+)-(?P=word)`, "foo-bar", false},
+	{`(?'q'["'])x\k'q'`, `'x'`, true},
+	{`(["'])x\g{1}`, `"x'`, false},
+	{`(?i)(abc)\1`, "abcABC", true},
+	{`(abc)\1`, "abcABC", false},
+
+	// Lookarounds
+	{`foo(?=bar)`, "foobar", true},
+	{`foo(?=bar)`, "foobaz", false},
+	{`foo(?!bar)`, "foobar", false},
+	{`foo(?!bar)`, "foobaz", true},
+	{`(?<=\$)\d+`, "costs $42", true},
+	{`(?<=\$)\d+`, "costs 42", false},
+	{`(?<!un)signed`, "unsigned int", false},
+	{`(?<!un)signed`, "signed int", true},
+	{`(?<=ä)ö`, "äö", true},
+
+	// Atomic groups and possessive quantifiers
+	{`(?>a+)ab`, "aaab", false},
+	{`a++b`, "aaab", true},
+	{`a*+a`, "aaaa", false},
+
+	// Quantifiers
+	{`^a{2,3}$`, "aaa", true},
+	{`^a{2,3}$`, "aaaa", false},
+	{`^a{2}$`, "aa", true},
+	{`^(a?){3}$`, "a", true},
+	{`x{,2}`, "x{,2}", true},
+	{`<.+?>x`, "<a><b>x", true},
+
+	// Classes, escapes and flags
+	{`[]a]+c`, "]ac", true},
+	{`[[:digit:]x]+y`, "1x2y", true},
+	{`\d+\.\d+`, "version 1.2", true},
+	{`\x41\x{42}C`, "ABC", true},
+	{`\Qa.b\E`, "a.b", true},
+	{`\Qa.b\E`, "axb", false},
+	{`(?i)hello`, "HeLLo", true},
+	{`(?i:h)ello`, "Hello", true},
+	{`(?i:h)ello`, "HELLO", false},
+	{`^\pL+$`, "Grüße", true},
+}
+
+func TestPCRE(t *testing.T) {
+	for _, tt := range pcreTests {
+		re, err := CompilePCRE(tt.re)
+		if err != nil {
+			t.Errorf("CompilePCRE(%#q): %v", tt.re, err)
+			continue
+		}
+		match, err := re.pcre.matchLine([]byte(tt.line))
+		if err != nil {
+			t.Errorf("%#q on %q: %v", tt.re, tt.line, err)
+			continue
+		}
+		if match != tt.match {
+			t.Errorf("%#q on %q = %v, want %v", tt.re, tt.line, match, tt.match)
+		}
+		// The approximation must match every line the pattern matches.
+		if match && re.MatchString(tt.line, true, true) < 0 {
+			t.Errorf("approximation %s of %#q does not match %q", re.Syntax, tt.re, tt.line)
+		}
+	}
+}
+
+var pcreErrorTests = []string{
+	`(abc`,
+	`abc)`,
+	`\2(a)`,
+	`\k<nope>(?<yes>a)`,
+	`*a`,
+	`a**`,
+	`[abc`,
+	`(?<n>a)(?<n>b)`,
+	`(?U)a`,
+	`a\`,
+}
+
+func TestPCREErrors(t *testing.T) {
+	for _, expr := range pcreErrorTests {
+		if _, err := CompilePCRE(expr); err == nil {
+			t.Errorf("CompilePCRE(%#q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCompileQuery(t *testing.T) {
+	re, err := CompileQuery("pcre:(a)\\1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if re.pcre == nil {
+		t.Errorf("CompileQuery(pcre:…) did not compile in PCRE mode")
+	}
+	if _, err := CompileQuery("(a)\\1"); err == nil {
+		t.Errorf("CompileQuery without prefix accepted a backreference")
+	}
+}
+
+var pcreGrepTests = []struct {
+	re  string
+	s   string
+	out string
+}{
+	{`(\w)\1`, "abc\nhello\nx\n", "input:2:hello\n"},
+	{`foo(?!bar)`, "foobar\nfoobaz\nfoo\n", "input:2:foobaz\ninput:3:foo\n"},
+	{`(?<=int )x`, "int x;\nchar x;\nint x\n", "input:1:int x;\ninput:3:int x\n"},
+}
+
+func TestPCREGrep(t *testing.T) {
+	for i, tt := range pcreGrepTests {
+		re, err := CompilePCRE(tt.re)
+		if err != nil {
+			t.Errorf("CompilePCRE(%#q): %v", tt.re, err)
+			continue
+		}
+		g := Grep{Regexp: re}
+		var out string
+		for _, match := range g.Reader(strings.NewReader(tt.s), "input") {
+			out += fmt.Sprintf("%s:%d:%s\n", match.Path, match.Line, match.Context)
+		}
+		if out != tt.out || g.BudgetErr != nil {
+			t.Errorf("#%d: grep(%#q, %q) = %q, %v, want %q", i, tt.re, tt.s, out, g.BudgetErr, tt.out)
+		}
+	}
+}
+
+func TestPCREBudget(t *testing.T) {
+	// Catastrophic backtracking: the approximation ^(a+)+$ matches all
+	// lines of a’s, but verifying lines of five or more takes time
+	// exponential in their length.
+	re, err := CompilePCRE(`^(a+)+(?<!aaaaa)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "aaaa\n" + strings.Repeat("a", 40) + "\naaa\n"
+
+	g := Grep{Regexp: re, MaxSteps: 100000}
+	matches := g.Reader(strings.NewReader(input), "input")
+	be, ok := g.BudgetErr.(*BudgetError)
+	if !ok || be.Time {
+		t.Fatalf("BudgetErr = %v, want step budget exceeded", g.BudgetErr)
+	}
+	if len(matches) != 1 || matches[0].Line != 1 {
+		t.Errorf("matches before the budget was exceeded = %v, want line 1", matches)
+	}
+
+	g = Grep{Regexp: re, MaxTime: 10 * time.Millisecond}
+	start := time.Now()
+	g.Reader(strings.NewReader(input), "input")
+	if be, ok := g.BudgetErr.(*BudgetError); !ok || !be.Time {
+		t.Fatalf("BudgetErr = %v, want time budget exceeded", g.BudgetErr)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("verification took %v despite a time budget of 10ms", elapsed)
+	}
+
+	// The budget is per file.
+	matches = g.Reader(strings.NewReader("aaa\n"), "input")
+	if g.BudgetErr != nil || len(matches) != 1 {
+		t.Errorf("next file: %d matches, BudgetErr = %v, want 1 match and no error", len(matches), g.BudgetErr)
+	}
+}
+
+func TestPCRELongLine(t *testing.T) {
+	long := strings.Repeat("ab", 450000)
+	for _, tt := range []struct {
+		re    string
+		line  string
+		match bool
+		depth bool
+	}{
+		// Repetitions of a single rune are matched iteratively.
+		{`(a)(?!b)[a-z ]*q`, "ac" + long + "q", true, false},
+		{`(a)(?!b)[a-z ]*?q`, "ac" + long + "q", true, false},
+		{`^[ab]{2,}c`, long + "c", true, false},
+		// Other repetitions recurse, which is limited by maxDepth.
+		{`^(?:ab)*c`, long + "c", false, true},
+	} {
+		re, err := CompilePCRE(tt.re)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := Grep{Regexp: re, MaxSteps: 10000000}
+		matches := g.Reader(strings.NewReader(tt.line+"\n"), "input")
+		if got := len(matches) == 1; got != tt.match {
+			t.Errorf("grep(%#q): match = %v, want %v", tt.re, got, tt.match)
+		}
+		be, ok := g.BudgetErr.(*BudgetError)
+		if tt.depth && (!ok || !be.Depth) {
+			t.Errorf("grep(%#q): BudgetErr = %v, want recursion depth exceeded", tt.re, g.BudgetErr)
+		}
+		if !tt.depth && g.BudgetErr != nil {
+			t.Errorf("grep(%#q): BudgetErr = %v, want nil", tt.re, g.BudgetErr)
+		}
+	}
+}
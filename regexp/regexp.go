@@ -18,6 +18,9 @@ type Regexp struct {
 	Syntax *syntax.Regexp
 	expr   string // original expression
 	m      matcher
+	pcre   *backtracker // verifies matching lines in PCRE mode, see CompilePCRE
+
+	structural *structProg // matched by Grep in structural mode, see CompileStruct
 }
 
 // String returns the source text used to compile the regular expression.
@@ -32,6 +35,10 @@ func Compile(expr string) (*Regexp, error) {
 	if err != nil {
 		return nil, err
 	}
+	return compile(expr, re)
+}
+
+func compile(expr string, re *syntax.Regexp) (*Regexp, error) {
 	sre := re.Simplify()
 	prog, err := syntax.Compile(sre)
 	if err != nil {
@@ -57,3 +64,8 @@ func (r *Regexp) Match(b []byte, beginText, endText bool) (end int) {
 func (r *Regexp) MatchString(s string, beginText, endText bool) (end int) {
 	return r.m.matchString(s, beginText, endText)
 }
+
+// Stats returns statistics about the DFA state cache of r, see MaxDFAStates.
+func (r *Regexp) Stats() MatchStats {
+	return r.m.stats()
+}
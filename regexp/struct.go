@@ -0,0 +1,436 @@
+// vim:ts=4:sw=4:noexpandtab
+package regexp
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"regexp/syntax"
+	"unicode/utf8"
+)
+
+// Structural mode.
+//
+// Queries starting with StructPrefix are structural patterns: source text
+// with holes such as
+//
+//	memcpy(:[dst], :[src], sizeof(:[type]))
+//
+// A hole :[name] matches any text in which parentheses, brackets and braces
+// are balanced, e.g. “a[i]” or “f(x, y)”, but not “a, b” when followed by
+// “)” or “x)”. String and character literals ("…", '…') and comments (/* … */,
+// // …) are skipped as a whole, so their contents neither need to be balanced
+// nor can they end a hole. Matches never start inside of a string or
+// comment. A hole which occurs multiple times must match the same text each
+// time, except for the anonymous hole :[_]. A run of whitespace in the
+// pattern matches any (possibly empty) run of whitespace, including newlines,
+// so matches can span multiple lines. All other text matches literally.
+//
+// The RE2 approximation of a structural pattern (Regexp.Syntax) is its
+// literal text with holes and whitespace replaced by (?s:.*). It is only
+// used for the trigram query: Grep matches structural patterns against whole
+// files using a backtracking matcher, which is limited by Grep.MaxSteps and
+// Grep.MaxTime just like in PCRE mode.
+
+// StructPrefix marks queries in structural mode, see CompileQuery.
+const StructPrefix = "struct:"
+
+// Binding is the text a hole of a structural pattern matched.
+type Binding struct {
+	Name  string
+	Value string
+}
+
+type structOp uint8
+
+const (
+	sLiteral structOp = iota
+	sSpace
+	sHole
+)
+
+type structElem struct {
+	op   structOp
+	text string // sLiteral: the text, sHole: the name
+}
+
+// structProg is a parsed structural pattern.
+type structProg struct {
+	elems []structElem
+	names []string // hole names in order of first occurrence, without _
+}
+
+// CompileStruct parses a structural pattern. The Syntax of the returned
+// Regexp is its RE2 approximation, and Grep finds matches of the pattern
+// (see StructPrefix) instead of matching lines.
+func CompileStruct(pattern string) (*Regexp, error) {
+	prog, err := parseStruct(pattern)
+	if err != nil {
+		return nil, &syntax.Error{Code: syntax.ErrorCode(err.Error()), Expr: pattern}
+	}
+	r, err := compile(pattern, prog.approx())
+	if err != nil {
+		return nil, err
+	}
+	r.structural = prog
+	return r, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// holeName returns the name of the hole at the beginning of s and the length
+// of the hole, or an empty name if s does not start with a hole.
+func holeName(s string) (string, int) {
+	if len(s) < 3 || s[0] != ':' || s[1] != '[' {
+		return "", 0
+	}
+	end := 2
+	for end < len(s) && isWordByte(int(s[end])) {
+		end++
+	}
+	if end == 2 || end == len(s) || s[end] != ']' {
+		return "", 0
+	}
+	return s[2:end], end + 1
+}
+
+func parseStruct(pattern string) (*structProg, error) {
+	prog := &structProg{}
+	seen := make(map[string]bool)
+	var lit []byte
+	flush := func() {
+		if len(lit) > 0 {
+			prog.elems = append(prog.elems, structElem{op: sLiteral, text: string(lit)})
+			lit = nil
+		}
+	}
+	for i := 0; i < len(pattern); {
+		if name, n := holeName(pattern[i:]); n > 0 {
+			flush()
+			prog.elems = append(prog.elems, structElem{op: sHole, text: name})
+			if name != "_" && !seen[name] {
+				seen[name] = true
+				prog.names = append(prog.names, name)
+			}
+			i += n
+			continue
+		}
+		if isSpace(pattern[i]) {
+			flush()
+			for i < len(pattern) && isSpace(pattern[i]) {
+				i++
+			}
+			prog.elems = append(prog.elems, structElem{op: sSpace})
+			continue
+		}
+		lit = append(lit, pattern[i])
+		i++
+	}
+	flush()
+
+	// Leading and trailing whitespace is insignificant.
+	for len(prog.elems) > 0 && prog.elems[0].op == sSpace {
+		prog.elems = prog.elems[1:]
+	}
+	for len(prog.elems) > 0 && prog.elems[len(prog.elems)-1].op == sSpace {
+		prog.elems = prog.elems[:len(prog.elems)-1]
+	}
+	if len(prog.elems) == 0 {
+		return nil, fmt.Errorf("empty structural pattern")
+	}
+	// A hole at the beginning or end would (lazily) match the empty string,
+	// which is never what the user meant.
+	if prog.elems[0].op != sLiteral || prog.elems[len(prog.elems)-1].op != sLiteral {
+		return nil, fmt.Errorf("structural pattern must begin and end with text, not a hole")
+	}
+	for i := 1; i < len(prog.elems); i++ {
+		if prog.elems[i-1].op == sHole && prog.elems[i].op == sHole {
+			return nil, fmt.Errorf("adjacent holes :[%s]:[%s] are ambiguous", prog.elems[i-1].text, prog.elems[i].text)
+		}
+	}
+	return prog, nil
+}
+
+var anyText = &syntax.Regexp{
+	Op:    syntax.OpStar,
+	Flags: syntax.DotNL,
+	Sub: []*syntax.Regexp{
+		&syntax.Regexp{Op: syntax.OpAnyChar, Flags: syntax.DotNL},
+	},
+}
+
+// approx returns the RE2 approximation of the pattern.
+func (prog *structProg) approx() *syntax.Regexp {
+	re := &syntax.Regexp{Op: syntax.OpConcat}
+	for _, e := range prog.elems {
+		if e.op == sLiteral {
+			re.Sub = append(re.Sub, &syntax.Regexp{Op: syntax.OpLiteral, Rune: []rune(e.text)})
+			continue
+		}
+		// Collapse holes and the whitespace surrounding them.
+		if last := len(re.Sub) - 1; re.Sub[last] != anyText {
+			re.Sub = append(re.Sub, anyText)
+		}
+	}
+	return re
+}
+
+// structMatch is a match of a structural pattern in a file.
+type structMatch struct {
+	start, end int
+	bindings   []Binding
+}
+
+// structMatcher finds the matches of a structProg in a file.
+type structMatcher struct {
+	budget
+
+	prog  *structProg
+	src   []byte
+	holes map[string][2]int // start and end of the bound holes
+}
+
+// skipUnit returns the end of the syntactic unit starting at i: a balanced
+// group, a string or character literal, a comment or a single character.
+// It returns -1 if src[i] is a closing delimiter or an opening delimiter
+// without matching closing delimiter, i.e. a hole cannot extend past i.
+func (m *structMatcher) skipUnit(i int) int {
+	src := m.src
+	m.step()
+	switch c := src[i]; c {
+	case '(', '[', '{':
+		var closing byte = ')'
+		if c == '[' {
+			closing = ']'
+		} else if c == '{' {
+			closing = '}'
+		}
+		for j := i + 1; j < len(src); {
+			if src[j] == closing {
+				return j + 1
+			}
+			next := m.skipUnit(j)
+			if next == -1 {
+				return -1
+			}
+			j = next
+		}
+		return -1
+
+	case ')', ']', '}':
+		return -1
+
+	case '"', '\'':
+		return m.skipString(i)
+
+	case '/':
+		return m.skipComment(i)
+	}
+	_, w := utf8.DecodeRune(src[i:])
+	return i + w
+}
+
+// skipString returns the end of the string or character literal starting at
+// i. Quotes without closing quote on the same line (e.g. the apostrophe in
+// Rust lifetimes or in prose) are treated as single characters.
+func (m *structMatcher) skipString(i int) int {
+	src := m.src
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '\n':
+			return i + 1
+		case src[i]:
+			return j + 1
+		}
+	}
+	return i + 1
+}
+
+// skipComment returns the end of the comment starting at i, or i+1 if there
+// is no comment at i.
+func (m *structMatcher) skipComment(i int) int {
+	src := m.src
+	if i+1 >= len(src) {
+		return i + 1
+	}
+	switch src[i+1] {
+	case '/':
+		if end := bytes.IndexByte(src[i:], '\n'); end != -1 {
+			return i + end
+		}
+		return len(src)
+	case '*':
+		if end := bytes.Index(src[i+2:], []byte("*/")); end != -1 {
+			return i + 2 + end + 2
+		}
+		return len(src)
+	}
+	return i + 1
+}
+
+func (m *structMatcher) isWordAt(i int) bool {
+	return i >= 0 && i < len(m.src) && isWordByte(int(m.src[i]))
+}
+
+// match returns the end of the match of the elements starting at elems[k]
+// at position i, or -1.
+func (m *structMatcher) match(k, i int) int {
+	m.step()
+	elems := m.prog.elems
+	if k == len(elems) {
+		// Like the first literal (see find), the last literal must not
+		// end in the middle of a word.
+		if m.isWordAt(i-1) && m.isWordAt(i) {
+			return -1
+		}
+		return i
+	}
+	switch e := elems[k]; e.op {
+	case sLiteral:
+		if !bytes.HasPrefix(m.src[i:], []byte(e.text)) {
+			return -1
+		}
+		return m.match(k+1, i+len(e.text))
+
+	case sSpace:
+		for i < len(m.src) && isSpace(m.src[i]) {
+			i++
+		}
+		return m.match(k+1, i)
+
+	default: // sHole
+		if bound, ok := m.holes[e.text]; ok {
+			value := m.src[bound[0]:bound[1]]
+			if !bytes.HasPrefix(m.src[i:], value) {
+				return -1
+			}
+			return m.match(k+1, i+len(value))
+		}
+		// Holes match lazily, i.e. the shortest balanced text for which
+		// the rest of the pattern matches.
+		for j := i; j != -1; {
+			if e.text != "_" {
+				m.holes[e.text] = [2]int{i, j}
+			}
+			if end := m.match(k+1, j); end != -1 {
+				return end
+			}
+			if j == len(m.src) {
+				break
+			}
+			j = m.skipUnit(j)
+		}
+		delete(m.holes, e.text)
+		return -1
+	}
+}
+
+// find returns all non-overlapping matches in src. It returns a *BudgetError
+// (and the matches found so far) if the budget set by reset is exhausted.
+func (m *structMatcher) find(src []byte) (matches []structMatch, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = m.budget.recover(r)
+		}
+	}()
+	m.src = src
+	first := []byte(m.prog.elems[0].text)
+	for i := 0; i < len(src); {
+		if bytes.HasPrefix(src[i:], first) && !(m.isWordAt(i-1) && m.isWordAt(i)) {
+			m.holes = make(map[string][2]int)
+			if end := m.match(0, i); end != -1 {
+				match := structMatch{start: i, end: end}
+				for _, name := range m.prog.names {
+					bound := m.holes[name]
+					match.bindings = append(match.bindings, Binding{
+						Name:  name,
+						Value: string(src[bound[0]:bound[1]]),
+					})
+				}
+				matches = append(matches, match)
+				i = end
+				continue
+			}
+		}
+		// Matches must not start inside of strings or comments, so skip
+		// those as a whole, but step into groups.
+		switch src[i] {
+		case '"', '\'':
+			i = m.skipString(i)
+		case '/':
+			i = m.skipComment(i)
+		default:
+			_, w := utf8.DecodeRune(src[i:])
+			i += w
+		}
+	}
+	return matches, nil
+}
+
+// lineAround returns the line (without newline) containing src[i] and the
+// offsets of its start and end.
+func lineAround(src []byte, i int) (line []byte, start, end int) {
+	start = bytes.LastIndexByte(src[:i], '\n') + 1
+	end = len(src)
+	if idx := bytes.IndexByte(src[start:], '\n'); idx != -1 {
+		end = start + idx
+	}
+	return src[start:end], start, end
+}
+
+// structReader is Grep.Reader for structural patterns: it reads the whole
+// file and returns one Match per match of the pattern, on the line where
+// the match starts, with the bindings of the holes.
+func (g *Grep) structReader(r io.Reader, name string) []Match {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		fmt.Fprintf(g.Stderr, "%s: %v\n", name, err)
+		return nil
+	}
+	m := structMatcher{prog: g.Regexp.structural}
+	m.reset(g.MaxSteps, g.MaxTime)
+	found, err := m.find(src)
+	if err != nil {
+		g.BudgetErr = err
+	}
+	var result []Match
+	lineno, counted := 1, 0
+	for _, sm := range found {
+		g.Match = true
+		lineno += countNL(src[counted:sm.start])
+		counted = sm.start
+		line, start, end := lineAround(src, sm.start)
+		match := Match{
+			Path:     name,
+			Line:     lineno,
+			Context:  html.EscapeString(string(line)),
+			Bindings: sm.bindings,
+		}
+		if start > 0 {
+			var p1 []byte
+			p1, start, _ = lineAround(src, start-1)
+			match.Ctxp1 = html.EscapeString(string(p1))
+			if start > 0 {
+				p2, _, _ := lineAround(src, start-1)
+				match.Ctxp2 = html.EscapeString(string(p2))
+			}
+		}
+		if end+1 < len(src) {
+			var n1 []byte
+			n1, _, end = lineAround(src, end+1)
+			match.Ctxn1 = html.EscapeString(string(n1))
+			if end+1 < len(src) {
+				n2, _, _ := lineAround(src, end+1)
+				match.Ctxn2 = html.EscapeString(string(n2))
+			}
+		}
+		result = append(result, match)
+	}
+	return result
+}
@@ -0,0 +1,169 @@
+// vim:ts=4:sw=4:noexpandtab
+package regexp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var structTests = []struct {
+	pattern string
+	src     string
+	want    []string // matched text followed by the bindings
+}{
+	{
+		`memcpy(:[a], :[b], sizeof(:[c]))`,
+		"memcpy(dst, src, sizeof(struct foo));",
+		[]string{"memcpy(dst, src, sizeof(struct foo))", "a=dst", "b=src", "c=struct foo"},
+	},
+	// Holes match balanced delimiters.
+	{
+		`memcpy(:[a], :[b], sizeof(:[c]))`,
+		"memcpy(buf[f(i, j)], (char *)p, sizeof(x[0]));",
+		[]string{"memcpy(buf[f(i, j)], (char *)p, sizeof(x[0]))", "a=buf[f(i, j)]", "b=(char *)p", "c=x[0]"},
+	},
+	// Whitespace matches any whitespace, including newlines.
+	{
+		`memcpy(:[a], :[b], sizeof(:[c]))`,
+		"memcpy(a,\n       b,sizeof ( c ));",
+		nil,
+	},
+	{
+		`memcpy(:[a], :[b], sizeof(:[c]))`,
+		"memcpy(a,\n       b,sizeof(c));",
+		[]string{"memcpy(a,\n       b,sizeof(c))", "a=a", "b=b", "c=c"},
+	},
+	// Strings and comments are skipped as a whole.
+	{
+		`printf(:[fmt], :[arg])`,
+		`printf("(%d, %d)", x);`,
+		[]string{`printf("(%d, %d)", x)`, `fmt="(%d, %d)"`, "arg=x"},
+	},
+	{
+		`f(:[x])`,
+		"f(a /* ) */ + b);",
+		[]string{"f(a /* ) */ + b)", "x=a /* ) */ + b"},
+	},
+	{
+		`f(:[x])`,
+		"/* f(a) */ s = \"f(b)\"; // f(c)\nf(d);",
+		[]string{"f(d)", "x=d"},
+	},
+	// Unbalanced text cannot be matched.
+	{
+		`f(:[x])`,
+		"f(a, (b);",
+		nil,
+	},
+	// Repeated holes match the same text, except for :[_].
+	{
+		`if (:[a] == :[a])`,
+		"if (x == y) {} if (p->q == p->q) {}",
+		[]string{"if (p->q == p->q)", "a=p->q"},
+	},
+	{
+		`g(:[_], :[_])`,
+		"g(1, 2)",
+		[]string{"g(1, 2)"},
+	},
+	// Literals do not match parts of words.
+	{
+		`free(:[p])`,
+		"xfree(a); free(b);",
+		[]string{"free(b)", "p=b"},
+	},
+	// Apostrophes without closing quote are not strings.
+	{
+		`f(:[x])`,
+		"// don't\nf(a);",
+		[]string{"f(a)", "x=a"},
+	},
+}
+
+func TestStruct(t *testing.T) {
+	for _, tt := range structTests {
+		re, err := CompileStruct(tt.pattern)
+		if err != nil {
+			t.Errorf("CompileStruct(%#q): %v", tt.pattern, err)
+			continue
+		}
+		m := structMatcher{prog: re.structural}
+		found, err := m.find([]byte(tt.src))
+		if err != nil {
+			t.Errorf("%#q on %q: %v", tt.pattern, tt.src, err)
+			continue
+		}
+		var got []string
+		for _, match := range found {
+			got = append(got, tt.src[match.start:match.end])
+			for _, b := range match.bindings {
+				got = append(got, b.Name+"="+b.Value)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%#q on %q = %q, want %q", tt.pattern, tt.src, got, tt.want)
+		}
+		// The approximation must match every match of the pattern (the
+		// DFA only matches single lines, though).
+		for _, match := range found {
+			if strings.Contains(tt.src[match.start:match.end], "\n") {
+				continue
+			}
+			if re.MatchString(tt.src[match.start:match.end], true, true) < 0 {
+				t.Errorf("approximation %s of %#q does not match %q", re.Syntax, tt.pattern, tt.src[match.start:match.end])
+			}
+		}
+	}
+}
+
+var structErrorTests = []string{
+	``,
+	`   `,
+	`:[a]`,
+	`:[a])`,
+	`f(:[a]`,
+	`f(:[a]:[b])`,
+}
+
+func TestStructErrors(t *testing.T) {
+	for _, pattern := range structErrorTests {
+		if _, err := CompileStruct(pattern); err == nil {
+			t.Errorf("CompileStruct(%#q) succeeded, want error", pattern)
+		}
+	}
+	if _, err := CompileStruct(`f(:[a-b])`); err != nil {
+		t.Errorf("CompileStruct with an invalid hole name: %v, want literal text", err)
+	}
+}
+
+func TestStructGrep(t *testing.T) {
+	re, err := CompileQuery("struct:memcpy(:[a], :[b], :[n])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "int main() {\n\tmemcpy(a,\n\t       b, 3);\n\treturn 0;\n}\n"
+	g := Grep{Regexp: re}
+	var out string
+	for _, match := range g.Reader(strings.NewReader(input), "input") {
+		out += fmt.Sprintf("%s:%d:%s|%s|%s|%s|%v\n", match.Path, match.Line, match.Ctxp1, match.Context, match.Ctxn1, match.Ctxn2, match.Bindings)
+	}
+	want := "input:2:int main() {|\tmemcpy(a,|\t       b, 3);|\treturn 0;|[{a a} {b b} {n 3}]\n"
+	if out != want || g.BudgetErr != nil {
+		t.Errorf("grep = %q, %v, want %q", out, g.BudgetErr, want)
+	}
+}
+
+func TestStructBudget(t *testing.T) {
+	re, err := CompileStruct(`f(:[a], :[b], :[c], :[d]) x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "f(" + strings.Repeat("1, ", 200) + "1) y\n"
+	g := Grep{Regexp: re, MaxSteps: 10000}
+	g.Reader(strings.NewReader(input), "input")
+	if be, ok := g.BudgetErr.(*BudgetError); !ok || be.Time {
+		t.Fatalf("BudgetErr = %v, want step budget exceeded", g.BudgetErr)
+	}
+}
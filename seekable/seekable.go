@@ -0,0 +1,453 @@
+// vim:ts=4:sw=4:noexpandtab
+
+// Package seekable implements a compressed file format which allows random
+// access. The uncompressed data is split into frames of FrameSize bytes, each
+// of which is compressed independently using DEFLATE. A frame index at the end
+// of the file maps uncompressed offsets to frames, so that reading a range of
+// a file only requires decompressing the frames covering that range.
+//
+// The file format is:
+//
+//	"dcs seekable 1\n"
+//	[frame]*
+//	[index]
+//	[trailer]
+//
+// Each frame is a raw DEFLATE stream. The index contains one entry per frame:
+// the compressed and uncompressed length of the frame as big-endian uint32.
+// The trailer consists of the number of frames as big-endian uint32 and the
+// number of lines (see Reader.Lines) as big-endian uint64, followed by
+// "\ndcs seekable trailr\n".
+//
+// Files in this format are stored next to where the uncompressed file would
+// be, with Suffix appended to their name. OpenFile and ReadFile transparently
+// read either variant.
+package seekable
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Suffix is appended to the name of compressed files.
+const Suffix = ".dcsz"
+
+// FrameSize is the number of uncompressed bytes per frame.
+const FrameSize = 64 << 10
+
+const (
+	magic        = "dcs seekable 1\n"
+	trailerMagic = "\ndcs seekable trailr\n"
+	trailerSize  = 4 + 8 + len(trailerMagic)
+	entrySize    = 4 + 4
+)
+
+var (
+	// Updated atomically, read by compressionRatio.
+	bytesIn  uint64
+	bytesOut uint64
+
+	uncompressedBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "seekable_uncompressed_bytes",
+			Help: "Uncompressed bytes written to compressed files.",
+		})
+
+	compressedBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "seekable_compressed_bytes",
+			Help: "Compressed bytes written, including frame indexes.",
+		})
+
+	compressionRatio = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "seekable_compression_ratio",
+			Help: "Compressed bytes divided by uncompressed bytes of all files written by this process.",
+		},
+		func() float64 {
+			in := atomic.LoadUint64(&bytesIn)
+			if in == 0 {
+				return 0
+			}
+			return float64(atomic.LoadUint64(&bytesOut)) / float64(in)
+		})
+
+	decompressionDurations = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "seekable_decompression_durations_ms",
+			Help: "Time spent decompressing frames of a single file in milliseconds.",
+			Buckets: []float64{
+				0.1, 0.25, 0.5, 1, 2, 3, 4, 5, 10, 25, 50, 100, 250, 500, 1000,
+			},
+		})
+)
+
+func init() {
+	prometheus.MustRegister(uncompressedBytes)
+	prometheus.MustRegister(compressedBytes)
+	prometheus.MustRegister(compressionRatio)
+	prometheus.MustRegister(decompressionDurations)
+}
+
+// Writer compresses everything written to it into frames. Close must be called
+// to write the frame index.
+type Writer struct {
+	w       io.Writer
+	frame   []byte
+	index   []byte
+	frames  uint32
+	in, out uint64
+	buf     bytes.Buffer
+	fw      *flate.Writer
+	err     error
+
+	// newlines and last track the lines of the uncompressed data.
+	newlines uint64
+	last     byte
+}
+
+// NewWriter returns a Writer writing compressed data to w.
+func NewWriter(w io.Writer) *Writer {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &Writer{
+		w:     w,
+		frame: make([]byte, 0, FrameSize),
+		fw:    fw,
+	}
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	var n int
+	n, w.err = w.w.Write(p)
+	w.out += uint64(n)
+}
+
+func (w *Writer) flushFrame() {
+	if len(w.frame) == 0 || w.err != nil {
+		return
+	}
+	if w.out == 0 {
+		w.write([]byte(magic))
+	}
+	w.buf.Reset()
+	w.fw.Reset(&w.buf)
+	if _, err := w.fw.Write(w.frame); err != nil {
+		w.err = err
+		return
+	}
+	if err := w.fw.Close(); err != nil {
+		w.err = err
+		return
+	}
+	w.write(w.buf.Bytes())
+	var entry [entrySize]byte
+	binary.BigEndian.PutUint32(entry[0:4], uint32(w.buf.Len()))
+	binary.BigEndian.PutUint32(entry[4:8], uint32(len(w.frame)))
+	w.index = append(w.index, entry[:]...)
+	w.frames++
+	w.in += uint64(len(w.frame))
+	w.frame = w.frame[:0]
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 && w.err == nil {
+		n := FrameSize - len(w.frame)
+		if n > len(p) {
+			n = len(p)
+		}
+		w.frame = append(w.frame, p[:n]...)
+		w.newlines += uint64(bytes.Count(p[:n], []byte{'\n'}))
+		if n > 0 {
+			w.last = p[n-1]
+		}
+		p = p[n:]
+		written += n
+		if len(w.frame) == FrameSize {
+			w.flushFrame()
+		}
+	}
+	return written, w.err
+}
+
+// Close writes the last frame and the frame index. It does not close the
+// underlying io.Writer.
+func (w *Writer) Close() error {
+	w.flushFrame()
+	if w.out == 0 {
+		w.write([]byte(magic))
+	}
+	w.write(w.index)
+	lines := w.newlines
+	if w.in > 0 && w.last != '\n' {
+		lines++
+	}
+	var trailer [trailerSize]byte
+	binary.BigEndian.PutUint32(trailer[0:4], w.frames)
+	binary.BigEndian.PutUint64(trailer[4:12], lines)
+	copy(trailer[12:], trailerMagic)
+	w.write(trailer[:])
+	if w.err != nil {
+		return w.err
+	}
+	atomic.AddUint64(&bytesIn, w.in)
+	atomic.AddUint64(&bytesOut, w.out)
+	uncompressedBytes.Add(float64(w.in))
+	compressedBytes.Add(float64(w.out))
+	return nil
+}
+
+// Reader provides random and sequential access to a compressed file.
+type Reader struct {
+	f *os.File
+
+	// offsets[i] is the uncompressed offset of frame i, offsets[len(frames)]
+	// is the uncompressed size.
+	offsets []int64
+	// coffsets[i] is the file offset of frame i.
+	coffsets []int64
+	// lines is the number of lines stored in the trailer, see Lines.
+	lines int64
+
+	// The most recently decompressed frame.
+	cached int
+	frame  []byte
+	fr     io.ReadCloser
+
+	pos          int64
+	decompressed time.Duration
+}
+
+// Open opens the compressed file name (including Suffix).
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return r, nil
+}
+
+var errCorrupt = errors.New("corrupt compressed file")
+
+func newReader(f *os.File) (*Reader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < int64(len(magic)+trailerSize) {
+		return nil, errCorrupt
+	}
+	var trailer [trailerSize]byte
+	if _, err := f.ReadAt(trailer[:], size-int64(trailerSize)); err != nil {
+		return nil, err
+	}
+	if string(trailer[12:]) != trailerMagic {
+		return nil, errCorrupt
+	}
+	frames := int64(binary.BigEndian.Uint32(trailer[0:4]))
+	indexOffset := size - int64(trailerSize) - frames*entrySize
+	if indexOffset < int64(len(magic)) {
+		return nil, errCorrupt
+	}
+	index := make([]byte, frames*entrySize)
+	if _, err := f.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	r := &Reader{
+		f:        f,
+		offsets:  make([]int64, frames+1),
+		coffsets: make([]int64, frames+1),
+		lines:    int64(binary.BigEndian.Uint64(trailer[4:12])),
+		cached:   -1,
+	}
+	r.coffsets[0] = int64(len(magic))
+	for i := int64(0); i < frames; i++ {
+		entry := index[i*entrySize:]
+		r.coffsets[i+1] = r.coffsets[i] + int64(binary.BigEndian.Uint32(entry[0:4]))
+		r.offsets[i+1] = r.offsets[i] + int64(binary.BigEndian.Uint32(entry[4:8]))
+	}
+	if r.coffsets[frames] != indexOffset {
+		return nil, errCorrupt
+	}
+	return r, nil
+}
+
+// Size returns the uncompressed size of the file.
+func (r *Reader) Size() int64 {
+	return r.offsets[len(r.offsets)-1]
+}
+
+// Lines returns the number of lines of the uncompressed file, where a
+// trailing line without newline counts as a line. It does not decompress
+// anything.
+func (r *Reader) Lines() int64 {
+	return r.lines
+}
+
+func (r *Reader) loadFrame(i int) error {
+	if r.cached == i {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		r.decompressed += time.Since(start)
+	}()
+	section := io.NewSectionReader(r.f, r.coffsets[i], r.coffsets[i+1]-r.coffsets[i])
+	if r.fr == nil {
+		r.fr = flate.NewReader(section)
+	} else if err := r.fr.(flate.Resetter).Reset(section, nil); err != nil {
+		return err
+	}
+	n := int(r.offsets[i+1] - r.offsets[i])
+	if cap(r.frame) < n {
+		r.frame = make([]byte, n)
+	}
+	r.frame = r.frame[:n]
+	r.cached = -1
+	if _, err := io.ReadFull(r.fr, r.frame); err != nil {
+		return errCorrupt
+	}
+	r.cached = i
+	return nil
+}
+
+// ReadAt implements io.ReaderAt. Only the frames covering [off, off+len(p))
+// are decompressed.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("seekable.Reader.ReadAt: negative offset")
+	}
+	n := 0
+	for len(p) > 0 {
+		if off >= r.Size() {
+			return n, io.EOF
+		}
+		// The frame containing off is the last frame starting at or before off.
+		i := sort.Search(len(r.offsets), func(i int) bool { return r.offsets[i] > off }) - 1
+		if err := r.loadFrame(i); err != nil {
+			return n, err
+		}
+		copied := copy(p, r.frame[off-r.offsets[i]:])
+		p = p[copied:]
+		off += int64(copied)
+		n += copied
+	}
+	return n, nil
+}
+
+// Read implements io.Reader for sequentially reading the whole file.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.Size() {
+		return 0, io.EOF
+	}
+	if remaining := r.Size() - r.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file and records the time spent decompressing.
+func (r *Reader) Close() error {
+	if r.decompressed > 0 {
+		decompressionDurations.Observe(float64(r.decompressed) / float64(time.Millisecond))
+	}
+	return r.f.Close()
+}
+
+// OpenFile opens the file name for reading. If name does not exist, but a
+// compressed variant (name + Suffix) does, the compressed variant is opened.
+func OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	r, cerr := Open(name + Suffix)
+	if cerr != nil {
+		if os.IsNotExist(cerr) {
+			// Report the error for the name the caller used.
+			return nil, err
+		}
+		return nil, cerr
+	}
+	return r, nil
+}
+
+// File is a file opened by OpenReaderAt.
+type File interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the (uncompressed) size of the file.
+	Size() int64
+}
+
+type plainFile struct {
+	*os.File
+	size int64
+}
+
+func (f *plainFile) Size() int64 {
+	return f.size
+}
+
+// OpenReaderAt is like OpenFile, but for random access. Of compressed files,
+// only the frames covering the ranges which are read are decompressed.
+func OpenReaderAt(name string) (File, error) {
+	f, err := OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := f.(*Reader); ok {
+		return r, nil
+	}
+	plain := f.(*os.File)
+	fi, err := plain.Stat()
+	if err != nil {
+		plain.Close()
+		return nil, err
+	}
+	return &plainFile{File: plain, size: fi.Size()}, nil
+}
+
+// ReadFile is like ioutil.ReadFile, but transparently reads compressed files
+// (see OpenFile).
+func ReadFile(name string) ([]byte, error) {
+	f, err := OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if r, ok := f.(*Reader); ok {
+		b := make([]byte, r.Size())
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return ioutil.ReadAll(f)
+}
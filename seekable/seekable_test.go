@@ -0,0 +1,180 @@
+package seekable
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCompressed(t *testing.T, name string, contents []byte) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := NewWriter(f)
+	// Write in odd-sized chunks to exercise frame boundaries.
+	for b := contents; len(b) > 0; {
+		n := 1000
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := w.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testContents(size int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"func ", "main", "(", ")", " {\n", "}\n", "\treturn ", "nil", "err"}
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rnd.Intn(len(words))])
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int{0, 1, FrameSize - 1, FrameSize, 3*FrameSize + 17} {
+		contents := testContents(size)
+		name := filepath.Join(dir, "file.c")
+		writeCompressed(t, name+Suffix, contents)
+
+		got, err := ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, contents) {
+			t.Errorf("size %d: ReadFile returned different contents", size)
+		}
+
+		r, err := Open(name + Suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := r.Size(), int64(size); got != want {
+			t.Errorf("size %d: Size() = %d, want %d", size, got, want)
+		}
+		lines := int64(bytes.Count(contents, []byte{'\n'}))
+		if size > 0 && contents[size-1] != '\n' {
+			lines++
+		}
+		if got := r.Lines(); got != lines {
+			t.Errorf("size %d: Lines() = %d, want %d", size, got, lines)
+		}
+		// Read ranges crossing frame boundaries.
+		for _, off := range []int64{0, FrameSize - 5, FrameSize, 2*FrameSize + 3} {
+			if off >= int64(size) {
+				continue
+			}
+			end := off + 100
+			if end > int64(size) {
+				end = int64(size)
+			}
+			p := make([]byte, end-off)
+			n, err := r.ReadAt(p, off)
+			if err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(p[:n], contents[off:end]) {
+				t.Errorf("size %d: ReadAt(off=%d) returned different contents", size, off)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestOpenFileUncompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "plain.c")
+	if err := ioutil.WriteFile(name, []byte("int main;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "int main;\n" {
+		t.Errorf("ReadFile(%q) = %q", name, got)
+	}
+
+	if _, err := ReadFile(filepath.Join(dir, "missing.c")); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(missing) = %v, want a not exist error", err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "corrupt.c"+Suffix)
+	if err := ioutil.WriteFile(name, []byte("dcs seekable 1\ngarbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name); err == nil {
+		t.Errorf("Open(%q) unexpectedly succeeded", name)
+	}
+}
+
+func TestOpenReaderAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seekable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := testContents(2*FrameSize + 17)
+	if err := ioutil.WriteFile(filepath.Join(dir, "plain.c"), contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeCompressed(t, filepath.Join(dir, "compressed.c"+Suffix), contents)
+
+	for _, name := range []string{"plain.c", "compressed.c"} {
+		f, err := OpenReaderAt(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f.Size(), int64(len(contents)); got != want {
+			t.Errorf("%s: Size() = %d, want %d", name, got, want)
+		}
+		off := int64(FrameSize + 3)
+		p := make([]byte, 100)
+		if _, err := f.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, contents[off:off+100]) {
+			t.Errorf("%s: ReadAt(off=%d) returned different contents", name, off)
+		}
+		if r, ok := f.(*Reader); ok && r.cached != 1 {
+			t.Errorf("%s: decompressed frame %d, want 1", name, r.cached)
+		}
+		f.Close()
+	}
+
+	if _, err := OpenReaderAt(filepath.Join(dir, "missing.c")); !os.IsNotExist(err) {
+		t.Errorf("OpenReaderAt(missing) = %v, want a not exist error", err)
+	}
+}
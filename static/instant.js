@@ -142,8 +142,34 @@ function addSearchResult(results, result) {
     var rest = result.path.substring(delimiter);
 
     // Append the new search result, then sort the results.
-    var el = $('<li data-ranking="' + result.ranking + '"><a onclick="track(event);" href="/show?file=' + encodeURIComponent(result.path) + '&line=' + result.line + '"><code><strong>' + sourcePackage + '</strong>' + escapeForHTML(rest) + '</code></a><br><pre>' + context + '</pre><small>PathRank: ' + result.pathrank + ', Final: ' + result.ranking + '</small></li>');
+    // With dedup:yes, identical files (in other packages) are collapsed into
+    // a single result.
+    var duplicates = '';
+    if (result.duplicates) {
+        var dupPackages = [];
+        $.each(result.duplicates, function(idx, path) {
+            var pkg = path.substring(0, path.indexOf("/"));
+            if ($.inArray(pkg, dupPackages) === -1) {
+                dupPackages.push(pkg);
+            }
+        });
+        duplicates = '<small>Identical file also in: ' + escapeForHTML(dupPackages.join(", ")) + '</small><br>';
+    }
+
+    // For struct: queries, show what the holes of the pattern matched.
+    var bindings = '';
+    if (result.bindings) {
+        bindings = '<small>' + $.map(result.bindings, function(b) {
+            return ':[' + escapeForHTML(b.name) + '] = <code>' + escapeForHTML(b.value) + '</code>';
+        }).join(', ') + '</small><br>';
+    }
+
+    var el = $('<li data-ranking="' + result.ranking + '"><a onclick="track(event);" href="/show?file=' + encodeURIComponent(result.path) + '&line=' + result.line + '"><code><strong>' + sourcePackage + '</strong>' + escapeForHTML(rest) + '</code></a><br><pre>' + context + '</pre>' + bindings + duplicates + '<small>PathRank: ' + result.pathrank + ', Final: ' + result.ranking + ' <a class="expand" href="#">more context</a></small></li>');
     $(el).children('a').attr('data-path', result.path).attr('data-line', result.line);
+    $(el).find('a.expand').click(function(ev) {
+        ev.preventDefault();
+        expandContext($(el), result, 10);
+    });
     results.append(el);
     $('ul#results').append($('ul#results>li').detach().sort(function(a, b) {
         return b.getAttribute('data-ranking') - a.getAttribute('data-ranking');
@@ -159,6 +185,26 @@ function addSearchResult(results, result) {
     }
 }
 
+// Replaces the context of a search result with the numContext lines before and
+// after the matching line, as returned by /context.
+function expandContext(el, result, numContext) {
+    $.ajax('/context?file=' + encodeURIComponent(result.path) + '&line=' + result.line + '&context=' + numContext)
+        .done(function(data, textStatus, xhr) {
+            // NB: The lines are already HTML-escaped by the server.
+            var context = $.map(data.Lines, function(line, idx) {
+                if (data.FirstLine + idx == result.line) {
+                    return '<strong>' + line + '</strong>';
+                }
+                return line;
+            });
+            el.children('pre').html(context.join("<br>"));
+            el.find('a.expand').remove();
+        })
+        .fail(function(xhr, textStatus, errorThrown) {
+            error(false, false, 'expand', 'Loading more context failed: ' + errorThrown);
+        });
+}
+
 function loadPage(nr) {
     // There’s pagination at the top and at the bottom of the page. In case the
     // user used the bottom one, it makes sense to scroll back to the top. In
@@ -428,6 +474,28 @@ function onEvent(e) {
         }
         break;
 
+        case "coverage":
+        // Not fatal: the query continues on the remaining backends.
+        error(false, false, msg.Type, "The results will be incomplete: only " + msg.BackendsQueried + " of " + msg.BackendsTotal + " Debian Code Search servers are okay right now.");
+        break;
+
+        case "ranking":
+        // Only worth mentioning when the query selected a ranking profile
+        // (see the rank: keyword) or overrode weights.
+        if (msg.Profile != "default" || msg.Overridden) {
+            var weights = $.map(msg.Weights, function(value, name) {
+                return name + "=" + value;
+            });
+            error(false, false, msg.Type, "Results are ranked with the “" + msg.Profile + "” ranking profile" + (msg.Overridden ? " (with overrides)" : "") + ": " + weights.join(", ") + ".");
+        }
+        break;
+
+        case "budgetexceeded":
+        // Not fatal: only the remainder of this file was not searched. The
+        // warning is shown once, no matter how many files are affected.
+        error(false, false, msg.Type, "The results may be incomplete: verifying the matches of your pcre: query took too long in some files (e.g. " + msg.Path + ").");
+        break;
+
         case "error":
         if (msg.ErrorType == "backendunavailable") {
             error(false, true, msg.ErrorType, "The results may be incomplete, not all Debian Code Search servers are okay right now.");
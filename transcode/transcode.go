@@ -0,0 +1,202 @@
+// vim:ts=4:sw=4:noexpandtab
+// Package transcode detects the encoding of source files which are not valid
+// UTF-8 (e.g. Latin-1, Shift-JIS or UTF-16, common in older packages) and
+// converts them to UTF-8, so that they can be indexed and searched.
+//
+// The importer keeps such files as they are and stores their UTF-8
+// transcoding next to them, with Suffix appended to the file name. The
+// detected encodings of the transcoded files of a package are stored next to
+// its unpacked directory, with EncodingsSuffix appended to the package name
+// (see WriteFile).
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Suffix is appended to the name of a file to form the name of its UTF-8
+// transcoding. Upstream files can have names ending in Suffix, too, so only
+// the files listed in the encodings of a package were transcoded.
+const Suffix = ".utf-8"
+
+// EncodingsSuffix is appended to the package name to form the name of the
+// file containing the encodings of the transcoded files of the package.
+const EncodingsSuffix = ".encodings"
+
+// UTF8 is the name Detect returns for valid UTF-8.
+const UTF8 = "utf-8"
+
+// encodings maps the names Detect returns to their decoders, in the order in
+// which Detect tries them (after UTF-16, which is recognized by its byte
+// order mark or its NUL bytes).
+var encodings = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"shift_jis", japanese.ShiftJIS},
+	{"euc-jp", japanese.EUCJP},
+	{"windows-1252", charmap.Windows1252},
+	{"iso-8859-1", charmap.ISO8859_1},
+	{"utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)},
+	{"utf-16be", unicode.UTF16(unicode.BigEndian, unicode.UseBOM)},
+}
+
+func lookup(name string) encoding.Encoding {
+	for _, e := range encodings {
+		if e.name == name {
+			return e.enc
+		}
+	}
+	return nil
+}
+
+// Detect returns the name of the encoding of b: UTF8 if b is valid UTF-8,
+// otherwise the first of the encodings ToUTF8 supports which can decode b
+// without errors. Detect returns the empty string if b looks like binary
+// data.
+func Detect(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	case utf8.Valid(b):
+		return UTF8
+	}
+	if enc := detectUTF16(b); enc != "" {
+		return enc
+	}
+	if bytes.IndexByte(b, 0) != -1 {
+		return ""
+	}
+	for _, e := range encodings[:4] {
+		decoded, err := e.enc.NewDecoder().Bytes(b)
+		if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+			continue
+		}
+		if e.enc == japanese.ShiftJIS || e.enc == japanese.EUCJP {
+			// Text in single-byte encodings can happen to be valid
+			// Shift-JIS or EUC-JP, but then typically decodes to
+			// half-width katakana and few other CJK characters.
+			if !plausibleJapanese(decoded) {
+				continue
+			}
+		}
+		return e.name
+	}
+	return ""
+}
+
+// detectUTF16 recognizes UTF-16 without byte order mark by the NUL bytes of
+// (mostly ASCII) text: every other byte is NUL.
+func detectUTF16(b []byte) string {
+	if len(b) < 2 || len(b)%2 != 0 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(b) / 2
+	switch {
+	case odd > pairs/2 && even == 0:
+		return "utf-16le"
+	case even > pairs/2 && odd == 0:
+		return "utf-16be"
+	}
+	return ""
+}
+
+func plausibleJapanese(decoded []byte) bool {
+	var cjk, halfwidth int
+	for _, r := range string(decoded) {
+		switch {
+		case r >= 0xff61 && r <= 0xff9f:
+			halfwidth++
+		case r >= 0x3000:
+			cjk++
+		}
+	}
+	return cjk > halfwidth
+}
+
+// ToUTF8 converts b from the encoding with the given name (as returned by
+// Detect) to UTF-8.
+func ToUTF8(b []byte, name string) ([]byte, error) {
+	if name == UTF8 {
+		return b, nil
+	}
+	enc := lookup(name)
+	if enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	return enc.NewDecoder().Bytes(b)
+}
+
+// WriteFile writes encodings, mapping file paths to encoding names, to name.
+// The format is that of package contenthash.
+func WriteFile(name string, encodings map[string]string) error {
+	paths := make([]string, 0, len(encodings))
+	for path := range encodings {
+		// A newline would make the file ambiguous, see ReadFile.
+		if strings.Contains(path, "\n") {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, path := range paths {
+		fmt.Fprintf(w, "%s  %s\n", encodings[path], path)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFile reads the encodings from name, as written by WriteFile.
+func ReadFile(name string) (map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+func read(r io.Reader) (map[string]string, error) {
+	encodings := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, "  ")
+		if idx == -1 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		encodings[line[idx+2:]] = line[:idx]
+	}
+	return encodings, scanner.Err()
+}
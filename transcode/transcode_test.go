@@ -0,0 +1,88 @@
+// vim:ts=4:sw=4:noexpandtab
+package transcode
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var detectTests = []struct {
+	name string
+	in   string
+	enc  string
+	utf8 string
+}{
+	{"ascii", "int main() {}\n", UTF8, "int main() {}\n"},
+	{"utf-8", "/* Größe */\n", UTF8, "/* Größe */\n"},
+	{"latin-1", "/* Gr\xf6\xdfe */\n", "windows-1252", "/* Größe */\n"},
+	{"latin-1 accent", "/* caf\xe9 */\n", "windows-1252", "/* café */\n"},
+	{"windows-1252 quotes", "/* \x93quoted\x94 */\n", "windows-1252", "/* “quoted” */\n"},
+	{"iso-8859-1 control", "/* \x81 caf\xe9 */\n", "iso-8859-1", "/* \u0081 café */\n"},
+	{"shift_jis", "/* \x93\xfa\x96\x7b\x8c\xea */\n", "shift_jis", "/* 日本語 */\n"},
+	{"euc-jp", "/* \xc6\xfc\xcb\xdc\xb8\xec */\n", "euc-jp", "/* 日本語 */\n"},
+	{"utf-16le bom", "\xff\xfei\x00n\x00t\x00\n\x00", "utf-16le", "int\n"},
+	{"utf-16be bom", "\xfe\xff\x00i\x00n\x00t\x00\n", "utf-16be", "int\n"},
+	{"utf-16le", "i\x00n\x00t\x00 \x00\xe4\x00\n\x00", "utf-16le", "int ä\n"},
+	{"binary", "\x7fELF\x02\x01\x01\x00\x00\x00\xff", "", ""},
+}
+
+func TestDetect(t *testing.T) {
+	for _, tt := range detectTests {
+		enc := Detect([]byte(tt.in))
+		if enc != tt.enc {
+			t.Errorf("%s: Detect(%q) = %q, want %q", tt.name, tt.in, enc, tt.enc)
+			continue
+		}
+		if enc == "" {
+			continue
+		}
+		got, err := ToUTF8([]byte(tt.in), enc)
+		if err != nil {
+			t.Errorf("%s: ToUTF8(%q, %q): %v", tt.name, tt.in, enc, err)
+			continue
+		}
+		if string(got) != tt.utf8 {
+			t.Errorf("%s: ToUTF8(%q, %q) = %q, want %q", tt.name, tt.in, enc, got, tt.utf8)
+		}
+	}
+}
+
+func TestToUTF8Unsupported(t *testing.T) {
+	if _, err := ToUTF8([]byte("x"), "klingon"); err == nil {
+		t.Fatalf("ToUTF8() with an unsupported encoding unexpectedly succeeded")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want := map[string]string{
+		"xblast_2.10.4-4/src/levels.c":    "windows-1252",
+		"xblast_2.10.4-4/src/with  two.c": "shift_jis",
+	}
+	name := filepath.Join(dir, "xblast_2.10.4-4"+EncodingsSuffix)
+	if err := WriteFile(name, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadFile() = %v, want %v", got, want)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	if _, err := read(strings.NewReader("no separator\n")); err == nil {
+		t.Fatalf("read() unexpectedly succeeded")
+	}
+}